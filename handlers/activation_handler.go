@@ -17,8 +17,12 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
+	"path"
+	"sync"
 
 	"github.com/k-lb/entrypoint-framework/handlers/internal/filesystem"
 	"github.com/k-lb/entrypoint-framework/handlers/internal/global"
@@ -26,13 +30,19 @@ import (
 	"github.com/fsnotify/fsnotify"
 )
 
-// FileActivationHandler implements ActivationHandler interface. It uses provided file as a source for ActivationEvents.
+// FileActivationHandler implements ActivationHandler interface. It uses provided file (or files matching a pattern) as
+// a source for ActivationEvents.
 type FileActivationHandler struct {
 	wasChanged     chan ActivationEvent
 	done           chan bool
 	activationFile string
+	isActive       func() (bool, error) // checks a current activation state, activationFileExists by default.
 	log            *slog.Logger
 	fs             filesystem.Filesystem
+	lastErr        lastError // the most recent error pushed with an ActivationEvent.
+	watcher        filesystem.Watcher
+	mu             sync.Mutex // serializes checks of an activation state.
+	lastState      bool       // a state of the last pushed ActivationEvent.
 
 	isOpen bool
 }
@@ -46,6 +56,31 @@ func (a *FileActivationHandler) GetWasChangedChannel() <-chan ActivationEvent {
 	return nil
 }
 
+// LastError returns the most recent error observed by the handler (a watcher error or a failed check of an activation
+// file) or nil if none occurred. It doesn't depend on draining a was changed channel.
+func (a *FileActivationHandler) LastError() error {
+	return a.lastErr.get()
+}
+
+// WatcherHealth returns a WatcherHealth of a watcher of an activation. It returns false if the watcher doesn't report
+// its health.
+func (a *FileActivationHandler) WatcherHealth() (WatcherHealth, bool) {
+	return watcherHealth(a.watcher)
+}
+
+// CurrentState checks an activation state at once, without waiting for a next ActivationEvent (e.g. for a readiness
+// endpoint). It doesn't push an event. If the state can't be checked, a state of the last pushed ActivationEvent is
+// returned with an error. It is safe to call at any time, also after Close.
+func (a *FileActivationHandler) CurrentState() (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	active, err := a.isActive()
+	if err != nil {
+		return a.lastState, err
+	}
+	return active, nil
+}
+
 // Close triggers closing of the FileActivationHandler.
 func (a *FileActivationHandler) Close() {
 	if a.isOpen {
@@ -55,8 +90,19 @@ func (a *FileActivationHandler) Close() {
 }
 
 // newFileActivationHandler returns a pointer to a FileActivationHandler and an error if any occurred. It initializes a
-// file watcher, handles an initial activation and listen for activation changes in a new goroutine.
-func newFileActivationHandler(activationFile string, log *slog.Logger, fs filesystem.Filesystem) (*FileActivationHandler, error) {
+// file watcher, handles an initial activation unless it is suppressed and listen for activation changes in a new
+// goroutine.
+func newFileActivationHandler(activationFile string, log *slog.Logger, fs filesystem.Filesystem, opts ...ActivationOption) (*FileActivationHandler, error) {
+	fw, err := fs.NewFileWatcher(activationFile, fsnotify.Create|fsnotify.Remove)
+	if err != nil {
+		return nil, fmt.Errorf("could not create a new file watcher for a file: %s. Reason: %w", activationFile, err)
+	}
+	return newFileActivationHandlerWithWatcher(fw, activationFile, log, fs, opts...), nil
+}
+
+// newFileActivationHandlerWithWatcher returns a pointer to a FileActivationHandler which listens for activation changes
+// notified by fw. It handles an initial activation unless it is suppressed.
+func newFileActivationHandlerWithWatcher(fw filesystem.Watcher, activationFile string, log *slog.Logger, fs filesystem.Filesystem, opts ...ActivationOption) *FileActivationHandler {
 	a := &FileActivationHandler{
 		wasChanged:     make(chan ActivationEvent, global.DefaultChanBuffSize),
 		done:           make(chan bool),
@@ -65,24 +111,77 @@ func newFileActivationHandler(activationFile string, log *slog.Logger, fs filesy
 		fs:             fs,
 		isOpen:         true,
 	}
-	fw, err := fs.NewFileWatcher(activationFile, fsnotify.Create|fsnotify.Remove)
+	a.isActive = a.activationFileExists
+	a.start(fw, opts)
+	return a
+}
+
+// newGlobActivationHandler returns a pointer to a FileActivationHandler and an error if any occurred. The activation is
+// active when at least one file in a dir has a name matching a pattern. It initializes a watcher of the dir, handles
+// an initial activation unless it is suppressed and listens for activation changes in a new goroutine.
+func newGlobActivationHandler(dir, pattern string, log *slog.Logger, fs filesystem.Filesystem, opts ...ActivationOption) (*FileActivationHandler, error) {
+	fw, err := fs.NewGlobWatcher(dir, pattern, fsnotify.Create|fsnotify.Remove|fsnotify.Rename)
 	if err != nil {
-		return nil, fmt.Errorf("could not create a new file watcher for a file: %s. Reason: %w", activationFile, err)
+		return nil, fmt.Errorf("could not create a new watcher for files %s in %s. Reason: %w", pattern, dir, err)
 	}
+	a := &FileActivationHandler{
+		wasChanged:     make(chan ActivationEvent, global.DefaultChanBuffSize),
+		done:           make(chan bool),
+		activationFile: path.Join(dir, pattern),
+		log:            log,
+		fs:             fs,
+		isOpen:         true,
+	}
+	a.isActive = func() (bool, error) {
+		names, err := a.fs.ListMatchingNames(dir, pattern)
+		if err != nil {
+			return false, fmt.Errorf("could not list activation files %s. Reason: %w", a.activationFile, err)
+		}
+		return len(names) > 0, nil
+	}
+	a.start(fw, opts)
+	return a, nil
+}
 
-	a.handle(new(filesystem.WatcherEvent))
+// start handles an initial activation unless it is suppressed and listens for activation changes notified by fw in
+// a new goroutine.
+func (a *FileActivationHandler) start(fw filesystem.Watcher, opts []ActivationOption) {
+	a.watcher = fw
+	if !newActivationOptions(opts).suppressInitialEvent {
+		a.handle(&filesystem.WatcherEvent{Initial: true})
+	}
 	go a.listenActivationChanges(fw)
-	return a, nil
 }
 
-// handle pushes an ActivationEvent to wasChanged channel and logs it.
+// handle pushes an ActivationEvent to wasChanged channel and logs it. If an activation state can't be checked, an error
+// is pushed with the event.
 func (a *FileActivationHandler) handle(ev *filesystem.WatcherEvent) {
 	if ev == nil { // ignore invalidated events
 		return
 	}
-	event := ActivationEvent{State: a.fs.DoesExist(a.activationFile), Error: ev.Error}
+	event := ActivationEvent{Error: ev.Error, Initial: ev.Initial, Source: a.activationFile}
+	a.mu.Lock()
+	if active, err := a.isActive(); err == nil {
+		event.State = active
+	} else if event.Error == nil {
+		event.Error = err
+	}
+	a.lastState = event.State
+	a.mu.Unlock()
+	a.lastErr.record(event.Error)
 	a.wasChanged <- event
-	a.log.Debug("an event was sent", slog.Bool("state", event.State), slog.Any(errorKey, event.Error))
+	a.log.Debug("an event was sent", slog.Bool("state", event.State), slog.Bool("initial", event.Initial), slog.Any(errorKey, event.Error))
+}
+
+// activationFileExists returns true if an activation file exists. If its status can't be checked for other reason than
+// its absence, an error is returned.
+func (a *FileActivationHandler) activationFileExists() (bool, error) {
+	if _, err := a.fs.Stat(a.activationFile); err == nil {
+		return true, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return false, fmt.Errorf("could not check if an activation file %s exists. Reason: %w", a.activationFile, err)
+	}
+	return false, nil
 }
 
 // listenActivationChanges listens to a filePresenceChanged channel and handle its events or closure.
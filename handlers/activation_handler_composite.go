@@ -0,0 +1,193 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/k-lb/entrypoint-framework/handlers/internal/global"
+)
+
+// CompositeActivationHandler implements ActivationHandler interface. It combines states of multiple child
+// ActivationHandlers (e.g. of different kinds) into a single activation with a combine function.
+type CompositeActivationHandler struct {
+	wasChanged chan ActivationEvent
+	done       chan struct{}
+	children   []ActivationHandler
+	combine    func([]bool) bool
+	lastErr    lastError // the most recent error pushed with an ActivationEvent.
+
+	states   []bool // the latest states of children, in the same order as children.
+	reported []bool // set for children which have sent at least one event without an error.
+	pending  int    // a number of children which haven't reported yet.
+	sent     bool   // set when the first combined state was sent.
+	state    bool   // the last combined state sent.
+
+	isOpen bool
+}
+
+// AllActive is a combine function of a CompositeActivationHandler which is active when all children are active.
+func AllActive(states []bool) bool {
+	for _, state := range states {
+		if !state {
+			return false
+		}
+	}
+	return true
+}
+
+// AnyActive is a combine function of a CompositeActivationHandler which is active when any child is active.
+func AnyActive(states []bool) bool {
+	for _, state := range states {
+		if state {
+			return true
+		}
+	}
+	return false
+}
+
+// NewCompositeActivationHandler returns a new CompositeActivationHandler and an error if any occurred. Activation is
+// a result of combine called with the latest states of children, in the order in which they are passed. The first
+// event is sent when every child has reported its state and following ones only when the combined state flips. A Source
+// of an event is a Source of the child whose event has driven it. Errors of children are forwarded with the last
+// combined state. When any child closes its was changed channel, the channel
+// of the CompositeActivationHandler is closed too. The children must not be used directly afterwards.
+func NewCompositeActivationHandler(combine func([]bool) bool, children ...ActivationHandler) (*CompositeActivationHandler, error) {
+	if combine == nil {
+		return nil, errors.New("can not create composite activation handler without a combine function")
+	}
+	if len(children) == 0 {
+		return nil, errors.New("can not create composite activation handler without children")
+	}
+	c := &CompositeActivationHandler{
+		wasChanged: make(chan ActivationEvent, global.DefaultChanBuffSize),
+		done:       make(chan struct{}),
+		children:   append([]ActivationHandler{}, children...),
+		combine:    combine,
+		states:     make([]bool, len(children)),
+		reported:   make([]bool, len(children)),
+		pending:    len(children),
+		isOpen:     true,
+	}
+	go c.listenActivationChanges()
+	return c, nil
+}
+
+// GetWasChangedChannel returns a read only channel with an ActivationEvent when the combined activation was changed.
+// When the handler is closed it returns a nil channel.
+func (c *CompositeActivationHandler) GetWasChangedChannel() <-chan ActivationEvent {
+	if c.isOpen {
+		return c.wasChanged
+	}
+	return nil
+}
+
+// LastError returns the most recent error forwarded from any child or nil if none occurred. It doesn't depend on
+// draining a was changed channel.
+func (c *CompositeActivationHandler) LastError() error {
+	return c.lastErr.get()
+}
+
+// Close triggers closing of the CompositeActivationHandler and all its children.
+func (c *CompositeActivationHandler) Close() {
+	if c.isOpen {
+		close(c.done)
+		for _, child := range c.children {
+			child.Close()
+		}
+		c.isOpen = false
+	}
+}
+
+// childActivationEvent is an event of a child with an index. open is false when the child's channel was closed.
+type childActivationEvent struct {
+	index int
+	event ActivationEvent
+	open  bool
+}
+
+// listenActivationChanges listens to was changed channels of all children and handles their events or closure.
+func (c *CompositeActivationHandler) listenActivationChanges() {
+	childChanged := make(chan childActivationEvent)
+	for i, child := range c.children {
+		go func(index int, wasChanged <-chan ActivationEvent) {
+			for {
+				select {
+				case ev, open := <-wasChanged:
+					select {
+					case childChanged <- childActivationEvent{index: index, event: ev, open: open}:
+					case <-c.done:
+						return
+					}
+					if !open {
+						return
+					}
+				case <-c.done:
+					return
+				}
+			}
+		}(i, child.GetWasChangedChannel())
+	}
+	for {
+		select {
+		case ev := <-childChanged:
+			if !ev.open {
+				close(c.wasChanged)
+				return
+			}
+			c.handle(ev.index, ev.event)
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// handle records a state of a child with an index and pushes an ActivationEvent when the combined state was changed.
+// An error of the child is pushed with the last combined state and leaves the state of the child unchanged.
+func (c *CompositeActivationHandler) handle(index int, ev ActivationEvent) {
+	if ev.Error != nil {
+		err := fmt.Errorf("an activation handler %d has reported an error. Reason: %w", index, ev.Error)
+		c.lastErr.record(err)
+		c.wasChanged <- ActivationEvent{State: c.state, Error: err, Source: childSource(index, ev)}
+		return
+	}
+	c.states[index] = ev.State
+	if !c.reported[index] {
+		c.reported[index] = true
+		c.pending--
+	}
+	if c.pending > 0 {
+		return
+	}
+	state := c.combine(append([]bool{}, c.states...))
+	if c.sent && state == c.state {
+		return
+	}
+	event := ActivationEvent{State: state, Initial: !c.sent && ev.Initial, Source: childSource(index, ev)}
+	c.sent, c.state = true, state
+	c.wasChanged <- event
+}
+
+// childSource returns a Source of an event of a child with an index. It is a Source set by the child or the index of
+// the child if the child doesn't set it.
+func childSource(index int, ev ActivationEvent) string {
+	if ev.Source != "" {
+		return ev.Source
+	}
+	return fmt.Sprintf("activation handler %d", index)
+}
@@ -0,0 +1,187 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// fakeActivationHandler implements ActivationHandler. Events are sent to its wasChanged channel by a test.
+type fakeActivationHandler struct {
+	wasChanged chan ActivationEvent
+	closed     atomic.Bool
+}
+
+func newFakeActivationHandler() *fakeActivationHandler {
+	return &fakeActivationHandler{wasChanged: make(chan ActivationEvent, 10)}
+}
+
+func (f *fakeActivationHandler) GetWasChangedChannel() <-chan ActivationEvent { return f.wasChanged }
+func (f *fakeActivationHandler) Close()                                       { f.closed.Store(true) }
+
+func (h *HandlersTestSuite) TestNewCompositeActivationHandler() {
+	h.Run("when there are no children, should return an error", func() {
+		handler, err := NewCompositeActivationHandler(AllActive)
+
+		h.Error(err)
+		h.Nil(handler)
+	})
+
+	h.Run("when there is no combine function, should return an error", func() {
+		handler, err := NewCompositeActivationHandler(nil, newFakeActivationHandler())
+
+		h.Error(err)
+		h.Nil(handler)
+	})
+}
+
+// compositeStep is a state sent by a child with an index and a combined state expected afterwards.
+type compositeStep struct {
+	child    int
+	state    bool
+	combined bool
+	flip     bool // set when an event with the combined state should be sent
+}
+
+func (h *HandlersTestSuite) TestCompositeActivationHandler() {
+	testCases := [...]struct {
+		name    string
+		combine func([]bool) bool
+		steps   []compositeStep
+	}{
+		{name: "when children are combined with AND, should send an event only when all children become active or any becomes inactive",
+			combine: AllActive,
+			steps: []compositeStep{
+				{child: 0, state: true, combined: false},
+				{child: 1, state: true, combined: true, flip: true},
+				{child: 1, state: false, combined: false, flip: true},
+				{child: 0, state: false, combined: false},
+				{child: 0, state: true, combined: false},
+				{child: 1, state: true, combined: true, flip: true},
+			}},
+		{name: "when children are combined with OR, should send an event only when any child becomes active or all become inactive",
+			combine: AnyActive,
+			steps: []compositeStep{
+				{child: 0, state: false, combined: false},
+				{child: 1, state: false, combined: false},
+				{child: 0, state: true, combined: true, flip: true},
+				{child: 1, state: true, combined: true},
+				{child: 0, state: false, combined: true},
+				{child: 1, state: false, combined: false, flip: true},
+			}},
+	}
+	for _, test := range testCases {
+		test := test
+		h.Run(test.name, func() {
+			first, second := newFakeActivationHandler(), newFakeActivationHandler()
+			handler, err := NewCompositeActivationHandler(test.combine, first, second)
+			h.Require().NoError(err)
+			errBarrier := errors.New("barrier")
+
+			first.wasChanged <- ActivationEvent{State: false, Initial: true}
+			second.wasChanged <- ActivationEvent{State: false, Initial: true}
+			ev := <-handler.GetWasChangedChannel()
+			// children are read concurrently, so the last of their initial events may come from any of them
+			h.Contains([]string{"activation handler 0", "activation handler 1"}, ev.Source)
+			h.Equal(ActivationEvent{State: false, Initial: true, Source: ev.Source}, ev, "should send an initial event when all children have reported")
+
+			children := [...]*fakeActivationHandler{first, second}
+			for i, step := range test.steps {
+				children[step.child].wasChanged <- ActivationEvent{State: step.state}
+				// an error is forwarded after the state is handled, so it shows that no other event was sent
+				children[step.child].wasChanged <- ActivationEvent{Error: errBarrier}
+				if step.flip {
+					h.Equal(ActivationEvent{State: step.combined, Source: fmt.Sprintf("activation handler %d", step.child)}, <-handler.GetWasChangedChannel(), "step %d", i)
+				}
+				ev := <-handler.GetWasChangedChannel()
+				h.ErrorIs(ev.Error, errBarrier, "step %d", i)
+				h.Equal(step.combined, ev.State, "step %d", i)
+			}
+
+			wasChanged := handler.GetWasChangedChannel()
+			handler.Close()
+			h.Nil(handler.GetWasChangedChannel())
+			h.True(first.closed.Load(), "should close children")
+			h.True(second.closed.Load(), "should close children")
+			select {
+			case ev := <-wasChanged:
+				h.Failf("unexpected event", "%+v", ev)
+			default:
+			}
+		})
+	}
+
+	h.Run("when a child sends an error, should forward it with the last combined state", func() {
+		first, second := newFakeActivationHandler(), newFakeActivationHandler()
+		handler, err := NewCompositeActivationHandler(AnyActive, first, second)
+		h.Require().NoError(err)
+		errChild := errors.New("child error")
+
+		first.wasChanged <- ActivationEvent{Error: errChild}
+		ev := <-handler.GetWasChangedChannel()
+		h.ErrorIs(ev.Error, errChild, "should forward an error before all children have reported")
+		h.False(ev.State)
+
+		first.wasChanged <- ActivationEvent{State: true}
+		second.wasChanged <- ActivationEvent{State: false}
+		ev = <-handler.GetWasChangedChannel()
+		h.True(ev.State)
+		h.NoError(ev.Error)
+		second.wasChanged <- ActivationEvent{Error: errChild}
+		ev = <-handler.GetWasChangedChannel()
+		h.ErrorIs(ev.Error, errChild)
+		h.True(ev.State, "shouldn't change the combined state on an error")
+		h.ErrorIs(handler.LastError(), errChild)
+
+		handler.Close()
+	})
+
+	h.Run("when children set sources, should name a source of the child whose change has flipped the combined state", func() {
+		first, second := newFakeActivationHandler(), newFakeActivationHandler()
+		handler, err := NewCompositeActivationHandler(AllActive, first, second)
+		h.Require().NoError(err)
+		errChild := errors.New("child error")
+
+		first.wasChanged <- ActivationEvent{State: true, Initial: true, Source: "/tmp/first"}
+		second.wasChanged <- ActivationEvent{State: true, Initial: true, Source: "/tmp/second"}
+		ev := <-handler.GetWasChangedChannel()
+		h.Contains([]string{"/tmp/first", "/tmp/second"}, ev.Source)
+		h.True(ev.Initial)
+		first.wasChanged <- ActivationEvent{State: false, Source: "/tmp/first"}
+		h.Equal(ActivationEvent{State: false, Source: "/tmp/first"}, <-handler.GetWasChangedChannel())
+		second.wasChanged <- ActivationEvent{Error: errChild, Source: "/tmp/second"}
+		ev = <-handler.GetWasChangedChannel()
+		h.ErrorIs(ev.Error, errChild)
+		h.Equal("/tmp/second", ev.Source, "should name a source of an error")
+
+		handler.Close()
+	})
+
+	h.Run("when a child closes its channel, should close a was changed channel", func() {
+		first, second := newFakeActivationHandler(), newFakeActivationHandler()
+		handler, err := NewCompositeActivationHandler(AllActive, first, second)
+		h.Require().NoError(err)
+
+		close(second.wasChanged)
+		_, open := <-handler.GetWasChangedChannel()
+		h.False(open)
+
+		handler.Close()
+	})
+}
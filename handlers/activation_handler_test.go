@@ -18,6 +18,7 @@ package handlers
 
 import (
 	"errors"
+	"io/fs"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -44,7 +45,7 @@ func (h *HandlersTestSuite) TestFileActivationHandler() {
 		h.Require().NotNil(handler)
 
 		h.Equal(global.DefaultChanBuffSize, cap(handler.GetWasChangedChannel()))
-		h.Zero(<-handler.GetWasChangedChannel())
+		h.Equal(ActivationEvent{Initial: true, Source: activationFile}, <-handler.GetWasChangedChannel(), "should mark an initial ActivationEvent")
 		handler.Close()
 		_, open := <-handler.done
 		h.False(open)
@@ -83,18 +84,25 @@ func (h *HandlersTestSuite) TestFileActivationHandler() {
 			handler, err := newFileActivationHandler(activationFile, logDiscard, mock.fs)
 
 			for _, event := range test.events {
-				mock.fs.EXPECT().DoesExist(activationFile).Times(1).Return(event.FileExists)
+				mock.fs.EXPECT().Stat(activationFile).Times(1).Return(statResult(event.FileExists))
 				mock.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Error: event.WatcherError})
 				filePresenceChanged <- struct{}{}
 			}
 
 			h.Require().NoError(err)
-			expectedEvent := ActivationEvent{State: test.initialFileExists}
+			expectedEvent := ActivationEvent{State: test.initialFileExists, Initial: true, Source: activationFile}
 			h.Equal(expectedEvent, <-handler.GetWasChangedChannel(), "should push initial ActivationEvent to a channel")
 			for _, testEvent := range test.events {
-				expectedEvent := ActivationEvent{State: testEvent.FileExists, Error: testEvent.WatcherError}
+				expectedEvent := ActivationEvent{State: testEvent.FileExists, Error: testEvent.WatcherError, Source: activationFile}
 				h.Equal(expectedEvent, <-handler.GetWasChangedChannel(), "should push expected ActivationEvent to a channel")
 			}
+			var expectedLastError error
+			for _, testEvent := range test.events {
+				if testEvent.WatcherError != nil {
+					expectedLastError = testEvent.WatcherError
+				}
+			}
+			h.Equal(expectedLastError, handler.LastError(), "should return the most recent error")
 			close(filePresenceChanged)
 			_, open := <-handler.GetWasChangedChannel()
 			h.False(open, "should close a channel")
@@ -112,4 +120,124 @@ func (h *HandlersTestSuite) TestFileActivationHandler() {
 		_, open := <-handler.GetWasChangedChannel()
 		h.False(open, "should close a channel")
 	})
+
+	h.RunWithMockEnv("when an initial event is suppressed, should push only events of subsequent changes", func(mock *mocksControl) {
+		filePresenceChanged := make(chan struct{}, 1)
+		mock.watcher.EXPECT().GetNotificationChannel().Times(1).Return(filePresenceChanged)
+		mock.fs.EXPECT().NewFileWatcher(activationFile, fsnotify.Create|fsnotify.Remove).Times(1).Return(mock.watcher, nil)
+		handler, err := newFileActivationHandler(activationFile, logDiscard, mock.fs, WithSuppressInitialActivationEvent())
+		h.Require().NoError(err)
+		h.Require().NotNil(handler)
+		h.Empty(handler.GetWasChangedChannel(), "should not push an initial ActivationEvent")
+
+		mock.fs.EXPECT().Stat(activationFile).Times(1).Return(statResult(true))
+		mock.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{})
+		filePresenceChanged <- struct{}{}
+		h.Equal(ActivationEvent{State: true, Source: activationFile}, <-handler.GetWasChangedChannel(), "the first event should correspond to a real change and not be marked as initial")
+		close(filePresenceChanged)
+		_, open := <-handler.GetWasChangedChannel()
+		h.False(open, "should close a channel")
+	})
+
+	h.RunWithMockEnv("when a status of an activation file can't be checked, should push an inactive event with an error", func(mock *mocksControl) {
+		filePresenceChanged := make(chan struct{}, 1)
+		mock.watcher.EXPECT().GetNotificationChannel().Times(1).Return(filePresenceChanged)
+		mock.fs.EXPECT().NewFileWatcher(activationFile, fsnotify.Create|fsnotify.Remove).Times(1).Return(mock.watcher, nil)
+		mock.fs.EXPECT().Stat(activationFile).Times(1).Return(nil, fs.ErrPermission)
+		handler, err := newFileActivationHandler(activationFile, logDiscard, mock.fs)
+		h.Require().NoError(err)
+		h.Require().NotNil(handler)
+
+		event := <-handler.GetWasChangedChannel()
+		h.False(event.State)
+		h.ErrorIs(event.Error, fs.ErrPermission)
+		h.ErrorIs(handler.LastError(), fs.ErrPermission)
+		close(filePresenceChanged)
+		_, open := <-handler.GetWasChangedChannel()
+		h.False(open, "should close a channel")
+	})
+}
+
+func (h *HandlersTestSuite) TestFileActivationHandlerCurrentState() {
+	const activationFile = "path/to/a/file.test"
+	h.RunWithMockEnv("when a state is queried, should check a presence of an activation file without pushing an event", func(mock *mocksControl) {
+		filePresenceChanged := mock.init(activationFile, true)
+		handler, err := newFileActivationHandler(activationFile, logDiscard, mock.fs)
+		h.Require().NoError(err)
+		h.Equal(ActivationEvent{State: true, Initial: true, Source: activationFile}, <-handler.GetWasChangedChannel())
+
+		for _, exists := range []bool{true, false, true} {
+			mock.fs.EXPECT().Stat(activationFile).Times(1).Return(statResult(exists))
+			active, err := handler.CurrentState()
+			h.NoError(err)
+			h.Equal(exists, active, "should match a presence of an activation file")
+		}
+		h.Empty(handler.GetWasChangedChannel(), "shouldn't push an event")
+
+		close(filePresenceChanged)
+		_, open := <-handler.GetWasChangedChannel()
+		h.False(open, "should close a channel")
+	})
+
+	h.RunWithMockEnv("when a state can't be checked, should return a state of the last pushed event and an error", func(mock *mocksControl) {
+		filePresenceChanged := mock.init(activationFile, false)
+		handler, err := newFileActivationHandler(activationFile, logDiscard, mock.fs)
+		h.Require().NoError(err)
+		<-handler.GetWasChangedChannel() // discard initial state
+
+		mock.fs.EXPECT().Stat(activationFile).Times(1).Return(statResult(true))
+		mock.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Create})
+		filePresenceChanged <- struct{}{}
+		h.Equal(ActivationEvent{State: true, Source: activationFile}, <-handler.GetWasChangedChannel())
+
+		mock.fs.EXPECT().Stat(activationFile).Times(1).Return(nil, fs.ErrPermission)
+		active, err := handler.CurrentState()
+		h.ErrorIs(err, fs.ErrPermission)
+		h.True(active, "should match the last pushed event")
+		h.NoError(handler.LastError(), "shouldn't record an error of a query")
+
+		close(filePresenceChanged)
+		_, open := <-handler.GetWasChangedChannel()
+		h.False(open, "should close a channel")
+	})
+}
+
+func (h *HandlersTestSuite) TestFileActivationHandlerGlob() {
+	h.RunWithMockEnv("when NewGlobWatcher returns an error, should return an error", func(mock *mocksControl) {
+		errWatcher := errors.New("watcher error")
+		mock.fs.EXPECT().NewGlobWatcher("dir", "isactive-*", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(nil, errWatcher)
+		handler, err := newGlobActivationHandler("dir", "isactive-*", logDiscard, mock.fs)
+
+		h.ErrorIs(err, errWatcher)
+		h.Nil(handler)
+	})
+
+	h.RunWithMockEnv("when matching files are created and removed, should push an activation state of their presence", func(mock *mocksControl) {
+		filePresenceChanged := make(chan struct{}, 1)
+		mock.fs.EXPECT().NewGlobWatcher("dir", "isactive-*", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mock.watcher, nil)
+		mock.watcher.EXPECT().GetNotificationChannel().Times(1).Return(filePresenceChanged)
+		mock.fs.EXPECT().ListMatchingNames("dir", "isactive-*").Times(1).Return([]string{}, nil)
+		handler, err := newGlobActivationHandler("dir", "isactive-*", logDiscard, mock.fs)
+		h.Require().NoError(err)
+		h.Require().NotNil(handler)
+		h.Equal(ActivationEvent{State: false, Initial: true, Source: "dir/isactive-*"}, <-handler.GetWasChangedChannel())
+
+		for _, names := range [][]string{{"isactive-a"}, {"isactive-a", "isactive-b"}, {"isactive-b"}, {}} {
+			mock.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Create})
+			mock.fs.EXPECT().ListMatchingNames("dir", "isactive-*").Times(1).Return(names, nil)
+			filePresenceChanged <- struct{}{}
+			h.Equal(ActivationEvent{State: len(names) > 0, Source: "dir/isactive-*"}, <-handler.GetWasChangedChannel(), names)
+		}
+
+		mock.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Create})
+		mock.fs.EXPECT().ListMatchingNames("dir", "isactive-*").Times(1).Return(nil, fs.ErrPermission)
+		filePresenceChanged <- struct{}{}
+		event := <-handler.GetWasChangedChannel()
+		h.False(event.State)
+		h.ErrorIs(event.Error, fs.ErrPermission, "should push an error when a dir can't be listed")
+
+		close(filePresenceChanged)
+		_, open := <-handler.GetWasChangedChannel()
+		h.False(open, "should close a channel")
+	})
 }
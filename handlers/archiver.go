@@ -0,0 +1,90 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"github.com/k-lb/entrypoint-framework/handlers/internal/filesystem"
+)
+
+// Archiver extracts and lists files of an archive with a new configuration. It is used by a tarred
+// ConfigurationHandler, so other archive formats can be supported by passing an Archiver to WithArchiver.
+type Archiver interface {
+	// Extract extracts all files from an archive to a toDir directory. Files already present in toDir are replaced.
+	Extract(archive, toDir string) error
+	// List returns a sorted list of names of files from an archive without extracting it.
+	List(archive string) ([]string, error)
+}
+
+// TarArchiver is an Archiver of tarballs, which may be gzip compressed. It is used by default. Passed to a handler it
+// uses a filesystem of the handler, so options like WithStripComponents and WithDurableWrites apply to it.
+type TarArchiver struct {
+	fs filesystem.Filesystem
+}
+
+// Extract extracts all files from a tarball to a toDir directory.
+func (a TarArchiver) Extract(archive, toDir string) error {
+	return orNewFilesystem(a.fs).Extract(archive, toDir)
+}
+
+// List returns a sorted list of names of files from a tarball without extracting it.
+func (a TarArchiver) List(archive string) ([]string, error) {
+	return orNewFilesystem(a.fs).ListTarEntries(archive)
+}
+
+// ZipArchiver is an Archiver of zip archives. Only regular files and directories are supported. Passed to a handler it
+// uses a filesystem of the handler, so options like WithStripComponents and WithDurableWrites apply to it.
+type ZipArchiver struct {
+	fs filesystem.Filesystem
+}
+
+// Extract extracts all files from a zip archive to a toDir directory.
+func (a ZipArchiver) Extract(archive, toDir string) error {
+	return orNewFilesystem(a.fs).ExtractZip(archive, toDir)
+}
+
+// List returns a sorted list of names of files from a zip archive without extracting it.
+func (a ZipArchiver) List(archive string) ([]string, error) {
+	return orNewFilesystem(a.fs).ListZipEntries(archive)
+}
+
+// bindArchiver returns an archiver which uses fs if it is one of built-in archivers without a filesystem. A nil
+// archiver is replaced with a TarArchiver.
+func bindArchiver(archiver Archiver, fs filesystem.Filesystem) Archiver {
+	switch a := archiver.(type) {
+	case nil:
+		return TarArchiver{fs: fs}
+	case TarArchiver:
+		if a.fs == nil {
+			a.fs = fs
+		}
+		return a
+	case ZipArchiver:
+		if a.fs == nil {
+			a.fs = fs
+		}
+		return a
+	}
+	return archiver
+}
+
+// orNewFilesystem returns fs or a new Filesystem with default options if fs is nil.
+func orNewFilesystem(fs filesystem.Filesystem) filesystem.Filesystem {
+	if fs == nil {
+		return filesystem.New(nil)
+	}
+	return fs
+}
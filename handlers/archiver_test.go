@@ -0,0 +1,142 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"os"
+	"path"
+)
+
+// fakeArchiver is an Archiver which returns errors without reading any archive.
+type fakeArchiver struct {
+	err error
+}
+
+func (a fakeArchiver) Extract(string, string) error  { return a.err }
+func (a fakeArchiver) List(string) ([]string, error) { return nil, a.err }
+
+func (h *HandlersTestSuite) TestBindArchiver() {
+	h.RunWithMockEnv("when an archiver is nil, should return a TarArchiver using a handler filesystem", func(mocks *mocksControl) {
+		mocks.fs.EXPECT().Extract("archive", "toDir").Times(1).Return(nil)
+		mocks.fs.EXPECT().ListTarEntries("archive").Times(1).Return([]string{"file"}, nil)
+		archiver := bindArchiver(nil, mocks.fs)
+
+		h.Equal(TarArchiver{fs: mocks.fs}, archiver)
+		h.NoError(archiver.Extract("archive", "toDir"))
+		names, err := archiver.List("archive")
+		h.NoError(err)
+		h.Equal([]string{"file"}, names)
+	})
+
+	h.RunWithMockEnv("when an archiver is a ZipArchiver, should make it use a handler filesystem", func(mocks *mocksControl) {
+		mocks.fs.EXPECT().ExtractZip("archive", "toDir").Times(1).Return(nil)
+		mocks.fs.EXPECT().ListZipEntries("archive").Times(1).Return([]string{"file"}, nil)
+		archiver := bindArchiver(ZipArchiver{}, mocks.fs)
+
+		h.NoError(archiver.Extract("archive", "toDir"))
+		names, err := archiver.List("archive")
+		h.NoError(err)
+		h.Equal([]string{"file"}, names)
+	})
+
+	h.RunWithMockEnv("when an archiver is a custom one, should return it unchanged", func(mocks *mocksControl) {
+		archiver := fakeArchiver{err: errors.New("archiver error")}
+
+		h.Equal(archiver, bindArchiver(archiver, mocks.fs))
+	})
+}
+
+func (h *HandlersTestSuite) TestUpdateTarredConfigWithArchiver() {
+	h.RunWithMockEnv("when an archiver returns an error, should return it in an update result", func(mocks *mocksControl) {
+		errArchiver := errors.New("archiver error")
+		mocks.fs.EXPECT().ClearDir("newConfigDir").Times(1).Return(nil)
+
+		result := updateTarredConfig("newConfigHardlinkPath", "newConfigDir", "oldConfigDir", fakeArchiver{err: errArchiver}, nil, nil, nil, mocks.fs)(context.Background())
+		h.ErrorIs(result.Err, errArchiver)
+	})
+}
+
+func (h *HandlersTestSuite) TestTarredConfigurationHandlerArchivers() {
+	h.Run("when the same files are archived with tar and zip, should report identical update results", func() {
+		testDir := h.T().TempDir()
+		files := map[string]string{"first": "first content", "second": "second content"}
+		changedFiles := map[string]string{"first": "changed content", "third": "third content"}
+		updates := map[string][]UpdateResult{}
+		appliedFiles := map[string][]string{}
+		for name, archiver := range map[string]Archiver{"tar": TarArchiver{}, "zip": ZipArchiver{}} {
+			newConfigFile := path.Join(testDir, "config."+name)
+			newConfigDir, oldConfigDir := path.Join(testDir, name, "new"), path.Join(testDir, name, "old")
+			writeArchive := func(archive string, files map[string]string) {
+				if name == "zip" {
+					h.writeZip(archive, files)
+				} else {
+					h.writeTarball(archive, files)
+				}
+			}
+			writeArchive(newConfigFile, files)
+			handler, err := NewTarredConfigurationHandler(newConfigFile, newConfigDir, oldConfigDir, nil, WithArchiver(archiver))
+			h.Require().NoError(err)
+			h.NoError(<-handler.GetWasChangedChannel())
+			h.Require().NoError(handler.Update())
+			updates[name] = append(updates[name], <-handler.GetUpdateResultChannel())
+
+			writeArchive(newConfigFile+".new", changedFiles)
+			h.Require().NoError(os.Rename(newConfigFile+".new", newConfigFile))
+			h.NoError(<-handler.GetWasChangedChannel())
+			h.Require().NoError(handler.Update())
+			updates[name] = append(updates[name], <-handler.GetUpdateResultChannel())
+			appliedFiles[name], err = handler.AppliedFiles()
+			h.NoError(err)
+			content, err := os.ReadFile(path.Join(oldConfigDir, "first"))
+			h.NoError(err)
+			h.Equal("changed content", string(content), name)
+
+			wasChanged := handler.GetWasChangedChannel()
+			handler.Close()
+			for range wasChanged {
+			}
+		}
+
+		h.Equal([]UpdateResult{
+			{ChangedFiles: map[string]Modification{"first": Created, "second": Created}},
+			{ChangedFiles: map[string]Modification{"first": Modified, "second": Deleted, "third": Created}},
+		}, updates["tar"])
+		h.Equal(updates["tar"], updates["zip"])
+		h.Equal([]string{"first", "third"}, appliedFiles["tar"])
+		h.Equal(appliedFiles["tar"], appliedFiles["zip"])
+	})
+}
+
+// writeZip creates a zip archive with regular files named by keys of files and with their values as content.
+func (h *HandlersTestSuite) writeZip(archive string, files map[string]string) {
+	file, err := os.Create(archive)
+	h.Require().NoError(err)
+	defer file.Close()
+	writer := zip.NewWriter(file)
+	defer writer.Close()
+	for name, content := range files {
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate}
+		header.SetMode(0664)
+		w, err := writer.CreateHeader(header)
+		h.Require().NoError(err)
+		_, err = w.Write([]byte(content))
+		h.Require().NoError(err)
+	}
+}
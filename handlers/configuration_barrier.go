@@ -0,0 +1,205 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/k-lb/entrypoint-framework/handlers/internal/global"
+)
+
+// BarrierResult is a result of an update cycle of a ConfigurationBarrier.
+type BarrierResult[T any] struct {
+	Results []T   // update results of all handlers, in the same order as handlers were passed to a constructor.
+	Err     error // errors pushed by handlers before a cycle has started and errors of triggering updates joined.
+}
+
+// ConfigurationBarrier batches changes of multiple ConfigurationHandlers feeding one process into a single update
+// cycle. When no handler has pushed a was changed event for a quiet period since the last one, updates of all handlers
+// are triggered and a single BarrierResult is pushed to a ready channel after all of them have completed, so
+// the process can be restarted once.
+type ConfigurationBarrier[T any] struct {
+	ready    chan BarrierResult[T]
+	done     chan struct{}
+	children []ConfigurationHandler[T]
+	quiet    time.Duration
+	clock    global.Clock
+
+	changed  bool             // set when a handler has pushed a was changed event after a cycle has started.
+	quietEnd <-chan time.Time // fires when a quiet period has elapsed since the last was changed event.
+	running  int              // a number of updates of a current cycle which haven't completed yet, 0 when no cycle runs.
+	results  []T              // update results of a current cycle.
+	errs     []error          // errors of a current cycle.
+	pending  []error          // errors pushed by children since a current cycle has started.
+
+	isOpen bool
+}
+
+// NewConfigurationBarrier returns a new ConfigurationBarrier and an error if any occurred. Update results of children
+// are read only by the ConfigurationBarrier, so children must not be updated directly afterwards. Changes pushed
+// during an update cycle start another cycle after the current one has completed. When any child closes one of its
+// channels, a ready channel is closed.
+func NewConfigurationBarrier[T any](quiet time.Duration, children ...ConfigurationHandler[T]) (*ConfigurationBarrier[T], error) {
+	return newConfigurationBarrier(quiet, global.NewClock(), children...)
+}
+
+// newConfigurationBarrier returns a pointer to a ConfigurationBarrier which uses clock to measure a quiet period and
+// an error if any occurred. It listens for events of children in a new goroutine.
+func newConfigurationBarrier[T any](quiet time.Duration, clock global.Clock, children ...ConfigurationHandler[T]) (*ConfigurationBarrier[T], error) {
+	if len(children) == 0 {
+		return nil, errors.New("can not create configuration barrier without configuration handlers")
+	}
+	b := &ConfigurationBarrier[T]{
+		ready:    make(chan BarrierResult[T], global.DefaultChanBuffSize),
+		done:     make(chan struct{}),
+		children: append([]ConfigurationHandler[T]{}, children...),
+		quiet:    quiet,
+		clock:    clock,
+		isOpen:   true,
+	}
+	go b.listenToEvents()
+	return b, nil
+}
+
+// GetReadyChannel returns a read only channel with a BarrierResult when an update cycle has completed. When
+// the barrier is closed it returns a nil channel.
+func (b *ConfigurationBarrier[T]) GetReadyChannel() <-chan BarrierResult[T] {
+	if b.isOpen {
+		return b.ready
+	}
+	return nil
+}
+
+// Close triggers closing of the ConfigurationBarrier and all its children.
+func (b *ConfigurationBarrier[T]) Close() {
+	if b.isOpen {
+		close(b.done)
+		for _, child := range b.children {
+			child.Close()
+		}
+		b.isOpen = false
+	}
+}
+
+// childConfigurationEvent is an event of a child with an index. It is a was changed event if updated is false and
+// an update result otherwise. open is false when a channel of the child was closed.
+type childConfigurationEvent[T any] struct {
+	index   int
+	err     error
+	updated bool
+	result  T
+	open    bool
+}
+
+// listenToEvents listens to was changed and update result channels of all children and handles their events or
+// closure.
+func (b *ConfigurationBarrier[T]) listenToEvents() {
+	childChanged := make(chan childConfigurationEvent[T])
+	for i, child := range b.children {
+		go b.forward(i, child, childChanged)
+	}
+	for {
+		select {
+		case ev := <-childChanged:
+			if !ev.open {
+				close(b.ready)
+				return
+			}
+			b.handle(ev)
+		case <-b.quietEnd:
+			b.quietEnd = nil
+			if b.running == 0 {
+				b.startCycle()
+			}
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// forward sends events of a child with an index to childChanged until any channel of the child is closed or
+// the barrier is closed.
+func (b *ConfigurationBarrier[T]) forward(index int, child ConfigurationHandler[T], childChanged chan<- childConfigurationEvent[T]) {
+	wasChanged, updateResult := child.GetWasChangedChannel(), child.GetUpdateResultChannel()
+	for {
+		ev := childConfigurationEvent[T]{index: index}
+		select {
+		case ev.err, ev.open = <-wasChanged:
+		case ev.result, ev.open = <-updateResult:
+			ev.updated = true
+		case <-b.done:
+			return
+		}
+		select {
+		case childChanged <- ev:
+		case <-b.done:
+			return
+		}
+		if !ev.open {
+			return
+		}
+	}
+}
+
+// handle starts a quiet period after a was changed event and records an update result. It pushes a BarrierResult when
+// all updates of a cycle have completed and starts another cycle if changes were pushed in the meantime.
+func (b *ConfigurationBarrier[T]) handle(ev childConfigurationEvent[T]) {
+	if !ev.updated {
+		if ev.err != nil {
+			b.pending = append(b.pending, fmt.Errorf("a configuration handler %d has reported an error. Reason: %w", ev.index, ev.err))
+		}
+		b.changed = true
+		b.quietEnd = b.clock.After(b.quiet)
+		return
+	}
+	if b.running == 0 { // a child was updated outside of a cycle
+		return
+	}
+	b.results[ev.index] = ev.result
+	if b.running--; b.running == 0 {
+		b.finishCycle()
+	}
+}
+
+// startCycle triggers updates of all children. Errors pushed by children since the previous cycle belong to it.
+// Changes pushed from now on belong to a next cycle.
+func (b *ConfigurationBarrier[T]) startCycle() {
+	b.changed = false
+	b.results, b.errs, b.pending = make([]T, len(b.children)), b.pending, nil
+	for i, child := range b.children {
+		if err := child.Update(); err != nil {
+			b.errs = append(b.errs, fmt.Errorf("could not update a configuration handler %d. Reason: %w", i, err))
+			continue
+		}
+		b.running++
+	}
+	if b.running == 0 {
+		b.finishCycle()
+	}
+}
+
+// finishCycle pushes a BarrierResult of a current cycle. It starts a next cycle if changes were pushed during
+// the current one and a quiet period has already elapsed.
+func (b *ConfigurationBarrier[T]) finishCycle() {
+	b.ready <- BarrierResult[T]{Results: b.results, Err: errors.Join(b.errs...)}
+	b.results, b.errs = nil, nil
+	if b.changed && b.quietEnd == nil {
+		b.startCycle()
+	}
+}
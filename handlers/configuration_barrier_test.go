@@ -0,0 +1,150 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"errors"
+	"time"
+)
+
+// fakeConfigurationHandler is a ConfigurationHandler of ints. Update signals on updated and a test pushes a result.
+type fakeConfigurationHandler struct {
+	wasChanged chan error
+	results    chan int
+	updated    chan struct{}
+	updateErr  error
+	closed     bool
+}
+
+func newFakeConfigurationHandler() *fakeConfigurationHandler {
+	return &fakeConfigurationHandler{wasChanged: make(chan error, 10), results: make(chan int, 10), updated: make(chan struct{}, 10)}
+}
+
+func (f *fakeConfigurationHandler) GetWasChangedChannel() <-chan error { return f.wasChanged }
+func (f *fakeConfigurationHandler) GetUpdateResultChannel() <-chan int { return f.results }
+func (f *fakeConfigurationHandler) Close()                             { f.closed = true }
+
+func (f *fakeConfigurationHandler) Update() error {
+	if f.updateErr != nil {
+		return f.updateErr
+	}
+	f.updated <- struct{}{}
+	return nil
+}
+
+func (h *HandlersTestSuite) TestNewConfigurationBarrier() {
+	barrier, err := NewConfigurationBarrier[int](time.Second)
+
+	h.Error(err, "should return an error without handlers")
+	h.Nil(barrier)
+}
+
+func (h *HandlersTestSuite) TestConfigurationBarrier() {
+	const quiet = time.Second
+	// waitForTimers waits until a barrier has asked clock for n timers in total.
+	waitForTimers := func(clock *manualClock, n int) {
+		h.Require().Eventually(func() bool { return clock.pendingTimers() == n }, time.Second, time.Millisecond)
+	}
+
+	h.Run("when two handlers change within a quiet period, should run one combined update cycle", func() {
+		clock := &manualClock{now: time.Now()}
+		first, second := newFakeConfigurationHandler(), newFakeConfigurationHandler()
+		barrier, err := newConfigurationBarrier[int](quiet, clock, first, second)
+		h.Require().NoError(err)
+
+		first.wasChanged <- nil
+		waitForTimers(clock, 1)
+		clock.advance(quiet / 2)
+		second.wasChanged <- nil
+		waitForTimers(clock, 2)
+		clock.advance(quiet / 2)
+		h.Never(func() bool { return len(first.updated) > 0 }, 50*time.Millisecond, time.Millisecond, "shouldn't update before a quiet period since the last change")
+		clock.advance(quiet / 2)
+		<-first.updated
+		<-second.updated
+		second.results <- 2
+		h.Empty(barrier.GetReadyChannel(), "shouldn't signal readiness before all updates have completed")
+		first.results <- 1
+
+		h.Equal(BarrierResult[int]{Results: []int{1, 2}}, <-barrier.GetReadyChannel())
+		h.Empty(first.updated, "should update each handler once")
+		h.Empty(second.updated, "should update each handler once")
+		barrier.Close()
+		h.True(first.closed)
+		h.True(second.closed)
+		h.Nil(barrier.GetReadyChannel())
+	})
+
+	h.Run("when a handler changes during an update cycle, should run another cycle with its error after the current one", func() {
+		clock := &manualClock{now: time.Now()}
+		first, second := newFakeConfigurationHandler(), newFakeConfigurationHandler()
+		barrier, err := newConfigurationBarrier[int](quiet, clock, first, second)
+		h.Require().NoError(err)
+
+		first.wasChanged <- nil
+		waitForTimers(clock, 1)
+		clock.advance(quiet)
+		<-first.updated
+		<-second.updated
+		errChange := errors.New("change error")
+		second.wasChanged <- errChange
+		waitForTimers(clock, 1)
+		clock.advance(quiet)
+		first.results <- 1
+		second.results <- 2
+		h.Equal(BarrierResult[int]{Results: []int{1, 2}}, <-barrier.GetReadyChannel())
+
+		<-first.updated
+		<-second.updated
+		first.results <- 3
+		second.results <- 4
+		result := <-barrier.GetReadyChannel()
+		h.Equal([]int{3, 4}, result.Results)
+		h.ErrorIs(result.Err, errChange, "should report an error pushed before the cycle has started")
+		barrier.Close()
+	})
+
+	h.Run("when a handler can't be updated, should report an error with results of other handlers", func() {
+		clock := &manualClock{now: time.Now()}
+		first, second := newFakeConfigurationHandler(), newFakeConfigurationHandler()
+		first.updateErr = ErrHandlerClosed
+		barrier, err := newConfigurationBarrier[int](quiet, clock, first, second)
+		h.Require().NoError(err)
+
+		second.wasChanged <- nil
+		waitForTimers(clock, 1)
+		clock.advance(quiet)
+		<-second.updated
+		second.results <- 2
+
+		result := <-barrier.GetReadyChannel()
+		h.Equal([]int{0, 2}, result.Results)
+		h.ErrorIs(result.Err, ErrHandlerClosed)
+		barrier.Close()
+	})
+
+	h.Run("when a handler closes its channel, should close a ready channel", func() {
+		first, second := newFakeConfigurationHandler(), newFakeConfigurationHandler()
+		barrier, err := newConfigurationBarrier[int](quiet, &manualClock{}, first, second)
+		h.Require().NoError(err)
+
+		close(second.wasChanged)
+		_, open := <-barrier.GetReadyChannel()
+		h.False(open)
+		barrier.Close()
+	})
+}
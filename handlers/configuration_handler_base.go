@@ -17,9 +17,14 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	iofs "io/fs"
 	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/k-lb/entrypoint-framework/handlers/internal/filesystem"
 	"github.com/k-lb/entrypoint-framework/handlers/internal/global"
@@ -32,137 +37,818 @@ import (
 // without any risk of reading/writing the same file.
 type ConfigurationHandlerBase[T any] struct {
 	wasChanged   chan error
-	updateStart  chan struct{}
-	updateFunc   func() T
+	updateStart  chan updateRequest
+	updateFunc   func(context.Context) T
 	updateResult chan T
-	isOpen       bool
+	tamper       chan error
+	heartbeat    chan time.Time
+	diskPressure chan DiskPressureEvent
+	shutdownErr  chan error
+	isOpen       atomic.Bool // read by WaitForChange, which may run concurrently with Close.
+
+	sendLock sync.RWMutex  // held by senders to updateStart, so Close doesn't close it during a send.
+	closing  chan struct{} // closed by Close before updateStart, so senders waiting for a full updateStart return.
+
+	matched atomic.Bool // true if a content of the last hardlinked configuration matches a content pattern.
+
+	isChanged atomic.Bool  // set when a configuration was changed successfully after the last update was requested.
+	inFlight  atomic.Int32 // a number of requested updates whose results haven't been pushed yet.
+	lastErr   lastError    // the most recent error pushed to wasChanged or tamper channel.
+
+	subscribers subscribers // receive copies of events pushed to wasChanged channel.
+
+	appliedSnapshot dirSnapshot // a snapshot of a directory watched for tampering taken after the last update.
 
 	newConfigPath         string //a path to a new configuration.
 	newConfigHardlinkPath string //a path to a hardlink of a new configuration.
 
-	log *slog.Logger
-	fs  filesystem.Filesystem
+	watcher filesystem.Watcher // a watcher of a new configuration, kept to report its health.
+
+	log  *slog.Logger
+	fs   filesystem.Filesystem
+	opts configurationOptions
 }
 
 // GetWasChangedChannel returns a read only channel with an error that occurred during configuration changing. The error
 // is nil when the configuration was changed successfully. When the handler is closed it returns a nil channel.
 func (c *ConfigurationHandlerBase[_]) GetWasChangedChannel() <-chan error {
-	if c.isOpen {
+	if c.isOpen.Load() {
 		return c.wasChanged
 	}
 	return nil
 }
 
-// Update triggers the configuration update. When the handler is closed it only logs an error.
-func (c *ConfigurationHandlerBase[_]) Update() {
-	if c.isOpen {
-		c.updateStart <- struct{}{}
-	} else {
-		c.log.Error("can't update the configuration after handler was closed")
+// WaitForChange blocks until the next 'was changed' event and returns its error (nil when the configuration was changed
+// successfully). It returns ctx.Err() when ctx is done first and an ErrHandlerClosed when the handler is or gets closed.
+// It consumes events from the same channel as GetWasChangedChannel, so an event is received either by WaitForChange
+// or by a reader of the channel. They shouldn't be used at the same time.
+func (c *ConfigurationHandlerBase[_]) WaitForChange(ctx context.Context) error {
+	wasChanged := c.GetWasChangedChannel()
+	if wasChanged == nil {
+		return fmt.Errorf("can't wait for a change. Reason: %w", ErrHandlerClosed)
+	}
+	select {
+	case err, open := <-wasChanged:
+		if !open {
+			return fmt.Errorf("can't wait for a change. Reason: %w", ErrHandlerClosed)
+		}
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Subscribe returns a new read only channel which receives every 'was changed' event, independently of
+// GetWasChangedChannel and other subscribers, and a function which unsubscribes and closes the channel. When
+// the channel is full, its oldest event is dropped, so a slow subscriber doesn't block the handler. The channel is
+// closed when the handler is closed. If the handler is already closed, a closed channel is returned.
+func (c *ConfigurationHandlerBase[_]) Subscribe() (<-chan error, func()) {
+	return c.subscribers.add()
+}
+
+// updateRequest is sent to start an update. If force is set, a hardlink is recreated before updating.
+type updateRequest struct {
+	force bool
+}
+
+// Update triggers the configuration update. When the handler is closed it returns an ErrHandlerClosed.
+func (c *ConfigurationHandlerBase[_]) Update() error {
+	return c.requestUpdate(updateRequest{})
+}
+
+// ForceUpdate triggers the configuration update of a current new configuration even if no change was observed (e.g.
+// when an applied configuration was wiped and must be repopulated). It recreates the hardlink of a new configuration
+// before updating. As no change event is awaited, a file which is still being written may be applied. If creating the
+// hardlink fails, the last hardlinked configuration is used. When the handler is closed it returns an ErrHandlerClosed.
+func (c *ConfigurationHandlerBase[_]) ForceUpdate() error {
+	return c.requestUpdate(updateRequest{force: true})
+}
+
+// UpdateRejectReason tells why TryUpdate hasn't started an update.
+type UpdateRejectReason int
+
+const (
+	RejectNone            UpdateRejectReason = iota // an update was started
+	RejectClosed                                    // the handler is closed
+	RejectNoChange                                  // no change (matching a content pattern) was observed since the last update
+	RejectAlreadyRunning                            // a requested update hasn't pushed its result yet
+	RejectResultPending                             // a result of the last update wasn't read yet
+	RejectTooManyInFlight                           // a limit set by WithMaxInFlight is reached
+)
+
+// ToString returns string representation of an UpdateRejectReason.
+func (r UpdateRejectReason) ToString() string {
+	switch r {
+	case RejectNone:
+		return "none"
+	case RejectClosed:
+		return "closed"
+	case RejectNoChange:
+		return "no change"
+	case RejectAlreadyRunning:
+		return "already running"
+	case RejectResultPending:
+		return "result pending"
+	case RejectTooManyInFlight:
+		return "too many in flight"
+	}
+	return "invalid"
+}
+
+// TryUpdate triggers the configuration update only if a new configuration was changed since the last update was
+// requested and no other update is running or waiting for its result to be read. It never blocks. It returns true if
+// the update was started or false and a reason of the rejection otherwise. Unlike Update, it doesn't queue updates.
+// It is safe to call it from many goroutines, as a change starts at most one update, and concurrently with Close.
+func (c *ConfigurationHandlerBase[_]) TryUpdate() (started bool, reason UpdateRejectReason) {
+	switch {
+	case !c.isOpen.Load():
+		return false, RejectClosed
+	case c.opts.maxInFlight > 0 && int(c.inFlight.Load()) >= c.opts.maxInFlight:
+		return false, RejectTooManyInFlight
+	case c.inFlight.Load() > 0:
+		return false, RejectAlreadyRunning
+	case len(c.updateResult) > 0:
+		return false, RejectResultPending
+	case !c.isChanged.Load() || (c.opts.contentPattern != nil && !c.matched.Load()):
+		return false, RejectNoChange
+	case !c.inFlight.CompareAndSwap(0, 1): // claims a free slot at once, so concurrent calls can't both pass
+		return false, RejectAlreadyRunning
+	case !c.isChanged.CompareAndSwap(true, false): // a change checked earlier may already be consumed by another call
+		c.inFlight.Add(-1)
+		return false, RejectNoChange
+	case !c.sendUpdateRequest(updateRequest{}): // the handler was closed after it was checked
+		c.inFlight.Add(-1)
+		return false, RejectClosed
 	}
+	return true, RejectNone
+}
+
+// requestUpdate sends an update request to be handled in a listening goroutine. When the handler is closed it returns
+// an ErrHandlerClosed.
+func (c *ConfigurationHandlerBase[_]) requestUpdate(req updateRequest) error {
+	if !c.isOpen.Load() {
+		return fmt.Errorf("can't update the configuration. Reason: %w", ErrHandlerClosed)
+	} else if c.opts.contentPattern != nil && !c.matched.Load() {
+		return fmt.Errorf("can't update the configuration. Reason: %w", ErrConfigNoMatch)
+	}
+	if !c.reserveInFlight() {
+		return fmt.Errorf("can't update the configuration. Reason: %w", ErrTooManyInFlight)
+	}
+	if c.opts.dropStaleResults {
+		c.dropStaleResults()
+	}
+	c.isChanged.Store(false)
+	if !c.sendUpdateRequest(req) {
+		c.inFlight.Add(-1)
+		return fmt.Errorf("can't update the configuration. Reason: %w", ErrHandlerClosed)
+	}
+	return nil
+}
+
+// sendUpdateRequest sends req to a listening goroutine. It returns false if the handler is closed, also when it is
+// closed while req waits for a full update channel.
+func (c *ConfigurationHandlerBase[_]) sendUpdateRequest(req updateRequest) bool {
+	c.sendLock.RLock()
+	defer c.sendLock.RUnlock()
+	if !c.isOpen.Load() {
+		return false
+	}
+	select {
+	case c.updateStart <- req:
+		return true
+	case <-c.closing:
+		return false
+	}
+}
+
+// ErrTooManyInFlight is returned when an update is requested while a limit set by WithMaxInFlight is reached.
+var ErrTooManyInFlight = errors.New("too many updates in flight")
+
+// reserveInFlight increments a number of updates in flight and returns true, unless a limit set by WithMaxInFlight is
+// reached. A check and an increment are done at once, so concurrent calls can't exceed the limit.
+func (c *ConfigurationHandlerBase[_]) reserveInFlight() bool {
+	for {
+		n := c.inFlight.Load()
+		if c.opts.maxInFlight > 0 && int(n) >= c.opts.maxInFlight {
+			return false
+		}
+		if c.inFlight.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// InFlightUpdates returns a number of requested updates which haven't pushed their results yet (a running update and
+// queued ones). It can be used to throttle producers of updates.
+func (c *ConfigurationHandlerBase[_]) InFlightUpdates() int {
+	return int(c.inFlight.Load())
+}
+
+// dropStaleResults discards all results which are waiting in an update result channel.
+func (c *ConfigurationHandlerBase[_]) dropStaleResults() {
+	for {
+		select {
+		case <-c.updateResult:
+			c.log.Debug("A stale update result was dropped")
+		default:
+			return
+		}
+	}
+}
+
+// LastError returns the most recent error observed by the handler (a watcher error, a failed hardlink, a deletion of
+// a configuration or tampering) or nil if none occurred. It doesn't depend on draining handler channels. Update results
+// are not inspected, as their type is defined by an update function.
+func (c *ConfigurationHandlerBase[_]) LastError() error {
+	return c.lastErr.get()
+}
+
+// WatcherHealth returns a WatcherHealth of a watcher of a new configuration. It returns false if the watcher doesn't
+// report its health (e.g. a watcher passed to NewConfigurationHandlerWithWatcher without a Health method).
+func (c *ConfigurationHandlerBase[_]) WatcherHealth() (WatcherHealth, bool) {
+	return watcherHealth(c.watcher)
 }
 
 // GetUpdateResultChannel returns a read only channel with a T event when the configuration was updated. When the
 // handler is closed it returns a nil channel.
 func (c *ConfigurationHandlerBase[T]) GetUpdateResultChannel() <-chan T {
-	if c.isOpen {
+	if c.isOpen.Load() {
 		return c.updateResult
 	}
 	return nil
 }
 
-// Close triggers closing of the ConfigurationHandlerBase.
+// GetTamperChannel returns a read only channel with an error when files from a directory passed to WithTamperDetection
+// were changed without an update. When the handler is closed or tamper detection is disabled it returns a nil channel.
+func (c *ConfigurationHandlerBase[_]) GetTamperChannel() <-chan error {
+	if c.isOpen.Load() {
+		return c.tamper
+	}
+	return nil
+}
+
+// DiskPressureEvent is sent when a usage of a filesystem checked with WithDiskPressureWarning crosses a threshold.
+type DiskPressureEvent struct {
+	Path      string    // a path of the checked filesystem.
+	Usage     float64   // a fraction of the filesystem which isn't available.
+	Threshold float64   // a threshold which was crossed.
+	Time      time.Time // a time of the check.
+}
+
+// GetDiskPressureChannel returns a read only channel with a DiskPressureEvent sent when a usage of a filesystem checked
+// with WithDiskPressureWarning crosses a threshold. When the handler is closed or the check is disabled it returns
+// a nil channel.
+func (c *ConfigurationHandlerBase[_]) GetDiskPressureChannel() <-chan DiskPressureEvent {
+	if c.isOpen.Load() {
+		return c.diskPressure
+	}
+	return nil
+}
+
+// GetHeartbeatChannel returns a read only channel with a time of a heartbeat sent every interval passed to WithHeartbeat
+// by a goroutine handling events, so a watchdog can detect that it has stalled. A heartbeat is dropped if the previous
+// one wasn't read. When the handler is closed or heartbeats are disabled it returns a nil channel.
+func (c *ConfigurationHandlerBase[_]) GetHeartbeatChannel() <-chan time.Time {
+	if c.isOpen.Load() {
+		return c.heartbeat
+	}
+	return nil
+}
+
+var ErrNoAppliedDir = errors.New("handler doesn't apply a configuration to a directory")
+
+// AppliedFiles returns a sorted list of names of files (relative to a directory) which are currently in a directory
+// with an applied configuration. It returns an ErrNoAppliedDir if the handler doesn't apply a configuration to
+// a directory (e.g. a single file handler).
+func (c *ConfigurationHandlerBase[_]) AppliedFiles() ([]string, error) {
+	if c.opts.appliedDir == "" {
+		return nil, fmt.Errorf("can't list applied files. Reason: %w", ErrNoAppliedDir)
+	}
+	return listAppliedFiles(c.opts.appliedDir, c.fs)
+}
+
+// NewConfigPath returns a path to a watched new configuration.
+func (c *ConfigurationHandlerBase[_]) NewConfigPath() string {
+	return c.newConfigPath
+}
+
+// HardlinkPath returns a path to a hardlink of a new configuration.
+func (c *ConfigurationHandlerBase[_]) HardlinkPath() string {
+	return c.newConfigHardlinkPath
+}
+
+// NewConfigDir returns a directory to which a new configuration is extracted. It returns an empty string if the handler
+// doesn't apply a configuration to a directory.
+func (c *ConfigurationHandlerBase[_]) NewConfigDir() string {
+	return c.opts.newConfigDir
+}
+
+// OldConfigDir returns a directory with an applied configuration. It returns an empty string if the handler doesn't
+// apply a configuration to a directory.
+func (c *ConfigurationHandlerBase[_]) OldConfigDir() string {
+	return c.opts.appliedDir
+}
+
+// GetShutdownErrorChannel returns a read only channel with an error of a shutdown (e.g. a failed deletion of the hardlink)
+// or nil if the shutdown succeeded. A single value is sent after the handler is closed and the channel is closed
+// afterwards. Unlike other channels, it is returned after the handler is closed, so the error can be read reliably.
+func (c *ConfigurationHandlerBase[_]) GetShutdownErrorChannel() <-chan error {
+	return c.shutdownErr
+}
+
+// Close triggers closing of the ConfigurationHandlerBase. Watchers are stopped and events which they notify afterwards
+// are dropped. Heartbeat, disk pressure and update result channels are closed first, then a tamper channel and
+// a wasChanged channel, after the hardlink is deleted, are closed when watchers have closed their notification
+// channels. Channels returned by Subscribe are closed together with the wasChanged channel. An error of the deletion
+// is sent to a shutdown error channel, not to a wasChanged channel. Close never blocks.
 func (c *ConfigurationHandlerBase[_]) Close() {
-	if c.isOpen {
+	if c.isOpen.CompareAndSwap(true, false) {
+		close(c.closing) // unblocks senders, so the lock is taken at once
+		c.sendLock.Lock()
 		close(c.updateStart)
-		c.isOpen = false
+		c.sendLock.Unlock()
 	}
 }
 
 // newConfigurationHandlerBase returns a pointer to a ConfigurationHandlerBase and an error if any occurred. It
-// initializes a file watcher, handles an initial configuration if present and listen for configuration changes in a new
-// goroutine.
+// initializes a file watcher of a newConfigPath and passes it to newConfigurationHandlerBaseWithWatcher.
 func newConfigurationHandlerBase[T any](
 	newConfigPath,
 	newConfigHardlinkPath string,
 	updateFunc func() T,
 	log *slog.Logger,
-	fs filesystem.Filesystem) (*ConfigurationHandlerBase[T], error) {
+	fs filesystem.Filesystem,
+	opts ...ConfigurationOption) (*ConfigurationHandlerBase[T], error) {
+	return newCancellableConfigurationHandlerBase(newConfigPath, newConfigHardlinkPath, ignoreContext(updateFunc), log, fs, opts...)
+}
+
+// newCancellableConfigurationHandlerBase returns a pointer to a ConfigurationHandlerBase and an error if any occurred.
+// It works as newConfigurationHandlerBase, but updateFunc gets a context which is cancelled when a newer configuration
+// is notified during an update if stale updates are cancelled.
+func newCancellableConfigurationHandlerBase[T any](
+	newConfigPath,
+	newConfigHardlinkPath string,
+	updateFunc func(context.Context) T,
+	log *slog.Logger,
+	fs filesystem.Filesystem,
+	opts ...ConfigurationOption) (*ConfigurationHandlerBase[T], error) {
+	ops := configWatchedOps
+	if newConfigurationOptions(opts).emptyMeansDeleted {
+		ops |= fsnotify.Write // truncation of a file in place is notified only as a write
+	}
+	fw, err := fs.NewFileWatcher(newConfigPath, ops)
+	if err != nil {
+		return nil, fmt.Errorf("could not create a new file watcher for a file: %s. Reason: %w", newConfigPath, err)
+	}
+	return newConfigurationHandlerBaseWithWatcher(fw, newConfigPath, newConfigHardlinkPath, updateFunc, log, fs, opts...)
+}
+
+// ignoreContext returns updateFunc as a function which ignores a context. It returns nil if updateFunc is nil.
+func ignoreContext[T any](updateFunc func() T) func(context.Context) T {
+	if updateFunc == nil {
+		return nil
+	}
+	return func(context.Context) T { return updateFunc() }
+}
+
+// newConfigurationHandlerBaseWithWatcher returns a pointer to a ConfigurationHandlerBase and an error if any occurred.
+// It handles an initial configuration if present and listens for configuration changes notified by fw in a new
+// goroutine. fw is stopped if an error is returned.
+func newConfigurationHandlerBaseWithWatcher[T any](
+	fw filesystem.Watcher,
+	newConfigPath,
+	newConfigHardlinkPath string,
+	updateFunc func(context.Context) T,
+	log *slog.Logger,
+	fs filesystem.Filesystem,
+	opts ...ConfigurationOption) (*ConfigurationHandlerBase[T], error) {
 	c := &ConfigurationHandlerBase[T]{
 		wasChanged:   make(chan error, global.DefaultChanBuffSize),
-		updateStart:  make(chan struct{}, global.DefaultChanBuffSize),
+		updateStart:  make(chan updateRequest, global.DefaultChanBuffSize),
 		updateResult: make(chan T, global.DefaultChanBuffSize),
-		isOpen:       true,
+		shutdownErr:  make(chan error, 1),
+		closing:      make(chan struct{}),
 
 		newConfigPath:         newConfigPath,
 		newConfigHardlinkPath: newConfigHardlinkPath,
 		updateFunc:            updateFunc,
 
-		log: log,
-		fs:  fs,
+		watcher: fw,
+
+		log:  log,
+		fs:   fs,
+		opts: newConfigurationOptions(opts),
 	}
-	fw, err := fs.NewFileWatcher(newConfigPath, fsnotify.Create|fsnotify.Remove)
-	if err != nil {
-		return nil, fmt.Errorf("could not create a new file watcher for a file: %s. Reason: %w", newConfigPath, err)
+	c.isOpen.Store(true)
+	if c.opts.heartbeatInterval > 0 {
+		c.heartbeat = make(chan time.Time, 1)
+	}
+	if c.opts.diskPressurePath != "" && c.opts.diskPressureInterval > 0 {
+		c.diskPressure = make(chan DiskPressureEvent, global.DefaultChanBuffSize)
+	}
+	var tw filesystem.Watcher
+	if c.opts.tamperDir != "" {
+		var err error
+		if tw, err = fs.NewDirWatcher(c.opts.tamperDir); err != nil {
+			fw.Stop()
+			return nil, fmt.Errorf("could not create a new directory watcher for a dir: %s. Reason: %w", c.opts.tamperDir, err)
+		}
+		c.tamper = make(chan error, global.DefaultChanBuffSize)
+		c.refreshAppliedSnapshot()
 	}
 
-	if fs.DoesExist(newConfigPath) {
-		c.handle(new(filesystem.WatcherEvent))
+	if err := c.handleInitialWithContext(); err != nil {
+		fw.Stop()
+		if tw != nil {
+			tw.Stop()
+		}
+		return nil, err
 	}
-	go c.listenToEvents(fw)
+	go c.listenToEvents(fw, tw)
 	return c, nil
 }
 
+// handleInitialWithContext handles an initial configuration. If a context was set by a context-aware constructor, it
+// returns an error when the context is done before the configuration is handled (e.g. on a hanging mount). The handling
+// isn't interrupted then, so a hardlink may still be created after the error is returned.
+func (c *ConfigurationHandlerBase[_]) handleInitialWithContext() error {
+	ctx := c.opts.initialContext
+	if ctx == nil {
+		c.handleInitial()
+		return nil
+	}
+	handled := make(chan struct{})
+	go func() {
+		defer close(handled)
+		c.handleInitial()
+	}()
+	select {
+	case <-handled:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("could not handle an initial configuration %s. Reason: %w", c.newConfigPath, ctx.Err())
+	}
+}
+
+// handleInitial hardlinks a new configuration if it exists and pushes an initial event unless it is suppressed.
+func (c *ConfigurationHandlerBase[_]) handleInitial() {
+	_, statErr := c.fs.Stat(c.newConfigPath)
+	switch {
+	case errors.Is(statErr, iofs.ErrNotExist):
+	case statErr != nil:
+		err := fmt.Errorf("could not check if a file %s exists. Reason: %w", c.newConfigPath, statErr)
+		c.lastErr.record(err)
+		c.wasChanged <- err
+		c.subscribers.notify(err)
+	case c.opts.suppressInitialEvent:
+		if err := c.process(&filesystem.WatcherEvent{Initial: true}); err != nil {
+			c.lastErr.record(err)
+			c.log.Warn("could not handle an initial configuration", slog.Any(errorKey, err))
+		}
+	default:
+		c.handle(&filesystem.WatcherEvent{Initial: true})
+	}
+}
+
 var ErrConfigDeleted = errors.New("configuration was deleted")
 
+var ErrConfigNoMatch = errors.New("configuration doesn't match a pattern")
+
+// ErrConfigIsDirectory is returned when a watched configuration path is a directory (e.g. after a bad mount). Such
+// a configuration can't be hardlinked, so it isn't retried until another event is notified.
+var ErrConfigIsDirectory = errors.New("configuration is a directory")
+
+// ErrConfigNotStable is returned when a new configuration is still being written after all checks of a stability check
+// set by WithStabilityCheck. It isn't hardlinked until another event is notified.
+var ErrConfigNotStable = errors.New("configuration is still being written")
+
 // handle pushes a handling error to wasChanged channel and logs it.
 func (c *ConfigurationHandlerBase[_]) handle(ev *filesystem.WatcherEvent) {
 	if ev == nil { // ignore invalidated events
 		return
 	}
+	err := c.process(ev)
+	c.lastErr.record(err)
+	if err == nil {
+		c.isChanged.Store(true)
+	}
+	c.wasChanged <- err
+	c.subscribers.notify(err)
+	c.log.Debug("A wasChanged event was sent", slog.Bool("initial", ev.Initial), slog.Any(errorKey, err))
+}
+
+// process hardlinks a new configuration after an event and returns an error if the event carried one, the
+// configuration was deleted or it couldn't be hardlinked.
+func (c *ConfigurationHandlerBase[_]) process(ev *filesystem.WatcherEvent) error {
 	err := ev.Error
 	if err != nil {
 		err = fmt.Errorf("error from watcher(%s). Reason: %w", c.newConfigPath, err)
-	} else if ev.Operation.Has(fsnotify.Remove) {
+	} else if isDeleted(ev, c.newConfigPath, c.fs) {
 		err = ErrConfigDeleted
-	} else if err = c.fs.Hardlink(c.newConfigPath, c.newConfigHardlinkPath); err != nil {
+	} else if err = c.waitUntilStable(); err != nil {
+		err = fmt.Errorf("could not check if a file %s was fully written. Reason: %w", c.newConfigPath, err)
+	} else if err = c.checkNotEmpty(); err != nil {
+		c.log.Debug("a new configuration wasn't hardlinked", slog.Any(errorKey, err))
+	} else if err = c.fs.Hardlink(c.newConfigPath, c.newConfigHardlinkPath); err != nil && isDirectory(c.newConfigPath, c.fs) {
+		err = fmt.Errorf("a file %s is a directory. Reason: %w", c.newConfigPath, ErrConfigIsDirectory)
+	} else if err != nil {
 		err = fmt.Errorf("could not create a hardlink of a file %s to %s. Reason: %w", c.newConfigPath, c.newConfigHardlinkPath, err)
+	} else {
+		err = c.matchContent()
 	}
-	c.wasChanged <- err
-	c.log.Debug("A wasChanged event was sent", slog.Any(errorKey, err))
+	if c.opts.contentPattern != nil {
+		c.matched.Store(err == nil)
+	}
+	return err
+}
+
+// configWatchedOps are operations on a new configuration which are watched by configuration handlers. A rename is
+// watched, as on some platforms moving a file over the configuration is notified as a rename instead of a create.
+const configWatchedOps = fsnotify.Create | fsnotify.Remove | fsnotify.Rename
+
+// isDeleted returns true if an event tells that a file was deleted. A renamed file is deleted only if it doesn't exist
+// afterwards, otherwise another file was moved over it, which is a change.
+func isDeleted(ev *filesystem.WatcherEvent, file string, fs filesystem.Filesystem) bool {
+	return ev.Operation.Has(fsnotify.Remove) || (ev.Operation.Has(fsnotify.Rename) && !fs.DoesExist(file))
+}
+
+// isDirectory returns true if a file exists and is a directory. It is used to explain a failure of a hardlink, so
+// a regular configuration isn't checked.
+func isDirectory(file string, fs filesystem.Filesystem) bool {
+	info, err := fs.Stat(file)
+	return err == nil && info.IsDir()
+}
+
+// checkNotEmpty returns an ErrConfigDeleted if an empty configuration means deleted and a new configuration is empty.
+func (c *ConfigurationHandlerBase[_]) checkNotEmpty() error {
+	if !c.opts.emptyMeansDeleted {
+		return nil
+	}
+	info, err := c.fs.Stat(c.newConfigPath)
+	if err != nil {
+		return fmt.Errorf("could not check a size of a file %s. Reason: %w", c.newConfigPath, err)
+	} else if info.Size() == 0 {
+		return fmt.Errorf("a file %s is empty. Reason: %w", c.newConfigPath, ErrConfigDeleted)
+	}
+	return nil
+}
+
+// matchContent returns an ErrConfigNoMatch if a content of a hardlinked configuration doesn't match a content
+// pattern. It returns nil when the pattern is not set.
+func (c *ConfigurationHandlerBase[_]) matchContent() error {
+	if c.opts.contentPattern == nil {
+		return nil
+	}
+	content, err := c.fs.ReadFile(c.newConfigHardlinkPath)
+	if err != nil {
+		return fmt.Errorf("could not read a file %s. Reason: %w", c.newConfigHardlinkPath, err)
+	} else if !c.opts.contentPattern.Match(content) {
+		return fmt.Errorf("a content of a file %s doesn't match %s. Reason: %w", c.newConfigPath, c.opts.contentPattern, ErrConfigNoMatch)
+	}
+	return nil
+}
+
+// maxStabilityChecks limits how many times waitUntilStable checks a new configuration, so a file which is rewritten
+// continuously doesn't stall handling of other events and Close.
+const maxStabilityChecks = 100
+
+// waitUntilStable blocks until a size and a modification time of a new configuration haven't changed for
+// a stability interval. It returns immediately when the stability check is disabled. It returns an ErrConfigNotStable
+// if the configuration has changed in each of maxStabilityChecks checks and an ErrHandlerClosed if the handler was
+// closed in the meantime.
+func (c *ConfigurationHandlerBase[_]) waitUntilStable() error {
+	if c.opts.stabilityInterval <= 0 {
+		return nil
+	}
+	previous, err := c.fs.Stat(c.newConfigPath)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < maxStabilityChecks; i++ {
+		select {
+		case <-c.opts.clock.After(global.Jitter(c.opts.stabilityInterval, c.opts.jitter)):
+		case <-c.closing:
+			return ErrHandlerClosed
+		}
+		current, err := c.fs.Stat(c.newConfigPath)
+		if err != nil {
+			return err
+		}
+		if current.Size() == previous.Size() && current.ModTime().Equal(previous.ModTime()) {
+			return nil
+		}
+		c.log.Debug("a new configuration is still being written", slog.Int64("size", current.Size()))
+		previous = current
+	}
+	return fmt.Errorf("a file %s has changed in each of %d checks. Reason: %w", c.newConfigPath, maxStabilityChecks, ErrConfigNotStable)
 }
 
-// listenToEvents listens to changes of a new configuration from watcher and an update channel.
-func (c *ConfigurationHandlerBase[_]) listenToEvents(fw filesystem.Watcher) {
+// listenToEvents listens to changes of a new configuration from watcher, an update channel and changes of an applied
+// configuration from tamper watcher if it is not nil.
+func (c *ConfigurationHandlerBase[_]) listenToEvents(fw, tw filesystem.Watcher) {
 	configChanged := fw.GetNotificationChannel()
+	var tamperChanged <-chan struct{}
+	if tw != nil {
+		tamperChanged = tw.GetNotificationChannel()
+	}
+	var (
+		lastUpdate time.Time        // a start of the last update, zero before the first one.
+		throttled  <-chan time.Time // fires when a deferred update may be started, nil if none is deferred.
+		deferred   updateRequest    // a deferred update, it is forced if any coalesced request was forced.
+		beat       <-chan time.Time // fires when a heartbeat should be sent, nil if heartbeats are disabled.
+		pressure   <-chan time.Time // fires when disk pressure should be checked, nil if it isn't checked.
+		pressured  bool             // set when the last check has found a usage above a threshold.
+	)
+	if c.heartbeat != nil {
+		beat = c.opts.clock.After(global.Jitter(c.opts.heartbeatInterval, c.opts.jitter))
+	}
+	if c.diskPressure != nil {
+		pressure = c.opts.clock.After(global.Jitter(c.opts.diskPressureInterval, c.opts.jitter))
+	}
+	update := func(req updateRequest) {
+		lastUpdate = c.opts.clock.Now()
+		notified, open := c.runUpdate(req, tw, configChanged)
+		c.inFlight.Add(-1) // after a result was pushed, so TryUpdate sees it as pending instead
+		if notified && !c.handleConfigNotification(open, fw) {
+			configChanged = nil
+		}
+	}
 	for {
 		select {
 		case _, open := <-configChanged:
-			if open {
-				c.handle(fw.GetEvent())
-			} else {
+			if !c.handleConfigNotification(open, fw) {
 				configChanged = nil
-				if err := c.fs.DeleteFile(c.newConfigHardlinkPath); err != nil {
-					c.wasChanged <- err
-				}
-				close(c.wasChanged)
-				c.log.Debug("A wasChanged channel was closed")
 			}
-		case _, open := <-c.updateStart:
+		case _, open := <-tamperChanged:
+			if open && c.updateStart == nil {
+				c.log.Debug("A tamper event was dropped, as the handler is closed")
+			} else if open {
+				c.checkTampering(tw.GetEvent())
+			} else {
+				tamperChanged = nil
+				close(c.tamper)
+				c.log.Debug("A tamper channel was closed")
+			}
+		case req, open := <-c.updateStart:
 			if !open {
 				fw.Stop()
+				if tw != nil {
+					tw.Stop()
+				}
 				c.updateStart = nil
+				if throttled != nil {
+					throttled = nil
+					c.inFlight.Add(-1) // a deferred update is dropped, so it won't push its result
+				}
+				if c.heartbeat != nil {
+					beat = nil
+					close(c.heartbeat)
+				}
+				if c.diskPressure != nil {
+					pressure = nil
+					close(c.diskPressure)
+				}
 				close(c.updateResult)
 				c.log.Debug("An update result channel was closed")
 				continue
 			}
-			if c.updateFunc != nil {
-				c.updateResult <- c.updateFunc()
-				c.log.Debug("An update result event was sent")
+			if throttled != nil {
+				deferred.force = deferred.force || req.force
+				c.inFlight.Add(-1) // a coalesced request doesn't push its own result
+				c.log.Debug("An update request was coalesced with a deferred one")
+				continue
+			}
+			if wait := c.updateDelay(lastUpdate); wait > 0 {
+				throttled, deferred = c.opts.clock.After(wait), req
+				c.log.Debug("An update was deferred by a rate limit", slog.Duration("wait", wait))
+				continue
+			}
+			update(req)
+		case now := <-beat:
+			select {
+			case c.heartbeat <- now:
+			default:
+				c.log.Debug("A heartbeat was dropped, as the previous one wasn't read")
 			}
+			beat = c.opts.clock.After(global.Jitter(c.opts.heartbeatInterval, c.opts.jitter))
+		case now := <-pressure:
+			pressured = c.checkDiskPressure(now, pressured)
+			pressure = c.opts.clock.After(global.Jitter(c.opts.diskPressureInterval, c.opts.jitter))
+		case <-throttled:
+			throttled = nil
+			update(deferred)
 		}
-		if configChanged == nil && c.updateStart == nil {
+		if configChanged == nil && c.updateStart == nil && tamperChanged == nil {
 			return
 		}
 	}
 }
+
+// checkDiskPressure checks a usage of a filesystem set by WithDiskPressureWarning and sends a DiskPressureEvent if it
+// has crossed a threshold since the last check, i.e. wasPressured is false. It returns true if the usage is above
+// the threshold. If the usage can't be checked, the last result is kept.
+func (c *ConfigurationHandlerBase[_]) checkDiskPressure(now time.Time, wasPressured bool) bool {
+	free, total, err := c.fs.FreeSpace(c.opts.diskPressurePath)
+	if err != nil {
+		c.log.Warn("could not check free space", slog.String("path", c.opts.diskPressurePath), slog.Any(errorKey, err))
+		return wasPressured
+	}
+	if total == 0 {
+		return wasPressured
+	}
+	usage := 1 - float64(free)/float64(total)
+	if usage < c.opts.diskPressureThreshold {
+		return false
+	}
+	if wasPressured {
+		return true
+	}
+	c.log.Warn("a usage of a filesystem has crossed a threshold", slog.String("path", c.opts.diskPressurePath),
+		slog.Float64("usage", usage), slog.Float64("threshold", c.opts.diskPressureThreshold))
+	select {
+	case c.diskPressure <- DiskPressureEvent{Path: c.opts.diskPressurePath, Usage: usage, Threshold: c.opts.diskPressureThreshold, Time: now}:
+	default:
+		c.log.Debug("A disk pressure event was dropped, as a channel is full")
+	}
+	return true
+}
+
+// updateDelay returns how long an update must be deferred to start no sooner than an update rate limit after
+// the last update. It returns 0 when the limit is disabled or no update has been started yet.
+func (c *ConfigurationHandlerBase[_]) updateDelay(lastUpdate time.Time) time.Duration {
+	if c.opts.updateRateLimit <= 0 || lastUpdate.IsZero() {
+		return 0
+	}
+	return c.opts.updateRateLimit - c.opts.clock.Now().Sub(lastUpdate)
+}
+
+// handleConfigNotification handles a notification from a watcher of a new configuration. It is dropped when the handler
+// is closed. When a notification channel was closed, the hardlink is deleted, a wasChanged channel is closed and false
+// is returned.
+func (c *ConfigurationHandlerBase[_]) handleConfigNotification(open bool, fw filesystem.Watcher) bool {
+	if open && c.updateStart == nil {
+		c.log.Debug("A configuration event was dropped, as the handler is closed")
+	} else if open {
+		c.handle(fw.GetEvent())
+	} else {
+		var err error
+		if c.opts.keepHardlinkOnClose {
+			c.log.Debug("A hardlink was kept", slog.String("hardlink", c.newConfigHardlinkPath))
+		} else if err = c.fs.DeleteFile(c.newConfigHardlinkPath); err != nil {
+			err = fmt.Errorf("could not delete a hardlink %s. Reason: %w", c.newConfigHardlinkPath, err)
+			c.lastErr.record(err)
+		}
+		close(c.wasChanged)
+		c.subscribers.close()
+		c.log.Debug("A wasChanged channel was closed")
+		c.shutdownErr <- err
+		close(c.shutdownErr)
+		return false
+	}
+	return true
+}
+
+// runUpdate recreates a hardlink if an update is forced, calls an update function and pushes its result. A snapshot of
+// an applied configuration is refreshed if tw is not nil. If stale updates are cancelled, configChanged is watched
+// during the update and a context of the update is cancelled on its notification. It returns true and whether
+// configChanged is open if the notification was received then, so it can be handled after the update.
+func (c *ConfigurationHandlerBase[_]) runUpdate(req updateRequest, tw filesystem.Watcher, configChanged <-chan struct{}) (notified, open bool) {
+	if req.force {
+		if err := c.fs.Hardlink(c.newConfigPath, c.newConfigHardlinkPath); err != nil {
+			c.log.Warn("could not recreate a hardlink before a forced update", slog.Any(errorKey, err))
+		}
+	}
+	if c.updateFunc == nil {
+		return
+	}
+	ctx := context.Background()
+	if c.opts.cancelStaleUpdates && configChanged != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		done := make(chan struct{})
+		watched := make(chan [2]bool, 1)
+		go func() {
+			select {
+			case _, open := <-configChanged:
+				c.log.Debug("An update is cancelled by a newer configuration")
+				cancel()
+				watched <- [2]bool{true, open}
+			case <-done:
+				watched <- [2]bool{}
+			}
+		}()
+		defer func() {
+			close(done)
+			result := <-watched
+			cancel()
+			notified, open = result[0], result[1]
+		}()
+	}
+	result := c.updateFunc(ctx)
+	if tw != nil {
+		c.refreshAppliedSnapshot()
+	}
+	c.updateResult <- result
+	c.log.Debug("An update result event was sent")
+	return
+}
@@ -17,11 +17,21 @@
 package handlers
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/k-lb/entrypoint-framework/handlers/internal/filesystem"
 	"github.com/k-lb/entrypoint-framework/handlers/internal/global"
+	m "go.uber.org/mock/gomock"
 )
 
 func (h *HandlersTestSuite) TestNewConfigurationHandlerBase() {
@@ -31,7 +41,7 @@ func (h *HandlersTestSuite) TestNewConfigurationHandlerBase() {
 
 	h.RunWithMockEnv("when NewFileWatcher returns an error, should returns a nil handler and an error", func(mocks *mocksControl) {
 		watcherErr := errors.New("watcher error")
-		mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove).Times(1).Return(mocks.watcher, watcherErr)
+		mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, watcherErr)
 		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", neverUsedUpdateFunc, logDiscard, mocks.fs)
 
 		h.Nil(configHandler)
@@ -41,7 +51,7 @@ func (h *HandlersTestSuite) TestNewConfigurationHandlerBase() {
 
 	h.runWithExpects("when NewFileWatcher returns no error, should set all configuration handler's fields and correctly close them", func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
 		expectedUpdateResult := 123
-		mocks.fs.EXPECT().DoesExist("newConfigPath").Times(1).Return(false)
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
 		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return expectedUpdateResult }, logDiscard, mocks.fs)
 
 		h.NoError(err)
@@ -49,10 +59,10 @@ func (h *HandlersTestSuite) TestNewConfigurationHandlerBase() {
 		h.Equal(global.DefaultChanBuffSize, cap(configHandler.GetWasChangedChannel()))
 		h.Equal(global.DefaultChanBuffSize, cap(configHandler.updateStart))
 		h.Equal(global.DefaultChanBuffSize, cap(configHandler.GetUpdateResultChannel()))
-		h.True(configHandler.isOpen)
+		h.True(configHandler.isOpen.Load())
 		h.Equal("newConfigPath", configHandler.newConfigPath)
 		h.Equal("newConfigHardlinkPath", configHandler.newConfigHardlinkPath)
-		h.Equal(expectedUpdateResult, configHandler.updateFunc())
+		h.Equal(expectedUpdateResult, configHandler.updateFunc(context.Background()))
 
 		return configHandler
 	})
@@ -68,10 +78,13 @@ func (h *HandlersTestSuite) TestNewConfigurationHandlerBase() {
 	}
 	for _, test := range initialConfigTestCases {
 		h.runWithExpects(test.name, func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
-			mocks.fs.EXPECT().DoesExist("newConfigPath").Times(1).Return(test.doesConfigExist)
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(test.doesConfigExist))
 			if test.doesConfigExist {
 				mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(test.hardlinkError)
 			}
+			if test.hardlinkError != nil {
+				mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(true))
+			}
 			configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", neverUsedUpdateFunc, logDiscard, mocks.fs)
 
 			h.NoError(err)
@@ -89,6 +102,16 @@ func (h *HandlersTestSuite) TestNewConfigurationHandlerBase() {
 		})
 	}
 
+	h.runWithExpects("when a status of a new config file can't be checked, should push an event with the error", func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(nil, fs.ErrPermission)
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", neverUsedUpdateFunc, logDiscard, mocks.fs)
+
+		h.NoError(err)
+		h.NotNil(configHandler)
+		h.ErrorIs(<-configHandler.GetWasChangedChannel(), fs.ErrPermission)
+		return configHandler
+	})
+
 	configChangedTestCases := [...]struct {
 		name   string
 		events []any
@@ -106,7 +129,7 @@ func (h *HandlersTestSuite) TestNewConfigurationHandlerBase() {
 	for _, test := range configChangedTestCases {
 		test := test
 		h.runWithExpects("when a new config file doesn't exist and "+test.name, func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
-			mocks.fs.EXPECT().DoesExist("newConfigPath").Times(1).Return(false)
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
 			count := 0
 			countUpdateFunc := func() int { count++; return count }
 			configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", countUpdateFunc, logDiscard, mocks.fs)
@@ -120,6 +143,9 @@ func (h *HandlersTestSuite) TestNewConfigurationHandlerBase() {
 					} else {
 						mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{})
 						mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(errWasChanged)
+						if errWasChanged != nil {
+							mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(true))
+						}
 					}
 					configChanged <- struct{}{}
 					h.ErrorIs(<-configHandler.GetWasChangedChannel(), errWasChanged)
@@ -128,7 +154,7 @@ func (h *HandlersTestSuite) TestNewConfigurationHandlerBase() {
 					configChanged <- struct{}{}
 					h.ErrorIs(<-configHandler.GetWasChangedChannel(), ErrConfigDeleted)
 				} else if updateResult, ok := ev.(int); ok {
-					configHandler.Update()
+					h.NoError(configHandler.Update())
 					if updateResult > 0 {
 						h.Equal(<-configHandler.GetUpdateResultChannel(), updateResult)
 					}
@@ -143,8 +169,8 @@ func (h *HandlersTestSuite) TestNewConfigurationHandlerBase() {
 
 	h.RunWithMockEnv("when Update is called after handler was closed", func(mocks *mocksControl) {
 		configChanged := make(chan struct{}, 10)
-		mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove).Times(1).Return(mocks.watcher, nil)
-		mocks.fs.EXPECT().DoesExist("newConfigPath").Times(1).Return(false)
+		mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
 		errDeleteHardlink := errors.New("delete hardlink error")
 		mocks.fs.EXPECT().DeleteFile("newConfigHardlinkPath").Times(1).Return(errDeleteHardlink)
 		mocks.watcher.EXPECT().GetNotificationChannel().Times(1).Return(configChanged)
@@ -154,18 +180,19 @@ func (h *HandlersTestSuite) TestNewConfigurationHandlerBase() {
 		h.Require().NoError(err)
 
 		configHandler.Close()
-		configHandler.Update()
+		h.ErrorIs(configHandler.Update(), ErrHandlerClosed)
+		h.ErrorIs(configHandler.ForceUpdate(), ErrHandlerClosed)
 
 		_, open := <-configHandler.updateResult
 		h.False(open)
 		close(configChanged)
-		h.ErrorIs(<-configHandler.wasChanged, errDeleteHardlink)
 		_, open = <-configHandler.wasChanged
-		h.False(open)
+		h.False(open, "shouldn't push a shutdown error to a wasChanged channel")
+		h.ErrorIs(<-configHandler.GetShutdownErrorChannel(), errDeleteHardlink)
 	})
 
 	h.runWithExpects("when an event is nil", func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
-		mocks.fs.EXPECT().DoesExist("newConfigPath").Times(1).Return(false)
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
 		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", neverUsedUpdateFunc, logDiscard, mocks.fs)
 		h.Require().NotNil(configHandler)
 		h.Require().NoError(err)
@@ -175,9 +202,1251 @@ func (h *HandlersTestSuite) TestNewConfigurationHandlerBase() {
 	})
 }
 
+func (h *HandlersTestSuite) TestConfigurationHandlerRenameEvent() {
+	h.runWithExpects("when a file is renamed onto a new config path, should hardlink it and push an event", func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs)
+		h.Require().NoError(err)
+		h.Require().NotNil(configHandler)
+
+		mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Rename})
+		mocks.fs.EXPECT().DoesExist("newConfigPath").Times(1).Return(true)
+		mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(nil)
+		configChanged <- struct{}{}
+		h.NoError(<-configHandler.GetWasChangedChannel())
+		return configHandler
+	})
+
+	h.runWithExpects("when a new config file is renamed away, should push an ErrConfigDeleted", func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs)
+		h.Require().NoError(err)
+		h.Require().NotNil(configHandler)
+
+		mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Rename})
+		mocks.fs.EXPECT().DoesExist("newConfigPath").Times(1).Return(false)
+		configChanged <- struct{}{}
+		h.ErrorIs(<-configHandler.GetWasChangedChannel(), ErrConfigDeleted)
+		return configHandler
+	})
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerForceUpdate() {
+	testCases := [...]struct {
+		name          string
+		hardlinkError error
+	}{
+		{name: "when ForceUpdate is called without a prior change, should hardlink a new config and run an update"},
+		{name: "when ForceUpdate is called and hardlinking fails, should still run an update", hardlinkError: errors.New("hardlink error")},
+	}
+	for _, test := range testCases {
+		test := test
+		h.runWithExpects(test.name, func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+			configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 7 }, logDiscard, mocks.fs)
+			h.Require().NotNil(configHandler)
+			h.Require().NoError(err)
+
+			mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(test.hardlinkError)
+			h.NoError(configHandler.ForceUpdate())
+			h.Equal(7, <-configHandler.GetUpdateResultChannel())
+			h.Empty(configHandler.GetWasChangedChannel())
+			return configHandler
+		})
+	}
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerDropStaleResults() {
+	testCases := [...]struct {
+		name            string
+		opts            []ConfigurationOption
+		expectedResults []int
+	}{
+		{name: "when a result wasn't read before Update, should keep it", expectedResults: []int{1, 2}},
+		{name: "when a result wasn't read before Update and stale results are dropped, should discard it", opts: []ConfigurationOption{WithDropStaleResults()}, expectedResults: []int{2}},
+	}
+	for _, test := range testCases {
+		test := test
+		h.runWithExpects(test.name, func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+			updates := 0
+			configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { updates++; return updates }, logDiscard, mocks.fs, test.opts...)
+			h.Require().NoError(err)
+			h.Require().NotNil(configHandler)
+
+			h.NoError(configHandler.Update())
+			h.Eventually(func() bool { return len(configHandler.GetUpdateResultChannel()) == 1 }, time.Second, time.Second/100)
+			h.NoError(configHandler.Update())
+			for _, expected := range test.expectedResults {
+				h.Equal(expected, <-configHandler.GetUpdateResultChannel())
+			}
+			h.Empty(configHandler.GetUpdateResultChannel())
+			return configHandler
+		})
+	}
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerLastError() {
+	h.runWithExpects("when handling events fails, should return the most recent error", func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+		errWatcher := errors.New("watcher error")
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(true))
+		mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(nil)
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs)
+		h.Require().NoError(err)
+		h.Require().NotNil(configHandler)
+		h.NoError(<-configHandler.GetWasChangedChannel())
+		h.NoError(configHandler.LastError(), "should be nil while a handler is healthy")
+
+		mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Error: errWatcher})
+		configChanged <- struct{}{}
+		h.ErrorIs(<-configHandler.GetWasChangedChannel(), errWatcher)
+		h.ErrorIs(configHandler.LastError(), errWatcher)
+
+		mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Remove})
+		configChanged <- struct{}{}
+		<-configHandler.GetWasChangedChannel()
+		h.ErrorIs(configHandler.LastError(), ErrConfigDeleted)
+		h.NotErrorIs(configHandler.LastError(), errWatcher)
+		return configHandler
+	})
+
+	h.RunWithMockEnv("when deleting a hardlink on close fails, should return the error", func(mocks *mocksControl) {
+		errDelete := errors.New("delete error")
+		configChanged := make(chan struct{})
+		mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		mocks.fs.EXPECT().DeleteFile("newConfigHardlinkPath").Times(1).Return(errDelete)
+		mocks.watcher.EXPECT().GetNotificationChannel().Times(1).Return(configChanged)
+		mocks.watcher.EXPECT().Stop().Times(1)
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs)
+		h.Require().NoError(err)
+
+		wasChanged := configHandler.GetWasChangedChannel()
+		configHandler.Close()
+		close(configChanged)
+		for err := range wasChanged {
+			h.Failf("unexpected event", "a wasChanged event was pushed on close: %v", err)
+		}
+		h.ErrorIs(configHandler.LastError(), errDelete)
+		shutdownErr := configHandler.GetShutdownErrorChannel()
+		h.NotNil(shutdownErr, "should return a shutdown error channel after close")
+		h.ErrorIs(<-shutdownErr, errDelete)
+		_, open := <-shutdownErr
+		h.False(open)
+	})
+
+	h.RunWithMockEnv("when deleting a hardlink on close succeeds, should send a nil shutdown error", func(mocks *mocksControl) {
+		configChanged := make(chan struct{})
+		mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		mocks.fs.EXPECT().DeleteFile("newConfigHardlinkPath").Times(1).Return(nil)
+		mocks.watcher.EXPECT().GetNotificationChannel().Times(1).Return(configChanged)
+		mocks.watcher.EXPECT().Stop().Times(1)
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs)
+		h.Require().NoError(err)
+
+		configHandler.Close()
+		close(configChanged)
+		h.NoError(<-configHandler.GetShutdownErrorChannel())
+		h.NoError(configHandler.LastError())
+	})
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerWaitForChange() {
+	h.runWithExpects("when a change arrives, should return its error", func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs)
+		h.Require().NoError(err)
+		h.Require().NotNil(configHandler)
+
+		mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Create})
+		mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(nil)
+		configChanged <- struct{}{}
+		h.NoError(configHandler.WaitForChange(context.Background()))
+
+		mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Remove})
+		configChanged <- struct{}{}
+		h.ErrorIs(configHandler.WaitForChange(context.Background()), ErrConfigDeleted)
+		return configHandler
+	})
+
+	h.runWithExpects("when no change arrives before a timeout, should return a context error", func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs)
+		h.Require().NoError(err)
+		h.Require().NotNil(configHandler)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second/100)
+		defer cancel()
+		h.ErrorIs(configHandler.WaitForChange(ctx), context.DeadlineExceeded)
+		return configHandler
+	})
+
+	h.RunWithMockEnv("when a handler is closed during a wait, should return ErrHandlerClosed", func(mocks *mocksControl) {
+		configChanged := make(chan struct{})
+		mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		mocks.fs.EXPECT().DeleteFile("newConfigHardlinkPath").Times(1).Return(nil)
+		mocks.watcher.EXPECT().GetNotificationChannel().Times(1).Return(configChanged)
+		mocks.watcher.EXPECT().Stop().Times(1).Do(func() { close(configChanged) })
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs)
+		h.Require().NoError(err)
+
+		waitErr := make(chan error)
+		go func() { waitErr <- configHandler.WaitForChange(context.Background()) }()
+		time.Sleep(time.Second / 100)
+		configHandler.Close()
+		h.ErrorIs(<-waitErr, ErrHandlerClosed)
+		h.ErrorIs(configHandler.WaitForChange(context.Background()), ErrHandlerClosed, "should return ErrHandlerClosed after closing")
+	})
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerSubscribe() {
+	h.runWithExpects("when there are two subscribers, both should receive every change until one unsubscribes", func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs)
+		h.Require().NoError(err)
+		first, unsubscribeFirst := configHandler.Subscribe()
+		second, unsubscribeSecond := configHandler.Subscribe()
+		defer unsubscribeSecond()
+
+		mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Create})
+		mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(nil)
+		configChanged <- struct{}{}
+		h.NoError(<-configHandler.GetWasChangedChannel())
+		h.NoError(<-first)
+		h.NoError(<-second)
+
+		unsubscribeFirst()
+		unsubscribeFirst()
+		_, open := <-first
+		h.False(open, "an unsubscribed channel should be closed")
+
+		mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Remove})
+		configChanged <- struct{}{}
+		h.ErrorIs(<-configHandler.GetWasChangedChannel(), ErrConfigDeleted)
+		h.ErrorIs(<-second, ErrConfigDeleted)
+		return configHandler
+	})
+
+	h.RunWithMockEnv("when a handler is closed, should close channels of subscribers", func(mocks *mocksControl) {
+		configChanged := make(chan struct{})
+		mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		mocks.fs.EXPECT().DeleteFile("newConfigHardlinkPath").Times(1).Return(nil)
+		mocks.watcher.EXPECT().GetNotificationChannel().Times(1).Return(configChanged)
+		mocks.watcher.EXPECT().Stop().Times(1).Do(func() { close(configChanged) })
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs)
+		h.Require().NoError(err)
+		subscribed, unsubscribe := configHandler.Subscribe()
+
+		configHandler.Close()
+		_, open := <-subscribed
+		h.False(open)
+		unsubscribe()
+		h.NoError(<-configHandler.GetShutdownErrorChannel())
+		subscribed, _ = configHandler.Subscribe()
+		_, open = <-subscribed
+		h.False(open, "a channel returned after closing should be closed")
+	})
+}
+
+func (h *HandlersTestSuite) TestSubscribersDropOldest() {
+	s := subscribers{}
+	ch, unsubscribe := s.add()
+	defer unsubscribe()
+	errs := make([]error, global.DefaultChanBuffSize+1)
+	for i := range errs {
+		errs[i] = fmt.Errorf("error %d", i)
+		s.notify(errs[i])
+	}
+
+	h.Len(ch, global.DefaultChanBuffSize)
+	h.Equal(errs[1], <-ch, "the oldest event should be dropped")
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerSuppressInitialEvent() {
+	testCases := [...]struct {
+		name          string
+		hardlinkError error
+	}{
+		{name: "when a new config file exists and an initial event is suppressed, should hardlink it without pushing an event"},
+		{name: "when a new config file exists, an initial event is suppressed and a hardlink fails, shouldn't push an event", hardlinkError: errors.New("hardlink error")},
+	}
+	for _, test := range testCases {
+		test := test
+		h.runWithExpects(test.name, func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(true))
+			mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(test.hardlinkError)
+			if test.hardlinkError != nil {
+				mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(true))
+			}
+			configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs, WithSuppressInitialEvent())
+			h.Require().NoError(err)
+			h.Require().NotNil(configHandler)
+			h.Empty(configHandler.GetWasChangedChannel(), "should not push an initial event")
+
+			mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Remove})
+			configChanged <- struct{}{}
+			h.ErrorIs(<-configHandler.GetWasChangedChannel(), ErrConfigDeleted, "the first event should correspond to a real change")
+			return configHandler
+		})
+	}
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerContentPattern() {
+	errRead := errors.New("read error")
+	testCases := [...]struct {
+		name          string
+		content       string
+		readError     error
+		expectedError error
+	}{
+		{name: "when a content matches a pattern, should push a nil event and permit an update", content: "enabled: true"},
+		{name: "when a content doesn't match a pattern, should push a no match event and reject an update", content: "enabled: false", expectedError: ErrConfigNoMatch},
+		{name: "when a content can't be read, should push an error and reject an update", readError: errRead, expectedError: errRead},
+	}
+	for _, test := range testCases {
+		test := test
+		h.runWithExpects(test.name, func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+			configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs, withContentPattern(regexp.MustCompile(`(?m)^enabled: true$`)))
+			h.Require().NoError(err)
+			h.Require().NotNil(configHandler)
+			h.ErrorIs(configHandler.Update(), ErrConfigNoMatch, "should reject an update before a configuration is observed")
+
+			mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Create})
+			mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(nil)
+			mocks.fs.EXPECT().ReadFile("newConfigHardlinkPath").Times(1).Return([]byte(test.content), test.readError)
+			configChanged <- struct{}{}
+			if test.expectedError != nil {
+				h.ErrorIs(<-configHandler.GetWasChangedChannel(), test.expectedError)
+				h.ErrorIs(configHandler.Update(), ErrConfigNoMatch)
+				h.ErrorIs(configHandler.ForceUpdate(), ErrConfigNoMatch)
+				started, reason := configHandler.TryUpdate()
+				h.False(started)
+				h.Equal(RejectNoChange, reason, "should reject an update of a configuration which doesn't match")
+			} else {
+				h.NoError(<-configHandler.GetWasChangedChannel())
+				h.NoError(configHandler.Update())
+				h.Equal(1, <-configHandler.GetUpdateResultChannel())
+			}
+
+			mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Remove})
+			configChanged <- struct{}{}
+			h.ErrorIs(<-configHandler.GetWasChangedChannel(), ErrConfigDeleted)
+			h.ErrorIs(configHandler.Update(), ErrConfigNoMatch, "should reject an update after a configuration was deleted")
+			return configHandler
+		})
+	}
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerInitialEvent() {
+	h.RunWithMockEnv("when a new config file exists at startup, should mark only its event as initial", func(mocks *mocksControl) {
+		logs := &syncBuffer{}
+		log := slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		configChanged := make(chan struct{}, 1)
+		mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
+		mocks.watcher.EXPECT().GetNotificationChannel().Times(1).Return(configChanged)
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(true))
+		mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(2).Return(nil)
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, log, mocks.fs)
+		h.Require().NoError(err)
+		h.NoError(<-configHandler.GetWasChangedChannel())
+
+		mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Create})
+		configChanged <- struct{}{}
+		h.NoError(<-configHandler.GetWasChangedChannel())
+
+		mocks.watcher.EXPECT().Stop().Times(1)
+		mocks.fs.EXPECT().DeleteFile("newConfigHardlinkPath").Times(1).Return(nil)
+		configHandler.Close()
+		close(configChanged)
+		for range configHandler.wasChanged {
+		}
+		h.Equal(1, strings.Count(logs.String(), "initial=true"), "an initial event should be marked")
+		h.Equal(1, strings.Count(logs.String(), "initial=false"), "a watcher event shouldn't be marked")
+	})
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerAppliedFiles() {
+	neverUsedUpdateFunc := func() int { h.Fail("updateFunc called"); return 0 }
+	errList := errors.New("list error")
+	testCases := [...]struct {
+		name          string
+		opts          []ConfigurationOption
+		files         []string
+		listError     error
+		expectedFiles []string
+		expectedError error
+	}{
+		{name: "when a handler doesn't apply a configuration to a directory, should return an error", expectedError: ErrNoAppliedDir},
+		{name: "when an applied dir can't be listed, should return an error", opts: []ConfigurationOption{withConfigDirs("newConfigDir", "oldConfigDir")}, listError: errList, expectedError: errList},
+		{name: "when an applied dir is listed, should return sorted files", opts: []ConfigurationOption{withConfigDirs("newConfigDir", "oldConfigDir")},
+			files: []string{"dir/b", "a", "c"}, expectedFiles: []string{"a", "c", "dir/b"}},
+	}
+	for _, test := range testCases {
+		test := test
+		h.runWithExpects(test.name, func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+			configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", neverUsedUpdateFunc, logDiscard, mocks.fs, test.opts...)
+			h.Require().NoError(err)
+			if test.expectedError != ErrNoAppliedDir {
+				mocks.fs.EXPECT().ListFileNamesInDir("oldConfigDir").Times(1).Return(test.files, test.listError)
+			}
+
+			files, err := configHandler.AppliedFiles()
+			h.ErrorIs(err, test.expectedError)
+			h.Equal(test.expectedFiles, files)
+			return configHandler
+		})
+	}
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerPaths() {
+	neverUsedUpdateFunc := func() int { h.Fail("updateFunc called"); return 0 }
+	testCases := [...]struct {
+		name                 string
+		opts                 []ConfigurationOption
+		expectedNewConfigDir string
+		expectedOldConfigDir string
+	}{
+		{name: "when a handler doesn't apply a configuration to a directory, should return paths and empty dirs"},
+		{name: "when a handler applies a configuration to a directory, should return paths and dirs", opts: []ConfigurationOption{withConfigDirs("newConfigDir", "oldConfigDir")},
+			expectedNewConfigDir: "newConfigDir", expectedOldConfigDir: "oldConfigDir"},
+	}
+	for _, test := range testCases {
+		test := test
+		h.runWithExpects(test.name, func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+			configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", neverUsedUpdateFunc, logDiscard, mocks.fs, test.opts...)
+			h.Require().NoError(err)
+
+			h.Equal("newConfigPath", configHandler.NewConfigPath())
+			h.Equal("newConfigHardlinkPath", configHandler.HardlinkPath())
+			h.Equal(test.expectedNewConfigDir, configHandler.NewConfigDir())
+			h.Equal(test.expectedOldConfigDir, configHandler.OldConfigDir())
+			return configHandler
+		})
+	}
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerKeepHardlinkOnClose() {
+	testCases := [...]struct {
+		name         string
+		opts         []ConfigurationOption
+		expectDelete bool
+	}{
+		{name: "when a handler is closed by default, should delete a hardlink", expectDelete: true},
+		{name: "when a handler is closed with WithKeepHardlinkOnClose, should keep a hardlink", opts: []ConfigurationOption{WithKeepHardlinkOnClose()}},
+	}
+	for _, test := range testCases {
+		test := test
+		h.RunWithMockEnv(test.name, func(mocks *mocksControl) {
+			configChanged := make(chan struct{}, 10)
+			mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(true))
+			mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(nil)
+			mocks.watcher.EXPECT().GetNotificationChannel().Times(1).Return(configChanged)
+			mocks.watcher.EXPECT().Stop().Times(1)
+			if test.expectDelete {
+				mocks.fs.EXPECT().DeleteFile("newConfigHardlinkPath").Times(1).Return(nil)
+			}
+			configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs, test.opts...)
+			h.Require().NoError(err)
+			h.Require().NotNil(configHandler)
+			h.NoError(<-configHandler.GetWasChangedChannel())
+
+			configHandler.Close()
+			close(configChanged)
+			_, open := <-configHandler.wasChanged
+			h.False(open)
+		})
+	}
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerStabilityCheck() {
+	neverUsedUpdateFunc := func() int { h.Fail("updateFunc called"); return 0 }
+	start := time.Now()
+
+	h.runWithExpects("when a new config is still growing, should hardlink it only after it has stabilized", func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", neverUsedUpdateFunc, logDiscard, mocks.fs, WithStabilityCheck(time.Millisecond))
+		h.Require().NotNil(configHandler)
+		h.Require().NoError(err)
+
+		m.InOrder(
+			mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Create}),
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(fakeFileInfo{size: 1, modTime: start}, nil),
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(fakeFileInfo{size: 2, modTime: start.Add(time.Second)}, nil),
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(fakeFileInfo{size: 3, modTime: start.Add(2 * time.Second)}, nil),
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(fakeFileInfo{size: 3, modTime: start.Add(2 * time.Second)}, nil),
+			mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(nil),
+		)
+		configChanged <- struct{}{}
+		h.NoError(<-configHandler.GetWasChangedChannel())
+		return configHandler
+	})
+
+	h.runWithExpects("when a jitter is set, should perturb intervals between checks within a bound", func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+		const checks = 20
+		clock := &fakeClock{now: start}
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", neverUsedUpdateFunc, logDiscard, mocks.fs,
+			WithStabilityCheck(time.Second), WithJitter(0.25), withClock(clock))
+		h.Require().NotNil(configHandler)
+		h.Require().NoError(err)
+
+		calls := []any{mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Create})}
+		for i := 0; i < checks; i++ {
+			calls = append(calls, mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(fakeFileInfo{size: int64(i), modTime: start}, nil))
+		}
+		calls = append(calls,
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(fakeFileInfo{size: checks - 1, modTime: start}, nil),
+			mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(nil))
+		m.InOrder(calls...)
+		configChanged <- struct{}{}
+		h.NoError(<-configHandler.GetWasChangedChannel())
+
+		waits := clock.getWaits()
+		h.Len(waits, checks)
+		perturbed := false
+		for _, wait := range waits {
+			h.GreaterOrEqual(wait, 750*time.Millisecond)
+			h.LessOrEqual(wait, 1250*time.Millisecond)
+			perturbed = perturbed || wait != waits[0]
+		}
+		h.True(perturbed, "intervals should differ")
+		return configHandler
+	})
+
+	h.runWithExpects("when a new config can't be stated, should push an event with the error and not hardlink it", func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+		errStat := errors.New("stat error")
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", neverUsedUpdateFunc, logDiscard, mocks.fs, WithStabilityCheck(time.Millisecond))
+		h.Require().NotNil(configHandler)
+		h.Require().NoError(err)
+
+		m.InOrder(
+			mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Create}),
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(fakeFileInfo{size: 1, modTime: start}, nil),
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(nil, errStat),
+		)
+		configChanged <- struct{}{}
+		h.ErrorIs(<-configHandler.GetWasChangedChannel(), errStat)
+		return configHandler
+	})
+
+	h.runWithExpects("when a new config keeps changing, should push an event with an ErrConfigNotStable and not hardlink it", func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", neverUsedUpdateFunc, logDiscard, mocks.fs,
+			WithStabilityCheck(time.Second), withClock(&fakeClock{now: start}))
+		h.Require().NotNil(configHandler)
+		h.Require().NoError(err)
+
+		size := int64(0)
+		m.InOrder(
+			mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Create}),
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(maxStabilityChecks+1).DoAndReturn(func(string) (fs.FileInfo, error) {
+				size++
+				return fakeFileInfo{size: size, modTime: start}, nil
+			}),
+		)
+		configChanged <- struct{}{}
+		h.ErrorIs(<-configHandler.GetWasChangedChannel(), ErrConfigNotStable)
+		return configHandler
+	})
+
+	h.RunWithMockEnv("when a handler is closed while a new config is checked, should stop waiting and push an event with an ErrHandlerClosed", func(mocks *mocksControl) {
+		clock := &manualClock{now: start}
+		configChanged := make(chan struct{}, 10)
+		mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		mocks.watcher.EXPECT().GetNotificationChannel().Times(1).Return(configChanged)
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", neverUsedUpdateFunc, logDiscard, mocks.fs,
+			WithStabilityCheck(time.Second), withClock(clock))
+		h.Require().NotNil(configHandler)
+		h.Require().NoError(err)
+
+		m.InOrder(
+			mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Create}),
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(fakeFileInfo{size: 1, modTime: start}, nil),
+			mocks.watcher.EXPECT().Stop().Times(1),
+			mocks.fs.EXPECT().DeleteFile("newConfigHardlinkPath").Times(1).Return(nil),
+		)
+		configChanged <- struct{}{}
+		h.Require().Eventually(func() bool { return clock.pendingTimers() == 1 }, time.Second, time.Millisecond)
+		configHandler.Close()
+		h.ErrorIs(<-configHandler.wasChanged, ErrHandlerClosed)
+
+		close(configChanged)
+		_, open := <-configHandler.wasChanged
+		h.False(open)
+	})
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerInitialContext() {
+	h.RunWithMockEnv("when hardlinking an initial configuration hangs, should stop a watcher and return a timeout error", func(mocks *mocksControl) {
+		release := make(chan struct{})
+		defer close(release)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second/10)
+		defer cancel()
+		mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(true))
+		mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).DoAndReturn(func(string, string) error {
+			<-release
+			return nil
+		})
+		mocks.watcher.EXPECT().Stop().Times(1)
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs, withInitialContext(ctx))
+
+		h.ErrorIs(err, context.DeadlineExceeded)
+		h.Nil(configHandler)
+	})
+
+	h.runWithExpects("when an initial configuration is handled before a deadline, should push an initial event", func(_ chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(true))
+		mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(nil)
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs, withInitialContext(ctx))
+		h.Require().NoError(err)
+		h.Require().NotNil(configHandler)
+
+		h.NoError(<-configHandler.GetWasChangedChannel())
+		return configHandler
+	})
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerEmptyMeansDeleted() {
+	neverUsedUpdateFunc := func() int { h.Fail("updateFunc called"); return 0 }
+
+	h.RunWithMockEnv("when an empty config means deleted, should watch writes and push ErrConfigDeleted for an empty config", func(mocks *mocksControl) {
+		configChanged := make(chan struct{}, 10)
+		mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove|fsnotify.Rename|fsnotify.Write).Times(1).Return(mocks.watcher, nil)
+		mocks.watcher.EXPECT().GetNotificationChannel().Times(1).Return(configChanged)
+		m.InOrder(
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(true)),
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(fakeFileInfo{size: 5}, nil),
+			mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(nil),
+		)
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", neverUsedUpdateFunc, logDiscard, mocks.fs, WithEmptyMeansDeleted())
+		h.Require().NoError(err)
+		h.Require().NotNil(configHandler)
+		h.NoError(<-configHandler.GetWasChangedChannel())
+
+		mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Write})
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(fakeFileInfo{size: 0}, nil)
+		configChanged <- struct{}{}
+		h.ErrorIs(<-configHandler.GetWasChangedChannel(), ErrConfigDeleted, "should push ErrConfigDeleted for a truncated config")
+		h.ErrorIs(configHandler.LastError(), ErrConfigDeleted)
+
+		mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Write})
+		m.InOrder(
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(fakeFileInfo{size: 3}, nil),
+			mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(nil),
+		)
+		configChanged <- struct{}{}
+		h.NoError(<-configHandler.GetWasChangedChannel(), "should hardlink a config written again")
+
+		mocks.watcher.EXPECT().Stop().Times(1)
+		mocks.fs.EXPECT().DeleteFile("newConfigHardlinkPath").Times(1).Return(nil)
+		configHandler.Close()
+		close(configChanged)
+		_, open := <-configHandler.wasChanged
+		h.False(open)
+	})
+
+	h.RunWithMockEnv("when an initial config can't be stated for a size, should push an event with the error and not hardlink it", func(mocks *mocksControl) {
+		errStat := errors.New("stat error")
+		configChanged := make(chan struct{}, 10)
+		mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove|fsnotify.Rename|fsnotify.Write).Times(1).Return(mocks.watcher, nil)
+		mocks.watcher.EXPECT().GetNotificationChannel().Times(1).Return(configChanged)
+		m.InOrder(
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(true)),
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(nil, errStat),
+		)
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", neverUsedUpdateFunc, logDiscard, mocks.fs, WithEmptyMeansDeleted())
+		h.Require().NoError(err)
+		h.Require().NotNil(configHandler)
+		err = <-configHandler.GetWasChangedChannel()
+		h.ErrorIs(err, errStat)
+		h.NotErrorIs(err, ErrConfigDeleted)
+
+		mocks.watcher.EXPECT().Stop().Times(1)
+		mocks.fs.EXPECT().DeleteFile("newConfigHardlinkPath").Times(1).Return(nil)
+		configHandler.Close()
+		close(configChanged)
+		_, open := <-configHandler.wasChanged
+		h.False(open)
+	})
+
+	h.runWithExpects("when an empty config doesn't mean deleted, should hardlink an empty config", func(_ chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(fakeFileInfo{size: 0}, nil)
+		mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(nil)
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", neverUsedUpdateFunc, logDiscard, mocks.fs)
+		h.Require().NoError(err)
+		h.Require().NotNil(configHandler)
+
+		h.NoError(<-configHandler.GetWasChangedChannel())
+		return configHandler
+	})
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerDirectory() {
+	neverUsedUpdateFunc := func() int { h.Fail("updateFunc called"); return 0 }
+
+	h.runWithExpects("when a new config is a directory, should push ErrConfigIsDirectory once without retrying a hardlink", func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+		errHardlink := errors.New("operation not permitted")
+		m.InOrder(
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(fakeFileInfo{mode: fs.ModeDir}, nil),
+			mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(errHardlink),
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(fakeFileInfo{mode: fs.ModeDir}, nil),
+		)
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", neverUsedUpdateFunc, logDiscard, mocks.fs)
+		h.Require().NoError(err)
+		h.Require().NotNil(configHandler)
+
+		err = <-configHandler.GetWasChangedChannel()
+		h.ErrorIs(err, ErrConfigIsDirectory)
+		h.NotErrorIs(err, errHardlink, "shouldn't report a confusing hardlink error")
+		h.ErrorIs(configHandler.LastError(), ErrConfigIsDirectory)
+		h.Empty(configHandler.GetWasChangedChannel(), "shouldn't retry without an event")
+
+		mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Create})
+		mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(nil)
+		configChanged <- struct{}{}
+		h.NoError(<-configHandler.GetWasChangedChannel(), "should hardlink a file which replaced a directory")
+		return configHandler
+	})
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerUpdateRateLimit() {
+	const minInterval = time.Second
+
+	h.runWithExpects("when updates are requested faster than a limit, should coalesce them and apply the latest one after an interval", func(_ chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+		clock := &manualClock{now: time.Now()}
+		version := atomic.Int32{}
+		updateTimes := []time.Time{}
+		update := func() int {
+			updateTimes = append(updateTimes, clock.Now())
+			return int(version.Load())
+		}
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", update, logDiscard, mocks.fs, WithUpdateRateLimit(minInterval), withClock(clock))
+		h.Require().NoError(err)
+		h.Require().NotNil(configHandler)
+
+		version.Store(1)
+		h.Require().NoError(configHandler.Update())
+		h.Equal(1, <-configHandler.GetUpdateResultChannel(), "should start the first update immediately")
+
+		mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(nil)
+		for v := int32(2); v <= 5; v++ {
+			version.Store(v)
+			if v == 3 {
+				h.Require().NoError(configHandler.ForceUpdate())
+			} else {
+				h.Require().NoError(configHandler.Update())
+			}
+		}
+		h.Eventually(func() bool { return clock.pendingTimers() == 1 && len(configHandler.updateStart) == 0 }, time.Second, time.Millisecond)
+		clock.advance(minInterval / 2)
+		select {
+		case result := <-configHandler.GetUpdateResultChannel():
+			h.Failf("unexpected update", "an update was started before an interval elapsed with a result %d", result)
+		case <-time.After(20 * time.Millisecond):
+		}
+		clock.advance(minInterval / 2)
+		h.Equal(5, <-configHandler.GetUpdateResultChannel(), "should apply the latest configuration")
+		h.Len(updateTimes, 2, "should coalesce deferred requests into a single update")
+		h.GreaterOrEqual(updateTimes[1].Sub(updateTimes[0]), minInterval)
+
+		clock.advance(10 * minInterval)
+		version.Store(6)
+		h.Require().NoError(configHandler.Update())
+		h.Equal(6, <-configHandler.GetUpdateResultChannel(), "should start an update immediately after an interval elapsed")
+		h.Equal(0, clock.pendingTimers())
+		return configHandler
+	})
+
+	h.runWithExpects("when a handler is closed with a deferred update, should drop it", func(_ chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+		clock := &manualClock{now: time.Now()}
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs, WithUpdateRateLimit(minInterval), withClock(clock))
+		h.Require().NoError(err)
+		h.Require().NotNil(configHandler)
+
+		h.Require().NoError(configHandler.Update())
+		h.Equal(1, <-configHandler.GetUpdateResultChannel())
+		h.Require().NoError(configHandler.Update())
+		h.Eventually(func() bool { return clock.pendingTimers() == 1 }, time.Second, time.Millisecond)
+		return configHandler
+	})
+
+	h.RunWithMockEnv("when a handler is closed with a deferred update, shouldn't count it as in flight", func(mocks *mocksControl) {
+		clock := &manualClock{now: time.Now()}
+		configChanged := make(chan struct{})
+		mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		mocks.watcher.EXPECT().GetNotificationChannel().Times(1).Return(configChanged)
+		mocks.watcher.EXPECT().Stop().Times(1)
+		mocks.fs.EXPECT().DeleteFile("newConfigHardlinkPath").Times(1).Return(nil)
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs, WithUpdateRateLimit(minInterval), withClock(clock))
+		h.Require().NoError(err)
+		h.Require().NotNil(configHandler)
+
+		h.Require().NoError(configHandler.Update())
+		h.Equal(1, <-configHandler.GetUpdateResultChannel())
+		h.Require().NoError(configHandler.Update())
+		h.Require().NoError(configHandler.Update())
+		h.Eventually(func() bool { return clock.pendingTimers() == 1 && len(configHandler.updateStart) == 0 }, time.Second, time.Millisecond)
+		h.Equal(1, configHandler.InFlightUpdates(), "coalesced requests should be counted once")
+
+		resultChan := configHandler.GetUpdateResultChannel()
+		configHandler.Close()
+		_, open := <-resultChan
+		h.False(open)
+		h.Equal(0, configHandler.InFlightUpdates())
+
+		close(configChanged)
+		_, open = <-configHandler.wasChanged
+		h.False(open)
+	})
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerHeartbeat() {
+	const interval = time.Second
+
+	h.runWithExpects("when heartbeats are disabled, should return a nil heartbeat channel", func(_ chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs)
+		h.Require().NoError(err)
+		h.Require().NotNil(configHandler)
+
+		h.Nil(configHandler.GetHeartbeatChannel())
+		return configHandler
+	})
+
+	h.RunWithMockEnv("when heartbeats are enabled, should send them every interval until the handler is closed", func(mocks *mocksControl) {
+		clock := &manualClock{now: time.Now()}
+		start := clock.Now()
+		configChanged := make(chan struct{})
+		mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		mocks.watcher.EXPECT().GetNotificationChannel().Times(1).Return(configChanged)
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs, WithHeartbeat(interval), withClock(clock))
+		h.Require().NoError(err)
+		h.Require().NotNil(configHandler)
+		heartbeat := configHandler.GetHeartbeatChannel()
+		h.Require().NotNil(heartbeat)
+
+		for i := 1; i <= 3; i++ {
+			h.Eventually(func() bool { return clock.pendingTimers() == 1 }, time.Second, time.Millisecond)
+			clock.advance(interval / 2)
+			h.Empty(heartbeat, "shouldn't send a heartbeat before an interval elapsed")
+			clock.advance(interval / 2)
+			h.Equal(start.Add(time.Duration(i)*interval), <-heartbeat)
+		}
+
+		h.Eventually(func() bool { return clock.pendingTimers() == 1 }, time.Second, time.Millisecond)
+		clock.advance(interval)
+		h.Eventually(func() bool { return clock.pendingTimers() == 1 }, time.Second, time.Millisecond)
+		clock.advance(interval)
+		h.Eventually(func() bool { return clock.pendingTimers() == 1 }, time.Second, time.Millisecond)
+		h.Len(heartbeat, 1, "should drop a heartbeat if the previous one wasn't read")
+		<-heartbeat
+
+		mocks.watcher.EXPECT().Stop().Times(1)
+		mocks.fs.EXPECT().DeleteFile("newConfigHardlinkPath").Times(1).Return(nil)
+		configHandler.Close()
+		h.Nil(configHandler.GetHeartbeatChannel())
+		_, open := <-heartbeat
+		h.False(open, "should close a heartbeat channel")
+		clock.advance(interval)
+		close(configChanged)
+		_, open = <-configHandler.wasChanged
+		h.False(open)
+	})
+
+	h.RunWithMockEnv("when a jitter is set, should perturb intervals between heartbeats within a bound", func(mocks *mocksControl) {
+		const beats = 20
+		clock := &manualClock{now: time.Now()}
+		configChanged := make(chan struct{})
+		mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		mocks.watcher.EXPECT().GetNotificationChannel().Times(1).Return(configChanged)
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs,
+			WithHeartbeat(interval), WithJitter(0.25), withClock(clock))
+		h.Require().NoError(err)
+		heartbeat := configHandler.GetHeartbeatChannel()
+
+		for range beats {
+			h.Eventually(func() bool { return clock.pendingTimers() == 1 }, time.Second, time.Millisecond)
+			clock.advance(2 * interval)
+			<-heartbeat
+		}
+
+		waits := clock.getWaits()
+		h.GreaterOrEqual(len(waits), beats)
+		perturbed := false
+		for _, wait := range waits {
+			h.GreaterOrEqual(wait, 750*time.Millisecond)
+			h.LessOrEqual(wait, 1250*time.Millisecond)
+			perturbed = perturbed || wait != waits[0]
+		}
+		h.True(perturbed, "intervals should differ")
+
+		mocks.watcher.EXPECT().Stop().Times(1)
+		mocks.fs.EXPECT().DeleteFile("newConfigHardlinkPath").Times(1).Return(nil)
+		configHandler.Close()
+		close(configChanged)
+		_, open := <-configHandler.wasChanged
+		h.False(open)
+	})
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerDiskPressure() {
+	const interval = time.Second
+
+	h.runWithExpects("when a disk pressure check is disabled, should return a nil channel", func(_ chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs)
+		h.Require().NoError(err)
+
+		h.Nil(configHandler.GetDiskPressureChannel())
+		return configHandler
+	})
+
+	h.RunWithMockEnv("when a usage crosses a threshold, should send a warning once until it drops below", func(mocks *mocksControl) {
+		clock := &manualClock{now: time.Now()}
+		configChanged := make(chan struct{})
+		mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		mocks.watcher.EXPECT().GetNotificationChannel().Times(1).Return(configChanged)
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs,
+			WithDiskPressureWarning("oldConfigDir", 0.9, interval), withClock(clock))
+		h.Require().NoError(err)
+		pressure := configHandler.GetDiskPressureChannel()
+		h.Require().NotNil(pressure)
+
+		checks := [...]struct {
+			free          uint64
+			err           error
+			expectedUsage float64 // 0 if no event is expected
+		}{
+			{free: 50},
+			{free: 5, expectedUsage: 0.95},
+			{free: 4},
+			{err: errors.New("statfs error")},
+			{free: 60},
+			{free: 8, expectedUsage: 0.92},
+		}
+		for _, check := range checks {
+			h.Eventually(func() bool { return clock.pendingTimers() == 1 }, time.Second, time.Millisecond)
+			mocks.fs.EXPECT().FreeSpace("oldConfigDir").Times(1).Return(check.free, uint64(100), check.err)
+			clock.advance(interval)
+			h.Eventually(func() bool { return clock.pendingTimers() == 1 }, time.Second, time.Millisecond)
+			if check.expectedUsage == 0 {
+				h.Empty(pressure)
+				continue
+			}
+			ev := <-pressure
+			h.Equal("oldConfigDir", ev.Path)
+			h.InDelta(check.expectedUsage, ev.Usage, 1e-9)
+			h.Equal(0.9, ev.Threshold)
+			h.Equal(clock.Now(), ev.Time)
+		}
+
+		mocks.watcher.EXPECT().Stop().Times(1)
+		mocks.fs.EXPECT().DeleteFile("newConfigHardlinkPath").Times(1).Return(nil)
+		configHandler.Close()
+		h.Nil(configHandler.GetDiskPressureChannel())
+		_, open := <-pressure
+		h.False(open, "should close a disk pressure channel")
+		close(configChanged)
+		_, open = <-configHandler.wasChanged
+		h.False(open)
+	})
+
+	h.RunWithMockEnv("when a jitter is set, should perturb intervals between checks within a bound", func(mocks *mocksControl) {
+		const checks = 20
+		clock := &manualClock{now: time.Now()}
+		configChanged := make(chan struct{})
+		mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		mocks.watcher.EXPECT().GetNotificationChannel().Times(1).Return(configChanged)
+		mocks.fs.EXPECT().FreeSpace("oldConfigDir").Times(checks).Return(uint64(50), uint64(100), nil)
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs,
+			WithDiskPressureWarning("oldConfigDir", 0.9, interval), WithJitter(0.25), withClock(clock))
+		h.Require().NoError(err)
+
+		for range checks {
+			h.Eventually(func() bool { return clock.pendingTimers() == 1 }, time.Second, time.Millisecond)
+			clock.advance(2 * interval)
+		}
+		h.Eventually(func() bool { return clock.pendingTimers() == 1 }, time.Second, time.Millisecond)
+
+		waits := clock.getWaits()
+		h.Len(waits, checks+1)
+		perturbed := false
+		for _, wait := range waits {
+			h.GreaterOrEqual(wait, 750*time.Millisecond)
+			h.LessOrEqual(wait, 1250*time.Millisecond)
+			perturbed = perturbed || wait != waits[0]
+		}
+		h.True(perturbed, "intervals should differ")
+
+		mocks.watcher.EXPECT().Stop().Times(1)
+		mocks.fs.EXPECT().DeleteFile("newConfigHardlinkPath").Times(1).Return(nil)
+		configHandler.Close()
+		close(configChanged)
+		_, open := <-configHandler.wasChanged
+		h.False(open)
+	})
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerCancelStaleUpdates() {
+	h.runWithExpects("when a newer configuration is notified during an update, should cancel it and handle the configuration", func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+		started := make(chan struct{})
+		update := func(ctx context.Context) int {
+			close(started)
+			<-ctx.Done()
+			return -1
+		}
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		configHandler, err := newCancellableConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", update, logDiscard, mocks.fs, WithCancelStaleUpdates())
+		h.Require().NoError(err)
+		h.Require().NotNil(configHandler)
+
+		h.Require().NoError(configHandler.Update())
+		<-started
+		mocks.watcher.EXPECT().GetEvent().Times(1).Return(&WatcherEvent{Operation: fsnotify.Create})
+		mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(nil)
+		configChanged <- struct{}{}
+		h.Equal(-1, <-configHandler.GetUpdateResultChannel(), "should return a result of a cancelled update")
+		h.NoError(<-configHandler.GetWasChangedChannel(), "should handle the newer configuration after the update")
+		return configHandler
+	})
+
+	h.runWithExpects("when stale updates aren't cancelled, should finish an update before handling a newer configuration", func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+		started, release := make(chan struct{}), make(chan struct{})
+		update := func(ctx context.Context) int {
+			close(started)
+			select {
+			case <-ctx.Done():
+				return -1
+			case <-release:
+				return 1
+			}
+		}
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		configHandler, err := newCancellableConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", update, logDiscard, mocks.fs)
+		h.Require().NoError(err)
+		h.Require().NotNil(configHandler)
+
+		h.Require().NoError(configHandler.Update())
+		<-started
+		mocks.watcher.EXPECT().GetEvent().Times(1).Return(&WatcherEvent{Operation: fsnotify.Create})
+		mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(nil)
+		configChanged <- struct{}{}
+		select {
+		case err := <-configHandler.GetWasChangedChannel():
+			h.Failf("unexpected event", "a newer configuration was handled during an update with %v", err)
+		case <-time.After(20 * time.Millisecond):
+		}
+		close(release)
+		h.Equal(1, <-configHandler.GetUpdateResultChannel(), "shouldn't cancel the update")
+		h.NoError(<-configHandler.GetWasChangedChannel())
+		return configHandler
+	})
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerTryUpdate() {
+	h.Run("when the handler is closed, should reject an update", func() {
+		started, reason := (&ConfigurationHandlerBase[int]{}).TryUpdate()
+
+		h.False(started)
+		h.Equal(RejectClosed, reason, reason.ToString())
+	})
+
+	h.runWithExpects("when an update can't be started, should reject it with a reason", func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+		running, release := make(chan struct{}, 1), make(chan struct{})
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int {
+			running <- struct{}{}
+			<-release
+			return 1
+		}, logDiscard, mocks.fs)
+		h.Require().NoError(err)
+		h.Require().NotNil(configHandler)
+		// change pushes an event of a successfully changed configuration.
+		change := func() {
+			mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Create})
+			mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(nil)
+			configChanged <- struct{}{}
+			h.NoError(<-configHandler.GetWasChangedChannel())
+		}
+		// expectTryUpdate calls TryUpdate and checks its results.
+		expectTryUpdate := func(expectedStarted bool, expectedReason UpdateRejectReason) {
+			started, reason := configHandler.TryUpdate()
+			h.Equal(expectedStarted, started)
+			h.Equal(expectedReason, reason, reason.ToString())
+		}
+
+		expectTryUpdate(false, RejectNoChange)
+		change()
+		expectTryUpdate(true, RejectNone)
+		<-running
+		expectTryUpdate(false, RejectAlreadyRunning)
+		close(release)
+		h.Eventually(func() bool { return configHandler.inFlight.Load() == 0 }, time.Second, time.Millisecond)
+		expectTryUpdate(false, RejectResultPending)
+		h.Equal(1, <-configHandler.GetUpdateResultChannel())
+		expectTryUpdate(false, RejectNoChange)
+		change()
+		expectTryUpdate(true, RejectNone)
+		<-running
+		h.Equal(1, <-configHandler.GetUpdateResultChannel())
+		expectTryUpdate(false, RejectNoChange)
+		h.NoError(configHandler.Update(), "should keep queueing updates without a change")
+		<-running
+		h.Equal(1, <-configHandler.GetUpdateResultChannel())
+		return configHandler
+	})
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerTryUpdateConcurrently() {
+	h.runWithExpects("when many goroutines try to update at once, should start at most one update per change", func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs)
+		h.Require().NoError(err)
+
+		const changes, callers = 5, 50
+		for range changes {
+			mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Create})
+			mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(nil)
+			configChanged <- struct{}{}
+			h.NoError(<-configHandler.GetWasChangedChannel())
+
+			started := atomic.Int32{}
+			start, done := make(chan struct{}), make(chan struct{}, callers)
+			for range callers {
+				go func() {
+					<-start
+					for range 10 {
+						if ok, _ := configHandler.TryUpdate(); ok {
+							started.Add(1)
+						}
+					}
+					done <- struct{}{}
+				}()
+			}
+			close(start)
+			for range callers {
+				<-done
+			}
+			h.Equal(int32(1), started.Load())
+			h.Equal(1, <-configHandler.GetUpdateResultChannel())
+		}
+		return configHandler
+	})
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerCloseConcurrently() {
+	h.RunWithMockEnv("when the handler is closed while updates are requested, should reject them without a panic", func(mocks *mocksControl) {
+		const rounds, callers = 20, 8
+		for range rounds {
+			configChanged := make(chan struct{}, 1)
+			mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
+			mocks.watcher.EXPECT().GetNotificationChannel().Times(1).Return(configChanged)
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+			configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs)
+			h.Require().NoError(err)
+			mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Create})
+			mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(nil)
+			configChanged <- struct{}{}
+			h.Require().NoError(<-configHandler.GetWasChangedChannel())
+
+			results, drained := configHandler.GetUpdateResultChannel(), make(chan struct{})
+			go func() {
+				for range results {
+				}
+				close(drained)
+			}()
+			running, ended := sync.WaitGroup{}, sync.WaitGroup{}
+			for i := range callers {
+				running.Add(1)
+				ended.Add(1)
+				go func() {
+					defer ended.Done()
+					for calls := 0; ; calls++ {
+						if calls == 1 {
+							running.Done()
+						}
+						if i%2 == 0 {
+							if _, reason := configHandler.TryUpdate(); reason == RejectClosed {
+								return
+							}
+						} else if err := configHandler.Update(); errors.Is(err, ErrHandlerClosed) {
+							return
+						}
+					}
+				}()
+			}
+			running.Wait()
+			mocks.watcher.EXPECT().Stop().Times(1)
+			configHandler.Close()
+			ended.Wait()
+			<-drained
+
+			mocks.fs.EXPECT().DeleteFile("newConfigHardlinkPath").Times(1).Return(nil)
+			close(configChanged)
+			_, open := <-configHandler.wasChanged
+			h.False(open)
+		}
+	})
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerMaxInFlight() {
+	h.runWithExpects("when a limit of updates in flight is reached, should reject updates until prior ones complete", func(configChanged chan struct{}, mocks *mocksControl) *ConfigurationHandlerBase[int] {
+		running, release := make(chan struct{}, 1), make(chan struct{})
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int {
+			running <- struct{}{}
+			<-release
+			return 1
+		}, logDiscard, mocks.fs, WithMaxInFlight(2))
+		h.Require().NoError(err)
+
+		h.NoError(configHandler.Update())
+		<-running
+		h.NoError(configHandler.Update())
+		h.Equal(2, configHandler.InFlightUpdates())
+		h.ErrorIs(configHandler.Update(), ErrTooManyInFlight)
+		h.ErrorIs(configHandler.ForceUpdate(), ErrTooManyInFlight)
+		started, reason := configHandler.TryUpdate()
+		h.False(started)
+		h.Equal(RejectTooManyInFlight, reason, reason.ToString())
+		h.Equal(2, configHandler.InFlightUpdates(), "rejected updates shouldn't be counted")
+
+		release <- struct{}{}
+		h.Equal(1, <-configHandler.GetUpdateResultChannel())
+		<-running
+		h.Eventually(func() bool { return configHandler.InFlightUpdates() == 1 }, time.Second, time.Millisecond)
+		h.NoError(configHandler.Update(), "should accept an update after a prior one completed")
+		close(release)
+		<-running
+		h.Equal(1, <-configHandler.GetUpdateResultChannel())
+		h.Equal(1, <-configHandler.GetUpdateResultChannel())
+		h.Eventually(func() bool { return configHandler.InFlightUpdates() == 0 }, time.Second, time.Millisecond)
+		return configHandler
+	})
+}
+
 func (h *HandlersTestSuite) runWithExpects(name string, test func(chan struct{}, *mocksControl) *ConfigurationHandlerBase[int]) {
 	h.RunWithMockEnv(name, func(mocks *mocksControl) {
-		mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove).Times(1).Return(mocks.watcher, nil)
+		mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
 		mocks.fs.EXPECT().DeleteFile("newConfigHardlinkPath").Times(1).Return(nil)
 		configChanged := make(chan struct{}, 10)
 		mocks.watcher.EXPECT().GetNotificationChannel().Times(1).Return(configChanged)
@@ -0,0 +1,273 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"log/slog"
+	"sync"
+
+	"github.com/k-lb/entrypoint-framework/handlers/internal/filesystem"
+	"github.com/k-lb/entrypoint-framework/handlers/internal/global"
+)
+
+// LayeredConfigurationHandler listens to changes of multiple tarred configuration layers (each of which should only be
+// moved to by writer and hardlinked by reader). A change to any layer triggers creation of its hardlink and pushing
+// 'was changed' event. On update all layers are extracted in order, so files from later layers override files from
+// earlier ones.
+type LayeredConfigurationHandler struct {
+	wasChanged   chan error
+	updateStart  chan struct{}
+	updateFunc   func() UpdateResult
+	updateResult chan UpdateResult
+	shutdownErr  chan error
+	isOpen       bool
+	lastErr      lastError // the most recent error pushed to wasChanged channel.
+
+	newConfigDir string   // a directory to which layers are extracted.
+	oldConfigDir string   // a directory with an applied configuration.
+	layers       []string // paths to new configuration layers.
+	hardlinks    []string // paths to hardlinks of new configuration layers, in the same order as layers.
+
+	log *slog.Logger
+	fs  filesystem.Filesystem
+}
+
+// GetWasChangedChannel returns a read only channel with an error that occurred during changing of any layer. The error
+// is nil when the layer was changed successfully. When the handler is closed it returns a nil channel.
+func (c *LayeredConfigurationHandler) GetWasChangedChannel() <-chan error {
+	if c.isOpen {
+		return c.wasChanged
+	}
+	return nil
+}
+
+// Update triggers the configuration update. When the handler is closed it returns an ErrHandlerClosed.
+func (c *LayeredConfigurationHandler) Update() error {
+	if !c.isOpen {
+		return fmt.Errorf("can't update the configuration. Reason: %w", ErrHandlerClosed)
+	}
+	c.updateStart <- struct{}{}
+	return nil
+}
+
+// GetUpdateResultChannel returns a read only channel with an UpdateResult when the configuration was updated. When the
+// handler is closed it returns a nil channel.
+func (c *LayeredConfigurationHandler) GetUpdateResultChannel() <-chan UpdateResult {
+	if c.isOpen {
+		return c.updateResult
+	}
+	return nil
+}
+
+// AppliedFiles returns a sorted list of names of files (relative to a directory) which are currently in a directory
+// with an applied configuration.
+func (c *LayeredConfigurationHandler) AppliedFiles() ([]string, error) {
+	return listAppliedFiles(c.oldConfigDir, c.fs)
+}
+
+// LayerPaths returns paths to watched configuration layers in order of their extraction.
+func (c *LayeredConfigurationHandler) LayerPaths() []string {
+	return append([]string{}, c.layers...)
+}
+
+// HardlinkPaths returns paths to hardlinks of configuration layers, in the same order as LayerPaths.
+func (c *LayeredConfigurationHandler) HardlinkPaths() []string {
+	return append([]string{}, c.hardlinks...)
+}
+
+// NewConfigDir returns a directory to which layers are extracted.
+func (c *LayeredConfigurationHandler) NewConfigDir() string {
+	return c.newConfigDir
+}
+
+// OldConfigDir returns a directory with an applied configuration.
+func (c *LayeredConfigurationHandler) OldConfigDir() string {
+	return c.oldConfigDir
+}
+
+// LastError returns the most recent error observed by the handler (a watcher error, a failed hardlink or a deletion of
+// a layer) or nil if none occurred. It doesn't depend on draining handler channels.
+func (c *LayeredConfigurationHandler) LastError() error {
+	return c.lastErr.get()
+}
+
+// GetShutdownErrorChannel returns a read only channel with errors of a shutdown (e.g. failed deletions of hardlinks)
+// joined or nil if the shutdown succeeded. A single value is sent after the handler is closed and the channel is closed
+// afterwards. Unlike other channels, it is returned after the handler is closed, so the error can be read reliably.
+func (c *LayeredConfigurationHandler) GetShutdownErrorChannel() <-chan error {
+	return c.shutdownErr
+}
+
+// Close triggers closing of the LayeredConfigurationHandler. Watchers are stopped and events which they notify
+// afterwards are dropped. An update result channel is closed first and a wasChanged channel is closed, after hardlinks
+// are deleted, when all watchers have closed their notification channels. Errors of deletions are sent to a shutdown
+// error channel. Close never blocks.
+func (c *LayeredConfigurationHandler) Close() {
+	if c.isOpen {
+		close(c.updateStart)
+		c.isOpen = false
+	}
+}
+
+// newLayeredConfigurationHandler returns a pointer to a LayeredConfigurationHandler and an error if any occurred. It
+// initializes a file watcher of every layer, handles initial layers if present and listens for their changes in a new
+// goroutine.
+func newLayeredConfigurationHandler(
+	layers []string,
+	newConfigDir,
+	oldConfigDir string,
+	log *slog.Logger,
+	fs filesystem.Filesystem) (*LayeredConfigurationHandler, error) {
+	if len(layers) == 0 {
+		return nil, errors.New("can not create layered configuration handler without layers")
+	}
+	c := &LayeredConfigurationHandler{
+		wasChanged:   make(chan error, global.DefaultChanBuffSize),
+		updateStart:  make(chan struct{}, global.DefaultChanBuffSize),
+		updateResult: make(chan UpdateResult, global.DefaultChanBuffSize),
+		shutdownErr:  make(chan error, 1),
+		isOpen:       true,
+
+		newConfigDir: newConfigDir,
+		oldConfigDir: oldConfigDir,
+		layers:       append([]string{}, layers...),
+		hardlinks:    make([]string, len(layers)),
+
+		log: log,
+		fs:  fs,
+	}
+	watchers := make([]filesystem.Watcher, 0, len(layers))
+	for i, layer := range c.layers {
+		fw, err := fs.NewFileWatcher(layer, configWatchedOps)
+		if err != nil {
+			for _, w := range watchers {
+				w.Stop()
+			}
+			return nil, fmt.Errorf("could not create a new file watcher for a layer: %s. Reason: %w", layer, err)
+		}
+		watchers = append(watchers, fw)
+		c.hardlinks[i] = layer + hardlinkPostfix
+	}
+	c.updateFunc = updateLayeredTarredConfig(c.hardlinks, newConfigDir, oldConfigDir, TarArchiver{fs: fs}, fs)
+
+	for i, layer := range c.layers {
+		_, statErr := fs.Stat(layer)
+		switch {
+		case errors.Is(statErr, iofs.ErrNotExist):
+		case statErr != nil:
+			err := fmt.Errorf("could not check if a layer %s exists. Reason: %w", layer, statErr)
+			c.lastErr.record(err)
+			c.wasChanged <- err
+		default:
+			c.handle(i, &filesystem.WatcherEvent{Initial: true})
+		}
+	}
+	go c.listenToEvents(watchers)
+	return c, nil
+}
+
+// layerEvent is an event of a watcher of a layer with an index.
+type layerEvent struct {
+	index int
+	event *filesystem.WatcherEvent
+}
+
+// handle hardlinks a layer with an index after an event. It pushes a handling error to wasChanged channel and logs it.
+func (c *LayeredConfigurationHandler) handle(index int, ev *filesystem.WatcherEvent) {
+	if ev == nil { // ignore invalidated events
+		return
+	}
+	layer, hardlink := c.layers[index], c.hardlinks[index]
+	err := ev.Error
+	if err != nil {
+		err = fmt.Errorf("error from watcher(%s). Reason: %w", layer, err)
+	} else if isDeleted(ev, layer, c.fs) {
+		err = fmt.Errorf("a layer %s was deleted. Reason: %w", layer, ErrConfigDeleted)
+	} else if err = c.fs.Hardlink(layer, hardlink); err != nil && isDirectory(layer, c.fs) {
+		err = fmt.Errorf("a layer %s is a directory. Reason: %w", layer, ErrConfigIsDirectory)
+	} else if err != nil {
+		err = fmt.Errorf("could not create a hardlink of a layer %s to %s. Reason: %w", layer, hardlink, err)
+	}
+	c.lastErr.record(err)
+	c.wasChanged <- err
+	c.log.Debug("A wasChanged event was sent", slog.String("layer", layer), slog.Bool("initial", ev.Initial), slog.Any(errorKey, err))
+}
+
+// listenToEvents listens to changes of layers from watchers and an update channel. Events of all watchers are handled
+// in a single goroutine, so a layer is never hardlinked during an update.
+func (c *LayeredConfigurationHandler) listenToEvents(watchers []filesystem.Watcher) {
+	layerChanged := make(chan layerEvent)
+	wg := sync.WaitGroup{}
+	for i, fw := range watchers {
+		wg.Add(1)
+		go func(index int, fw filesystem.Watcher) {
+			defer wg.Done()
+			for range fw.GetNotificationChannel() {
+				layerChanged <- layerEvent{index: index, event: fw.GetEvent()}
+			}
+		}(i, fw)
+	}
+	go func() {
+		wg.Wait()
+		close(layerChanged)
+	}()
+
+	var changes <-chan layerEvent = layerChanged
+	for {
+		select {
+		case ev, open := <-changes:
+			if open && c.updateStart == nil {
+				c.log.Debug("A layer event was dropped, as the handler is closed", slog.String("layer", c.layers[ev.index]))
+				continue
+			} else if open {
+				c.handle(ev.index, ev.event)
+				continue
+			}
+			changes = nil
+			errs := []error{}
+			for _, hardlink := range c.hardlinks {
+				if err := c.fs.DeleteFile(hardlink); err != nil {
+					err = fmt.Errorf("could not delete a hardlink %s. Reason: %w", hardlink, err)
+					c.lastErr.record(err)
+					errs = append(errs, err)
+				}
+			}
+			close(c.wasChanged)
+			c.log.Debug("A wasChanged channel was closed")
+			c.shutdownErr <- errors.Join(errs...)
+			close(c.shutdownErr)
+		case _, open := <-c.updateStart:
+			if !open {
+				for _, fw := range watchers {
+					fw.Stop()
+				}
+				c.updateStart = nil
+				close(c.updateResult)
+				c.log.Debug("An update result channel was closed")
+				continue
+			}
+			c.updateResult <- c.updateFunc()
+			c.log.Debug("An update result event was sent")
+		}
+		if changes == nil && c.updateStart == nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,200 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"archive/tar"
+	"errors"
+	"os"
+	"path"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func (h *HandlersTestSuite) TestNewLayeredConfigurationHandler() {
+	h.RunWithMockEnv("when there are no layers, should return an error", func(mocks *mocksControl) {
+		configHandler, err := newLayeredConfigurationHandler(nil, "newConfigDir", "oldConfigDir", logDiscard, mocks.fs)
+
+		h.Error(err)
+		h.Nil(configHandler)
+	})
+
+	h.RunWithMockEnv("when NewFileWatcher of a layer returns an error, should stop watchers of previous layers and return an error", func(mocks *mocksControl) {
+		errWatcher := errors.New("watcher error")
+		mocks.fs.EXPECT().NewFileWatcher("base", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
+		mocks.fs.EXPECT().NewFileWatcher("overlay", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(nil, errWatcher)
+		mocks.watcher.EXPECT().Stop().Times(1)
+		configHandler, err := newLayeredConfigurationHandler([]string{"base", "overlay"}, "newConfigDir", "oldConfigDir", logDiscard, mocks.fs)
+
+		h.ErrorIs(err, errWatcher)
+		h.Nil(configHandler)
+	})
+
+	h.RunWithMockEnv("when layers change, should hardlink a changed layer and push an event", func(mocks *mocksControl) {
+		baseChanged, overlayChanged := make(chan struct{}, 1), make(chan struct{}, 1)
+		mocks.fs.EXPECT().NewFileWatcher("base", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
+		mocks.fs.EXPECT().NewFileWatcher("overlay", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.dirWatcher, nil)
+		mocks.fs.EXPECT().Stat("base").Times(1).Return(statResult(true))
+		mocks.fs.EXPECT().Stat("overlay").Times(1).Return(statResult(false))
+		mocks.fs.EXPECT().Hardlink("base", "base"+hardlinkPostfix).Times(1).Return(nil)
+		mocks.watcher.EXPECT().GetNotificationChannel().Times(1).Return(baseChanged)
+		mocks.dirWatcher.EXPECT().GetNotificationChannel().Times(1).Return(overlayChanged)
+		configHandler, err := newLayeredConfigurationHandler([]string{"base", "overlay"}, "newConfigDir", "oldConfigDir", logDiscard, mocks.fs)
+		h.Require().NoError(err)
+		h.NoError(<-configHandler.GetWasChangedChannel(), "should push an event of an initial layer")
+		h.NoError(configHandler.LastError())
+
+		mocks.dirWatcher.EXPECT().GetEvent().Times(1).Return(&WatcherEvent{Operation: fsnotify.Create})
+		mocks.fs.EXPECT().Hardlink("overlay", "overlay"+hardlinkPostfix).Times(1).Return(nil)
+		overlayChanged <- struct{}{}
+		h.NoError(<-configHandler.GetWasChangedChannel())
+
+		mocks.watcher.EXPECT().GetEvent().Times(1).Return(&WatcherEvent{Operation: fsnotify.Rename})
+		mocks.fs.EXPECT().DoesExist("base").Times(1).Return(true)
+		mocks.fs.EXPECT().Hardlink("base", "base"+hardlinkPostfix).Times(1).Return(nil)
+		baseChanged <- struct{}{}
+		h.NoError(<-configHandler.GetWasChangedChannel(), "should hardlink a layer moved over a watched one")
+
+		mocks.watcher.EXPECT().GetEvent().Times(1).Return(&WatcherEvent{Operation: fsnotify.Remove})
+		baseChanged <- struct{}{}
+		h.ErrorIs(<-configHandler.GetWasChangedChannel(), ErrConfigDeleted)
+		h.ErrorIs(configHandler.LastError(), ErrConfigDeleted)
+
+		mocks.watcher.EXPECT().Stop().Times(1).Do(func() { close(baseChanged) })
+		mocks.dirWatcher.EXPECT().Stop().Times(1).Do(func() { close(overlayChanged) })
+		errDelete := errors.New("delete error")
+		mocks.fs.EXPECT().DeleteFile("base" + hardlinkPostfix).Times(1).Return(errDelete)
+		mocks.fs.EXPECT().DeleteFile("overlay" + hardlinkPostfix).Times(1).Return(nil)
+		wasChanged := configHandler.GetWasChangedChannel()
+		configHandler.Close()
+		h.ErrorIs(configHandler.Update(), ErrHandlerClosed)
+		_, open := <-wasChanged
+		h.False(open, "shouldn't push a shutdown error to a wasChanged channel")
+		h.ErrorIs(<-configHandler.GetShutdownErrorChannel(), errDelete)
+		h.ErrorIs(configHandler.LastError(), errDelete)
+	})
+}
+
+func (h *HandlersTestSuite) TestLayeredConfigurationHandlerDirectory() {
+	h.RunWithMockEnv("when a layer is a directory, should push ErrConfigIsDirectory", func(mocks *mocksControl) {
+		configChanged := make(chan struct{})
+		mocks.fs.EXPECT().NewFileWatcher("base", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
+		mocks.fs.EXPECT().Stat("base").Times(2).Return(fakeFileInfo{mode: os.ModeDir}, nil)
+		mocks.fs.EXPECT().Hardlink("base", "base"+hardlinkPostfix).Times(1).Return(errors.New("operation not permitted"))
+		mocks.watcher.EXPECT().GetNotificationChannel().Times(1).Return(configChanged)
+		configHandler, err := newLayeredConfigurationHandler([]string{"base"}, "newConfigDir", "oldConfigDir", logDiscard, mocks.fs)
+		h.Require().NoError(err)
+
+		h.ErrorIs(<-configHandler.GetWasChangedChannel(), ErrConfigIsDirectory)
+
+		mocks.watcher.EXPECT().Stop().Times(1).Do(func() { close(configChanged) })
+		mocks.fs.EXPECT().DeleteFile("base" + hardlinkPostfix).Times(1).Return(nil)
+		configHandler.Close()
+		h.NoError(<-configHandler.GetShutdownErrorChannel())
+	})
+}
+
+func (h *HandlersTestSuite) TestLayeredConfigurationHandlerPaths() {
+	h.RunWithMockEnv("when a handler is created, should return paths passed to a constructor", func(mocks *mocksControl) {
+		configChanged := make(chan struct{})
+		mocks.fs.EXPECT().NewFileWatcher("base", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
+		mocks.fs.EXPECT().Stat("base").Times(1).Return(statResult(false))
+		mocks.watcher.EXPECT().GetNotificationChannel().Times(1).Return(configChanged)
+		layers := []string{"base"}
+		configHandler, err := newLayeredConfigurationHandler(layers, "newConfigDir", "oldConfigDir", logDiscard, mocks.fs)
+		h.Require().NoError(err)
+
+		h.Equal([]string{"base"}, configHandler.LayerPaths())
+		h.Equal([]string{"base" + hardlinkPostfix}, configHandler.HardlinkPaths())
+		h.Equal("newConfigDir", configHandler.NewConfigDir())
+		h.Equal("oldConfigDir", configHandler.OldConfigDir())
+		configHandler.LayerPaths()[0] = "changed"
+		h.Equal([]string{"base"}, configHandler.LayerPaths(), "shouldn't allow changing paths of a handler")
+
+		mocks.watcher.EXPECT().Stop().Times(1).Do(func() { close(configChanged) })
+		mocks.fs.EXPECT().DeleteFile("base" + hardlinkPostfix).Times(1).Return(nil)
+		configHandler.Close()
+		h.NoError(<-configHandler.GetShutdownErrorChannel())
+	})
+}
+
+func (h *HandlersTestSuite) TestLayeredTarredConfigurationHandler() {
+	h.Run("when an overlay overrides and adds files, should update an old config dir with merged layers", func() {
+		testDir := h.T().TempDir()
+		base, overlay := path.Join(testDir, "base.tar"), path.Join(testDir, "overlay.tar")
+		newConfigDir, oldConfigDir := path.Join(testDir, "new"), path.Join(testDir, "old")
+		h.Require().NoError(os.Mkdir(newConfigDir, os.ModePerm))
+		h.Require().NoError(os.Mkdir(oldConfigDir, os.ModePerm))
+		h.Require().NoError(os.WriteFile(path.Join(oldConfigDir, "stale"), []byte("stale"), 0664))
+		h.writeTarball(base, map[string]string{"common": "base", "overridden": "base"})
+		h.writeTarball(overlay, map[string]string{"overridden": "overlay", "added": "overlay"})
+
+		configHandler, err := NewLayeredTarredConfigurationHandler([]string{base, overlay}, newConfigDir, oldConfigDir, nil)
+		h.Require().NoError(err)
+		h.NoError(<-configHandler.GetWasChangedChannel())
+		h.NoError(<-configHandler.GetWasChangedChannel())
+		h.Require().NoError(configHandler.Update())
+		result := <-configHandler.GetUpdateResultChannel()
+
+		h.NoError(result.Err)
+		h.Equal([]string{"added", "common", "overridden"}, result.Created())
+		h.Equal([]string{"stale"}, result.Deleted())
+		for name, expected := range map[string]string{"common": "base", "overridden": "overlay", "added": "overlay"} {
+			content, err := os.ReadFile(path.Join(oldConfigDir, name))
+			h.NoError(err, name)
+			h.Equal(expected, string(content), name)
+		}
+
+		newOverlay := path.Join(testDir, "overlay.tar.new")
+		h.writeTarball(newOverlay, map[string]string{"overridden": "new overlay"})
+		h.Require().NoError(os.Rename(newOverlay, overlay))
+		h.NoError(<-configHandler.GetWasChangedChannel(), "should push an event when any layer changes")
+		h.Require().NoError(configHandler.Update())
+		result = <-configHandler.GetUpdateResultChannel()
+
+		h.NoError(result.Err)
+		h.Equal([]string{"overridden"}, result.Modified())
+		h.Equal([]string{"added"}, result.Deleted())
+		content, err := os.ReadFile(path.Join(oldConfigDir, "overridden"))
+		h.NoError(err)
+		h.Equal("new overlay", string(content))
+		files, err := configHandler.AppliedFiles()
+		h.NoError(err)
+		h.Equal([]string{"common", "overridden"}, files)
+
+		wasChanged := configHandler.GetWasChangedChannel()
+		configHandler.Close()
+		for range wasChanged {
+		}
+		h.NoFileExists(base + hardlinkPostfix)
+		h.NoFileExists(overlay + hardlinkPostfix)
+	})
+}
+
+// writeTarball creates a tarball with regular files named by keys of files and with their values as content.
+func (h *HandlersTestSuite) writeTarball(tarball string, files map[string]string) {
+	file, err := os.Create(tarball)
+	h.Require().NoError(err)
+	defer file.Close()
+	writer := tar.NewWriter(file)
+	defer writer.Close()
+	for name, content := range files {
+		h.Require().NoError(writer.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0664, Size: int64(len(content))}))
+		_, err := writer.Write([]byte(content))
+		h.Require().NoError(err)
+	}
+}
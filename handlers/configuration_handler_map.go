@@ -0,0 +1,101 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/k-lb/entrypoint-framework/handlers/internal/global"
+)
+
+// MappedConfigurationHandler wraps a ConfigurationHandler and transforms each of its update results with a mapping
+// function. Was changed events, updating and closing are forwarded to the wrapped handler unchanged.
+type MappedConfigurationHandler[T, U any] struct {
+	inner        ConfigurationHandler[T]
+	mapFunc      func(T) U
+	updateResult chan U
+	isOpen       bool
+}
+
+// MapConfigurationHandler returns a pointer to a MappedConfigurationHandler that applies mapFunc to every update
+// result of an inner handler and an error if any occurred. The inner handler must not be used directly afterwards.
+func MapConfigurationHandler[T, U any](inner ConfigurationHandler[T], mapFunc func(T) U) (*MappedConfigurationHandler[T, U], error) {
+	if inner == nil {
+		return nil, errors.New("can not create mapped configuration handler without an inner handler")
+	}
+	if mapFunc == nil {
+		return nil, errors.New("can not create mapped configuration handler without a mapping function")
+	}
+	m := &MappedConfigurationHandler[T, U]{
+		inner:        inner,
+		mapFunc:      mapFunc,
+		updateResult: make(chan U, global.DefaultChanBuffSize),
+		isOpen:       true,
+	}
+	go m.mapResults(inner.GetUpdateResultChannel())
+	return m, nil
+}
+
+// GetWasChangedChannel returns a was changed channel of the inner handler.
+func (m *MappedConfigurationHandler[_, _]) GetWasChangedChannel() <-chan error {
+	return m.inner.GetWasChangedChannel()
+}
+
+// Update triggers the configuration update of the inner handler. When the handler is closed it returns
+// an ErrHandlerClosed.
+func (m *MappedConfigurationHandler[_, _]) Update() error {
+	if !m.isOpen {
+		return fmt.Errorf("can't update the configuration. Reason: %w", ErrHandlerClosed)
+	}
+	return m.inner.Update()
+}
+
+// GetUpdateResultChannel returns a read only channel with mapped update results. When the handler is closed it
+// returns a nil channel.
+func (m *MappedConfigurationHandler[_, U]) GetUpdateResultChannel() <-chan U {
+	if m.isOpen {
+		return m.updateResult
+	}
+	return nil
+}
+
+// LastError returns the most recent error observed by the inner handler or nil if none occurred or the inner handler
+// doesn't provide it.
+func (m *MappedConfigurationHandler[_, _]) LastError() error {
+	if inner, ok := m.inner.(interface{ LastError() error }); ok {
+		return inner.LastError()
+	}
+	return nil
+}
+
+// Close triggers closing of the inner handler.
+func (m *MappedConfigurationHandler[_, _]) Close() {
+	if m.isOpen {
+		m.inner.Close()
+		m.isOpen = false
+	}
+}
+
+// mapResults pushes mapped results from an innerResult channel until it is closed. Then it closes its own update
+// result channel.
+func (m *MappedConfigurationHandler[T, _]) mapResults(innerResult <-chan T) {
+	for result := range innerResult {
+		m.updateResult <- m.mapFunc(result)
+	}
+	close(m.updateResult)
+}
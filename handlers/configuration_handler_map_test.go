@@ -0,0 +1,77 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/k-lb/entrypoint-framework/handlers/internal/filesystem"
+)
+
+func (h *HandlersTestSuite) TestMapConfigurationHandler() {
+	h.RunWithMockEnv("when an inner handler sends results, should push mapped results and forward other calls", func(mocks *mocksControl) {
+		configChanged := make(chan struct{}, 10)
+		mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		mocks.watcher.EXPECT().GetNotificationChannel().Times(1).Return(configChanged)
+		count := 0
+		inner, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { count++; return count }, logDiscard, mocks.fs)
+		h.Require().NoError(err)
+		h.Require().NotNil(inner)
+
+		mappedHandler, err := MapConfigurationHandler[int](inner, func(i int) string { return "result " + strconv.Itoa(i) })
+		h.Require().NoError(err)
+		var mapped ConfigurationHandler[string] = mappedHandler
+
+		mocks.watcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Create})
+		mocks.fs.EXPECT().Hardlink("newConfigPath", "newConfigHardlinkPath").Times(1).Return(nil)
+		configChanged <- struct{}{}
+		h.NoError(<-mapped.GetWasChangedChannel())
+		h.NoError(mapped.(*MappedConfigurationHandler[int, string]).LastError())
+
+		h.NoError(mapped.Update())
+		h.Equal("result 1", <-mapped.GetUpdateResultChannel())
+		h.NoError(mapped.Update())
+		h.Equal("result 2", <-mapped.GetUpdateResultChannel())
+
+		mocks.watcher.EXPECT().Stop().Times(1)
+		mocks.fs.EXPECT().DeleteFile("newConfigHardlinkPath").Times(1).Return(nil)
+		resultChannel := mapped.GetUpdateResultChannel()
+		mapped.Close()
+		_, open := <-resultChannel
+		h.False(open)
+		h.Nil(mapped.GetUpdateResultChannel())
+		h.ErrorIs(mapped.Update(), ErrHandlerClosed)
+		close(configChanged)
+		_, open = <-inner.wasChanged
+		h.False(open)
+	})
+	h.Run("when there is no inner handler, should return an error", func() {
+		mapped, err := MapConfigurationHandler[int](nil, strconv.Itoa)
+
+		h.Error(err)
+		h.Nil(mapped)
+	})
+
+	h.Run("when there is no mapping function, should return an error", func() {
+		mapped, err := MapConfigurationHandler[int, string](newFakeConfigurationHandler(), nil)
+
+		h.Error(err)
+		h.Nil(mapped)
+	})
+}
@@ -0,0 +1,113 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/k-lb/entrypoint-framework/handlers/internal/filesystem"
+)
+
+var ErrConfigTampered = errors.New("applied configuration was changed without an update")
+
+// fileState contains file attributes that change when a file is modified.
+type fileState struct {
+	size    int64
+	modTime time.Time
+	mode    fs.FileMode
+}
+
+// dirSnapshot maps file names from a directory to their states.
+type dirSnapshot map[string]fileState
+
+// takeDirSnapshot returns a dirSnapshot of all files from a dir and an error if any occurred.
+func takeDirSnapshot(dir string, fs filesystem.Filesystem) (dirSnapshot, error) {
+	files, err := fs.ListFileNamesInDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not list files in a dir: %s. Reason: %w", dir, err)
+	}
+	snapshot := dirSnapshot{}
+	for _, file := range files {
+		info, err := fs.Stat(path.Join(dir, file))
+		if err != nil {
+			return nil, fmt.Errorf("could not get a status of a file: %s. Reason: %w", file, err)
+		}
+		snapshot[file] = fileState{size: info.Size(), modTime: info.ModTime(), mode: info.Mode()}
+	}
+	return snapshot, nil
+}
+
+// changedFiles returns a sorted list of file names which are present only in one of snapshots or which states differ.
+func (d dirSnapshot) changedFiles(other dirSnapshot) []string {
+	changed := []string{}
+	for file, state := range d {
+		if otherState, ok := other[file]; !ok || state.size != otherState.size || state.mode != otherState.mode ||
+			!state.modTime.Equal(otherState.modTime) {
+			changed = append(changed, file)
+		}
+	}
+	for file := range other {
+		if _, ok := d[file]; !ok {
+			changed = append(changed, file)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
+
+// refreshAppliedSnapshot takes a snapshot of a directory watched for tampering. It should be called after each update
+// so changes made by the update are not reported as tampering.
+func (c *ConfigurationHandlerBase[_]) refreshAppliedSnapshot() {
+	snapshot, err := takeDirSnapshot(c.opts.tamperDir, c.fs)
+	if err != nil {
+		c.log.Warn("could not take a snapshot of an applied configuration", slog.Any(errorKey, err))
+		return
+	}
+	c.appliedSnapshot = snapshot
+}
+
+// checkTampering compares a directory watched for tampering with a snapshot taken after the last update. If they
+// differ it pushes an ErrConfigTampered with names of changed files to tamper channel.
+func (c *ConfigurationHandlerBase[_]) checkTampering(ev *filesystem.WatcherEvent) {
+	if ev == nil { // ignore invalidated events
+		return
+	}
+	var err error
+	if ev.Error != nil {
+		err = fmt.Errorf("error from directory watcher(%s). Reason: %w", c.opts.tamperDir, ev.Error)
+	} else {
+		snapshot, snapshotErr := takeDirSnapshot(c.opts.tamperDir, c.fs)
+		if snapshotErr != nil {
+			err = snapshotErr
+		} else if changed := c.appliedSnapshot.changedFiles(snapshot); len(changed) > 0 {
+			c.appliedSnapshot = snapshot
+			err = fmt.Errorf("%w: %s", ErrConfigTampered, strings.Join(changed, ", "))
+		} else {
+			return
+		}
+	}
+	c.lastErr.record(err)
+	c.tamper <- err
+	c.log.Warn("A tamper event was sent", slog.Any(errorKey, err))
+}
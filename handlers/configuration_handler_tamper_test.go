@@ -0,0 +1,170 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/k-lb/entrypoint-framework/handlers/internal/filesystem"
+)
+
+func (h *HandlersTestSuite) TestDirSnapshotChangedFiles() {
+	start := time.Now()
+	snapshot := dirSnapshot{
+		"same":     {size: 1, modTime: start, mode: 0664},
+		"size":     {size: 1, modTime: start, mode: 0664},
+		"mode":     {size: 1, modTime: start, mode: 0664},
+		"time":     {size: 1, modTime: start, mode: 0664},
+		"only old": {size: 1, modTime: start, mode: 0664},
+	}
+	other := dirSnapshot{
+		"same":     {size: 1, modTime: start, mode: 0664},
+		"size":     {size: 2, modTime: start, mode: 0664},
+		"mode":     {size: 1, modTime: start, mode: 0600},
+		"time":     {size: 1, modTime: start.Add(time.Second), mode: 0664},
+		"only new": {size: 1, modTime: start, mode: 0664},
+	}
+	h.Equal([]string{"mode", "only new", "only old", "size", "time"}, snapshot.changedFiles(other))
+	h.Equal([]string{}, snapshot.changedFiles(snapshot))
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerTamperDetection() {
+	start := time.Now()
+	neverUsedUpdateFunc := func() int { h.Fail("updateFunc called"); return 0 }
+
+	h.RunWithMockEnv("when NewDirWatcher returns an error, should stop a file watcher and return an error", func(mocks *mocksControl) {
+		errDirWatcher := errors.New("dir watcher error")
+		mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
+		mocks.fs.EXPECT().NewDirWatcher("oldConfigDir").Times(1).Return(nil, errDirWatcher)
+		mocks.watcher.EXPECT().Stop().Times(1)
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", neverUsedUpdateFunc, logDiscard, mocks.fs, WithTamperDetection("oldConfigDir"))
+
+		h.Nil(configHandler)
+		h.ErrorIs(err, errDirWatcher)
+	})
+
+	h.RunWithMockEnv("when tamper detection is disabled, should return a nil tamper channel", func(mocks *mocksControl) {
+		configChanged := make(chan struct{})
+		mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		mocks.fs.EXPECT().DeleteFile("newConfigHardlinkPath").Times(1).Return(nil)
+		mocks.watcher.EXPECT().GetNotificationChannel().Times(1).Return(configChanged)
+		mocks.watcher.EXPECT().Stop().Times(1)
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", neverUsedUpdateFunc, logDiscard, mocks.fs)
+		h.Require().NoError(err)
+
+		h.Nil(configHandler.GetTamperChannel())
+		configHandler.Close()
+		close(configChanged)
+		_, open := <-configHandler.wasChanged
+		h.False(open)
+	})
+
+	testCases := [...]struct {
+		name           string
+		updateFirst    bool
+		filesAfter     []string
+		sizeAfter      int64
+		expectedTamper bool
+	}{
+		{name: "when a file in a watched dir is modified directly, should push a tamper event", filesAfter: []string{"a"}, sizeAfter: 2, expectedTamper: true},
+		{name: "when a file is added to a watched dir directly, should push a tamper event", filesAfter: []string{"a", "b"}, sizeAfter: 1, expectedTamper: true},
+		{name: "when a watched dir is notified but nothing changed, shouldn't push a tamper event", filesAfter: []string{"a"}, sizeAfter: 1},
+		{name: "when a watched dir is changed by an update, shouldn't push a tamper event", updateFirst: true, filesAfter: []string{"a", "b"}, sizeAfter: 2},
+	}
+	for _, test := range testCases {
+		test := test
+		h.RunWithMockEnv(test.name, func(mocks *mocksControl) {
+			configChanged := make(chan struct{}, 10)
+			tamperChanged := make(chan struct{}, 10)
+			mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
+			mocks.fs.EXPECT().NewDirWatcher("oldConfigDir").Times(1).Return(mocks.dirWatcher, nil)
+			mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+			mocks.watcher.EXPECT().GetNotificationChannel().Times(1).Return(configChanged)
+			mocks.dirWatcher.EXPECT().GetNotificationChannel().Times(1).Return(tamperChanged)
+			mocks.fs.EXPECT().ListFileNamesInDir("oldConfigDir").Times(1).Return([]string{"a"}, nil)
+			mocks.fs.EXPECT().Stat("oldConfigDir/a").Times(1).Return(fakeFileInfo{size: 1, modTime: start}, nil)
+			// expectSnapshotAfter returns a channel which is closed when a snapshot has been taken.
+			expectSnapshotAfter := func() <-chan struct{} {
+				taken := make(chan struct{})
+				mocks.fs.EXPECT().ListFileNamesInDir("oldConfigDir").Times(1).Return(test.filesAfter, nil)
+				last := mocks.fs.EXPECT().Stat("oldConfigDir/a").Times(1).Return(fakeFileInfo{size: test.sizeAfter, modTime: start}, nil)
+				if len(test.filesAfter) > 1 {
+					last = mocks.fs.EXPECT().Stat("oldConfigDir/b").Times(1).Return(fakeFileInfo{size: 1, modTime: start}, nil)
+				}
+				last.Do(func(string) { close(taken) })
+				return taken
+			}
+			configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", func() int { return 1 }, logDiscard, mocks.fs, WithTamperDetection("oldConfigDir"))
+			h.Require().NoError(err)
+			h.Require().NotNil(configHandler)
+
+			if test.updateFirst {
+				expectSnapshotAfter()
+				h.NoError(configHandler.Update())
+				h.Equal(1, <-configHandler.GetUpdateResultChannel())
+			}
+			taken := expectSnapshotAfter()
+			mocks.dirWatcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Operation: fsnotify.Write})
+			tamperChanged <- struct{}{}
+			if test.expectedTamper {
+				h.ErrorIs(<-configHandler.GetTamperChannel(), ErrConfigTampered)
+			}
+			<-taken // a tamper event notified after Close would be dropped
+
+			mocks.watcher.EXPECT().Stop().Times(1)
+			mocks.dirWatcher.EXPECT().Stop().Times(1)
+			mocks.fs.EXPECT().DeleteFile("newConfigHardlinkPath").Times(1).Return(nil)
+			configHandler.Close()
+			close(tamperChanged)
+			close(configChanged)
+			_, open := <-configHandler.tamper
+			h.False(open, "should close a tamper channel without sending other events")
+			_, open = <-configHandler.wasChanged
+			h.False(open)
+		})
+	}
+
+	h.RunWithMockEnv("when a dir watcher returns an error, should push it to a tamper channel", func(mocks *mocksControl) {
+		configChanged := make(chan struct{}, 10)
+		tamperChanged := make(chan struct{}, 10)
+		errWatcher := errors.New("watcher error")
+		mocks.fs.EXPECT().NewFileWatcher("newConfigPath", fsnotify.Create|fsnotify.Remove|fsnotify.Rename).Times(1).Return(mocks.watcher, nil)
+		mocks.fs.EXPECT().NewDirWatcher("oldConfigDir").Times(1).Return(mocks.dirWatcher, nil)
+		mocks.fs.EXPECT().Stat("newConfigPath").Times(1).Return(statResult(false))
+		mocks.fs.EXPECT().ListFileNamesInDir("oldConfigDir").Times(1).Return([]string{}, nil)
+		mocks.watcher.EXPECT().GetNotificationChannel().Times(1).Return(configChanged)
+		mocks.dirWatcher.EXPECT().GetNotificationChannel().Times(1).Return(tamperChanged)
+		configHandler, err := newConfigurationHandlerBase("newConfigPath", "newConfigHardlinkPath", neverUsedUpdateFunc, logDiscard, mocks.fs, WithTamperDetection("oldConfigDir"))
+		h.Require().NoError(err)
+
+		mocks.dirWatcher.EXPECT().GetEvent().Times(1).Return(&filesystem.WatcherEvent{Error: errWatcher})
+		tamperChanged <- struct{}{}
+		h.ErrorIs(<-configHandler.GetTamperChannel(), errWatcher)
+
+		mocks.watcher.EXPECT().Stop().Times(1)
+		mocks.dirWatcher.EXPECT().Stop().Times(1)
+		mocks.fs.EXPECT().DeleteFile("newConfigHardlinkPath").Times(1).Return(nil)
+		configHandler.Close()
+		close(tamperChanged)
+		close(configChanged)
+		_, open := <-configHandler.tamper
+		h.False(open)
+	})
+}
@@ -17,70 +17,479 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	iofs "io/fs"
+	"log/slog"
 	"path"
+	"slices"
+	"strings"
 
 	"github.com/k-lb/entrypoint-framework/handlers/internal/filesystem"
+	"github.com/k-lb/entrypoint-framework/handlers/internal/global"
 )
 
-// updateSingleFileConfig returns a function that copies a file from newConfigHardlinkPath to oldConfigFile.
-func updateSingleFileConfig(newConfigHardlinkPath, oldConfigFile string, fs filesystem.Filesystem) func() error {
+// updateSingleFileConfig returns a function that copies a file from newConfigHardlinkPath to oldConfigFile if their
+// contents or modes are different or oldConfigFile doesn't exist. It returns a SingleFileUpdateResult.
+func updateSingleFileConfig(newConfigHardlinkPath, oldConfigFile string, fs filesystem.Filesystem) func() SingleFileUpdateResult {
+	return func() SingleFileUpdateResult {
+		if _, err := fs.Stat(oldConfigFile); err == nil {
+			different, err := fs.AreFilesDifferent(newConfigHardlinkPath, oldConfigFile)
+			if err != nil {
+				return SingleFileUpdateResult{Err: fmt.Errorf("could not check if files are different. Reason: %w", err)}
+			} else if !different {
+				return SingleFileUpdateResult{}
+			}
+		} else if !errors.Is(err, iofs.ErrNotExist) {
+			return SingleFileUpdateResult{Err: fmt.Errorf("could not check if a file %s exists. Reason: %w", oldConfigFile, err)}
+		}
+		if err := fs.Copy(newConfigHardlinkPath, oldConfigFile); err != nil {
+			return SingleFileUpdateResult{Err: err}
+		}
+		return SingleFileUpdateResult{Changed: true}
+	}
+}
+
+// SingleFileUpdateResult tells if a single file configuration was changed by an update and contains an error if it was
+// observed. Changed is false when an applied configuration already had the same content and mode.
+type SingleFileUpdateResult struct {
+	Changed bool
+	Err     error
+}
+
+// updateGzippedSingleFileConfig returns a function that decompresses newConfigHardlinkPath to oldConfigFile atomically.
+// It returns an error if the new configuration is not a valid gzip file or it can't be decompressed.
+func updateGzippedSingleFileConfig(newConfigHardlinkPath, oldConfigFile string, fs filesystem.Filesystem) func() error {
 	return func() error {
-		return fs.Copy(newConfigHardlinkPath, oldConfigFile)
+		if err := fs.Decompress(newConfigHardlinkPath, oldConfigFile); err != nil {
+			return fmt.Errorf("could not decompress a file %s to %s. Reason: %w", newConfigHardlinkPath, oldConfigFile, err)
+		}
+		return nil
 	}
 }
 
-// updateTarredConfig returns a function that untars newConfigHardlinkPath into newConfigDir. Then it updates
-// oldConfigDir to resemble newConfigDir. If a file hasn't changed it is not moved. It returns an UpdateResult.
-func updateTarredConfig(newConfigHardlinkPath, newConfigDir, oldConfigDir string, fs filesystem.Filesystem) func() UpdateResult {
-	return func() UpdateResult {
+// updateTarredConfig returns a function that extracts newConfigHardlinkPath into newConfigDir with an archiver and
+// changes modes of extracted files matching rules. Placeholders in extracted files are substituted by an interpolation
+// if it isn't nil. Then it updates oldConfigDir to resemble newConfigDir. If a file hasn't changed it is not moved. The
+// update stops between operations on files when ctx is done. It returns an UpdateResult.
+func updateTarredConfig(newConfigHardlinkPath, newConfigDir, oldConfigDir string, archiver Archiver, rules []PermissionRule, interpolation *envInterpolation, gate *schemaGate, fs filesystem.Filesystem) func(context.Context) UpdateResult {
+	return func(ctx context.Context) UpdateResult {
 		if err := fs.ClearDir(newConfigDir); err != nil {
 			return UpdateResult{Err: fmt.Errorf("could not clear a new config directory %s. Reason: %w", newConfigDir, err)}
-		} else if err := fs.Extract(newConfigHardlinkPath, newConfigDir); err != nil {
+		} else if err := archiver.Extract(newConfigHardlinkPath, newConfigDir); err != nil {
 			return UpdateResult{Err: fmt.Errorf("could not extract a file %s to a directory %s. Reason: %w", newConfigHardlinkPath, newConfigDir, err)}
-		}
-		filePresenceMap, err := createFilePresenceMap(oldConfigDir, newConfigDir, fs)
-		if err != nil {
+		} else if err := applyPermissionRules(newConfigDir, rules, fs); err != nil {
+			return UpdateResult{Err: err}
+		} else if err := interpolation.apply(newConfigDir, fs); err != nil {
+			return UpdateResult{Err: err}
+		} else if err := gate.check(newConfigDir); err != nil {
 			return UpdateResult{Err: err}
 		}
-		changedFiles := map[string]Modification{}
-		for configFile, flag := range filePresenceMap {
-			newConfigFilePath := path.Join(newConfigDir, configFile)
-			oldConfigFilePath := path.Join(oldConfigDir, configFile)
-			switch flag {
-			case newConfigDirFlag:
-				if err := fs.MoveFile(newConfigFilePath, oldConfigFilePath); err != nil {
-					return UpdateResult{changedFiles, fmt.Errorf("could not move a file. Result %w", err)}
-				}
-				changedFiles[configFile] = Created
-			case newConfigDirFlag | oldConfigDirFlag:
-				different, err := fs.AreFilesDifferent(newConfigFilePath, oldConfigFilePath)
-				if err != nil {
-					return UpdateResult{changedFiles, fmt.Errorf("could not check if files are different. Result %w", err)}
-				}
-				if different {
-					if err := fs.MoveFile(newConfigFilePath, oldConfigFilePath); err != nil {
-						return UpdateResult{changedFiles, fmt.Errorf("could not move a file . Result %w", err)}
-					}
-					changedFiles[configFile] = Modified
+		return applyConfigDir(ctx, newConfigDir, oldConfigDir, fs)
+	}
+}
+
+// ErrSchemaVersionMismatch is returned (wrapped) in an UpdateResult when a schema version of a new configuration is
+// outside of a range set by WithSchemaGate.
+var ErrSchemaVersionMismatch = errors.New("schema version of a configuration is not supported")
+
+// schemaGate rejects configurations with a schema version outside of [min, max].
+type schemaGate struct {
+	extract  func(dir string) (int, error)
+	min, max int
+}
+
+// check returns an error if a version can't be extracted from a dir or it is outside of a supported range. A nil gate
+// accepts every configuration.
+func (g *schemaGate) check(dir string) error {
+	if g == nil {
+		return nil
+	}
+	version, err := g.extract(dir)
+	if err != nil {
+		return fmt.Errorf("could not extract a schema version from a directory %s. Reason: %w", dir, err)
+	}
+	if version < g.min || version > g.max {
+		return fmt.Errorf("a schema version %d is outside of a supported range [%d, %d]. Reason: %w", version, g.min, g.max, ErrSchemaVersionMismatch)
+	}
+	return nil
+}
+
+// updateLayeredTarredConfig returns a function that extracts all layerHardlinks in order into newConfigDir with
+// an archiver, so files from later layers replace files from earlier ones. Then it updates oldConfigDir to resemble
+// newConfigDir. If a file hasn't changed it is not moved. It returns an UpdateResult.
+func updateLayeredTarredConfig(layerHardlinks []string, newConfigDir, oldConfigDir string, archiver Archiver, fs filesystem.Filesystem) func() UpdateResult {
+	return func() UpdateResult {
+		if err := fs.ClearDir(newConfigDir); err != nil {
+			return UpdateResult{Err: fmt.Errorf("could not clear a new config directory %s. Reason: %w", newConfigDir, err)}
+		}
+		for _, layer := range layerHardlinks {
+			if err := archiver.Extract(layer, newConfigDir); err != nil {
+				return UpdateResult{Err: fmt.Errorf("could not extract a layer %s to a directory %s. Reason: %w", layer, newConfigDir, err)}
+			}
+		}
+		return applyConfigDir(context.Background(), newConfigDir, oldConfigDir, fs)
+	}
+}
+
+// applyPermissionRules changes a mode of every file from a dir to a mode of the first rule matching its name.
+func applyPermissionRules(dir string, rules []PermissionRule, fs filesystem.Filesystem) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	files, err := fs.ListFileNamesInDir(dir)
+	if err != nil {
+		return fmt.Errorf("could not list files in a dir: %s. Reason: %w", dir, err)
+	}
+	for _, file := range files {
+		rule, ok := matchPermissionRule(file, rules)
+		if !ok {
+			continue
+		}
+		if err := fs.Chmod(path.Join(dir, file), rule.Mode); err != nil {
+			return fmt.Errorf("could not change a mode of a file %s to %s. Reason: %w", file, rule.Mode, err)
+		}
+	}
+	return nil
+}
+
+// matchPermissionRule returns the first rule with a glob matching a name of a file. A glob without a slash is matched
+// against a base name of the file.
+func matchPermissionRule(file string, rules []PermissionRule) (PermissionRule, bool) {
+	for _, rule := range rules {
+		name := file
+		if !strings.Contains(rule.Glob, "/") {
+			name = path.Base(file)
+		}
+		if matched, _ := path.Match(rule.Glob, name); matched {
+			return rule, true
+		}
+	}
+	return PermissionRule{}, false
+}
+
+// validatePermissionRules returns an error if a glob of any rule is malformed.
+func validatePermissionRules(rules []PermissionRule) error {
+	for _, rule := range rules {
+		if _, err := path.Match(rule.Glob, ""); err != nil {
+			return fmt.Errorf("invalid glob %q of a permission rule. Reason: %w", rule.Glob, err)
+		}
+	}
+	return nil
+}
+
+// ErrUpdateCancelled is returned in an UpdateResult when an update was cancelled by a newer configuration. Files
+// reported as changed were applied completely, the rest of files weren't touched.
+var ErrUpdateCancelled = errors.New("update was cancelled")
+
+// applyConfigDir updates oldConfigDir to resemble newConfigDir. If a file hasn't changed it is not moved. ctx is checked
+// before an operation on every file, so when it is done, the update stops without leaving a partially changed file. It
+// returns an UpdateResult.
+func applyConfigDir(ctx context.Context, newConfigDir, oldConfigDir string, fs filesystem.Filesystem) UpdateResult {
+	filePresenceMap, err := createFilePresenceMap(oldConfigDir, newConfigDir, fs)
+	if err != nil {
+		return UpdateResult{Err: err}
+	}
+	changedFiles := map[string]Modification{}
+	for configFile, flag := range filePresenceMap {
+		if err := ctx.Err(); err != nil {
+			return UpdateResult{ChangedFiles: changedFiles, Err: fmt.Errorf("could not update all files. Reason: %w", errors.Join(ErrUpdateCancelled, err))}
+		}
+		newConfigFilePath := path.Join(newConfigDir, configFile)
+		oldConfigFilePath := path.Join(oldConfigDir, configFile)
+		switch flag {
+		case newConfigDirFlag:
+			if dir := path.Dir(configFile); dir != "." {
+				if err := fs.CreateDir(path.Join(oldConfigDir, dir)); err != nil {
+					return UpdateResult{ChangedFiles: changedFiles, Err: fmt.Errorf("could not create a directory. Result %w", err)}
 				}
-			case oldConfigDirFlag:
-				if err := fs.DeleteFile(oldConfigFilePath); err != nil {
-					return UpdateResult{changedFiles, fmt.Errorf("could not delete a file. Result %w", err)}
+			}
+			if err := fs.MoveFile(newConfigFilePath, oldConfigFilePath); err != nil {
+				return UpdateResult{ChangedFiles: changedFiles, Err: fmt.Errorf("could not move a file. Result %w", err)}
+			}
+			changedFiles[configFile] = Created
+		case newConfigDirFlag | oldConfigDirFlag:
+			different, err := fs.AreFilesDifferent(newConfigFilePath, oldConfigFilePath)
+			if err != nil {
+				return UpdateResult{ChangedFiles: changedFiles, Err: fmt.Errorf("could not check if files are different. Result %w", err)}
+			}
+			if different {
+				if err := fs.MoveFile(newConfigFilePath, oldConfigFilePath); err != nil {
+					return UpdateResult{ChangedFiles: changedFiles, Err: fmt.Errorf("could not move a file . Result %w", err)}
 				}
-				changedFiles[configFile] = Deleted
+				changedFiles[configFile] = Modified
+			}
+		case oldConfigDirFlag:
+			if err := fs.DeleteFile(oldConfigFilePath); err != nil {
+				return UpdateResult{ChangedFiles: changedFiles, Err: fmt.Errorf("could not delete a file. Result %w", err)}
 			}
+			changedFiles[configFile] = Deleted
 		}
-		return UpdateResult{changedFiles, nil}
 	}
+	return UpdateResult{ChangedFiles: changedFiles}
+}
+
+// pruneEmptyDirs returns a function that runs an update of oldConfigDir and then deletes directories of oldConfigDir
+// left empty, so deleted files don't leave orphan directories behind. Nothing is pruned if no file was deleted.
+func pruneEmptyDirs(update func(context.Context) UpdateResult, oldConfigDir string, fs filesystem.Filesystem) func(context.Context) UpdateResult {
+	return func(ctx context.Context) UpdateResult {
+		result := update(ctx)
+		if len(result.Deleted()) == 0 {
+			return result
+		}
+		if err := fs.DeleteEmptyDirs(oldConfigDir); err != nil {
+			result.Err = errors.Join(result.Err, fmt.Errorf("could not prune empty directories of %s. Reason: %w", oldConfigDir, err))
+		}
+		return result
+	}
+}
+
+// detectRenames returns a function that runs an update of oldConfigDir and reports every deleted file paired with
+// a created file of an identical content as Renamed instead. Hashes of all files of oldConfigDir are taken before
+// the update, as deleted files can't be read afterwards. If they can't be taken, the update result is not changed.
+func detectRenames(update func(context.Context) UpdateResult, oldConfigDir string, fs filesystem.Filesystem) func(context.Context) UpdateResult {
+	return func(ctx context.Context) UpdateResult {
+		oldHashes, hashErr := hashFilesInDir(oldConfigDir, fs)
+		result := update(ctx)
+		if hashErr != nil || result.Err != nil {
+			return result
+		}
+		deleted := map[string][]string{} // names of deleted files by hashes of their contents
+		for _, file := range result.Deleted() {
+			if hash, ok := oldHashes[file]; ok {
+				deleted[hash] = append(deleted[hash], file)
+			}
+		}
+		for _, file := range result.Created() {
+			hash, err := fs.HashFile(path.Join(oldConfigDir, file))
+			if err != nil || len(deleted[string(hash)]) == 0 {
+				continue
+			}
+			from := deleted[string(hash)][0]
+			deleted[string(hash)] = deleted[string(hash)][1:]
+			delete(result.ChangedFiles, from)
+			delete(result.ChangedFiles, file)
+			result.Renames = append(result.Renames, Renamed{From: from, To: file})
+		}
+		return result
+	}
+}
+
+// preservedDirLayout is a time layout of names of directories with preserved failed extractions.
+const preservedDirLayout = "20060102T150405.000000000Z"
+
+// preserveFailedExtraction returns a function that runs an update and, when it fails, copies files of newConfigDir to
+// a subdirectory of dir named after a time of the failure, so a failing input can be inspected after the next update
+// clears newConfigDir. A cancelled update isn't preserved, as its input wasn't faulty. A failed copy is only logged,
+// so a result of the update is never changed.
+func preserveFailedExtraction(update func(context.Context) UpdateResult, newConfigDir, dir string, clock global.Clock, log *slog.Logger, fs filesystem.Filesystem) func(context.Context) UpdateResult {
+	return func(ctx context.Context) UpdateResult {
+		result := update(ctx)
+		if result.Err == nil || errors.Is(result.Err, ErrUpdateCancelled) {
+			return result
+		}
+		preserved := path.Join(dir, clock.Now().UTC().Format(preservedDirLayout))
+		if err := copyDir(newConfigDir, preserved, fs); err != nil {
+			log.Warn("could not preserve a failed extraction", slog.String("dir", preserved), slog.Any(errorKey, err))
+		} else {
+			log.Info("a failed extraction was preserved", slog.String("dir", preserved))
+		}
+		return result
+	}
+}
+
+// copyDir copies all files of a fromDir tree to a toDir, which is created with missing subdirectories.
+func copyDir(fromDir, toDir string, fs filesystem.Filesystem) error {
+	files, err := fs.ListFileNamesInDir(fromDir)
+	if err != nil {
+		return fmt.Errorf("could not list files in a dir: %s. Reason: %w", fromDir, err)
+	} else if err := fs.CreateDir(toDir); err != nil {
+		return fmt.Errorf("could not create a dir: %s. Reason: %w", toDir, err)
+	}
+	for _, file := range files {
+		to := path.Join(toDir, file)
+		if err := fs.CreateDir(path.Dir(to)); err != nil {
+			return fmt.Errorf("could not create a dir: %s. Reason: %w", path.Dir(to), err)
+		} else if err := fs.Copy(path.Join(fromDir, file), to); err != nil {
+			return fmt.Errorf("could not copy a file %s to %s. Reason: %w", file, to, err)
+		}
+	}
+	return nil
+}
+
+// hashFilesInDir returns hashes of contents of all files from a dir by their names.
+func hashFilesInDir(dir string, fs filesystem.Filesystem) (map[string]string, error) {
+	files, err := fs.ListFileNamesInDir(dir)
+	if errors.Is(err, iofs.ErrNotExist) {
+		return map[string]string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]string, len(files))
+	for _, file := range files {
+		hash, err := fs.HashFile(path.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+		hashes[file] = string(hash)
+	}
+	return hashes, nil
+}
+
+// updateJSONPatchedConfig returns a function that applies a JSON Patch from patchHardlinkPath to targetFile and writes
+// the patched targetFile atomically with its mode kept. If any operation fails, targetFile is not changed. It returns
+// a JSONPatchUpdateResult.
+func updateJSONPatchedConfig(patchHardlinkPath, targetFile string, fs filesystem.Filesystem) func() JSONPatchUpdateResult {
+	return func() JSONPatchUpdateResult {
+		patch, err := fs.ReadFile(patchHardlinkPath)
+		if err != nil {
+			return JSONPatchUpdateResult{Err: fmt.Errorf("could not read a patch %s. Reason: %w", patchHardlinkPath, err)}
+		}
+		info, err := fs.Stat(targetFile)
+		if err != nil {
+			return JSONPatchUpdateResult{Err: fmt.Errorf("could not check a target file %s. Reason: %w", targetFile, err)}
+		}
+		document, err := fs.ReadFile(targetFile)
+		if err != nil {
+			return JSONPatchUpdateResult{Err: fmt.Errorf("could not read a target file %s. Reason: %w", targetFile, err)}
+		}
+		patched, paths, err := applyJSONPatch(document, patch)
+		if err != nil {
+			return JSONPatchUpdateResult{Err: err}
+		}
+		content, err := json.MarshalIndent(patched, "", "  ")
+		if err != nil {
+			return JSONPatchUpdateResult{Err: fmt.Errorf("could not encode a patched document. Reason: %w", err)}
+		}
+		if err := fs.WriteFileAtomic(targetFile, append(content, '\n'), info.Mode().Perm()); err != nil {
+			return JSONPatchUpdateResult{Err: fmt.Errorf("could not write a target file %s. Reason: %w", targetFile, err)}
+		}
+		return JSONPatchUpdateResult{Paths: paths}
+	}
+}
+
+// JSONPatchUpdateResult contains paths of operations of a JSON Patch which changed a target file, in order of
+// the patch, and an error if it was observed. Paths of test operations are not listed. Paths are empty on an error, as
+// the target file is not changed then.
+type JSONPatchUpdateResult struct {
+	Paths []string
+	Err   error
+}
+
+// updatePipeline returns a function that runs steps in order. The first step gets input and every next step gets
+// an output of a previous one. It stops at the first failing step and returns a PipelineResult with its error,
+// otherwise a PipelineResult with an output of the last step.
+func updatePipeline[T any](input any, steps []func(prev any) (any, error)) func() PipelineResult[T] {
+	return func() PipelineResult[T] {
+		value := input
+		for i, step := range steps {
+			var err error
+			if value, err = step(value); err != nil {
+				return PipelineResult[T]{Err: fmt.Errorf("step %d of a pipeline failed. Reason: %w", i, err)}
+			}
+		}
+		if value == nil {
+			return PipelineResult[T]{}
+		}
+		result, ok := value.(T)
+		if !ok {
+			return PipelineResult[T]{Err: fmt.Errorf("the last step of a pipeline returned %T instead of %T", value, result)}
+		}
+		return PipelineResult[T]{Value: result}
+	}
+}
+
+// PipelineResult contains a value returned by the last step of a pipeline or an error of the first step that failed.
+type PipelineResult[T any] struct {
+	Value T
+	Err   error
 }
 
 // UpdateResult contains a map of file names with modification that was made to them and an error if it was observed.
+// With rename detection files which were renamed are not in a map of changed files but in Renames.
 type UpdateResult struct {
 	ChangedFiles map[string]Modification
+	Renames      []Renamed
 	Err          error
 }
 
+// Renamed is a file which was deleted From one name and created with an identical content To another.
+type Renamed struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Created returns a sorted list of file names that were created.
+func (u UpdateResult) Created() []string { return u.filesWith(Created) }
+
+// Modified returns a sorted list of file names that were modified.
+func (u UpdateResult) Modified() []string { return u.filesWith(Modified) }
+
+// Deleted returns a sorted list of file names that were deleted.
+func (u UpdateResult) Deleted() []string { return u.filesWith(Deleted) }
+
+// filesWith returns a sorted list of file names with a given modification. It is empty if no file matches.
+func (u UpdateResult) filesWith(modification Modification) []string {
+	files := []string{}
+	for file, m := range u.ChangedFiles {
+		if m == modification {
+			files = append(files, file)
+		}
+	}
+	slices.Sort(files)
+	return files
+}
+
+// IsDestructive returns true if any file was deleted, modified or renamed, so an update changed an existing
+// configuration instead of only adding to it.
+func (u UpdateResult) IsDestructive() bool {
+	if len(u.Renames) > 0 {
+		return true
+	}
+	for _, m := range u.ChangedFiles {
+		if m == Deleted || m == Modified {
+			return true
+		}
+	}
+	return false
+}
+
+// Classify returns a ChangeClass of all changed files. It doesn't take an error into account.
+func (u UpdateResult) Classify() ChangeClass {
+	switch {
+	case u.IsDestructive():
+		return Destructive
+	case len(u.ChangedFiles) > 0:
+		return Additive
+	}
+	return NoChange
+}
+
+// ChangeClass specifies if an update changed an existing configuration. It can be used to require an approval of
+// destructive updates.
+type ChangeClass int
+
+const (
+	NoChange    ChangeClass = iota // no file was changed
+	Additive                       // files were only created
+	Destructive                    // at least one file was deleted, modified or renamed
+)
+
+// ToString returns string name of a change class.
+func (c ChangeClass) ToString() string {
+	switch c {
+	case NoChange:
+		return "no change"
+	case Additive:
+		return "additive"
+	case Destructive:
+		return "destructive"
+	}
+	return "invalid"
+}
+
 // Modification specifies type of modification made to a file while updating.
 type Modification int
 
@@ -90,13 +499,29 @@ const (
 	Created
 )
 
+// listAppliedFiles returns a sorted list of names of files from an appliedDir.
+func listAppliedFiles(appliedDir string, fs filesystem.Filesystem) ([]string, error) {
+	files, err := fs.ListFileNamesInDir(appliedDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not list files in a dir: %s. Reason: %w", appliedDir, err)
+	}
+	slices.Sort(files)
+	return files, nil
+}
+
 // createFilePresenceMap creates a map of file's names from both oldConfigDir and newConfigDir with a presence in
-// old/new ConfigDir flag.
+// old/new ConfigDir flag. A missing oldConfigDir is created and treated as empty.
 func createFilePresenceMap(oldConfigDir, newConfigDir string, fs filesystem.Filesystem) (filePresenceMap, error) {
 	result := filePresenceMap{}
-	if err := result.setFlag(oldConfigDir, oldConfigDirFlag, fs); err != nil {
+	if err := result.setFlag(oldConfigDir, oldConfigDirFlag, fs); errors.Is(err, iofs.ErrNotExist) {
+		// on the first run there is no applied configuration yet, so all files are created in a new oldConfigDir.
+		if err := fs.CreateDir(oldConfigDir); err != nil {
+			return filePresenceMap{}, fmt.Errorf("could not create a dir: %s. Result %w", oldConfigDir, err)
+		}
+	} else if err != nil {
 		return filePresenceMap{}, err
-	} else if err := result.setFlag(newConfigDir, newConfigDirFlag, fs); err != nil {
+	}
+	if err := result.setFlag(newConfigDir, newConfigDirFlag, fs); err != nil {
 		return filePresenceMap{}, err
 	}
 	return result, nil
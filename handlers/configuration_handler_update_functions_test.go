@@ -17,24 +17,85 @@
 package handlers
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io/fs"
 	"path"
+	"time"
+
+	m "go.uber.org/mock/gomock"
 )
 
 func (h *HandlersTestSuite) TestUpdateSingleFileConfig() {
-	h.RunWithMockEnv("when MoveFile returns an error, it returns an expected error", func(mocks *mocksControl) {
+	h.RunWithMockEnv("when Copy returns an error, it returns an expected error", func(mocks *mocksControl) {
 		errMoveFile := errors.New("move file error")
+		mocks.fs.EXPECT().Stat("oldConfigFile").Times(1).Return(statResult(false))
 		mocks.fs.EXPECT().Copy("newConfigHardlinkPath", "oldConfigFile").Times(1).Return(errMoveFile)
 		updateResult := updateSingleFileConfig("newConfigHardlinkPath", "oldConfigFile", mocks.fs)()
 
-		h.Equal(errMoveFile, updateResult)
+		h.Equal(SingleFileUpdateResult{Err: errMoveFile}, updateResult)
 	})
 
-	h.RunWithMockEnv("when MoveFile returns no error, it returns no error", func(mocks *mocksControl) {
+	h.RunWithMockEnv("when an old config doesn't exist, it copies a new config and returns a changed result", func(mocks *mocksControl) {
+		mocks.fs.EXPECT().Stat("oldConfigFile").Times(1).Return(statResult(false))
 		mocks.fs.EXPECT().Copy("newConfigHardlinkPath", "oldConfigFile").Times(1).Return(nil)
 		updateResult := updateSingleFileConfig("newConfigHardlinkPath", "oldConfigFile", mocks.fs)()
 
-		h.Nil(updateResult)
+		h.Equal(SingleFileUpdateResult{Changed: true}, updateResult)
+	})
+
+	h.RunWithMockEnv("when configs are different, it copies a new config and returns a changed result", func(mocks *mocksControl) {
+		mocks.fs.EXPECT().Stat("oldConfigFile").Times(1).Return(statResult(true))
+		mocks.fs.EXPECT().AreFilesDifferent("newConfigHardlinkPath", "oldConfigFile").Times(1).Return(true, nil)
+		mocks.fs.EXPECT().Copy("newConfigHardlinkPath", "oldConfigFile").Times(1).Return(nil)
+		updateResult := updateSingleFileConfig("newConfigHardlinkPath", "oldConfigFile", mocks.fs)()
+
+		h.Equal(SingleFileUpdateResult{Changed: true}, updateResult)
+	})
+
+	h.RunWithMockEnv("when configs are the same, it doesn't copy a new config and returns an unchanged result", func(mocks *mocksControl) {
+		mocks.fs.EXPECT().Stat("oldConfigFile").Times(1).Return(statResult(true))
+		mocks.fs.EXPECT().AreFilesDifferent("newConfigHardlinkPath", "oldConfigFile").Times(1).Return(false, nil)
+		updateResult := updateSingleFileConfig("newConfigHardlinkPath", "oldConfigFile", mocks.fs)()
+
+		h.Equal(SingleFileUpdateResult{}, updateResult)
+	})
+
+	h.RunWithMockEnv("when AreFilesDifferent returns an error, it doesn't copy a new config and returns an error", func(mocks *mocksControl) {
+		errDiff := errors.New("diff error")
+		mocks.fs.EXPECT().Stat("oldConfigFile").Times(1).Return(statResult(true))
+		mocks.fs.EXPECT().AreFilesDifferent("newConfigHardlinkPath", "oldConfigFile").Times(1).Return(false, errDiff)
+		updateResult := updateSingleFileConfig("newConfigHardlinkPath", "oldConfigFile", mocks.fs)()
+
+		h.ErrorIs(updateResult.Err, errDiff)
+		h.False(updateResult.Changed)
+	})
+
+	h.RunWithMockEnv("when Stat of an old config returns an error, it doesn't copy a new config and returns an error", func(mocks *mocksControl) {
+		errStat := errors.New("stat error")
+		mocks.fs.EXPECT().Stat("oldConfigFile").Times(1).Return(nil, errStat)
+		updateResult := updateSingleFileConfig("newConfigHardlinkPath", "oldConfigFile", mocks.fs)()
+
+		h.ErrorIs(updateResult.Err, errStat)
+		h.False(updateResult.Changed)
+	})
+}
+
+func (h *HandlersTestSuite) TestUpdateGzippedSingleFileConfig() {
+	h.RunWithMockEnv("when Decompress returns an error, it returns an expected error", func(mocks *mocksControl) {
+		errDecompress := errors.New("decompress error")
+		mocks.fs.EXPECT().Decompress("newConfigHardlinkPath", "oldConfigFile").Times(1).Return(errDecompress)
+		updateResult := updateGzippedSingleFileConfig("newConfigHardlinkPath", "oldConfigFile", mocks.fs)()
+
+		h.ErrorIs(updateResult, errDecompress)
+	})
+
+	h.RunWithMockEnv("when Decompress returns no error, it returns no error", func(mocks *mocksControl) {
+		mocks.fs.EXPECT().Decompress("newConfigHardlinkPath", "oldConfigFile").Times(1).Return(nil)
+		updateResult := updateGzippedSingleFileConfig("newConfigHardlinkPath", "oldConfigFile", mocks.fs)()
+
+		h.NoError(updateResult)
 	})
 }
 
@@ -48,6 +109,7 @@ func (h *HandlersTestSuite) TestUpdateTarredConfig() {
 	testCases := [...]struct {
 		name                                                  string
 		errClearDir, errExtract, errListOldDir, errListNewDir error
+		errCreateOldDir                                       error
 		oldConfigFiles                                        []string
 		newConfigFiles                                        []string
 		events                                                []event
@@ -57,6 +119,15 @@ func (h *HandlersTestSuite) TestUpdateTarredConfig() {
 		{name: "when Extract returns an error", errExtract: errors.New("extract error")},
 		{name: "when ListFileNamesInDir for oldConfigDir returns an error", errListOldDir: errors.New("list old dir error")},
 		{name: "when ListFileNamesInDir for newConfigDir returns an error", errListNewDir: errors.New("list new dir error")},
+		{name: "when oldConfigDir doesn't exist and CreateDir returns an error", errListOldDir: fs.ErrNotExist, errCreateOldDir: errors.New("create dir error")},
+		{name: "when oldConfigDir doesn't exist, it is created and all files are created",
+			errListOldDir:  fmt.Errorf("wrapped: %w", fs.ErrNotExist),
+			newConfigFiles: []string{"new", "other"},
+			events:         []event{{configFile: "new", move: true}, {configFile: "other", move: true}},
+			expectedChangedFiles: map[string]Modification{
+				"new":   Created,
+				"other": Created,
+			}},
 		{name: "when ListFileNamesInDir returns empty maps", expectedChangedFiles: map[string]Modification{}},
 		{name: "when MoveFile returns an error",
 			newConfigFiles:       []string{"new"},
@@ -112,7 +183,11 @@ func (h *HandlersTestSuite) TestUpdateTarredConfig() {
 				if mocks.fs.EXPECT().Extract("newConfigHardlinkPath", "newConfigDir").Times(1).Return(test.errExtract); test.errExtract != nil {
 					return test.errExtract
 				}
-				if mocks.fs.EXPECT().ListFileNamesInDir("oldConfigDir").Times(1).Return(test.oldConfigFiles, test.errListOldDir); test.errListOldDir != nil {
+				if mocks.fs.EXPECT().ListFileNamesInDir("oldConfigDir").Times(1).Return(test.oldConfigFiles, test.errListOldDir); errors.Is(test.errListOldDir, fs.ErrNotExist) {
+					if mocks.fs.EXPECT().CreateDir("oldConfigDir").Times(1).Return(test.errCreateOldDir); test.errCreateOldDir != nil {
+						return test.errCreateOldDir
+					}
+				} else if test.errListOldDir != nil {
 					return test.errListOldDir
 				}
 				if mocks.fs.EXPECT().ListFileNamesInDir("newConfigDir").Times(1).Return(test.newConfigFiles, test.errListNewDir); test.errListNewDir != nil {
@@ -134,12 +209,395 @@ func (h *HandlersTestSuite) TestUpdateTarredConfig() {
 				return nil
 			}()
 
-			updateResult := updateTarredConfig("newConfigHardlinkPath", "newConfigDir", "oldConfigDir", mocks.fs)()
+			updateResult := updateTarredConfig("newConfigHardlinkPath", "newConfigDir", "oldConfigDir", TarArchiver{fs: mocks.fs}, nil, nil, nil, mocks.fs)(context.Background())
 
 			h.Equal(test.expectedChangedFiles, updateResult.ChangedFiles)
 			h.ErrorIs(updateResult.Err, expectedError)
 		})
 	}
+
+	h.RunWithMockEnv("when ctx is cancelled during an update, it completes a current file and returns an ErrUpdateCancelled", func(mocks *mocksControl) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		mocks.fs.EXPECT().ClearDir("newConfigDir").Times(1).Return(nil)
+		mocks.fs.EXPECT().Extract("newConfigHardlinkPath", "newConfigDir").Times(1).Return(nil)
+		mocks.fs.EXPECT().ListFileNamesInDir("oldConfigDir").Times(1).Return([]string{}, nil)
+		mocks.fs.EXPECT().ListFileNamesInDir("newConfigDir").Times(1).Return([]string{"a", "b", "c"}, nil)
+		var moved string
+		mocks.fs.EXPECT().MoveFile(m.Any(), m.Any()).Times(1).DoAndReturn(func(src, _ string) error {
+			moved = path.Base(src)
+			cancel()
+			return nil
+		})
+
+		updateResult := updateTarredConfig("newConfigHardlinkPath", "newConfigDir", "oldConfigDir", TarArchiver{fs: mocks.fs}, nil, nil, nil, mocks.fs)(ctx)
+
+		h.ErrorIs(updateResult.Err, ErrUpdateCancelled)
+		h.ErrorIs(updateResult.Err, context.Canceled)
+		h.Equal(map[string]Modification{moved: Created}, updateResult.ChangedFiles, "should report only a completed file")
+	})
+}
+
+func (h *HandlersTestSuite) TestUpdateLayeredTarredConfig() {
+	layers := []string{"base_hardlink", "overlay_hardlink"}
+
+	h.RunWithMockEnv("when ClearDir returns an error, it returns an expected error", func(mocks *mocksControl) {
+		errClearDir := errors.New("clear dir error")
+		mocks.fs.EXPECT().ClearDir("newConfigDir").Times(1).Return(errClearDir)
+		updateResult := updateLayeredTarredConfig(layers, "newConfigDir", "oldConfigDir", TarArchiver{fs: mocks.fs}, mocks.fs)()
+
+		h.ErrorIs(updateResult.Err, errClearDir)
+	})
+
+	h.RunWithMockEnv("when Extract of a layer returns an error, it doesn't extract next layers and returns an expected error", func(mocks *mocksControl) {
+		errExtract := errors.New("extract error")
+		mocks.fs.EXPECT().ClearDir("newConfigDir").Times(1).Return(nil)
+		mocks.fs.EXPECT().Extract("base_hardlink", "newConfigDir").Times(1).Return(errExtract)
+		updateResult := updateLayeredTarredConfig(layers, "newConfigDir", "oldConfigDir", TarArchiver{fs: mocks.fs}, mocks.fs)()
+
+		h.ErrorIs(updateResult.Err, errExtract)
+	})
+
+	h.RunWithMockEnv("when all layers are extracted, it extracts them in order and updates oldConfigDir", func(mocks *mocksControl) {
+		m.InOrder(
+			mocks.fs.EXPECT().ClearDir("newConfigDir").Times(1).Return(nil),
+			mocks.fs.EXPECT().Extract("base_hardlink", "newConfigDir").Times(1).Return(nil),
+			mocks.fs.EXPECT().Extract("overlay_hardlink", "newConfigDir").Times(1).Return(nil),
+			mocks.fs.EXPECT().ListFileNamesInDir("oldConfigDir").Times(1).Return([]string{"common"}, nil),
+			mocks.fs.EXPECT().ListFileNamesInDir("newConfigDir").Times(1).Return([]string{"common", "added"}, nil),
+		)
+		mocks.fs.EXPECT().AreFilesDifferent("newConfigDir/common", "oldConfigDir/common").Times(1).Return(true, nil)
+		mocks.fs.EXPECT().MoveFile("newConfigDir/common", "oldConfigDir/common").Times(1).Return(nil)
+		mocks.fs.EXPECT().MoveFile("newConfigDir/added", "oldConfigDir/added").Times(1).Return(nil)
+		updateResult := updateLayeredTarredConfig(layers, "newConfigDir", "oldConfigDir", TarArchiver{fs: mocks.fs}, mocks.fs)()
+
+		h.NoError(updateResult.Err)
+		h.Equal(map[string]Modification{"common": Modified, "added": Created}, updateResult.ChangedFiles)
+	})
+}
+
+func (h *HandlersTestSuite) TestApplyPermissionRules() {
+	rules := []PermissionRule{{Glob: "*.key", Mode: 0600}, {Glob: "*.conf", Mode: 0644}, {Glob: "secret/*", Mode: 0400}}
+
+	h.RunWithMockEnv("when files match rules, should change their modes to modes of the first matching rules", func(mocks *mocksControl) {
+		mocks.fs.EXPECT().ListFileNamesInDir("newConfigDir").Times(1).Return([]string{"tls.key", "app.conf", "other", "dir/nested.key", "secret/a.conf"}, nil)
+		mocks.fs.EXPECT().Chmod("newConfigDir/tls.key", fs.FileMode(0600)).Times(1).Return(nil)
+		mocks.fs.EXPECT().Chmod("newConfigDir/app.conf", fs.FileMode(0644)).Times(1).Return(nil)
+		mocks.fs.EXPECT().Chmod("newConfigDir/dir/nested.key", fs.FileMode(0600)).Times(1).Return(nil)
+		mocks.fs.EXPECT().Chmod("newConfigDir/secret/a.conf", fs.FileMode(0644)).Times(1).Return(nil)
+
+		h.NoError(applyPermissionRules("newConfigDir", rules, mocks.fs))
+	})
+
+	h.RunWithMockEnv("when there are no rules, shouldn't list files", func(mocks *mocksControl) {
+		h.NoError(applyPermissionRules("newConfigDir", nil, mocks.fs))
+	})
+
+	h.RunWithMockEnv("when changing a mode fails, should return an error", func(mocks *mocksControl) {
+		errChmod := errors.New("chmod error")
+		mocks.fs.EXPECT().ListFileNamesInDir("newConfigDir").Times(1).Return([]string{"tls.key"}, nil)
+		mocks.fs.EXPECT().Chmod("newConfigDir/tls.key", fs.FileMode(0600)).Times(1).Return(errChmod)
+
+		h.ErrorIs(applyPermissionRules("newConfigDir", rules, mocks.fs), errChmod)
+	})
+
+	h.Run("when a glob is malformed, should return an error", func() {
+		h.NoError(validatePermissionRules(rules))
+		h.ErrorIs(validatePermissionRules([]PermissionRule{{Glob: "[", Mode: 0600}}), path.ErrBadPattern)
+	})
+}
+
+func (h *HandlersTestSuite) TestDetectRenames() {
+	errHash := errors.New("hash error")
+	testCases := [...]struct {
+		name            string
+		oldHashes       map[string]string
+		errOldHash      error
+		result          UpdateResult
+		newHashes       map[string]string
+		expectedChanged map[string]Modification
+		expectedRenames []Renamed
+	}{
+		{name: "when a created file has a content of a deleted one, should report a rename",
+			oldHashes:       map[string]string{"a": "1", "b": "2"},
+			result:          UpdateResult{ChangedFiles: map[string]Modification{"a": Deleted, "c": Created, "b": Modified}},
+			newHashes:       map[string]string{"c": "1"},
+			expectedChanged: map[string]Modification{"b": Modified},
+			expectedRenames: []Renamed{{From: "a", To: "c"}}},
+		{name: "when a created file has a different content than a deleted one, shouldn't report a rename",
+			oldHashes:       map[string]string{"a": "1"},
+			result:          UpdateResult{ChangedFiles: map[string]Modification{"a": Deleted, "c": Created}},
+			newHashes:       map[string]string{"c": "2"},
+			expectedChanged: map[string]Modification{"a": Deleted, "c": Created}},
+		{name: "when many files have the same content, should pair each deleted file only once",
+			oldHashes:       map[string]string{"a": "1"},
+			result:          UpdateResult{ChangedFiles: map[string]Modification{"a": Deleted, "c": Created, "d": Created}},
+			newHashes:       map[string]string{"c": "1", "d": "1"},
+			expectedChanged: map[string]Modification{"d": Created},
+			expectedRenames: []Renamed{{From: "a", To: "c"}}},
+		{name: "when old files can't be hashed, shouldn't change a result",
+			oldHashes:       map[string]string{"a": "1"},
+			errOldHash:      errHash,
+			result:          UpdateResult{ChangedFiles: map[string]Modification{"a": Deleted, "c": Created}},
+			expectedChanged: map[string]Modification{"a": Deleted, "c": Created}},
+	}
+	for _, test := range testCases {
+		test := test
+		h.RunWithMockEnv(test.name, func(mocks *mocksControl) {
+			oldFiles := []string{}
+			for file := range test.oldHashes {
+				oldFiles = append(oldFiles, file)
+			}
+			mocks.fs.EXPECT().ListFileNamesInDir("oldConfigDir").Times(1).Return(oldFiles, nil)
+			for file, hash := range test.oldHashes {
+				mocks.fs.EXPECT().HashFile(path.Join("oldConfigDir", file)).MaxTimes(1).Return([]byte(hash), test.errOldHash)
+			}
+			for file, hash := range test.newHashes {
+				mocks.fs.EXPECT().HashFile(path.Join("oldConfigDir", file)).Times(1).Return([]byte(hash), nil)
+			}
+			update := detectRenames(func(context.Context) UpdateResult { return test.result }, "oldConfigDir", mocks.fs)
+
+			result := update(context.Background())
+			h.NoError(result.Err)
+			h.Equal(test.expectedChanged, result.ChangedFiles)
+			h.Equal(test.expectedRenames, result.Renames)
+		})
+	}
+
+	h.RunWithMockEnv("when an update fails, should return its result", func(mocks *mocksControl) {
+		errUpdate := errors.New("update error")
+		mocks.fs.EXPECT().ListFileNamesInDir("oldConfigDir").Times(1).Return([]string{}, nil)
+		update := detectRenames(func(context.Context) UpdateResult { return UpdateResult{Err: errUpdate} }, "oldConfigDir", mocks.fs)
+
+		h.ErrorIs(update(context.Background()).Err, errUpdate)
+	})
+}
+
+func (h *HandlersTestSuite) TestPruneEmptyDirs() {
+	h.RunWithMockEnv("when files were deleted, should delete empty dirs of an old config dir", func(mocks *mocksControl) {
+		result := UpdateResult{ChangedFiles: map[string]Modification{"sub/a": Deleted}}
+		mocks.fs.EXPECT().DeleteEmptyDirs("oldConfigDir").Times(1).Return(nil)
+		update := pruneEmptyDirs(func(context.Context) UpdateResult { return result }, "oldConfigDir", mocks.fs)
+
+		h.Equal(result, update(context.Background()))
+	})
+
+	h.RunWithMockEnv("when empty dirs can't be deleted, should return an error", func(mocks *mocksControl) {
+		errDelete := errors.New("delete error")
+		mocks.fs.EXPECT().DeleteEmptyDirs("oldConfigDir").Times(1).Return(errDelete)
+		update := pruneEmptyDirs(func(context.Context) UpdateResult {
+			return UpdateResult{ChangedFiles: map[string]Modification{"sub/a": Deleted}}
+		}, "oldConfigDir", mocks.fs)
+
+		h.ErrorIs(update(context.Background()).Err, errDelete)
+	})
+
+	h.RunWithMockEnv("when no file was deleted, shouldn't delete dirs", func(mocks *mocksControl) {
+		result := UpdateResult{ChangedFiles: map[string]Modification{"a": Created, "b": Modified}}
+		update := pruneEmptyDirs(func(context.Context) UpdateResult { return result }, "oldConfigDir", mocks.fs)
+
+		h.Equal(result, update(context.Background()))
+	})
+}
+
+func (h *HandlersTestSuite) TestPreserveFailedExtraction() {
+	clock := &fakeClock{now: time.Date(2024, 5, 6, 7, 8, 9, 10, time.UTC)}
+	preserved := path.Join("preservedDir", "20240506T070809.000000010Z")
+	errUpdate := errors.New("update error")
+
+	h.RunWithMockEnv("when an update fails, should copy files of a new config dir and return its result", func(mocks *mocksControl) {
+		mocks.fs.EXPECT().ListFileNamesInDir("newConfigDir").Times(1).Return([]string{"a", "sub/b"}, nil)
+		mocks.fs.EXPECT().CreateDir(preserved).Times(2).Return(nil)
+		mocks.fs.EXPECT().CreateDir(path.Join(preserved, "sub")).Times(1).Return(nil)
+		mocks.fs.EXPECT().Copy(path.Join("newConfigDir", "a"), path.Join(preserved, "a")).Times(1).Return(nil)
+		mocks.fs.EXPECT().Copy(path.Join("newConfigDir", "sub/b"), path.Join(preserved, "sub/b")).Times(1).Return(nil)
+		update := preserveFailedExtraction(func(context.Context) UpdateResult { return UpdateResult{Err: errUpdate} },
+			"newConfigDir", "preservedDir", clock, logDiscard, mocks.fs)
+
+		h.ErrorIs(update(context.Background()).Err, errUpdate)
+	})
+
+	h.RunWithMockEnv("when files can't be copied, should return a result of an update", func(mocks *mocksControl) {
+		mocks.fs.EXPECT().ListFileNamesInDir("newConfigDir").Times(1).Return([]string{"a"}, nil)
+		mocks.fs.EXPECT().CreateDir(preserved).Times(2).Return(nil)
+		mocks.fs.EXPECT().Copy(path.Join("newConfigDir", "a"), path.Join(preserved, "a")).Times(1).Return(errors.New("copy error"))
+		update := preserveFailedExtraction(func(context.Context) UpdateResult { return UpdateResult{Err: errUpdate} },
+			"newConfigDir", "preservedDir", clock, logDiscard, mocks.fs)
+
+		h.ErrorIs(update(context.Background()).Err, errUpdate)
+	})
+
+	for name, err := range map[string]error{"succeeds": nil, "is cancelled": fmt.Errorf("wrapped: %w", ErrUpdateCancelled)} {
+		h.RunWithMockEnv("when an update "+name+", shouldn't copy files", func(mocks *mocksControl) {
+			result := UpdateResult{ChangedFiles: map[string]Modification{"a": Created}, Err: err}
+			update := preserveFailedExtraction(func(context.Context) UpdateResult { return result },
+				"newConfigDir", "preservedDir", clock, logDiscard, mocks.fs)
+
+			h.Equal(result, update(context.Background()))
+		})
+	}
+}
+
+func (h *HandlersTestSuite) TestUpdateJSONPatchedConfig() {
+	h.RunWithMockEnv("when a patch can't be read, it returns an error and doesn't write a target", func(mocks *mocksControl) {
+		errRead := errors.New("read error")
+		mocks.fs.EXPECT().ReadFile("patchHardlinkPath").Times(1).Return(nil, errRead)
+		updateResult := updateJSONPatchedConfig("patchHardlinkPath", "targetFile", mocks.fs)()
+
+		h.ErrorIs(updateResult.Err, errRead)
+		h.Empty(updateResult.Paths)
+	})
+
+	h.RunWithMockEnv("when a target doesn't exist, it returns an error and doesn't write a target", func(mocks *mocksControl) {
+		mocks.fs.EXPECT().ReadFile("patchHardlinkPath").Times(1).Return([]byte(`[]`), nil)
+		mocks.fs.EXPECT().Stat("targetFile").Times(1).Return(statResult(false))
+		updateResult := updateJSONPatchedConfig("patchHardlinkPath", "targetFile", mocks.fs)()
+
+		h.ErrorIs(updateResult.Err, fs.ErrNotExist)
+	})
+
+	h.RunWithMockEnv("when a test operation fails, it returns an error and doesn't write a target", func(mocks *mocksControl) {
+		mocks.fs.EXPECT().ReadFile("patchHardlinkPath").Times(1).Return([]byte(`[{"op":"remove","path":"/a"},{"op":"test","path":"/b","value":1}]`), nil)
+		mocks.fs.EXPECT().Stat("targetFile").Times(1).Return(fakeFileInfo{mode: 0640}, nil)
+		mocks.fs.EXPECT().ReadFile("targetFile").Times(1).Return([]byte(`{"a":1,"b":2}`), nil)
+		updateResult := updateJSONPatchedConfig("patchHardlinkPath", "targetFile", mocks.fs)()
+
+		h.ErrorIs(updateResult.Err, ErrJSONPatchTestFailed)
+		h.Empty(updateResult.Paths)
+	})
+
+	h.RunWithMockEnv("when a patch is applied, it writes a target with its mode and returns paths of operations", func(mocks *mocksControl) {
+		mocks.fs.EXPECT().ReadFile("patchHardlinkPath").Times(1).Return([]byte(`[{"op":"remove","path":"/a"},{"op":"add","path":"/c","value":3}]`), nil)
+		mocks.fs.EXPECT().Stat("targetFile").Times(1).Return(fakeFileInfo{mode: 0640}, nil)
+		mocks.fs.EXPECT().ReadFile("targetFile").Times(1).Return([]byte(`{"a":1,"b":2}`), nil)
+		mocks.fs.EXPECT().WriteFileAtomic("targetFile", []byte("{\n  \"b\": 2,\n  \"c\": 3\n}\n"), fs.FileMode(0640)).Times(1).Return(nil)
+		updateResult := updateJSONPatchedConfig("patchHardlinkPath", "targetFile", mocks.fs)()
+
+		h.NoError(updateResult.Err)
+		h.Equal([]string{"/a", "/c"}, updateResult.Paths)
+	})
+
+	h.RunWithMockEnv("when a target can't be written, it returns an error", func(mocks *mocksControl) {
+		errWrite := errors.New("write error")
+		mocks.fs.EXPECT().ReadFile("patchHardlinkPath").Times(1).Return([]byte(`[]`), nil)
+		mocks.fs.EXPECT().Stat("targetFile").Times(1).Return(fakeFileInfo{mode: 0640}, nil)
+		mocks.fs.EXPECT().ReadFile("targetFile").Times(1).Return([]byte(`{}`), nil)
+		mocks.fs.EXPECT().WriteFileAtomic("targetFile", m.Any(), m.Any()).Times(1).Return(errWrite)
+		updateResult := updateJSONPatchedConfig("patchHardlinkPath", "targetFile", mocks.fs)()
+
+		h.ErrorIs(updateResult.Err, errWrite)
+		h.Empty(updateResult.Paths)
+	})
+}
+
+func (h *HandlersTestSuite) TestUpdatePipeline() {
+	errStep := errors.New("step error")
+	// recorded returns a step appending its name to calls and returning a result of f.
+	recorded := func(calls *[]string, name string, f func(any) (any, error)) func(any) (any, error) {
+		return func(prev any) (any, error) {
+			*calls = append(*calls, name)
+			return f(prev)
+		}
+	}
+
+	h.Run("when all steps succeed, should thread outputs through steps and return an output of the last one", func() {
+		calls := []string{}
+		steps := []func(any) (any, error){
+			recorded(&calls, "decrypt", func(prev any) (any, error) { return "decrypted " + prev.(string), nil }),
+			recorded(&calls, "render", func(prev any) (any, error) { return len(prev.(string)), nil }),
+			recorded(&calls, "validate", func(prev any) (any, error) { return prev.(int) * 2, nil }),
+		}
+		result := updatePipeline[int]("input", steps)()
+
+		h.NoError(result.Err)
+		h.Equal(2*len("decrypted input"), result.Value)
+		h.Equal([]string{"decrypt", "render", "validate"}, calls)
+	})
+
+	h.Run("when a step fails, should return its error and not run next steps", func() {
+		calls := []string{}
+		steps := []func(any) (any, error){
+			recorded(&calls, "decrypt", func(prev any) (any, error) { return prev, nil }),
+			recorded(&calls, "render", func(any) (any, error) { return nil, errStep }),
+			recorded(&calls, "validate", func(prev any) (any, error) { return prev, nil }),
+		}
+		result := updatePipeline[string]("input", steps)()
+
+		h.ErrorIs(result.Err, errStep)
+		h.ErrorContains(result.Err, "step 1")
+		h.Empty(result.Value)
+		h.Equal([]string{"decrypt", "render"}, calls)
+	})
+
+	h.Run("when the last step returns a value of another type, should return an error", func() {
+		result := updatePipeline[int]("input", []func(any) (any, error){func(prev any) (any, error) { return prev, nil }})()
+
+		h.Error(result.Err)
+		h.Zero(result.Value)
+	})
+
+	h.Run("when the last step returns nil, should return a zero value", func() {
+		result := updatePipeline[error]("input", []func(any) (any, error){func(any) (any, error) { return nil, nil }})()
+
+		h.NoError(result.Err)
+		h.Nil(result.Value)
+	})
+}
+
+func (h *HandlersTestSuite) TestUpdateResultFilters() {
+	h.Run("when files have mixed modifications, should return sorted file names for each modification", func() {
+		result := UpdateResult{ChangedFiles: map[string]Modification{
+			"c": Created, "a": Created, "dir/m": Modified, "b": Modified, "z": Deleted, "y": Deleted, "x": Deleted,
+		}}
+
+		h.Equal([]string{"a", "c"}, result.Created())
+		h.Equal([]string{"b", "dir/m"}, result.Modified())
+		h.Equal([]string{"x", "y", "z"}, result.Deleted())
+	})
+
+	h.Run("when no file has a modification, should return empty slices", func() {
+		result := UpdateResult{ChangedFiles: map[string]Modification{"a": Created}}
+
+		h.Equal([]string{}, result.Modified())
+		h.Equal([]string{}, result.Deleted())
+		h.Equal([]string{}, UpdateResult{}.Created())
+	})
+}
+
+func (h *HandlersTestSuite) TestUpdateResultClassify() {
+	testCases := [...]struct {
+		name                string
+		changedFiles        map[string]Modification
+		renames             []Renamed
+		expectedDestructive bool
+		expectedClass       ChangeClass
+	}{
+		{name: "when no file was changed, should return NoChange", expectedClass: NoChange},
+		{name: "when files were only created, should return Additive",
+			changedFiles: map[string]Modification{"a": Created, "b": Created}, expectedClass: Additive},
+		{name: "when a file was modified, should return Destructive",
+			changedFiles: map[string]Modification{"a": Created, "b": Modified}, expectedDestructive: true, expectedClass: Destructive},
+		{name: "when a file was deleted, should return Destructive",
+			changedFiles: map[string]Modification{"a": Created, "c": Deleted}, expectedDestructive: true, expectedClass: Destructive},
+		{name: "when a file was renamed, should return Destructive",
+			renames: []Renamed{{From: "a", To: "b"}}, expectedDestructive: true, expectedClass: Destructive},
+	}
+	for _, test := range testCases {
+		test := test
+		h.Run(test.name, func() {
+			result := UpdateResult{ChangedFiles: test.changedFiles, Renames: test.renames}
+
+			h.Equal(test.expectedDestructive, result.IsDestructive())
+			h.Equal(test.expectedClass, result.Classify())
+		})
+	}
+
+	h.Run("test ChangeClass ToString", func() {
+		h.Equal("no change", NoChange.ToString())
+		h.Equal("additive", Additive.ToString())
+		h.Equal("destructive", Destructive.ToString())
+		h.Equal("invalid", ChangeClass(-1).ToString())
+	})
 }
 
 func (h *HandlersTestSuite) TestModificationToString() {
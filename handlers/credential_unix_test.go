@@ -0,0 +1,57 @@
+//go:build unix
+
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func (h *HandlersTestSuite) TestCmdProcessHandlerCredential() {
+	const nobody = 65534
+	h.Run("when a credential is set by a privileged entrypoint, a process runs as a user and a group", func() {
+		if os.Geteuid() != 0 {
+			h.T().Skip("an entrypoint must run as root")
+		}
+		var out bytes.Buffer
+		cmd := exec.Command("sh", "-c", "id -u; id -g")
+		cmd.Stdout = &out
+		handler, err := NewProcessHandler(cmd, nil, WithCredential(nobody, nobody))
+		h.Require().NoError(err)
+		handler.Start()
+
+		h.Require().NoError(<-handler.GetStartedChannel())
+		h.Require().NoError(<-handler.GetEndedChannel())
+		h.Equal([]string{"65534", "65534"}, strings.Fields(out.String()))
+	})
+
+	h.Run("when a credential is set by an unprivileged entrypoint, a process is not started and an error is returned", func() {
+		if os.Geteuid() == 0 {
+			h.T().Skip("an entrypoint must not run as root")
+		}
+		handler, err := NewProcessHandler(exec.Command("true"), nil, WithCredential(uint32(os.Geteuid()+1), uint32(os.Getegid()+1)))
+		h.Require().NoError(err)
+		handler.Start()
+
+		h.ErrorIs(<-handler.GetStartedChannel(), ErrInsufficientPrivilege)
+		h.False(handler.IsRunning())
+	})
+}
@@ -0,0 +1,105 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+
+	"github.com/k-lb/entrypoint-framework/handlers/internal/filesystem"
+)
+
+// ErrUnknownPlaceholder is returned when strict environment interpolation finds a placeholder of a variable which isn't
+// allowlisted or isn't set.
+var ErrUnknownPlaceholder = errors.New("placeholder of an unknown environment variable")
+
+// placeholderPattern matches a ${VAR} placeholder and captures a name of a variable.
+var placeholderPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// envInterpolation substitutes placeholders in files with values of allowlisted environment variables.
+type envInterpolation struct {
+	allowlist map[string]bool
+	strict    bool                        // an unknown placeholder is an error instead of being left intact.
+	lookupEnv func(string) (string, bool) // os.LookupEnv unless changed by tests.
+}
+
+// newEnvInterpolation returns an envInterpolation configured by options or nil if it wasn't requested.
+func newEnvInterpolation(o configurationOptions, lookupEnv func(string) (string, bool)) *envInterpolation {
+	if !o.envInterpolation {
+		return nil
+	}
+	allowlist := make(map[string]bool, len(o.envAllowlist))
+	for _, name := range o.envAllowlist {
+		allowlist[name] = true
+	}
+	return &envInterpolation{allowlist: allowlist, strict: o.strictEnvInterpolation, lookupEnv: lookupEnv}
+}
+
+// interpolate returns a content with placeholders of allowlisted and set variables substituted and a sorted list of
+// names of variables of placeholders left intact.
+func (e *envInterpolation) interpolate(content []byte) ([]byte, []string) {
+	unknown := []string{}
+	result := placeholderPattern.ReplaceAllFunc(content, func(placeholder []byte) []byte {
+		name := string(placeholderPattern.FindSubmatch(placeholder)[1])
+		if value, ok := e.lookupEnv(name); ok && e.allowlist[name] {
+			return []byte(value)
+		}
+		if !slices.Contains(unknown, name) {
+			unknown = append(unknown, name)
+		}
+		return placeholder
+	})
+	slices.Sort(unknown)
+	return result, unknown
+}
+
+// apply substitutes placeholders in every file from a dir. A file is rewritten atomically with its mode kept, only if
+// its content has changed. In a strict mode it returns an ErrUnknownPlaceholder at the first file with a placeholder
+// left intact, so files are never partially substituted.
+func (e *envInterpolation) apply(dir string, fs filesystem.Filesystem) error {
+	if e == nil {
+		return nil
+	}
+	files, err := fs.ListFileNamesInDir(dir)
+	if err != nil {
+		return fmt.Errorf("could not list files in a dir: %s. Reason: %w", dir, err)
+	}
+	for _, file := range files {
+		filePath := path.Join(dir, file)
+		content, err := fs.ReadFile(filePath)
+		if err != nil {
+			return fmt.Errorf("could not read a file %s. Reason: %w", file, err)
+		}
+		interpolated, unknown := e.interpolate(content)
+		if e.strict && len(unknown) > 0 {
+			return fmt.Errorf("could not substitute placeholders %v in a file %s. Reason: %w", unknown, file, ErrUnknownPlaceholder)
+		} else if slices.Equal(interpolated, content) {
+			continue
+		}
+		info, err := fs.Stat(filePath)
+		if err != nil {
+			return fmt.Errorf("could not get a mode of a file %s. Reason: %w", file, err)
+		}
+		if err := fs.WriteFileAtomic(filePath, interpolated, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("could not write an interpolated file %s. Reason: %w", file, err)
+		}
+	}
+	return nil
+}
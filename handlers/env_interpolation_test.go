@@ -0,0 +1,113 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+)
+
+func (h *HandlersTestSuite) TestEnvInterpolationInterpolate() {
+	env := map[string]string{"HOST": "localhost", "PORT": "8080", "SECRET": "secret", "EMPTY": ""}
+	lookupEnv := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	interpolation := newEnvInterpolation(configurationOptions{envInterpolation: true, envAllowlist: []string{"HOST", "PORT", "EMPTY", "UNSET"}}, lookupEnv)
+
+	testCases := [...]struct {
+		name            string
+		content         string
+		expectedContent string
+		expectedUnknown []string
+	}{
+		{name: "when there are no placeholders, it returns a content unchanged", content: "port: 80", expectedContent: "port: 80", expectedUnknown: []string{}},
+		{name: "when placeholders are allowlisted, it substitutes all of them", content: "url: ${HOST}:${PORT}/${HOST}", expectedContent: "url: localhost:8080/localhost", expectedUnknown: []string{}},
+		{name: "when a variable is set to an empty value, it substitutes it", content: "a${EMPTY}b", expectedContent: "ab", expectedUnknown: []string{}},
+		{name: "when a variable isn't allowlisted, it leaves a placeholder intact", content: "${HOST} ${SECRET}", expectedContent: "localhost ${SECRET}", expectedUnknown: []string{"SECRET"}},
+		{name: "when an allowlisted variable isn't set, it leaves a placeholder intact", content: "${UNSET} ${UNSET} ${OTHER}", expectedContent: "${UNSET} ${UNSET} ${OTHER}", expectedUnknown: []string{"OTHER", "UNSET"}},
+		{name: "when a placeholder is malformed, it leaves it intact", content: "$HOST ${HOST ${1A} ${}", expectedContent: "$HOST ${HOST ${1A} ${}", expectedUnknown: []string{}},
+	}
+	for _, test := range testCases {
+		test := test
+		h.Run(test.name, func() {
+			content, unknown := interpolation.interpolate([]byte(test.content))
+
+			h.Equal(test.expectedContent, string(content))
+			h.Equal(test.expectedUnknown, unknown)
+		})
+	}
+}
+
+func (h *HandlersTestSuite) TestEnvInterpolationApply() {
+	env := func(name string) (string, bool) {
+		if name == "HOST" {
+			return "localhost", true
+		}
+		return "", false
+	}
+	files := map[string]string{"app.conf": "host: ${HOST}", "static": "static", "unknown": "${HOST} ${SECRET}"}
+	expectReads := func(mocks *mocksControl) {
+		mocks.fs.EXPECT().ListFileNamesInDir("newConfigDir").Times(1).Return([]string{"app.conf", "static", "unknown"}, nil)
+		for name, content := range files {
+			mocks.fs.EXPECT().ReadFile(path.Join("newConfigDir", name)).MaxTimes(1).Return([]byte(content), nil)
+		}
+	}
+
+	h.Run("when an interpolation is nil, it doesn't touch files", func() {
+		var interpolation *envInterpolation
+		h.NoError(interpolation.apply("newConfigDir", nil))
+	})
+
+	h.RunWithMockEnv("when files contain placeholders, it rewrites only changed files with their modes", func(mocks *mocksControl) {
+		interpolation := newEnvInterpolation(configurationOptions{envInterpolation: true, envAllowlist: []string{"HOST"}}, env)
+		expectReads(mocks)
+		mocks.fs.EXPECT().Stat("newConfigDir/app.conf").Times(1).Return(fakeFileInfo{mode: 0600}, nil)
+		mocks.fs.EXPECT().WriteFileAtomic("newConfigDir/app.conf", []byte("host: localhost"), fs.FileMode(0600)).Times(1).Return(nil)
+		mocks.fs.EXPECT().Stat("newConfigDir/unknown").Times(1).Return(fakeFileInfo{mode: 0644}, nil)
+		mocks.fs.EXPECT().WriteFileAtomic("newConfigDir/unknown", []byte("localhost ${SECRET}"), fs.FileMode(0644)).Times(1).Return(nil)
+
+		h.NoError(interpolation.apply("newConfigDir", mocks.fs))
+	})
+
+	h.RunWithMockEnv("when a variable isn't allowlisted, it doesn't substitute it", func(mocks *mocksControl) {
+		interpolation := newEnvInterpolation(configurationOptions{envInterpolation: true}, env)
+		expectReads(mocks)
+
+		h.NoError(interpolation.apply("newConfigDir", mocks.fs))
+	})
+
+	h.RunWithMockEnv("when an interpolation is strict and a placeholder is unknown, it returns an ErrUnknownPlaceholder", func(mocks *mocksControl) {
+		interpolation := newEnvInterpolation(configurationOptions{envInterpolation: true, strictEnvInterpolation: true, envAllowlist: []string{"HOST"}}, env)
+		mocks.fs.EXPECT().ListFileNamesInDir("newConfigDir").Times(1).Return([]string{"unknown"}, nil)
+		mocks.fs.EXPECT().ReadFile("newConfigDir/unknown").Times(1).Return([]byte(files["unknown"]), nil)
+
+		err := interpolation.apply("newConfigDir", mocks.fs)
+		h.ErrorIs(err, ErrUnknownPlaceholder)
+		h.ErrorContains(err, "SECRET")
+	})
+
+	h.RunWithMockEnv("when a file can't be read, it returns an error", func(mocks *mocksControl) {
+		errRead := errors.New("read error")
+		interpolation := newEnvInterpolation(configurationOptions{envInterpolation: true}, env)
+		mocks.fs.EXPECT().ListFileNamesInDir("newConfigDir").Times(1).Return([]string{"app.conf"}, nil)
+		mocks.fs.EXPECT().ReadFile("newConfigDir/app.conf").Times(1).Return(nil, errRead)
+
+		h.ErrorIs(interpolation.apply("newConfigDir", mocks.fs), errRead)
+	})
+}
@@ -17,19 +17,32 @@
 // Package handlers provides three types of handlers.
 //
 // ActivationHandler provides information of a current state (active or inactive) of an application.
+// Composite ActivationHandler combines states of multiple ActivationHandlers with a boolean function.
 //
 // ConfigurationHandler provides information about changes made to configuration and allows to update it in a consistent way.
 // Single file ConfigurationHandler is intended for solutions where only one configuration file is present.
+// Gzipped single file ConfigurationHandler is used when the only configuration file is provided gzip compressed.
 // Tarred ConfigurationHandler is used when configuration contains of multiple files which are provided as a tar.
+// Layered ConfigurationHandler is used when configuration is provided as multiple tars extracted one over another.
 // Custom ConfigurationHandler is used when a user needs to run some custom actions file while updating.
+// Regex triggered ConfigurationHandler is used when a configuration can be updated only if it contains a marker.
+// Mapped ConfigurationHandler wraps any ConfigurationHandler and transforms its update results.
+// ConfigurationBarrier batches changes of multiple ConfigurationHandlers into a single update cycle.
 //
 // ProcessHandler provides information of changes to a process (start and end) and allows to send signals to it.
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"os"
 	"os/exec"
+	"regexp"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/k-lb/entrypoint-framework/handlers/internal/filesystem"
 	"github.com/k-lb/entrypoint-framework/handlers/internal/global"
@@ -39,9 +52,137 @@ const (
 	handlerLogKey   = "handler"
 	errorKey        = "error"
 	typeKey         = "type"
+	sourceKey       = "source"
 	hardlinkPostfix = "_hardlink"
 )
 
+// ErrHandlerClosed is returned (wrapped) by methods of a handler which can't be used after the handler was closed.
+var ErrHandlerClosed = errors.New("handler was closed")
+
+// ErrTooManyFiles is returned (wrapped) in an UpdateResult when a new configuration contains more files than allowed by
+// WithMaxFiles.
+var ErrTooManyFiles = filesystem.ErrTooManyEntries
+
+// ErrUnsafeEntry is returned (wrapped) in an UpdateResult when an entry of a new configuration would be extracted
+// outside of a new config dir (e.g. "../file") or it is absolute and WithRejectAbsoluteEntries is used.
+var ErrUnsafeEntry = filesystem.ErrUnsafeEntry
+
+// lastError records the most recent error observed by a handler, so it can be inspected without reading handler
+// channels. It is safe for concurrent use.
+type lastError struct {
+	mutex sync.Mutex
+	err   error
+}
+
+// record stores err as the most recent error. A nil err is ignored.
+func (l *lastError) record(err error) {
+	if err == nil {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.err = err
+}
+
+// get returns the most recent recorded error or nil if no error was recorded.
+func (l *lastError) get() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.err
+}
+
+// subscribers fans out 'was changed' events to channels returned by Subscribe. A full channel drops its oldest event,
+// so a slow subscriber never blocks a handler nor other subscribers. It is safe for concurrent use.
+type subscribers struct {
+	mutex    sync.Mutex
+	channels map[chan error]struct{}
+	closed   bool
+}
+
+// add returns a new channel receiving every notified event and a function which removes and closes it. The function
+// may be called many times. If subscribers are closed, a closed channel is returned.
+func (s *subscribers) add() (<-chan error, func()) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ch := make(chan error, global.DefaultChanBuffSize)
+	if s.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if s.channels == nil {
+		s.channels = map[chan error]struct{}{}
+	}
+	s.channels[ch] = struct{}{}
+	return ch, func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if _, ok := s.channels[ch]; ok {
+			delete(s.channels, ch)
+			close(ch)
+		}
+	}
+}
+
+// notify sends err to all channels. If a channel is full, its oldest event is dropped first.
+func (s *subscribers) notify(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for ch := range s.channels {
+		select {
+		case ch <- err:
+			continue
+		default:
+		}
+		select {
+		case <-ch:
+		default:
+		}
+		select {
+		case ch <- err:
+		default:
+		}
+	}
+}
+
+// close closes all channels. Channels added afterwards are closed at once.
+func (s *subscribers) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for ch := range s.channels {
+		close(ch)
+	}
+	s.channels = nil
+	s.closed = true
+}
+
+// Watcher is a source of events about changes of a watched file. It can be implemented to drive handlers with events
+// from other sources than a file system (e.g. polling or a message queue). GetNotificationChannel must be closed after
+// Stop is called.
+type Watcher = filesystem.Watcher
+
+// WatcherEvent is an event provided by a Watcher. It contains an operation observed on a watched file or an error.
+type WatcherEvent = filesystem.WatcherEvent
+
+// WatcherHealth is a diagnostic state of a watcher used by a handler. It tells if the watcher is open, if it was stopped,
+// how many events it has pushed and when the last one was pushed.
+type WatcherHealth = filesystem.WatcherHealth
+
+// watcherHealth returns a WatcherHealth of a watcher and true if the watcher reports it.
+func watcherHealth(w Watcher) (WatcherHealth, bool) {
+	if reporter, ok := w.(filesystem.HealthReporter); ok {
+		return reporter.Health(), true
+	}
+	return WatcherHealth{}, false
+}
+
+// NewPollingWatcher returns a new PollingWatcher of a file and an error if any occurred. The file is checked every
+// interval. It can be passed to constructors accepting a Watcher when changes of the file aren't notified by a file
+// system (e.g. on NFS). WithStaleHandleRecovery should be used for a file on NFS.
+func NewPollingWatcher(file string, interval time.Duration, logger *slog.Logger, opts ...PollingOption) (*PollingWatcher, error) {
+	log := global.HandleNilLogger(logger).With(slog.String("watcher", "polling"), slog.String("file", file))
+	return newPollingWatcher(file, interval, log, filesystem.New(log), opts...)
+}
+
 // ActivationHandler provides information of a current state (active or inactive) of application.
 type ActivationHandler interface {
 	// GetWasChangedChannel returns a read only channel with an ActivationEvent when the activation was changed.
@@ -51,16 +192,39 @@ type ActivationHandler interface {
 }
 
 // ActivationEvent contains a current state of an activation (active or inactive) and an error if it was observed.
+// Initial is set for an event of a state found when a handler was created. Source identifies what has driven the event:
+// an activation file (or a pattern of files) of a file handler or a child of a composite handler.
 type ActivationEvent struct {
-	State bool
-	Error error
+	State   bool
+	Error   error
+	Initial bool
+	Source  string
 }
 
 // NewActivationHandler returns a new ActivationHandler and an error if any occurred. Activation is changed based on
 // presence of an activationFile.
-func NewActivationHandler(activationFile string, logger *slog.Logger) (*FileActivationHandler, error) {
+func NewActivationHandler(activationFile string, logger *slog.Logger, opts ...ActivationOption) (*FileActivationHandler, error) {
 	log := global.HandleNilLogger(logger).With(slog.String(handlerLogKey, "activation"), slog.String("file", activationFile))
-	return newFileActivationHandler(activationFile, log, filesystem.New(log))
+	return newFileActivationHandler(activationFile, log, filesystem.New(log, newActivationOptions(opts).fsOpts...), opts...)
+}
+
+// NewActivationHandlerWithWatcher returns a new ActivationHandler and an error if any occurred. Activation is changed
+// based on presence of an activationFile, which is checked on each event of a watcher instead of a file watcher.
+// The watcher is stopped when the handler is closed.
+func NewActivationHandlerWithWatcher(watcher Watcher, activationFile string, logger *slog.Logger, opts ...ActivationOption) (*FileActivationHandler, error) {
+	if watcher == nil {
+		return nil, errors.New("can not create activation handler without a watcher")
+	}
+	log := global.HandleNilLogger(logger).With(slog.String(handlerLogKey, "activation"), slog.String("file", activationFile))
+	return newFileActivationHandlerWithWatcher(watcher, activationFile, log, filesystem.New(log, newActivationOptions(opts).fsOpts...), opts...), nil
+}
+
+// NewGlobActivationHandler returns a new ActivationHandler and an error if any occurred. Activation is active when at
+// least one file in a dir has a name matching a pattern (with syntax of filepath.Match, e.g. "isactive-*"). It is
+// recomputed whenever a matching file is created, removed or renamed in the dir. Subdirectories are not searched.
+func NewGlobActivationHandler(dir, pattern string, logger *slog.Logger, opts ...ActivationOption) (*FileActivationHandler, error) {
+	log := global.HandleNilLogger(logger).With(slog.String(handlerLogKey, "activation"), slog.String("dir", dir), slog.String("pattern", pattern))
+	return newGlobActivationHandler(dir, pattern, log, filesystem.New(log, newActivationOptions(opts).fsOpts...), opts...)
 }
 
 // ConfigurationHandler provides methods to safely update a configuration. It should be used when the configuration is
@@ -71,8 +235,9 @@ func NewActivationHandler(activationFile string, logger *slog.Logger) (*FileActi
 type ConfigurationHandler[T any] interface {
 	// GetWasChangedChannel returns a read only channel with an error that occurred during configuration changing.
 	GetWasChangedChannel() <-chan error
-	// Update triggers the configuration update.
-	Update()
+	// Update triggers the configuration update. It returns an error wrapping ErrHandlerClosed when the handler is
+	// closed.
+	Update() error
 	// GetUpdateResultChannel returns a read only channel with a T event when the configuration was updated.
 	GetUpdateResultChannel() <-chan T
 	// Close triggers closing of the ConfigurationHandler.
@@ -81,46 +246,177 @@ type ConfigurationHandler[T any] interface {
 
 // NewSingleFileConfigurationHandler returns a new ConfigurationHandler and an error if any occurred. Changes to
 // a newConfig will be watched and when Update is called it will be copied to oldConfig which is safe to read and write
-// if no update is ongoing.
-func NewSingleFileConfigurationHandler(newConfig, oldConfig string, logger *slog.Logger) (*ConfigurationHandlerBase[error], error) {
+// if no update is ongoing. An update result tells if oldConfig was changed, as newConfig is copied only if it differs.
+func NewSingleFileConfigurationHandler(newConfig, oldConfig string, logger *slog.Logger, opts ...ConfigurationOption) (*ConfigurationHandlerBase[SingleFileUpdateResult], error) {
 	log := global.HandleNilLogger(logger).With(
 		slog.String(handlerLogKey, "configuration"),
 		slog.String(typeKey, "single file"),
 		slog.String("newConfig", newConfig),
 		slog.String("oldConfig", oldConfig))
-	fs := filesystem.New(log)
+	fs := filesystem.New(log, newConfigurationOptions(opts).fsOpts...)
 	hardlink := newConfig + hardlinkPostfix
 	return newConfigurationHandlerBase(
-		newConfig, hardlink, updateSingleFileConfig(hardlink, oldConfig, fs), log, fs)
+		newConfig, hardlink, updateSingleFileConfig(hardlink, oldConfig, fs), log, fs, opts...)
+}
+
+// NewGzippedSingleFileConfigurationHandler returns a new ConfigurationHandler and an error if any occurred. Changes to
+// a newGzFile will be watched and when Update is called it will be decompressed to oldConfigFile atomically, so
+// oldConfigFile always contains a complete configuration. An update of a corrupt newGzFile returns an error and leaves
+// oldConfigFile untouched.
+func NewGzippedSingleFileConfigurationHandler(newGzFile, oldConfigFile string, logger *slog.Logger, opts ...ConfigurationOption) (*ConfigurationHandlerBase[error], error) {
+	log := global.HandleNilLogger(logger).With(
+		slog.String(handlerLogKey, "configuration"),
+		slog.String(typeKey, "gzipped single file"),
+		slog.String("newGzFile", newGzFile),
+		slog.String("oldConfigFile", oldConfigFile))
+	fs := filesystem.New(log, newConfigurationOptions(opts).fsOpts...)
+	hardlink := newGzFile + hardlinkPostfix
+	return newConfigurationHandlerBase(
+		newGzFile, hardlink, updateGzippedSingleFileConfig(hardlink, oldConfigFile, fs), log, fs, opts...)
 }
 
 // NewTarredConfigurationHandler returns a new ConfigurationHandler and an error if any occurred. Changes to
 // a newConfigFile will be watched and when Update is called it will extract newConfigFile to newConfigDir and compare
-// and update its content to an oldConfigDir. newConfigDir and oldConfigDir must be on the same device.
-func NewTarredConfigurationHandler(newConfigFile, newConfigDir, oldConfigDir string, logger *slog.Logger) (*ConfigurationHandlerBase[UpdateResult], error) {
+// and update its content to an oldConfigDir. newConfigFile is a tarball unless another Archiver is passed with
+// WithArchiver. newConfigDir and oldConfigDir must be on the same device.
+func NewTarredConfigurationHandler(newConfigFile, newConfigDir, oldConfigDir string, logger *slog.Logger, opts ...ConfigurationOption) (*ConfigurationHandlerBase[UpdateResult], error) {
 	log := global.HandleNilLogger(logger).With(
 		slog.String(handlerLogKey, "configuration"),
 		slog.String(typeKey, "tarred"),
 		slog.String("newConfigFile", newConfigFile),
 		slog.String("newConfigDir", newConfigDir),
 		slog.String("oldConfigDir", oldConfigDir))
-	fs := filesystem.New(log)
+	o := newConfigurationOptions(opts)
+	if err := validatePermissionRules(o.permissionRules); err != nil {
+		return nil, err
+	}
+	fs := filesystem.New(log, o.fsOpts...)
 	hardlink := newConfigFile + hardlinkPostfix
-	return newConfigurationHandlerBase(
-		newConfigFile, hardlink, updateTarredConfig(hardlink, newConfigDir, oldConfigDir, fs), log, fs)
+	update := updateTarredConfig(hardlink, newConfigDir, oldConfigDir, bindArchiver(o.archiver, fs), o.permissionRules, newEnvInterpolation(o, os.LookupEnv), o.schemaGate, fs)
+	if o.pruneEmptyDirs {
+		update = pruneEmptyDirs(update, oldConfigDir, fs)
+	}
+	if o.detectRenames {
+		update = detectRenames(update, oldConfigDir, fs)
+	}
+	if o.preserveFailedDir != "" {
+		update = preserveFailedExtraction(update, newConfigDir, o.preserveFailedDir, o.clock, log, fs)
+	}
+	return newCancellableConfigurationHandlerBase(newConfigFile, hardlink, update,
+		log, fs, append([]ConfigurationOption{withConfigDirs(newConfigDir, oldConfigDir)}, opts...)...)
+}
+
+// NewTarredConfigurationHandlerWithContext returns a new ConfigurationHandler and an error if any occurred. It works
+// as NewTarredConfigurationHandler, but an initial configuration is handled (hardlinked) under ctx, so a hanging
+// filesystem can't block the caller forever. If ctx is done first, an error wrapping ctx.Err() is returned.
+func NewTarredConfigurationHandlerWithContext(ctx context.Context, newConfigFile, newConfigDir, oldConfigDir string, logger *slog.Logger, opts ...ConfigurationOption) (*ConfigurationHandlerBase[UpdateResult], error) {
+	return NewTarredConfigurationHandler(newConfigFile, newConfigDir, oldConfigDir, logger, append([]ConfigurationOption{withInitialContext(ctx)}, opts...)...)
+}
+
+// NewLayeredTarredConfigurationHandler returns a new ConfigurationHandler and an error if any occurred. Changes to all
+// layers will be watched and when Update is called they will be extracted in order to newConfigDir, so files from later
+// layers override files from earlier ones. Then the content of newConfigDir is compared and updated to an oldConfigDir.
+// All layers must exist for an update to succeed. newConfigDir and oldConfigDir must be on the same device.
+func NewLayeredTarredConfigurationHandler(layers []string, newConfigDir, oldConfigDir string, logger *slog.Logger) (*LayeredConfigurationHandler, error) {
+	log := global.HandleNilLogger(logger).With(
+		slog.String(handlerLogKey, "configuration"),
+		slog.String(typeKey, "layered tarred"),
+		slog.Any("layers", layers),
+		slog.String("newConfigDir", newConfigDir),
+		slog.String("oldConfigDir", oldConfigDir))
+	return newLayeredConfigurationHandler(layers, newConfigDir, oldConfigDir, log, filesystem.New(log))
 }
 
 // NewCustomConfigurationHandler returns a new ConfigurationHandler and an error if any occurred. Changes to
 // a newConfigFile will be watched and a hardlink will be created of this file. The update function will be called by
 // ConfigurationHandler.Update().
-func NewCustomConfigurationHandler[T any](newConfigFile, hardlink string, update func() T, logger *slog.Logger) (*ConfigurationHandlerBase[T], error) {
+func NewCustomConfigurationHandler[T any](newConfigFile, hardlink string, update func() T, logger *slog.Logger, opts ...ConfigurationOption) (*ConfigurationHandlerBase[T], error) {
 	log := global.HandleNilLogger(logger).With(
 		slog.String(handlerLogKey, "configuration"),
 		slog.String(typeKey, "custom"),
 		slog.String("newConfigFile", newConfigFile),
 		slog.String("hardlink", hardlink))
 	return newConfigurationHandlerBase(
-		newConfigFile, hardlink, update, log, filesystem.New(log))
+		newConfigFile, hardlink, update, log, filesystem.New(log, newConfigurationOptions(opts).fsOpts...), opts...)
+}
+
+// NewJSONPatchConfigurationHandler returns a new ConfigurationHandler and an error if any occurred. Changes to
+// a patchFile with a JSON Patch document (RFC 6902) will be watched and when Update is called the patch will be applied
+// to a JSON document from targetFile, which is then replaced atomically. A patched document is written indented with
+// sorted keys. If any operation fails (e.g. a test operation doesn't match), targetFile is left untouched. The patch is
+// applied on every update, so Update should be called once per change of the patchFile.
+func NewJSONPatchConfigurationHandler(patchFile, targetFile string, logger *slog.Logger, opts ...ConfigurationOption) (*ConfigurationHandlerBase[JSONPatchUpdateResult], error) {
+	log := global.HandleNilLogger(logger).With(
+		slog.String(handlerLogKey, "configuration"),
+		slog.String(typeKey, "json patch"),
+		slog.String("patchFile", patchFile),
+		slog.String("targetFile", targetFile))
+	fs := filesystem.New(log, newConfigurationOptions(opts).fsOpts...)
+	hardlink := patchFile + hardlinkPostfix
+	return newConfigurationHandlerBase(
+		patchFile, hardlink, updateJSONPatchedConfig(hardlink, targetFile, fs), log, fs, opts...)
+}
+
+// NewPipelineConfigurationHandler returns a new ConfigurationHandler and an error if any occurred. Changes to
+// a newConfigFile will be watched and a hardlink will be created of this file. ConfigurationHandler.Update() runs steps
+// in order: the first step gets a path of the hardlink and every next step gets an output of a previous one. An update
+// result contains an output of the last step, which must be a T, or an error of the first step that failed.
+func NewPipelineConfigurationHandler[T any](newConfigFile, hardlink string, steps []func(prev any) (any, error), logger *slog.Logger, opts ...ConfigurationOption) (*ConfigurationHandlerBase[PipelineResult[T]], error) {
+	if len(steps) == 0 {
+		return nil, errors.New("can not create pipeline configuration handler without steps")
+	}
+	for i, step := range steps {
+		if step == nil {
+			return nil, fmt.Errorf("can not create pipeline configuration handler with a nil step %d", i)
+		}
+	}
+	log := global.HandleNilLogger(logger).With(
+		slog.String(handlerLogKey, "configuration"),
+		slog.String(typeKey, "pipeline"),
+		slog.String("newConfigFile", newConfigFile),
+		slog.String("hardlink", hardlink),
+		slog.Int("steps", len(steps)))
+	return newConfigurationHandlerBase(newConfigFile, hardlink, updatePipeline[T](hardlink, append([]func(any) (any, error){}, steps...)),
+		log, filesystem.New(log, newConfigurationOptions(opts).fsOpts...), opts...)
+}
+
+// NewRegexTriggeredConfigurationHandler returns a new ConfigurationHandler and an error if any occurred. Changes to
+// a newConfigFile will be watched and a hardlink will be created of this file. A wasChanged event is nil only when
+// a content of the newConfigFile matches a pattern, otherwise it is an error wrapping ErrConfigNoMatch. The update
+// function will be called by ConfigurationHandler.Update() only if the last content matched, otherwise Update returns
+// an error wrapping ErrConfigNoMatch.
+func NewRegexTriggeredConfigurationHandler[T any](newConfigFile string, pattern *regexp.Regexp, update func() T, logger *slog.Logger, opts ...ConfigurationOption) (*ConfigurationHandlerBase[T], error) {
+	if pattern == nil {
+		return nil, errors.New("can not create regex triggered configuration handler without a pattern")
+	}
+	log := global.HandleNilLogger(logger).With(
+		slog.String(handlerLogKey, "configuration"),
+		slog.String(typeKey, "regex triggered"),
+		slog.String("newConfigFile", newConfigFile),
+		slog.String("pattern", pattern.String()))
+	return newConfigurationHandlerBase(newConfigFile, newConfigFile+hardlinkPostfix, update, log,
+		filesystem.New(log, newConfigurationOptions(opts).fsOpts...), append([]ConfigurationOption{withContentPattern(pattern)}, opts...)...)
+}
+
+// NewConfigurationHandlerWithWatcher returns a new ConfigurationHandler and an error if any occurred. It works as
+// a ConfigurationHandler returned by NewCustomConfigurationHandler, but changes to a newConfigFile are notified by
+// a watcher instead of a file watcher. The watcher is stopped when the handler is closed. A PollingWatcher without its
+// own jitter uses a jitter set by WithJitter.
+func NewConfigurationHandlerWithWatcher[T any](watcher Watcher, newConfigFile, hardlink string, update func() T, logger *slog.Logger, opts ...ConfigurationOption) (*ConfigurationHandlerBase[T], error) {
+	if watcher == nil {
+		return nil, errors.New("can not create configuration handler without a watcher")
+	}
+	log := global.HandleNilLogger(logger).With(
+		slog.String(handlerLogKey, "configuration"),
+		slog.String(typeKey, "custom"),
+		slog.String("newConfigFile", newConfigFile),
+		slog.String("hardlink", hardlink))
+	o := newConfigurationOptions(opts)
+	if polling, ok := watcher.(*PollingWatcher); ok {
+		polling.inheritJitter(o.jitter)
+	}
+	return newConfigurationHandlerBaseWithWatcher(
+		watcher, newConfigFile, hardlink, ignoreContext(update), log, filesystem.New(log, o.fsOpts...), opts...)
 }
 
 // ProcessHandler executes an application and notifies when it starts and ends. It also allows to send signals to
@@ -134,17 +430,21 @@ type ProcessHandler interface {
 	Start()
 	// Stop stops a process.
 	Stop() error
+	// StopWithTimeout stops a process and kills it if it hasn't ended after a timeout.
+	StopWithTimeout(timeout time.Duration) error
 	// Kill kills a process.
 	Kill() error
 	// Signal sends a signal to a process.
 	Signal(syscall.Signal) error
+	// Close kills a process if it's running and closes started and ended channels after it has ended.
+	Close()
 }
 
 // NewProcessHandler returns a pointer to a new CmdProcessHandler instance.
-func NewProcessHandler(cmd *exec.Cmd, logger *slog.Logger) (*CmdProcessHandler, error) {
+func NewProcessHandler(cmd *exec.Cmd, logger *slog.Logger, opts ...ProcessOption) (*CmdProcessHandler, error) {
 	log := global.HandleNilLogger(logger).With(slog.String(handlerLogKey, "process"))
 	if cmd != nil {
 		log = log.With(slog.String("command", cmd.String()))
 	}
-	return newCmdProcessHandler(cmd, log)
+	return newCmdProcessHandler(cmd, log, opts...)
 }
@@ -17,7 +17,11 @@
 package handlers
 
 import (
+	"bytes"
+	"io/fs"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/k-lb/entrypoint-framework/handlers/internal/global"
 	"github.com/k-lb/entrypoint-framework/handlers/internal/mocks"
@@ -34,18 +38,145 @@ type HandlersTestSuite struct {
 
 type mocksControl struct {
 	*m.Controller
-	fs      *mocks.MockFilesystem
-	watcher *mocks.MockWatcher
+	fs         *mocks.MockFilesystem
+	watcher    *mocks.MockWatcher
+	dirWatcher *mocks.MockWatcher
 }
 
 func (mock *mocksControl) init(activationFile string, initialExists bool) chan struct{} {
 	filePresenceChanged := make(chan struct{}, 1)
 	mock.watcher.EXPECT().GetNotificationChannel().Times(1).Return(filePresenceChanged)
 	mock.fs.EXPECT().NewFileWatcher(m.Any(), m.Any()).Times(1).Return(mock.watcher, nil)
-	mock.fs.EXPECT().DoesExist(activationFile).Times(1).Return(initialExists)
+	mock.fs.EXPECT().Stat(activationFile).Times(1).Return(statResult(initialExists))
 	return filePresenceChanged
 }
 
+// statResult returns values returned by Filesystem.Stat for a file which exists or not.
+func statResult(exists bool) (fs.FileInfo, error) {
+	if exists {
+		return fakeFileInfo{}, nil
+	}
+	return nil, fs.ErrNotExist
+}
+
+// fakeFileInfo implements fs.FileInfo. Only methods which are overridden can be used.
+type fakeFileInfo struct {
+	fs.FileInfo
+	size    int64
+	modTime time.Time
+	mode    fs.FileMode
+}
+
+func (f fakeFileInfo) Size() int64        { return f.size }
+func (f fakeFileInfo) ModTime() time.Time { return f.modTime }
+func (f fakeFileInfo) Mode() fs.FileMode  { return f.mode }
+func (f fakeFileInfo) IsDir() bool        { return f.mode.IsDir() }
+
+// fakeClock implements global.Clock. Its time moves only when After is called and After fires immediately. All
+// durations passed to After are recorded.
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	waits []time.Duration
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.waits = append(f.waits, d)
+	f.now = f.now.Add(d)
+	c := make(chan time.Time, 1)
+	c <- f.now
+	return c
+}
+
+func (f *fakeClock) getWaits() []time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]time.Duration{}, f.waits...)
+}
+
+// manualClock implements global.Clock. Its time moves only when advance is called, which fires all channels returned
+// by After that are due. All durations passed to After are recorded.
+type manualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []manualTimer
+	waits  []time.Duration
+}
+
+// manualTimer is a channel returned by manualClock.After which fires at a time.
+type manualTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func (f *manualClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *manualClock) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.waits = append(f.waits, d)
+	c := make(chan time.Time, 1)
+	f.timers = append(f.timers, manualTimer{at: f.now.Add(d), c: c})
+	return c
+}
+
+func (f *manualClock) advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	pending := f.timers[:0]
+	for _, timer := range f.timers {
+		if timer.at.After(f.now) {
+			pending = append(pending, timer)
+		} else {
+			timer.c <- f.now
+		}
+	}
+	f.timers = pending
+}
+
+func (f *manualClock) pendingTimers() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.timers)
+}
+
+func (f *manualClock) getWaits() []time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]time.Duration{}, f.waits...)
+}
+
+// syncBuffer is a bytes.Buffer which can be written by a handler goroutine and read by a test.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.String()
+}
+
 func (h *HandlersTestSuite) RunWithMockEnv(name string, test func(mocks *mocksControl)) {
 	h.Run(name, func() {
 		ctrl := m.NewController(h.T())
@@ -54,6 +185,7 @@ func (h *HandlersTestSuite) RunWithMockEnv(name string, test func(mocks *mocksCo
 			Controller: ctrl,
 			fs:         mocks.NewMockFilesystem(ctrl),
 			watcher:    mocks.NewMockWatcher(ctrl),
+			dirWatcher: mocks.NewMockWatcher(ctrl),
 		}
 		h.T().Parallel()
 		test(mc)
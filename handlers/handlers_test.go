@@ -0,0 +1,1140 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// fakeWatcher implements Watcher. Events are pushed by a test instead of a file system.
+type fakeWatcher struct {
+	mu       sync.Mutex
+	event    *WatcherEvent
+	notifier chan struct{}
+	stopped  bool
+}
+
+func newFakeWatcher() *fakeWatcher {
+	return &fakeWatcher{notifier: make(chan struct{}, 1)}
+}
+
+func (f *fakeWatcher) push(ev WatcherEvent) {
+	f.mu.Lock()
+	f.event = &ev
+	f.mu.Unlock()
+	f.notifier <- struct{}{}
+}
+
+// notifyWithoutEvent sends a false positive notification, after which no event is pending.
+func (f *fakeWatcher) notifyWithoutEvent() {
+	f.notifier <- struct{}{}
+}
+
+func (f *fakeWatcher) GetEvent() *WatcherEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ev := f.event
+	f.event = nil
+	return ev
+}
+
+func (f *fakeWatcher) GetNotificationChannel() <-chan struct{} { return f.notifier }
+
+func (f *fakeWatcher) Stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.stopped {
+		f.stopped = true
+		close(f.notifier)
+	}
+}
+
+func (f *fakeWatcher) isStopped() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stopped
+}
+
+func (h *HandlersTestSuite) TestNewHandlersWithWatcher() {
+	h.Run("when a watcher is nil, should return an error", func() {
+		activationHandler, err := NewActivationHandlerWithWatcher(nil, "activationFile", nil)
+		h.Error(err)
+		h.Nil(activationHandler)
+		configHandler, err := NewConfigurationHandlerWithWatcher(nil, "newConfigFile", "hardlink", func() int { return 0 }, nil)
+		h.Error(err)
+		h.Nil(configHandler)
+	})
+
+	h.Run("when an activation handler is driven by a watcher, should push events of an activation file presence", func() {
+		testDir := h.T().TempDir()
+		activationFile := path.Join(testDir, "active")
+		watcher := newFakeWatcher()
+		handler, err := NewActivationHandlerWithWatcher(watcher, activationFile, nil)
+		h.Require().NoError(err)
+		h.Require().NotNil(handler)
+		h.Equal(ActivationEvent{State: false, Initial: true, Source: activationFile}, <-handler.GetWasChangedChannel())
+
+		h.Require().NoError(os.WriteFile(activationFile, []byte{}, 0664))
+		watcher.push(WatcherEvent{Operation: fsnotify.Create})
+		h.Equal(ActivationEvent{State: true, Source: activationFile}, <-handler.GetWasChangedChannel())
+
+		h.Require().NoError(os.Remove(activationFile))
+		watcher.notifyWithoutEvent()
+		watcher.push(WatcherEvent{Operation: fsnotify.Remove})
+		h.Equal(ActivationEvent{State: false, Source: activationFile}, <-handler.GetWasChangedChannel(), "should not push an event for a false positive notification")
+
+		handler.Close()
+		h.Eventually(watcher.isStopped, time.Second, time.Second/100, "should stop a watcher")
+	})
+
+	h.Run("when a configuration handler is driven by a watcher, should hardlink and update a configuration", func() {
+		testDir := h.T().TempDir()
+		newConfigFile := path.Join(testDir, "config")
+		hardlink := path.Join(testDir, "config_hardlink")
+		watcher := newFakeWatcher()
+		handler, err := NewConfigurationHandlerWithWatcher(watcher, newConfigFile, hardlink, func() string {
+			content, _ := os.ReadFile(hardlink)
+			return string(content)
+		}, nil)
+		h.Require().NoError(err)
+		h.Require().NotNil(handler)
+		h.Empty(handler.GetWasChangedChannel(), "should not push an event when a configuration doesn't exist")
+
+		h.Require().NoError(os.WriteFile(newConfigFile, []byte("content"), 0664))
+		watcher.push(WatcherEvent{Operation: fsnotify.Create})
+		h.NoError(<-handler.GetWasChangedChannel())
+		h.NoError(handler.Update())
+		h.Equal("content", <-handler.GetUpdateResultChannel())
+
+		watcher.notifyWithoutEvent()
+		watcher.push(WatcherEvent{Operation: fsnotify.Remove})
+		h.ErrorIs(<-handler.GetWasChangedChannel(), ErrConfigDeleted, "should not push an event for a false positive notification")
+
+		wasChanged := handler.GetWasChangedChannel()
+		handler.Close()
+		_, open := <-wasChanged
+		h.False(open)
+		h.True(watcher.isStopped())
+		h.NoFileExists(hardlink)
+	})
+}
+
+func (h *HandlersTestSuite) TestHandlersWatcherHealth() {
+	h.Run("when handlers use file watchers, should report their health until they are closed", func() {
+		testDir := h.T().TempDir()
+		activationFile, newConfig := path.Join(testDir, "active"), path.Join(testDir, "config")
+		activationHandler, err := NewActivationHandler(activationFile, nil)
+		h.Require().NoError(err)
+		configHandler, err := NewCustomConfigurationHandler(newConfig, newConfig+hardlinkPostfix, func() int { return 1 }, nil)
+		h.Require().NoError(err)
+		<-activationHandler.GetWasChangedChannel()
+
+		h.Require().NoError(os.WriteFile(activationFile, []byte{}, 0664))
+		h.Require().NoError(os.WriteFile(newConfig, []byte("config"), 0664))
+		<-activationHandler.GetWasChangedChannel()
+		h.NoError(<-configHandler.GetWasChangedChannel())
+		for name, health := range map[string]func() (WatcherHealth, bool){"activation": activationHandler.WatcherHealth, "configuration": configHandler.WatcherHealth} {
+			current, ok := health()
+			h.True(ok, name)
+			h.True(current.Open, name)
+			h.False(current.Stopped, name)
+			h.Positive(current.Events, name)
+			h.False(current.LastEvent.IsZero(), name)
+		}
+
+		activationHandler.Close()
+		wasChanged := configHandler.GetWasChangedChannel()
+		configHandler.Close()
+		for range wasChanged {
+		}
+		current, _ := configHandler.WatcherHealth()
+		h.True(current.Stopped)
+		h.False(current.Open, "should report a closed watcher")
+		h.Eventually(func() bool { current, _ := activationHandler.WatcherHealth(); return current.Stopped && !current.Open }, time.Second, time.Millisecond)
+	})
+
+	h.Run("when a watcher doesn't report its health, should return false", func() {
+		handler, err := NewActivationHandlerWithWatcher(newFakeWatcher(), path.Join(h.T().TempDir(), "active"), nil)
+		h.Require().NoError(err)
+		_, ok := handler.WatcherHealth()
+		h.False(ok)
+		handler.Close()
+	})
+}
+
+func (h *HandlersTestSuite) TestGlobActivationHandler() {
+	h.Run("when files are created and removed in a dir, should change an activation only for files matching a pattern", func() {
+		testDir := h.T().TempDir()
+		handler, err := NewGlobActivationHandler(testDir, "isactive-*", nil)
+		h.Require().NoError(err)
+		source := path.Join(testDir, "isactive-*")
+		h.Equal(ActivationEvent{State: false, Initial: true, Source: source}, <-handler.GetWasChangedChannel())
+
+		h.Require().NoError(os.WriteFile(path.Join(testDir, "other"), []byte{}, 0664))
+		h.Require().NoError(os.WriteFile(path.Join(testDir, "isactive-pod-1"), []byte{}, 0664))
+		h.Equal(ActivationEvent{State: true, Source: source}, <-handler.GetWasChangedChannel(), "should ignore a file which doesn't match")
+		h.Require().NoError(os.WriteFile(path.Join(testDir, "isactive-pod-2"), []byte{}, 0664))
+		h.Equal(ActivationEvent{State: true, Source: source}, <-handler.GetWasChangedChannel())
+		h.Require().NoError(os.Remove(path.Join(testDir, "isactive-pod-1")))
+		h.Equal(ActivationEvent{State: true, Source: source}, <-handler.GetWasChangedChannel(), "should stay active while any file matches")
+		h.Require().NoError(os.Remove(path.Join(testDir, "other")))
+		h.Require().NoError(os.Remove(path.Join(testDir, "isactive-pod-2")))
+		h.Equal(ActivationEvent{State: false, Source: source}, <-handler.GetWasChangedChannel())
+		h.Empty(handler.GetWasChangedChannel(), "should not push events for a file which doesn't match")
+
+		handler.Close()
+	})
+}
+
+func (h *HandlersTestSuite) TestSingleFileConfigurationHandler() {
+	h.Run("when a new configuration is changed, should tell if an old configuration was changed by an update", func() {
+		testDir := h.T().TempDir()
+		newConfig, oldConfig := path.Join(testDir, "new.conf"), path.Join(testDir, "app.conf")
+		handler, err := NewSingleFileConfigurationHandler(newConfig, oldConfig, nil)
+		h.Require().NoError(err)
+
+		for _, step := range [...]struct {
+			content         string
+			expectedChanged bool
+		}{
+			{content: "content", expectedChanged: true},
+			{content: "content", expectedChanged: false},
+			{content: "new content", expectedChanged: true},
+		} {
+			h.Require().NoError(os.WriteFile(newConfig+".new", []byte(step.content), 0664))
+			h.Require().NoError(os.Rename(newConfig+".new", newConfig))
+			h.NoError(<-handler.GetWasChangedChannel())
+			h.Require().NoError(handler.Update())
+			result := <-handler.GetUpdateResultChannel()
+			h.NoError(result.Err)
+			h.Equal(step.expectedChanged, result.Changed, step.content)
+			content, err := os.ReadFile(oldConfig)
+			h.NoError(err)
+			h.Equal(step.content, string(content))
+		}
+
+		wasChanged := handler.GetWasChangedChannel()
+		handler.Close()
+		for range wasChanged {
+		}
+	})
+}
+
+func (h *HandlersTestSuite) TestSingleFileConfigurationHandlerSymlink() {
+	h.Run("when a new configuration is a symlink of a ConfigMap volume, should apply a target after a ..data swap", func() {
+		testDir := h.T().TempDir()
+		volume, oldConfig := path.Join(testDir, "volume"), path.Join(testDir, "app.conf")
+		h.Require().NoError(os.Mkdir(volume, os.ModePerm))
+		// swap updates the volume as kubelet does, by atomically replacing a ..data symlink to a new data dir.
+		swap := func(version string) {
+			dataDir := ".." + version
+			h.Require().NoError(os.Mkdir(path.Join(volume, dataDir), os.ModePerm))
+			h.Require().NoError(os.WriteFile(path.Join(volume, dataDir, "app.conf"), []byte(version), 0664))
+			h.Require().NoError(os.Symlink(dataDir, path.Join(volume, "..data_tmp")))
+			h.Require().NoError(os.Rename(path.Join(volume, "..data_tmp"), path.Join(volume, "..data")))
+		}
+		swap("v1")
+		newConfig := path.Join(volume, "app.conf")
+		h.Require().NoError(os.Symlink(path.Join("..data", "app.conf"), newConfig))
+		handler, err := NewSingleFileConfigurationHandler(newConfig, oldConfig, nil)
+		h.Require().NoError(err)
+
+		for i, version := range []string{"v1", "v2", "v3"} {
+			if i > 0 {
+				swap(version)
+			}
+			h.NoError(<-handler.GetWasChangedChannel(), version)
+			h.Require().NoError(handler.Update())
+			result := <-handler.GetUpdateResultChannel()
+			h.NoError(result.Err)
+			h.True(result.Changed, version)
+			content, err := os.ReadFile(oldConfig)
+			h.NoError(err)
+			h.Equal(version, string(content))
+		}
+
+		wasChanged := handler.GetWasChangedChannel()
+		handler.Close()
+		for range wasChanged {
+		}
+		h.NoFileExists(newConfig + hardlinkPostfix)
+	})
+}
+
+func (h *HandlersTestSuite) TestConfigurationHandlerCloseWithPendingEvents() {
+	h.Run("when a handler is closed while a new configuration changes rapidly, should close its channels", func() {
+		testDir := h.T().TempDir()
+		newConfig, oldConfig := path.Join(testDir, "new.conf"), path.Join(testDir, "app.conf")
+		for i := 0; i < 20; i++ {
+			handler, err := NewSingleFileConfigurationHandler(newConfig, oldConfig, nil)
+			h.Require().NoError(err)
+			stopWriting := make(chan struct{})
+			written := make(chan struct{})
+			go func() {
+				defer close(written)
+				for {
+					select {
+					case <-stopWriting:
+						return
+					default:
+						os.WriteFile(newConfig+".new", []byte("content"), 0664)
+						os.Rename(newConfig+".new", newConfig)
+					}
+				}
+			}()
+			wasChanged, updateResult := handler.GetWasChangedChannel(), handler.GetUpdateResultChannel()
+			<-wasChanged
+			h.Require().NoError(handler.Update())
+			handler.Close()
+			closed := make(chan struct{})
+			go func() {
+				defer close(closed)
+				for range wasChanged {
+				}
+				for range updateResult {
+				}
+			}()
+			select {
+			case <-closed:
+			case <-time.After(5 * time.Second):
+				h.Fail("channels weren't closed after Close")
+			}
+			close(stopWriting)
+			<-written
+		}
+	})
+}
+
+func (h *HandlersTestSuite) TestGzippedSingleFileConfigurationHandler() {
+	h.Run("when a new configuration is gzipped, should update an old configuration with a decompressed content", func() {
+		testDir := h.T().TempDir()
+		newGzFile, oldConfigFile := path.Join(testDir, "app.conf.gz"), path.Join(testDir, "app.conf")
+		h.Require().NoError(os.WriteFile(oldConfigFile, []byte("old content"), 0664))
+		handler, err := NewGzippedSingleFileConfigurationHandler(newGzFile, oldConfigFile, nil)
+		h.Require().NoError(err)
+
+		h.writeGzipFile(newGzFile+".new", []byte("new content"))
+		h.Require().NoError(os.Rename(newGzFile+".new", newGzFile))
+		h.NoError(<-handler.GetWasChangedChannel())
+		h.Require().NoError(handler.Update())
+		h.NoError(<-handler.GetUpdateResultChannel())
+		content, err := os.ReadFile(oldConfigFile)
+		h.NoError(err)
+		h.Equal("new content", string(content))
+
+		h.Require().NoError(os.WriteFile(newGzFile+".new", []byte("corrupt content"), 0664))
+		h.Require().NoError(os.Rename(newGzFile+".new", newGzFile))
+		h.NoError(<-handler.GetWasChangedChannel())
+		h.Require().NoError(handler.Update())
+		h.Error(<-handler.GetUpdateResultChannel(), "should return an error of a corrupt gzip file")
+		content, err = os.ReadFile(oldConfigFile)
+		h.NoError(err)
+		h.Equal("new content", string(content), "should leave an old configuration untouched")
+
+		wasChanged := handler.GetWasChangedChannel()
+		handler.Close()
+		for range wasChanged {
+		}
+	})
+}
+
+func (h *HandlersTestSuite) TestRegexTriggeredConfigurationHandler() {
+	h.Run("when a pattern is nil, should return an error", func() {
+		handler, err := NewRegexTriggeredConfigurationHandler("newConfigFile", nil, func() int { return 0 }, nil)
+		h.Error(err)
+		h.Nil(handler)
+	})
+
+	h.Run("when a content of a new configuration changes, should push events depending on a pattern match", func() {
+		testDir := h.T().TempDir()
+		newConfigFile := path.Join(testDir, "config")
+		handler, err := NewRegexTriggeredConfigurationHandler(newConfigFile, regexp.MustCompile(`(?m)^# ready$`), func() string {
+			content, _ := os.ReadFile(newConfigFile + hardlinkPostfix)
+			return string(content)
+		}, nil)
+		h.Require().NoError(err)
+
+		h.Require().NoError(os.WriteFile(newConfigFile+".new", []byte("key=value\n"), 0664))
+		h.Require().NoError(os.Rename(newConfigFile+".new", newConfigFile))
+		h.ErrorIs(<-handler.GetWasChangedChannel(), ErrConfigNoMatch)
+		h.ErrorIs(handler.Update(), ErrConfigNoMatch)
+
+		h.Require().NoError(os.WriteFile(newConfigFile+".new", []byte("key=value\n# ready\n"), 0664))
+		h.Require().NoError(os.Rename(newConfigFile+".new", newConfigFile))
+		h.NoError(<-handler.GetWasChangedChannel())
+		h.Require().NoError(handler.Update())
+		h.Equal("key=value\n# ready\n", <-handler.GetUpdateResultChannel())
+
+		wasChanged := handler.GetWasChangedChannel()
+		handler.Close()
+		for range wasChanged {
+		}
+	})
+}
+
+func (h *HandlersTestSuite) TestJSONPatchConfigurationHandler() {
+	h.Run("when patches are moved to a patch file, should apply them to a target file on update", func() {
+		testDir := h.T().TempDir()
+		patchFile, targetFile := path.Join(testDir, "patch.json"), path.Join(testDir, "config.json")
+		h.Require().NoError(os.WriteFile(targetFile, []byte(`{"replicas":1,"debug":true,"hosts":["a"]}`), 0640))
+		handler, err := NewJSONPatchConfigurationHandler(patchFile, targetFile, nil)
+		h.Require().NoError(err)
+		applyPatch := func(patch string) JSONPatchUpdateResult {
+			h.Require().NoError(os.WriteFile(patchFile+".new", []byte(patch), 0664))
+			h.Require().NoError(os.Rename(patchFile+".new", patchFile))
+			h.NoError(<-handler.GetWasChangedChannel())
+			h.Require().NoError(handler.Update())
+			return <-handler.GetUpdateResultChannel()
+		}
+
+		result := applyPatch(`[
+			{"op":"test","path":"/replicas","value":1},
+			{"op":"replace","path":"/replicas","value":3},
+			{"op":"remove","path":"/debug"},
+			{"op":"add","path":"/hosts/-","value":"b"}
+		]`)
+		h.NoError(result.Err)
+		h.Equal([]string{"/replicas", "/debug", "/hosts/-"}, result.Paths)
+		content, err := os.ReadFile(targetFile)
+		h.NoError(err)
+		h.JSONEq(`{"replicas":3,"hosts":["a","b"]}`, string(content))
+		stat, err := os.Stat(targetFile)
+		h.Require().NoError(err)
+		h.Equal(os.FileMode(0640), stat.Mode().Perm(), "should keep a mode of a target file")
+
+		result = applyPatch(`[{"op":"remove","path":"/hosts/0"},{"op":"test","path":"/replicas","value":1}]`)
+		h.ErrorIs(result.Err, ErrJSONPatchTestFailed)
+		h.Empty(result.Paths)
+		after, err := os.ReadFile(targetFile)
+		h.NoError(err)
+		h.Equal(string(content), string(after), "should leave a target file untouched")
+
+		wasChanged := handler.GetWasChangedChannel()
+		handler.Close()
+		for range wasChanged {
+		}
+	})
+}
+
+func (h *HandlersTestSuite) TestPipelineConfigurationHandler() {
+	h.Run("when there are no steps, should return an error", func() {
+		handler, err := NewPipelineConfigurationHandler[string]("newConfigFile", "hardlink", nil, nil)
+		h.Error(err)
+		h.Nil(handler)
+	})
+
+	h.Run("when a step is nil, should return an error", func() {
+		handler, err := NewPipelineConfigurationHandler[string]("newConfigFile", "hardlink", []func(any) (any, error){nil}, nil)
+		h.Error(err)
+		h.Nil(handler)
+	})
+
+	h.Run("when a new configuration changes, should run steps on a hardlink on update", func() {
+		testDir := h.T().TempDir()
+		newConfigFile, hardlink := path.Join(testDir, "config"), path.Join(testDir, "config.hardlink")
+		steps := []func(any) (any, error){
+			func(prev any) (any, error) { return os.ReadFile(prev.(string)) },
+			func(prev any) (any, error) { return strings.ToUpper(string(prev.([]byte))), nil },
+			func(prev any) (any, error) {
+				if !strings.HasPrefix(prev.(string), "KEY=") {
+					return nil, errors.New("invalid configuration")
+				}
+				return prev, nil
+			},
+		}
+		handler, err := NewPipelineConfigurationHandler[string](newConfigFile, hardlink, steps, nil)
+		h.Require().NoError(err)
+
+		h.Require().NoError(os.WriteFile(newConfigFile+".new", []byte("key=value"), 0664))
+		h.Require().NoError(os.Rename(newConfigFile+".new", newConfigFile))
+		h.NoError(<-handler.GetWasChangedChannel())
+		h.Require().NoError(handler.Update())
+		result := <-handler.GetUpdateResultChannel()
+		h.NoError(result.Err)
+		h.Equal("KEY=VALUE", result.Value)
+
+		h.Require().NoError(os.WriteFile(newConfigFile+".new", []byte("value"), 0664))
+		h.Require().NoError(os.Rename(newConfigFile+".new", newConfigFile))
+		h.NoError(<-handler.GetWasChangedChannel())
+		h.Require().NoError(handler.Update())
+		result = <-handler.GetUpdateResultChannel()
+		h.ErrorContains(result.Err, "invalid configuration", "should return an error of a failing validation step")
+
+		wasChanged := handler.GetWasChangedChannel()
+		handler.Close()
+		for range wasChanged {
+		}
+	})
+}
+
+func (h *HandlersTestSuite) TestTarredConfigurationHandlerBootstrap() {
+	h.Run("when an old config dir doesn't exist, should create it with all files of a new configuration", func() {
+		testDir := h.T().TempDir()
+		newConfigFile := path.Join(testDir, "config.tar")
+		newConfigDir, oldConfigDir := path.Join(testDir, "new"), path.Join(testDir, "not", "existing", "old")
+		h.writeTarball(newConfigFile, map[string]string{"a": "a content", "b": "b content"})
+		handler, err := NewTarredConfigurationHandler(newConfigFile, newConfigDir, oldConfigDir, nil)
+		h.Require().NoError(err)
+		h.NoError(<-handler.GetWasChangedChannel())
+
+		h.Require().NoError(handler.Update())
+		result := <-handler.GetUpdateResultChannel()
+		h.NoError(result.Err)
+		h.Equal([]string{"a", "b"}, result.Created())
+		h.DirExists(oldConfigDir)
+		content, err := os.ReadFile(path.Join(oldConfigDir, "b"))
+		h.NoError(err)
+		h.Equal("b content", string(content))
+
+		wasChanged := handler.GetWasChangedChannel()
+		handler.Close()
+		for range wasChanged {
+		}
+	})
+}
+
+func (h *HandlersTestSuite) TestTarredConfigurationHandlerAppliedFiles() {
+	h.Run("when a configuration is applied, should list files of an old config dir", func() {
+		testDir := h.T().TempDir()
+		newConfigFile := path.Join(testDir, "config.tar")
+		newConfigDir, oldConfigDir := path.Join(testDir, "new"), path.Join(testDir, "old")
+		h.writeTarball(newConfigFile, map[string]string{"a": "a", "b": "b", "c": "c"})
+		handler, err := NewTarredConfigurationHandler(newConfigFile, newConfigDir, oldConfigDir, nil)
+		h.Require().NoError(err)
+		h.NoError(<-handler.GetWasChangedChannel())
+		h.Require().NoError(handler.Update())
+		h.NoError((<-handler.GetUpdateResultChannel()).Err)
+
+		files, err := handler.AppliedFiles()
+		h.NoError(err)
+		h.Equal([]string{"a", "b", "c"}, files)
+
+		h.writeTarball(newConfigFile+".new", map[string]string{"a": "a", "c": "new c"})
+		h.Require().NoError(os.Rename(newConfigFile+".new", newConfigFile))
+		h.NoError(<-handler.GetWasChangedChannel())
+		h.Require().NoError(handler.Update())
+		h.NoError((<-handler.GetUpdateResultChannel()).Err)
+
+		files, err = handler.AppliedFiles()
+		h.NoError(err)
+		h.Equal([]string{"a", "c"}, files, "should reflect deleted files")
+
+		wasChanged := handler.GetWasChangedChannel()
+		handler.Close()
+		for range wasChanged {
+		}
+	})
+}
+
+func (h *HandlersTestSuite) TestTarredConfigurationHandlerStripComponents() {
+	h.Run("when a new configuration has a versioned top-level dir and it is stripped, should apply files to the top of an old config dir", func() {
+		testDir := h.T().TempDir()
+		newConfigFile := path.Join(testDir, "config.tar")
+		newConfigDir, oldConfigDir := path.Join(testDir, "new"), path.Join(testDir, "old")
+		h.writeTarball(newConfigFile, map[string]string{"release-1.2.3/a": "a content", "release-1.2.3/b": "b content"})
+		handler, err := NewTarredConfigurationHandler(newConfigFile, newConfigDir, oldConfigDir, nil, WithStripComponents(1))
+		h.Require().NoError(err)
+		h.NoError(<-handler.GetWasChangedChannel())
+
+		h.Require().NoError(handler.Update())
+		result := <-handler.GetUpdateResultChannel()
+		h.NoError(result.Err)
+		h.Equal([]string{"a", "b"}, result.Created())
+		content, err := os.ReadFile(path.Join(oldConfigDir, "b"))
+		h.NoError(err)
+		h.Equal("b content", string(content))
+
+		wasChanged := handler.GetWasChangedChannel()
+		handler.Close()
+		for range wasChanged {
+		}
+	})
+}
+
+func (h *HandlersTestSuite) TestTarredConfigurationHandlerHashComparison() {
+	h.Run("when files are compared by hash, should report only files with different contents as modified", func() {
+		testDir := h.T().TempDir()
+		newConfigFile := path.Join(testDir, "config.tar")
+		newConfigDir, oldConfigDir := path.Join(testDir, "new"), path.Join(testDir, "old")
+		h.writeTarball(newConfigFile, map[string]string{"same": "same content", "changed": "old content"})
+		handler, err := NewTarredConfigurationHandler(newConfigFile, newConfigDir, oldConfigDir, nil, WithHashComparison(sha256.New))
+		h.Require().NoError(err)
+		h.NoError(<-handler.GetWasChangedChannel())
+		h.Require().NoError(handler.Update())
+		h.NoError((<-handler.GetUpdateResultChannel()).Err)
+
+		h.writeTarball(newConfigFile+".new", map[string]string{"same": "same content", "changed": "new content"})
+		h.Require().NoError(os.Rename(newConfigFile+".new", newConfigFile))
+		h.NoError(<-handler.GetWasChangedChannel())
+		h.Require().NoError(handler.Update())
+		result := <-handler.GetUpdateResultChannel()
+		h.NoError(result.Err)
+		h.Equal(map[string]Modification{"changed": Modified}, result.ChangedFiles)
+
+		wasChanged := handler.GetWasChangedChannel()
+		handler.Close()
+		for range wasChanged {
+		}
+	})
+}
+
+func (h *HandlersTestSuite) TestTarredConfigurationHandlerFileComparator() {
+	compareJSON := func(newFile, oldFile string) (bool, error) {
+		values := [2]any{}
+		for i, file := range [...]string{newFile, oldFile} {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				return false, err
+			} else if err := json.Unmarshal(content, &values[i]); err != nil {
+				return false, err
+			}
+		}
+		return !reflect.DeepEqual(values[0], values[1]), nil
+	}
+	testCases := [...]struct {
+		name            string
+		opts            []ConfigurationOption
+		expectedChanged map[string]Modification
+	}{
+		{name: "when files are compared byte by byte, should report a file with reordered keys as modified",
+			expectedChanged: map[string]Modification{"reordered.json": Modified, "changed.json": Modified}},
+		{name: "when files are compared by a JSON comparator, should report only a file with a changed value as modified",
+			opts: []ConfigurationOption{WithFileComparator(compareJSON)}, expectedChanged: map[string]Modification{"changed.json": Modified}},
+	}
+	for _, test := range testCases {
+		test := test
+		h.Run(test.name, func() {
+			testDir := h.T().TempDir()
+			newConfigFile := path.Join(testDir, "config.tar")
+			newConfigDir, oldConfigDir := path.Join(testDir, "new"), path.Join(testDir, "old")
+			h.writeTarball(newConfigFile, map[string]string{"reordered.json": `{"a": 1, "b": 2}`, "changed.json": `{"a": 1}`})
+			handler, err := NewTarredConfigurationHandler(newConfigFile, newConfigDir, oldConfigDir, nil, test.opts...)
+			h.Require().NoError(err)
+			h.NoError(<-handler.GetWasChangedChannel())
+			h.Require().NoError(handler.Update())
+			h.NoError((<-handler.GetUpdateResultChannel()).Err)
+
+			h.writeTarball(newConfigFile+".new", map[string]string{"reordered.json": `{"b":2,"a":1}`, "changed.json": `{"a": 2}`})
+			h.Require().NoError(os.Rename(newConfigFile+".new", newConfigFile))
+			h.NoError(<-handler.GetWasChangedChannel())
+			h.Require().NoError(handler.Update())
+			result := <-handler.GetUpdateResultChannel()
+			h.NoError(result.Err)
+			h.Equal(test.expectedChanged, result.ChangedFiles)
+
+			wasChanged := handler.GetWasChangedChannel()
+			handler.Close()
+			for range wasChanged {
+			}
+		})
+	}
+}
+
+func (h *HandlersTestSuite) TestTarredConfigurationHandlerWithContext() {
+	h.Run("when a context isn't done, should hardlink an initial configuration and push an event", func() {
+		testDir := h.T().TempDir()
+		newConfigFile := path.Join(testDir, "config.tar")
+		h.writeTarball(newConfigFile, map[string]string{"file": "content"})
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		handler, err := NewTarredConfigurationHandlerWithContext(ctx, newConfigFile, path.Join(testDir, "new"), path.Join(testDir, "old"), nil)
+		h.Require().NoError(err)
+		h.NoError(<-handler.GetWasChangedChannel())
+		h.FileExists(newConfigFile + hardlinkPostfix)
+
+		wasChanged := handler.GetWasChangedChannel()
+		handler.Close()
+		for range wasChanged {
+		}
+	})
+}
+
+func (h *HandlersTestSuite) TestTarredConfigurationHandlerPermissionRules() {
+	h.Run("when permission rules are set, should apply their modes and report no changes for an unchanged configuration", func() {
+		testDir := h.T().TempDir()
+		newConfigFile := path.Join(testDir, "config.tar")
+		newConfigDir, oldConfigDir := path.Join(testDir, "new"), path.Join(testDir, "old")
+		files := map[string]string{"tls.key": "key", "app.conf": "conf", "other": "other"}
+		h.writeTarball(newConfigFile, files)
+		rules := []PermissionRule{{Glob: "*.key", Mode: 0600}, {Glob: "*.conf", Mode: 0644}}
+		handler, err := NewTarredConfigurationHandler(newConfigFile, newConfigDir, oldConfigDir, nil, WithPermissionRules(rules))
+		h.Require().NoError(err)
+		h.NoError(<-handler.GetWasChangedChannel())
+		h.Require().NoError(handler.Update())
+		h.NoError((<-handler.GetUpdateResultChannel()).Err)
+		for name, expected := range map[string]os.FileMode{"tls.key": 0600, "app.conf": 0644} {
+			info, err := os.Stat(path.Join(oldConfigDir, name))
+			h.Require().NoError(err)
+			h.Equal(expected, info.Mode().Perm(), name)
+		}
+
+		h.writeTarball(newConfigFile+".new", files)
+		h.Require().NoError(os.Rename(newConfigFile+".new", newConfigFile))
+		h.NoError(<-handler.GetWasChangedChannel())
+		h.Require().NoError(handler.Update())
+		result := <-handler.GetUpdateResultChannel()
+		h.NoError(result.Err)
+		h.Empty(result.ChangedFiles, "should keep applied modes stable")
+
+		wasChanged := handler.GetWasChangedChannel()
+		handler.Close()
+		for range wasChanged {
+		}
+	})
+
+	h.Run("when a glob of a rule is malformed, should return an error", func() {
+		testDir := h.T().TempDir()
+		handler, err := NewTarredConfigurationHandler(path.Join(testDir, "config.tar"), path.Join(testDir, "new"), path.Join(testDir, "old"), nil,
+			WithPermissionRules([]PermissionRule{{Glob: "[", Mode: 0600}}))
+
+		h.ErrorIs(err, path.ErrBadPattern)
+		h.Nil(handler)
+	})
+}
+
+func (h *HandlersTestSuite) TestTarredConfigurationHandlerEnvInterpolation() {
+	h.T().Setenv("ENTRYPOINT_TEST_HOST", "localhost")
+	h.T().Setenv("ENTRYPOINT_TEST_SECRET", "secret")
+	files := map[string]string{"app.conf": "host: ${ENTRYPOINT_TEST_HOST}", "secret.conf": "secret: ${ENTRYPOINT_TEST_SECRET}"}
+
+	h.Run("when extracted files contain placeholders, should substitute only allowlisted variables", func() {
+		testDir := h.T().TempDir()
+		newConfigFile := path.Join(testDir, "config.tar")
+		newConfigDir, oldConfigDir := path.Join(testDir, "new"), path.Join(testDir, "old")
+		h.writeTarball(newConfigFile, files)
+		handler, err := NewTarredConfigurationHandler(newConfigFile, newConfigDir, oldConfigDir, nil, WithEnvInterpolation([]string{"ENTRYPOINT_TEST_HOST"}))
+		h.Require().NoError(err)
+		h.NoError(<-handler.GetWasChangedChannel())
+		h.Require().NoError(handler.Update())
+		h.NoError((<-handler.GetUpdateResultChannel()).Err)
+
+		for name, expected := range map[string]string{"app.conf": "host: localhost", "secret.conf": "secret: ${ENTRYPOINT_TEST_SECRET}"} {
+			content, err := os.ReadFile(path.Join(oldConfigDir, name))
+			h.NoError(err, name)
+			h.Equal(expected, string(content), name)
+		}
+
+		h.Require().NoError(handler.ForceUpdate())
+		result := <-handler.GetUpdateResultChannel()
+		h.NoError(result.Err)
+		h.Empty(result.ChangedFiles, "shouldn't report interpolated files as modified")
+
+		wasChanged := handler.GetWasChangedChannel()
+		handler.Close()
+		for range wasChanged {
+		}
+	})
+
+	h.Run("when an interpolation is strict and a placeholder isn't allowlisted, should fail an update and leave an old config dir untouched", func() {
+		testDir := h.T().TempDir()
+		newConfigFile := path.Join(testDir, "config.tar")
+		newConfigDir, oldConfigDir := path.Join(testDir, "new"), path.Join(testDir, "old")
+		h.writeTarball(newConfigFile, files)
+		handler, err := NewTarredConfigurationHandler(newConfigFile, newConfigDir, oldConfigDir, nil,
+			WithEnvInterpolation([]string{"ENTRYPOINT_TEST_HOST"}), WithStrictEnvInterpolation())
+		h.Require().NoError(err)
+		h.NoError(<-handler.GetWasChangedChannel())
+		h.Require().NoError(handler.Update())
+		result := <-handler.GetUpdateResultChannel()
+
+		h.ErrorIs(result.Err, ErrUnknownPlaceholder)
+		h.NoDirExists(oldConfigDir)
+
+		wasChanged := handler.GetWasChangedChannel()
+		handler.Close()
+		for range wasChanged {
+		}
+	})
+}
+
+func (h *HandlersTestSuite) TestTarredConfigurationHandlerPreserveFailedExtraction() {
+	h.T().Setenv("ENTRYPOINT_TEST_HOST", "localhost")
+
+	h.Run("when an update fails, should preserve extracted files before the next update clears a new config dir", func() {
+		testDir := h.T().TempDir()
+		newConfigFile := path.Join(testDir, "config.tar")
+		newConfigDir, oldConfigDir, preservedDir := path.Join(testDir, "new"), path.Join(testDir, "old"), path.Join(testDir, "preserved")
+		h.writeTarball(newConfigFile, map[string]string{"app.conf": "host: ${ENTRYPOINT_TEST_UNKNOWN}"})
+		handler, err := NewTarredConfigurationHandler(newConfigFile, newConfigDir, oldConfigDir, nil,
+			WithEnvInterpolation([]string{"ENTRYPOINT_TEST_HOST"}), WithStrictEnvInterpolation(), WithPreserveFailedExtraction(preservedDir))
+		h.Require().NoError(err)
+		h.NoError(<-handler.GetWasChangedChannel())
+		h.Require().NoError(handler.Update())
+		h.ErrorIs((<-handler.GetUpdateResultChannel()).Err, ErrUnknownPlaceholder)
+
+		h.writeTarball(newConfigFile+".new", map[string]string{"app.conf": "host: ${ENTRYPOINT_TEST_HOST}"})
+		h.Require().NoError(os.Rename(newConfigFile+".new", newConfigFile))
+		h.NoError(<-handler.GetWasChangedChannel())
+		h.Require().NoError(handler.Update())
+		h.NoError((<-handler.GetUpdateResultChannel()).Err)
+
+		copies, err := os.ReadDir(preservedDir)
+		h.Require().NoError(err)
+		h.Require().Len(copies, 1, "only a failed update should be preserved")
+		content, err := os.ReadFile(path.Join(preservedDir, copies[0].Name(), "app.conf"))
+		h.NoError(err)
+		h.Equal("host: ${ENTRYPOINT_TEST_UNKNOWN}", string(content))
+		h.NoFileExists(path.Join(newConfigDir, "app.conf"), "the next update should have cleared a new config dir")
+
+		wasChanged := handler.GetWasChangedChannel()
+		handler.Close()
+		for range wasChanged {
+		}
+	})
+}
+
+func (h *HandlersTestSuite) TestTarredConfigurationHandlerPruneEmptyDirs() {
+	testCases := [...]struct {
+		name         string
+		oldFiles     []string
+		opts         []ConfigurationOption
+		expectedDirs []string
+		removedDirs  []string
+	}{
+		{name: "when the last file of a subdirectory is deleted, should remove the subdirectory",
+			oldFiles:    []string{"app.conf", "sub/file"},
+			removedDirs: []string{"sub"}},
+		{name: "when the last files of nested subdirectories are deleted, should remove all of them",
+			oldFiles:    []string{"app.conf", "a/b/c/file", "a/b/file"},
+			removedDirs: []string{"a/b/c", "a/b", "a"}},
+		{name: "when pruning is disabled, should keep empty subdirectories",
+			oldFiles:     []string{"app.conf", "sub/file"},
+			opts:         []ConfigurationOption{WithPruneEmptyDirs(false)},
+			expectedDirs: []string{"sub"}},
+	}
+	for _, test := range testCases {
+		test := test
+		h.Run(test.name, func() {
+			testDir := h.T().TempDir()
+			newConfigFile := path.Join(testDir, "config.tar")
+			newConfigDir, oldConfigDir := path.Join(testDir, "new"), path.Join(testDir, "old")
+			for _, file := range test.oldFiles {
+				h.Require().NoError(os.MkdirAll(path.Dir(path.Join(oldConfigDir, file)), os.ModePerm))
+				h.Require().NoError(os.WriteFile(path.Join(oldConfigDir, file), []byte(file), 0664))
+			}
+			h.writeTarball(newConfigFile, map[string]string{"app.conf": "app.conf"})
+			handler, err := NewTarredConfigurationHandler(newConfigFile, newConfigDir, oldConfigDir, nil, test.opts...)
+			h.Require().NoError(err)
+			h.NoError(<-handler.GetWasChangedChannel())
+			h.Require().NoError(handler.Update())
+			h.NoError((<-handler.GetUpdateResultChannel()).Err)
+
+			for _, dir := range test.expectedDirs {
+				h.DirExists(path.Join(oldConfigDir, dir))
+			}
+			for _, dir := range test.removedDirs {
+				h.NoDirExists(path.Join(oldConfigDir, dir))
+			}
+			h.FileExists(path.Join(oldConfigDir, "app.conf"))
+
+			wasChanged := handler.GetWasChangedChannel()
+			handler.Close()
+			for range wasChanged {
+			}
+		})
+	}
+}
+
+func (h *HandlersTestSuite) TestTarredConfigurationHandlerSchemaGate() {
+	errExtract := errors.New("extract error")
+	// extractVersion reads a version from a schema_version file of a dir.
+	extractVersion := func(dir string) (int, error) {
+		content, err := os.ReadFile(path.Join(dir, "schema_version"))
+		if err != nil {
+			return 0, err
+		}
+		return strconv.Atoi(string(content))
+	}
+	testCases := [...]struct {
+		name            string
+		extract         func(string) (int, error)
+		version         string
+		expectedErr     error
+		expectedContent string
+	}{
+		{name: "when a version is in range, should apply a configuration", extract: extractVersion, version: "3", expectedContent: "new"},
+		{name: "when a version is equal to a bound, should apply a configuration", extract: extractVersion, version: "2", expectedContent: "new"},
+		{name: "when a version is out of range, should reject a configuration and keep the old one", extract: extractVersion, version: "4",
+			expectedErr: ErrSchemaVersionMismatch, expectedContent: "old"},
+		{name: "when a version can't be extracted, should reject a configuration and keep the old one",
+			extract: func(string) (int, error) { return 0, errExtract }, version: "3", expectedErr: errExtract, expectedContent: "old"},
+	}
+	for _, test := range testCases {
+		test := test
+		h.Run(test.name, func() {
+			testDir := h.T().TempDir()
+			newConfigFile := path.Join(testDir, "config.tar")
+			newConfigDir, oldConfigDir := path.Join(testDir, "new"), path.Join(testDir, "old")
+			h.Require().NoError(os.MkdirAll(oldConfigDir, os.ModePerm))
+			h.Require().NoError(os.WriteFile(path.Join(oldConfigDir, "app.conf"), []byte("old"), 0664))
+			h.writeTarball(newConfigFile, map[string]string{"app.conf": "new", "schema_version": test.version})
+			handler, err := NewTarredConfigurationHandler(newConfigFile, newConfigDir, oldConfigDir, nil, WithSchemaGate(test.extract, 2, 3))
+			h.Require().NoError(err)
+			h.NoError(<-handler.GetWasChangedChannel())
+			h.Require().NoError(handler.Update())
+
+			result := <-handler.GetUpdateResultChannel()
+			if test.expectedErr != nil {
+				h.ErrorIs(result.Err, test.expectedErr)
+				h.Empty(result.ChangedFiles)
+				h.NoFileExists(path.Join(oldConfigDir, "schema_version"))
+			} else {
+				h.NoError(result.Err)
+			}
+			content, err := os.ReadFile(path.Join(oldConfigDir, "app.conf"))
+			h.NoError(err)
+			h.Equal(test.expectedContent, string(content))
+
+			wasChanged := handler.GetWasChangedChannel()
+			handler.Close()
+			for range wasChanged {
+			}
+		})
+	}
+}
+
+func (h *HandlersTestSuite) TestTarredConfigurationHandlerPaths() {
+	h.Run("when a tarred handler is created, should return paths passed to a constructor", func() {
+		testDir := h.T().TempDir()
+		newConfigFile := path.Join(testDir, "config.tar")
+		newConfigDir, oldConfigDir := path.Join(testDir, "new"), path.Join(testDir, "old")
+		handler, err := NewTarredConfigurationHandler(newConfigFile, newConfigDir, oldConfigDir, nil)
+		h.Require().NoError(err)
+
+		h.Equal(newConfigFile, handler.NewConfigPath())
+		h.Equal(newConfigFile+hardlinkPostfix, handler.HardlinkPath())
+		h.Equal(newConfigDir, handler.NewConfigDir())
+		h.Equal(oldConfigDir, handler.OldConfigDir())
+
+		handler.Close()
+		h.NoError(<-handler.GetShutdownErrorChannel())
+	})
+}
+
+func (h *HandlersTestSuite) TestTarredConfigurationHandlerMaxFiles() {
+	files := map[string]string{"first": "first", "second": "second", "third": "third"}
+	testCases := [...]struct {
+		name        string
+		maxFiles    int
+		expectedErr error
+	}{
+		{name: "when a configuration has fewer files than allowed, should apply it", maxFiles: 4},
+		{name: "when a configuration has more files than allowed, should abort an update and leave an old config dir untouched", maxFiles: 2, expectedErr: ErrTooManyFiles},
+	}
+	for _, test := range testCases {
+		test := test
+		h.Run(test.name, func() {
+			testDir := h.T().TempDir()
+			newConfigFile := path.Join(testDir, "config.tar")
+			newConfigDir, oldConfigDir := path.Join(testDir, "new"), path.Join(testDir, "old")
+			h.Require().NoError(os.Mkdir(oldConfigDir, os.ModePerm))
+			h.Require().NoError(os.WriteFile(path.Join(oldConfigDir, "applied"), []byte("applied"), 0664))
+			h.writeTarball(newConfigFile, files)
+			handler, err := NewTarredConfigurationHandler(newConfigFile, newConfigDir, oldConfigDir, nil, WithMaxFiles(test.maxFiles))
+			h.Require().NoError(err)
+			h.NoError(<-handler.GetWasChangedChannel())
+			h.Require().NoError(handler.Update())
+			result := <-handler.GetUpdateResultChannel()
+
+			h.ErrorIs(result.Err, test.expectedErr)
+			applied, err := handler.AppliedFiles()
+			h.NoError(err)
+			if test.expectedErr != nil {
+				h.Equal([]string{"applied"}, applied)
+			} else {
+				h.Equal([]string{"first", "second", "third"}, applied)
+			}
+
+			wasChanged := handler.GetWasChangedChannel()
+			handler.Close()
+			for range wasChanged {
+			}
+		})
+	}
+}
+
+func (h *HandlersTestSuite) TestTarredConfigurationHandlerAbsoluteEntries() {
+	testCases := [...]struct {
+		name            string
+		opts            []ConfigurationOption
+		expectedApplied []string
+		expectedErr     error
+	}{
+		{name: "when a configuration has an absolute entry, should apply it relative to an old config dir", expectedApplied: []string{"absolute", "relative"}},
+		{name: "when a configuration has an absolute entry and absolute entries are rejected, should abort an update",
+			opts: []ConfigurationOption{WithRejectAbsoluteEntries()}, expectedApplied: []string{"applied"}, expectedErr: ErrUnsafeEntry},
+	}
+	for _, test := range testCases {
+		test := test
+		h.Run(test.name, func() {
+			testDir := h.T().TempDir()
+			newConfigFile := path.Join(testDir, "config.tar")
+			newConfigDir, oldConfigDir := path.Join(testDir, "new"), path.Join(testDir, "old")
+			h.Require().NoError(os.Mkdir(oldConfigDir, os.ModePerm))
+			h.Require().NoError(os.WriteFile(path.Join(oldConfigDir, "applied"), []byte("applied"), 0664))
+			h.writeTarball(newConfigFile, map[string]string{"/absolute": "absolute", "relative": "relative"})
+			handler, err := NewTarredConfigurationHandler(newConfigFile, newConfigDir, oldConfigDir, nil, test.opts...)
+			h.Require().NoError(err)
+			h.NoError(<-handler.GetWasChangedChannel())
+			h.Require().NoError(handler.Update())
+			result := <-handler.GetUpdateResultChannel()
+
+			h.ErrorIs(result.Err, test.expectedErr)
+			applied, err := handler.AppliedFiles()
+			h.NoError(err)
+			h.Equal(test.expectedApplied, applied)
+
+			wasChanged := handler.GetWasChangedChannel()
+			handler.Close()
+			for range wasChanged {
+			}
+		})
+	}
+}
+
+func (h *HandlersTestSuite) TestTarredConfigurationHandlerDirectory() {
+	h.Run("when a watched path is a directory, should push ErrConfigIsDirectory and apply a tarball which replaced it", func() {
+		testDir := h.T().TempDir()
+		newConfigFile := path.Join(testDir, "config.tar")
+		newConfigDir, oldConfigDir := path.Join(testDir, "new"), path.Join(testDir, "old")
+		h.Require().NoError(os.Mkdir(oldConfigDir, os.ModePerm))
+		h.Require().NoError(os.Mkdir(newConfigFile, os.ModePerm))
+		handler, err := NewTarredConfigurationHandler(newConfigFile, newConfigDir, oldConfigDir, nil)
+		h.Require().NoError(err)
+
+		h.ErrorIs(<-handler.GetWasChangedChannel(), ErrConfigIsDirectory)
+		h.NoFileExists(newConfigFile + hardlinkPostfix)
+		h.Require().NoError(os.WriteFile(path.Join(newConfigFile, "file"), []byte("content"), 0664))
+		h.Empty(handler.GetWasChangedChannel(), "shouldn't retry on changes inside a directory")
+
+		h.Require().NoError(os.RemoveAll(newConfigFile))
+		h.ErrorIs(<-handler.GetWasChangedChannel(), ErrConfigDeleted)
+		h.writeTarball(newConfigFile+".new", map[string]string{"file": "content"})
+		h.Require().NoError(os.Rename(newConfigFile+".new", newConfigFile))
+		h.NoError(<-handler.GetWasChangedChannel())
+		h.Require().NoError(handler.Update())
+		result := <-handler.GetUpdateResultChannel()
+		h.NoError(result.Err)
+		h.Equal([]string{"file"}, result.Created())
+
+		wasChanged := handler.GetWasChangedChannel()
+		handler.Close()
+		for range wasChanged {
+		}
+	})
+}
+
+func (h *HandlersTestSuite) TestTarredConfigurationHandlerRetarredConfiguration() {
+	h.Run("when a configuration is tarred again with new modification times, should report no changed files", func() {
+		testDir := h.T().TempDir()
+		newConfigFile := path.Join(testDir, "config.tar")
+		newConfigDir, oldConfigDir := path.Join(testDir, "new"), path.Join(testDir, "old")
+		writeTarball := func(tarball string, modTime time.Time) {
+			file, err := os.Create(tarball)
+			h.Require().NoError(err)
+			defer file.Close()
+			writer := tar.NewWriter(file)
+			defer writer.Close()
+			for _, name := range []string{"first", "second"} {
+				h.Require().NoError(writer.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0664, Size: 7, ModTime: modTime}))
+				_, err := writer.Write([]byte("content"))
+				h.Require().NoError(err)
+			}
+		}
+		writeTarball(newConfigFile, time.Now().Add(-time.Hour))
+		handler, err := NewTarredConfigurationHandler(newConfigFile, newConfigDir, oldConfigDir, nil)
+		h.Require().NoError(err)
+		h.NoError(<-handler.GetWasChangedChannel())
+		h.Require().NoError(handler.Update())
+		result := <-handler.GetUpdateResultChannel()
+		h.NoError(result.Err)
+		h.Equal([]string{"first", "second"}, result.Created())
+
+		writeTarball(newConfigFile+".new", time.Now())
+		h.Require().NoError(os.Rename(newConfigFile+".new", newConfigFile))
+		h.NoError(<-handler.GetWasChangedChannel())
+		h.Require().NoError(handler.Update())
+		result = <-handler.GetUpdateResultChannel()
+		h.NoError(result.Err)
+		h.Empty(result.ChangedFiles)
+		h.Equal(NoChange, result.Classify())
+
+		wasChanged := handler.GetWasChangedChannel()
+		handler.Close()
+		for range wasChanged {
+		}
+	})
+}
+
+func (h *HandlersTestSuite) TestTarredConfigurationHandlerRenameDetection() {
+	h.Run("when a file is renamed with an identical content, should report a rename instead of a deletion and a creation", func() {
+		testDir := h.T().TempDir()
+		newConfigFile := path.Join(testDir, "config.tar")
+		newConfigDir, oldConfigDir := path.Join(testDir, "new"), path.Join(testDir, "old")
+		h.writeTarball(newConfigFile, map[string]string{"old-name": "renamed content", "other": "other content"})
+		handler, err := NewTarredConfigurationHandler(newConfigFile, newConfigDir, oldConfigDir, nil, WithRenameDetection())
+		h.Require().NoError(err)
+		h.NoError(<-handler.GetWasChangedChannel())
+		h.Require().NoError(handler.Update())
+		h.NoError((<-handler.GetUpdateResultChannel()).Err)
+
+		h.writeTarball(newConfigFile+".new", map[string]string{"new-name": "renamed content", "other": "other content"})
+		h.Require().NoError(os.Rename(newConfigFile+".new", newConfigFile))
+		h.NoError(<-handler.GetWasChangedChannel())
+		h.Require().NoError(handler.Update())
+		result := <-handler.GetUpdateResultChannel()
+		h.NoError(result.Err)
+		h.Empty(result.ChangedFiles)
+		h.Equal([]Renamed{{From: "old-name", To: "new-name"}}, result.Renames)
+		content, err := os.ReadFile(path.Join(oldConfigDir, "new-name"))
+		h.NoError(err)
+		h.Equal("renamed content", string(content))
+		h.NoFileExists(path.Join(oldConfigDir, "old-name"))
+
+		wasChanged := handler.GetWasChangedChannel()
+		handler.Close()
+		for range wasChanged {
+		}
+	})
+}
+
+// writeGzipFile creates a gzip file with compressed content.
+func (h *HandlersTestSuite) writeGzipFile(gzipFile string, content []byte) {
+	file, err := os.Create(gzipFile)
+	h.Require().NoError(err)
+	defer file.Close()
+	writer := gzip.NewWriter(file)
+	_, err = writer.Write(content)
+	h.Require().NoError(err)
+	h.Require().NoError(writer.Close())
+}
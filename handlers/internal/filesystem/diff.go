@@ -17,14 +17,28 @@ package filesystem
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"slices"
 )
 
 // AreFilesDifferent returns:
 // true and no error if both files can be read and theirs contents or file modes are different,
 // false and no error if both files can be read and theirs contents and file modes are the same and
 // false and an error if any of files can not be read or status can not be gotten.
-func (real) AreFilesDifferent(firstFilePath, secondFilePath string) (bool, error) {
+// Modification times are never compared, so files extracted again from a re-created tarball are not different.
+// With hash comparison contents are compared by their hashes and files of different sizes or modes are not read.
+// With a content comparator contents are compared by it, unless files have different modes.
+func (r real) AreFilesDifferent(firstFilePath, secondFilePath string) (bool, error) {
+	if r.compareContents != nil {
+		return r.areFilesDifferentByComparator(firstFilePath, secondFilePath)
+	} else if r.newHash != nil {
+		return r.areFilesDifferentByHash(firstFilePath, secondFilePath)
+	}
 	content1, err := os.ReadFile(firstFilePath)
 	if err != nil {
 		return false, err
@@ -45,3 +59,141 @@ func (real) AreFilesDifferent(firstFilePath, secondFilePath string) (bool, error
 	areFileModesDifferent := stat1.Mode() != stat2.Mode()
 	return areContentsDifferent || areFileModesDifferent, nil
 }
+
+// DirsDiffer returns true and a sorted list of paths (relative to directories) of files which differ between dirA and
+// dirB trees. A file differs if it is present in only one tree or AreFilesDifferent returns true for both its copies.
+// Directories are compared only by files in them, so empty directories are ignored. It returns an error if any of
+// the directories can't be listed or files can't be compared.
+func (r real) DirsDiffer(dirA, dirB string) (bool, []string, error) {
+	namesA, err := r.ListFileNamesInDir(dirA)
+	if err != nil {
+		return false, nil, fmt.Errorf("could not list files of %s. Reason: %w", dirA, err)
+	}
+	namesB, err := r.ListFileNamesInDir(dirB)
+	if err != nil {
+		return false, nil, fmt.Errorf("could not list files of %s. Reason: %w", dirB, err)
+	}
+	onlyInB := make(map[string]bool, len(namesB))
+	for _, name := range namesB {
+		onlyInB[name] = true
+	}
+	differing := []string{}
+	for _, name := range namesA {
+		if !onlyInB[name] {
+			differing = append(differing, name)
+			continue
+		}
+		delete(onlyInB, name)
+		different, err := r.AreFilesDifferent(filepath.Join(dirA, name), filepath.Join(dirB, name))
+		if err != nil {
+			return false, nil, fmt.Errorf("could not compare files %s. Reason: %w", name, err)
+		} else if different {
+			differing = append(differing, name)
+		}
+	}
+	for name := range onlyInB {
+		differing = append(differing, name)
+	}
+	slices.Sort(differing)
+	return len(differing) > 0, differing, nil
+}
+
+// DirChecksum returns a hex encoded SHA-256 checksum of names (relative to a dir), modes and contents of all files of
+// a dir tree. Files are visited in a sorted order, so identical trees have the same checksum regardless of an order
+// of creation. Like in DirsDiffer, empty directories and modification times are ignored. It returns an error if the dir
+// can't be listed or any of files can't be read.
+func (r real) DirChecksum(dir string) (string, error) {
+	names, err := r.ListFileNamesInDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("could not list files of %s. Reason: %w", dir, err)
+	}
+	slices.Sort(names)
+	h := sha256.New()
+	for _, name := range names {
+		filePath := filepath.Join(dir, name)
+		stat, err := os.Stat(filePath)
+		if err != nil {
+			return "", fmt.Errorf("could not get a status of %s. Reason: %w", filePath, err)
+		}
+		// a size delimits a content, so a part of it can't be taken for a name of a next file.
+		fmt.Fprintf(h, "%s\x00%o\x00%d\x00", name, stat.Mode(), stat.Size())
+		if err := copyFileTo(h, filePath); err != nil {
+			return "", fmt.Errorf("could not read %s. Reason: %w", filePath, err)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// areFilesDifferentByComparator compares modes of files and if they are the same, their contents with a content
+// comparator.
+func (r real) areFilesDifferentByComparator(firstFilePath, secondFilePath string) (bool, error) {
+	stat1, err := os.Stat(firstFilePath)
+	if err != nil {
+		return false, err
+	}
+	stat2, err := os.Stat(secondFilePath)
+	if err != nil {
+		return false, err
+	}
+	if stat1.Mode() != stat2.Mode() {
+		return true, nil
+	}
+	different, err := r.compareContents(firstFilePath, secondFilePath)
+	if err != nil {
+		return false, fmt.Errorf("could not compare contents of %s and %s. Reason: %w", firstFilePath, secondFilePath, err)
+	}
+	return different, nil
+}
+
+// areFilesDifferentByHash compares sizes and modes of files and if they are the same, hashes of their contents. Files
+// are streamed through a hash, so they aren't loaded to memory.
+func (r real) areFilesDifferentByHash(firstFilePath, secondFilePath string) (bool, error) {
+	stat1, err := os.Stat(firstFilePath)
+	if err != nil {
+		return false, err
+	}
+	stat2, err := os.Stat(secondFilePath)
+	if err != nil {
+		return false, err
+	}
+	if stat1.Mode() != stat2.Mode() || stat1.Size() != stat2.Size() {
+		return true, nil
+	}
+	sum1, err := r.hashFile(firstFilePath)
+	if err != nil {
+		return false, err
+	}
+	sum2, err := r.hashFile(secondFilePath)
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Equal(sum1, sum2), nil
+}
+
+// HashFile returns a hash of a content of a filePath. A hash set with hash comparison is used, SHA-256 otherwise.
+func (r real) HashFile(filePath string) ([]byte, error) {
+	if r.newHash == nil {
+		r.newHash = sha256.New
+	}
+	return r.hashFile(filePath)
+}
+
+// hashFile returns a hash of a content of a filePath.
+func (r real) hashFile(filePath string) ([]byte, error) {
+	h := r.newHash()
+	if err := copyFileTo(h, filePath); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// copyFileTo copies a content of a filePath to w.
+func copyFileTo(w io.Writer, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
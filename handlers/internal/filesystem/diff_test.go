@@ -17,11 +17,121 @@
 package filesystem
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"hash"
 	"io/fs"
 	"os"
 	"path"
+	"time"
 )
 
+func (f *filesystemTestSuite) TestDirsDiffer() {
+	type file struct {
+		name, content string
+		mode          fs.FileMode
+	}
+	testCases := [...]struct {
+		name              string
+		filesA, filesB    []file
+		expectedDiffering []string
+	}{
+		{name: "when both trees are empty, should return false"},
+		{name: "when both trees are identical, should return false",
+			filesA: []file{{"a", "a", 0664}, {"dir/b", "b", 0664}, {"dir/inner/c", "c", 0600}},
+			filesB: []file{{"a", "a", 0664}, {"dir/b", "b", 0664}, {"dir/inner/c", "c", 0600}}},
+		{name: "when files have different contents or modes, should return their paths",
+			filesA: []file{{"same", "same", 0664}, {"dir/content", "1", 0664}, {"mode", "m", 0664}},
+			filesB: []file{{"same", "same", 0664}, {"dir/content", "2", 0664}, {"mode", "m", 0600}}, expectedDiffering: []string{"dir/content", "mode"}},
+		{name: "when files are present in only one tree, should return their paths",
+			filesA: []file{{"same", "same", 0664}, {"only a", "a", 0664}, {"dir/only a", "a", 0664}},
+			filesB: []file{{"same", "same", 0664}, {"only b", "b", 0664}}, expectedDiffering: []string{"dir/only a", "only a", "only b"}},
+	}
+	for _, test := range testCases {
+		test := test
+		f.RunWithTestDir(test.name, func(testDir string) {
+			dirA, dirB := path.Join(testDir, "a"), path.Join(testDir, "b")
+			for dir, files := range map[string][]file{dirA: test.filesA, dirB: test.filesB} {
+				f.Require().NoError(os.MkdirAll(dir, os.ModePerm))
+				for _, file := range files {
+					filePath := path.Join(dir, file.name)
+					f.Require().NoError(os.MkdirAll(path.Dir(filePath), os.ModePerm))
+					f.Require().NoError(os.WriteFile(filePath, []byte(file.content), file.mode))
+					f.Require().NoError(os.Chmod(filePath, file.mode))
+				}
+			}
+			f.Require().NoError(os.MkdirAll(path.Join(dirB, "empty"), os.ModePerm))
+
+			differ, differing, err := f.DirsDiffer(dirA, dirB)
+
+			f.NoError(err)
+			f.Equal(len(test.expectedDiffering) > 0, differ)
+			if test.expectedDiffering == nil {
+				test.expectedDiffering = []string{}
+			}
+			f.Equal(test.expectedDiffering, differing)
+		})
+	}
+
+	f.RunWithTestDir("when a directory does not exist, should return an error", func(testDir string) {
+		differ, differing, err := f.DirsDiffer(testDir, path.Join(testDir, "not existing"))
+		f.Error(err)
+		f.False(differ)
+		f.Nil(differing)
+	})
+}
+
+func (f *filesystemTestSuite) TestDirChecksum() {
+	type file struct {
+		name, content string
+		mode          fs.FileMode
+	}
+	base := []file{{"a", "a", 0664}, {"dir/b", "b", 0664}, {"dir/inner/c", "c", 0600}}
+	testCases := [...]struct {
+		name          string
+		files         []file
+		expectedEqual bool
+	}{
+		{name: "when trees are identical, should return the same checksum", files: base, expectedEqual: true},
+		{name: "when files are created in a different order, should return the same checksum",
+			files: []file{{"dir/inner/c", "c", 0600}, {"a", "a", 0664}, {"dir/b", "b", 0664}}, expectedEqual: true},
+		{name: "when a content differs, should return a different checksum", files: []file{{"a", "changed", 0664}, {"dir/b", "b", 0664}, {"dir/inner/c", "c", 0600}}},
+		{name: "when a mode differs, should return a different checksum", files: []file{{"a", "a", 0600}, {"dir/b", "b", 0664}, {"dir/inner/c", "c", 0600}}},
+		{name: "when a name differs, should return a different checksum", files: []file{{"renamed", "a", 0664}, {"dir/b", "b", 0664}, {"dir/inner/c", "c", 0600}}},
+		{name: "when a content is moved to a next file, should return a different checksum", files: []file{{"a", "", 0664}, {"dir/b", "ab", 0664}, {"dir/inner/c", "c", 0600}}},
+		{name: "when a file is missing, should return a different checksum", files: base[:2]},
+	}
+	for _, test := range testCases {
+		test := test
+		f.RunWithTestDir(test.name, func(testDir string) {
+			dirA, dirB := path.Join(testDir, "a"), path.Join(testDir, "b")
+			for dir, files := range map[string][]file{dirA: base, dirB: test.files} {
+				for _, file := range files {
+					filePath := path.Join(dir, file.name)
+					f.Require().NoError(os.MkdirAll(path.Dir(filePath), os.ModePerm))
+					f.Require().NoError(os.WriteFile(filePath, []byte(file.content), file.mode))
+					f.Require().NoError(os.Chmod(filePath, file.mode))
+				}
+			}
+
+			checksumA, err := f.DirChecksum(dirA)
+			f.Require().NoError(err)
+			checksumB, err := f.DirChecksum(dirB)
+			f.Require().NoError(err)
+
+			f.Len(checksumA, 2*sha256.Size)
+			f.Equal(test.expectedEqual, checksumA == checksumB)
+		})
+	}
+
+	f.RunWithTestDir("when a directory does not exist, should return an error", func(testDir string) {
+		checksum, err := f.DirChecksum(path.Join(testDir, "not existing"))
+		f.Error(err)
+		f.Empty(checksum)
+	})
+}
+
 func (f *filesystemTestSuite) TestAreFilesDifferent() {
 	type data struct {
 		content string
@@ -38,26 +148,118 @@ func (f *filesystemTestSuite) TestAreFilesDifferent() {
 		{name: "when both files exist with different contents", firstFile: data{"diff 1", 0664}, secondFile: data{"diff 2", 0664}, expectedAreDifferent: true},
 		{name: "when both files exist with the same content but different modes", firstFile: data{"same", 0775}, secondFile: data{"same", 0664}, expectedAreDifferent: true},
 		{name: "when both files exist with the same content and mode", firstFile: data{"same", 0664}, secondFile: data{"same", 0664}},
+		{name: "when both files exist with different contents of the same size", firstFile: data{"same 1", 0664}, secondFile: data{"same 2", 0664}, expectedAreDifferent: true},
 	}
-	for _, test := range testCases {
-		test := test
-		f.RunWithTestDir(test.name, func(testDir string) {
-			firstFilePath := path.Join(testDir, "file0")
-			secondFilePath := path.Join(testDir, "file1")
-			if test.firstFile.mode != 0 {
-				f.Require().NoError(os.WriteFile(firstFilePath, []byte(test.firstFile.content), test.firstFile.mode))
-			}
-			if test.secondFile.mode != 0 {
-				f.Require().NoError(os.WriteFile(secondFilePath, []byte(test.secondFile.content), test.secondFile.mode))
+	comparators := [...]struct {
+		name string
+		fs   Filesystem
+	}{
+		{name: "by content", fs: New(nil)},
+		{name: "by hash", fs: New(nil, WithHashComparison(sha256.New))},
+		{name: "by a content comparator", fs: New(nil, WithContentComparator(func(a, b string) (bool, error) {
+			contentA, err := os.ReadFile(a)
+			if err != nil {
+				return false, err
 			}
-			areDifferent, err := f.AreFilesDifferent(firstFilePath, secondFilePath)
+			contentB, err := os.ReadFile(b)
+			return !bytes.Equal(contentA, contentB), err
+		}))},
+	}
+	for _, test := range testCases {
+		for _, comparator := range comparators {
+			test, comparator := test, comparator
+			f.RunWithTestDir(test.name+" and files are compared "+comparator.name, func(testDir string) {
+				firstFilePath := path.Join(testDir, "file0")
+				secondFilePath := path.Join(testDir, "file1")
+				if test.firstFile.mode != 0 {
+					f.Require().NoError(os.WriteFile(firstFilePath, []byte(test.firstFile.content), test.firstFile.mode))
+				}
+				if test.secondFile.mode != 0 {
+					f.Require().NoError(os.WriteFile(secondFilePath, []byte(test.secondFile.content), test.secondFile.mode))
+				}
+				areDifferent, err := comparator.fs.AreFilesDifferent(firstFilePath, secondFilePath)
 
-			if test.expectErr {
-				f.Error(err)
-			} else {
-				f.NoError(err)
-				f.Equal(test.expectedAreDifferent, areDifferent)
-			}
+				if test.expectErr {
+					f.Error(err)
+				} else {
+					f.NoError(err)
+					f.Equal(test.expectedAreDifferent, areDifferent)
+				}
+			})
+		}
+	}
+
+	for _, comparator := range comparators {
+		comparator := comparator
+		f.RunWithTestDir("when files have the same content and mode but different modification times and are compared "+comparator.name+", should return false", func(testDir string) {
+			firstFilePath, secondFilePath := path.Join(testDir, "file0"), path.Join(testDir, "file1")
+			f.Require().NoError(os.WriteFile(firstFilePath, []byte("same"), 0664))
+			f.Require().NoError(os.WriteFile(secondFilePath, []byte("same"), 0664))
+			past := time.Now().Add(-time.Hour)
+			f.Require().NoError(os.Chtimes(secondFilePath, past, past))
+
+			areDifferent, err := comparator.fs.AreFilesDifferent(firstFilePath, secondFilePath)
+			f.NoError(err)
+			f.False(areDifferent)
 		})
 	}
+
+	f.RunWithTestDir("when files are hashed, should return equal hashes only for equal contents", func(testDir string) {
+		for name, content := range map[string]string{"a": "content", "b": "content", "c": "other"} {
+			f.Require().NoError(os.WriteFile(path.Join(testDir, name), []byte(content), 0664))
+		}
+		hashA, err := f.HashFile(path.Join(testDir, "a"))
+		f.Require().NoError(err)
+		hashB, err := f.HashFile(path.Join(testDir, "b"))
+		f.Require().NoError(err)
+		hashC, err := f.HashFile(path.Join(testDir, "c"))
+		f.Require().NoError(err)
+		expected := sha256.Sum256([]byte("content"))
+
+		f.Equal(expected[:], hashA)
+		f.Equal(hashA, hashB)
+		f.NotEqual(hashA, hashC)
+		_, err = f.HashFile(path.Join(testDir, "not existing"))
+		f.Error(err)
+	})
+
+	f.RunWithTestDir("when files are compared by a content comparator, should return its result for files of the same mode", func(testDir string) {
+		firstFilePath, secondFilePath, otherModePath := path.Join(testDir, "file0"), path.Join(testDir, "file1"), path.Join(testDir, "file2")
+		f.Require().NoError(os.WriteFile(firstFilePath, []byte("content"), 0664))
+		f.Require().NoError(os.WriteFile(secondFilePath, []byte("different content"), 0664))
+		f.Require().NoError(os.WriteFile(otherModePath, []byte("content"), 0600))
+		f.Require().NoError(os.Chmod(otherModePath, 0600))
+		compared := 0
+		errCompare := errors.New("compare error")
+		var result error
+		fs := New(nil, WithContentComparator(func(a, b string) (bool, error) {
+			compared++
+			return false, result
+		}))
+
+		areDifferent, err := fs.AreFilesDifferent(firstFilePath, secondFilePath)
+		f.NoError(err)
+		f.False(areDifferent, "should treat files as equal when a comparator does")
+		areDifferent, err = fs.AreFilesDifferent(firstFilePath, otherModePath)
+		f.NoError(err)
+		f.True(areDifferent, "should compare modes")
+		f.Equal(1, compared, "shouldn't compare contents of files of different modes")
+		result = errCompare
+		_, err = fs.AreFilesDifferent(firstFilePath, secondFilePath)
+		f.ErrorIs(err, errCompare)
+	})
+
+	f.RunWithTestDir("when files of different sizes are compared by hash, should not hash them", func(testDir string) {
+		firstFilePath, secondFilePath := path.Join(testDir, "file0"), path.Join(testDir, "file1")
+		f.Require().NoError(os.WriteFile(firstFilePath, []byte("short"), 0664))
+		f.Require().NoError(os.WriteFile(secondFilePath, []byte("longer content"), 0664))
+		hashes := 0
+		fs := New(nil, WithHashComparison(func() hash.Hash { hashes++; return sha256.New() }))
+
+		areDifferent, err := fs.AreFilesDifferent(firstFilePath, secondFilePath)
+
+		f.NoError(err)
+		f.True(areDifferent)
+		f.Zero(hashes)
+	})
 }
@@ -18,33 +18,128 @@ package filesystem
 
 import (
 	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strings"
 )
 
-// Extract extracts all files from a tarball to a toDir directory. If any errors occurs or anything from the tarball is
-// not a regular file, directory, hardlink or symlink then an error is returned.
-func (real) Extract(tarball, toDir string) error {
-	reader, err := os.Open(tarball)
+// gzipMagic is a header of every gzip compressed file.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// openTarball opens a tarball and returns a tar reader of its content, a function closing the tarball and an error if
+// any occurred. A gzip compressed tarball is decompressed.
+func openTarball(tarball string) (*tar.Reader, func(), error) {
+	file, err := os.Open(tarball)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not open %s. Reason: %w", tarball, err)
+	}
+	reader := bufio.NewReader(file)
+	if magic, err := reader.Peek(len(gzipMagic)); err != nil || !bytes.Equal(magic, gzipMagic) {
+		return tar.NewReader(reader), func() { file.Close() }, nil
+	}
+	gzipReader, err := gzip.NewReader(reader)
 	if err != nil {
-		return fmt.Errorf("could not open %s. Reason: %w", tarball, err)
+		file.Close()
+		return nil, nil, fmt.Errorf("could not decompress %s. Reason: %w", tarball, err)
 	}
-	defer reader.Close()
-	tarReader := tar.NewReader(reader)
+	return tar.NewReader(gzipReader), func() { gzipReader.Close(); file.Close() }, nil
+}
+
+// ListTarEntries returns a sorted list of normalized names of files (regular files, hardlinks and symlinks) from
+// a tarball without extracting it. Directories are skipped. It returns an error if the tarball can't be read.
+func (r real) ListTarEntries(tarball string) ([]string, error) {
+	tarReader, closeTarball, err := openTarball(tarball)
+	if err != nil {
+		return nil, err
+	}
+	defer closeTarball()
+	names := []string{}
+	stripped := strippedNames{}
 	for {
 		header, err := tarReader.Next()
 		if err == io.EOF {
 			break
 		} else if err != nil {
+			return nil, fmt.Errorf("could not read entries of a file %s. Reason: %w", tarball, err)
+		}
+		switch header.Typeflag {
+		case tar.TypeReg, tar.TypeLink, tar.TypeSymlink:
+			name, err := r.entryName(header.Name)
+			if err != nil {
+				return nil, fmt.Errorf("could not list entries of a file %s. Reason: %w", tarball, err)
+			} else if name == "" {
+				continue
+			}
+			if err := stripped.add(name, header.Name); err != nil {
+				return nil, fmt.Errorf("could not list entries of a file %s. Reason: %w", tarball, err)
+			} else if err := r.checkEntries(stripped); err != nil {
+				return nil, fmt.Errorf("could not list entries of a file %s. Reason: %w", tarball, err)
+			}
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// Extract extracts all files from a tarball (which may be gzip compressed) to a toDir directory. Files already present
+// in toDir are replaced, so tarballs can be extracted one over another. If any errors occurs or anything from
+// the tarball is not a regular file, directory, hardlink or symlink then an error is returned. With durable writes all
+// extracted files and directories are synced. Leading path segments of entries are stripped if it is set. An entry
+// which would be extracted outside of toDir (also through a symlink extracted earlier) or a symlink or a hardlink which
+// points outside of it is reported as an ErrUnsafeEntry.
+func (r real) Extract(tarball, toDir string) error {
+	tarReader, closeTarball, err := openTarball(tarball)
+	if err != nil {
+		return err
+	}
+	defer closeTarball()
+	realToDir, err := filepath.EvalSymlinks(toDir)
+	if err != nil {
+		return fmt.Errorf("could not resolve a directory %s. Reason: %w", toDir, err)
+	}
+	changedDirs := map[string]struct{}{toDir: {}}
+	stripped := strippedNames{}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("could not extract a file %s. Reason: %w", tarball, err)
+		}
+		name, err := r.entryName(header.Name)
+		if err != nil {
 			return fmt.Errorf("could not extract a file %s. Reason: %w", tarball, err)
+		} else if name == "" || name == "." { // a root directory of a tarball (or a stripped one), toDir is used instead
+			continue
+		}
+		if header.Typeflag != tar.TypeDir {
+			if err := stripped.add(name, header.Name); err != nil {
+				return fmt.Errorf("could not extract a file %s. Reason: %w", tarball, err)
+			} else if err := r.checkEntries(stripped); err != nil {
+				return fmt.Errorf("could not extract a file %s. Reason: %w", tarball, err)
+			}
+		}
+		path := filepath.Join(toDir, name)
+		parent, err := resolveWithin(realToDir, filepath.Dir(path)) // symlinks extracted earlier may lead outside
+		if err != nil {
+			return fmt.Errorf("could not extract a file %s from %s. Reason: %w", header.Name, tarball, err)
 		}
-		path := filepath.Join(toDir, header.Name)
 		info := header.FileInfo()
 
 		switch header.Typeflag {
 		case tar.TypeReg:
+			if err := removeExisting(path); err != nil {
+				return fmt.Errorf("could not replace a file %s from %s. Reason: %w", path, tarball, err)
+			}
 			file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
 			if err != nil {
 				return fmt.Errorf("could not open a file %s from %s. Reason: %w", path, tarball, err)
@@ -55,25 +150,184 @@ func (real) Extract(tarball, toDir string) error {
 			if err != nil {
 				return fmt.Errorf("could not copy a file %s from %s. Reason: %w", path, tarball, err)
 			}
+			if err := r.syncFile(file); err != nil {
+				return fmt.Errorf("could not fsync a file %s from %s. Reason: %w", path, tarball, err)
+			}
 		case tar.TypeDir:
 			if err := os.MkdirAll(path, info.Mode()); err != nil {
 				return fmt.Errorf("could not create a directory %s from %s. Reason: %w", path, tarball, err)
 			}
 		case tar.TypeLink:
-			linkPath := filepath.Join(toDir, header.Linkname)
+			linkName, err := r.entryName(header.Linkname)
+			if err != nil {
+				return fmt.Errorf("could not extract a hardlink %s from %s. Reason: %w", header.Name, tarball, err)
+			} else if linkName == "" {
+				return fmt.Errorf("a hardlink %s from %s points to a stripped entry %s", header.Name, tarball, header.Linkname)
+			}
+			linkPath := filepath.Join(toDir, linkName)
+			if err := checkHardlinkSource(realToDir, linkPath, parent); err != nil {
+				return fmt.Errorf("could not extract a hardlink %s from %s. Reason: %w", header.Name, tarball, err)
+			}
 			if path != linkPath {
+				if err := removeExisting(path); err != nil {
+					return fmt.Errorf("could not replace a file %s from %s. Reason: %w", path, tarball, err)
+				}
 				if err := os.Link(linkPath, path); err != nil {
 					return fmt.Errorf("could not create a hardlink from %s to %s from %s. Reason: %w", linkPath, path, tarball, err)
 				}
 			}
 		case tar.TypeSymlink:
-			linkPath := filepath.Join(toDir, header.Linkname[len(filepath.Dir(tarball)):])
+			linkPath, err := r.symlinkTarget(header.Linkname, parent, filepath.Dir(tarball), toDir, realToDir)
+			if err != nil {
+				return fmt.Errorf("could not extract a symlink %s from %s. Reason: %w", header.Name, tarball, err)
+			}
+			if err := removeExisting(path); err != nil {
+				return fmt.Errorf("could not replace a file %s from %s. Reason: %w", path, tarball, err)
+			}
 			if err := os.Symlink(linkPath, path); err != nil {
-				return fmt.Errorf("could not create a hardlink from %s to %s from %s. Reason: %w", linkPath, path, tarball, err)
+				return fmt.Errorf("could not create a symlink from %s to %s from %s. Reason: %w", linkPath, path, tarball, err)
 			}
 		default:
 			return fmt.Errorf("%s from %s is not a directory, regular file, hardlink or symlink", header.Name, tarball)
 		}
+		changedDirs[filepath.Dir(path)] = struct{}{}
+	}
+	for dir := range changedDirs {
+		if err := r.syncPath(dir); err != nil {
+			return err
+		}
 	}
 	return nil
 }
+
+// symlinkTarget returns a target of a symlink extracted to toDir, whose real path is realToDir, to a directory with
+// a real path realParent. A relative target is kept as is, as it is resolved from a directory of the symlink.
+// An absolute target is moved to toDir: a prefix of a tarballDir is removed from it and the rest is treated as relative
+// to toDir, unless absolute entries are rejected. It returns an ErrUnsafeEntry if the target resolves outside of toDir.
+func (r real) symlinkTarget(linkname, realParent, tarballDir, toDir, realToDir string) (string, error) {
+	target, resolved := linkname, filepath.Join(realParent, linkname)
+	if strings.HasPrefix(linkname, "/") {
+		if r.rejectAbsolute {
+			return "", fmt.Errorf("a symlink points to an absolute path %s. Reason: %w", linkname, ErrUnsafeEntry)
+		}
+		relative, _ := strings.CutPrefix(linkname, filepath.Clean(tarballDir)+"/")
+		target = filepath.Join(toDir, strings.TrimLeft(relative, "/"))
+		resolved = target
+	}
+	if _, err := resolveWithin(realToDir, resolved); err != nil {
+		return "", fmt.Errorf("a symlink points to %s. Reason: %w", linkname, err)
+	}
+	return target, nil
+}
+
+// checkHardlinkSource returns an ErrUnsafeEntry if a hardlink to linkPath, created in a directory with a real path
+// realParent, would link a file outside of a directory with a real path realToDir. A hardlink of a symlink is checked
+// as a symlink with the same target created in realParent.
+func checkHardlinkSource(realToDir, linkPath, realParent string) error {
+	dir, err := resolveWithin(realToDir, filepath.Dir(linkPath))
+	if err != nil {
+		return err
+	}
+	source := filepath.Join(dir, filepath.Base(linkPath))
+	if info, err := os.Lstat(source); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return nil // a missing source is reported by os.Link
+	}
+	target, err := os.Readlink(source)
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(realParent, target)
+	}
+	_, err = resolveWithin(realToDir, target)
+	return err
+}
+
+// resolveWithin returns a path with symlinks of its existing leading part evaluated, so it is a path which
+// the operating system uses. A part which doesn't exist yet is appended as is. It returns an ErrUnsafeEntry if the path
+// is outside of realToDir, which must have no symlinks.
+func resolveWithin(realToDir, path string) (string, error) {
+	var missing []string
+	existing := path
+	resolved, err := filepath.EvalSymlinks(existing)
+	for ; errors.Is(err, os.ErrNotExist) && filepath.Dir(existing) != existing; resolved, err = filepath.EvalSymlinks(existing) {
+		missing = append([]string{filepath.Base(existing)}, missing...)
+		existing = filepath.Dir(existing)
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not resolve %s. Reason: %w", path, err)
+	}
+	resolved = filepath.Join(append([]string{resolved}, missing...)...)
+	if rel, err := filepath.Rel(realToDir, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("%s resolves to %s outside of a destination. Reason: %w", path, resolved, ErrUnsafeEntry)
+	}
+	return resolved, nil
+}
+
+// removeExisting removes a file extracted earlier (e.g. from a previous tarball), so it is replaced instead of being
+// overwritten in place and an inode shared with other hardlinks isn't changed.
+func removeExisting(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// ErrUnsafeEntry is returned when a name of an archive entry points outside of a directory to which it is extracted
+// (e.g. "../etc/passwd") or it is absolute and absolute entries are rejected.
+var ErrUnsafeEntry = errors.New("archive entry points outside of a destination directory")
+
+// entryName returns a normalized name of an archive entry without stripped leading path segments. It returns an empty
+// string if no segments are left. A leading slash of an absolute name is removed, so the entry is treated as relative,
+// unless absolute entries are rejected. It returns an ErrUnsafeEntry if the name points outside of a destination.
+func (r real) entryName(name string) (string, error) {
+	if strings.HasPrefix(name, "/") {
+		if r.rejectAbsolute {
+			return "", fmt.Errorf("an entry %s is absolute. Reason: %w", name, ErrUnsafeEntry)
+		}
+		name = strings.TrimLeft(name, "/")
+	}
+	normalized := normalizeEntryName(name)
+	if normalized == ".." || strings.HasPrefix(normalized, "../") {
+		return "", fmt.Errorf("an entry %s points to a parent directory. Reason: %w", name, ErrUnsafeEntry)
+	}
+	if r.stripComponents == 0 {
+		return normalized, nil
+	}
+	segments := strings.Split(normalized, "/")
+	if len(segments) <= r.stripComponents {
+		return "", nil
+	}
+	return path.Join(segments[r.stripComponents:]...), nil
+}
+
+// ErrTooManyEntries is returned when an archive contains more files than allowed by WithMaxEntries.
+var ErrTooManyEntries = errors.New("archive contains too many files")
+
+// checkEntries returns an ErrTooManyEntries if a number of names exceeds a maximal number of entries.
+func (r real) checkEntries(names strippedNames) error {
+	if r.maxEntries > 0 && len(names) > r.maxEntries {
+		return fmt.Errorf("more than %d files were found. Reason: %w", r.maxEntries, ErrTooManyEntries)
+	}
+	return nil
+}
+
+// strippedNames maps names of tarball entries after stripping to their original names.
+type strippedNames map[string]string
+
+// add records that an original entry name was stripped to a name. It returns an error if an entry with a different
+// original name was stripped to the same name. An entry repeated in a tarball is not a collision.
+func (s strippedNames) add(name, original string) error {
+	original = normalizeEntryName(original)
+	if other, ok := s[name]; ok && other != original {
+		return fmt.Errorf("entries %s and %s are both stripped to %s", other, original, name)
+	}
+	s[name] = original
+	return nil
+}
+
+// normalizeEntryName returns a canonical name of a tarball entry. Some tools prefix every entry with "./", so names are
+// cleaned to be the same regardless of a tool that produced a tarball.
+func normalizeEntryName(name string) string {
+	return path.Clean(name)
+}
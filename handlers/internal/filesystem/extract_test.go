@@ -17,6 +17,10 @@
 package filesystem
 
 import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path"
@@ -62,3 +66,363 @@ func (f *filesystemTestSuite) TestExtract() {
 		f.Equal(path.Join(extractDir, files[0]), symlinkDest)
 	})
 }
+
+func (f *filesystemTestSuite) TestExtractNormalizesEntryNames() {
+	f.RunWithTestDir("when tarballs differ only by a leading ./ in entry names, should extract the same files", func(testDir string) {
+		oldConfigDir := path.Join(testDir, "old")
+		newConfigDir := path.Join(testDir, "new")
+		f.Require().NoError(os.Mkdir(oldConfigDir, os.ModePerm))
+		f.Require().NoError(os.Mkdir(newConfigDir, os.ModePerm))
+		f.writeTarball(path.Join(testDir, "plain.tar"), false, sampleTarEntries("")...)
+		f.writeTarball(path.Join(testDir, "prefixed.tar"), false, sampleTarEntries("./")...)
+
+		f.Require().NoError(f.Extract(path.Join(testDir, "plain.tar"), oldConfigDir))
+		f.Require().NoError(f.Extract(path.Join(testDir, "prefixed.tar"), newConfigDir))
+
+		oldFiles, err := f.ListFileNamesInDir(oldConfigDir)
+		f.Require().NoError(err)
+		newFiles, err := f.ListFileNamesInDir(newConfigDir)
+		f.Require().NoError(err)
+		f.ElementsMatch([]string{"file.test", "dir/inner_file.test", "file.hardlink"}, oldFiles)
+		f.ElementsMatch(oldFiles, newFiles)
+		for _, file := range newFiles {
+			different, err := f.AreFilesDifferent(path.Join(oldConfigDir, file), path.Join(newConfigDir, file))
+			f.NoError(err)
+			f.False(different, file)
+		}
+	})
+}
+
+func (f *filesystemTestSuite) TestExtractStripComponents() {
+	f.RunWithTestDir("when entries are in a top-level dir and one component is stripped, should extract files at the top of a target", func(testDir string) {
+		tarball, extractDir := path.Join(testDir, "test.tar"), path.Join(testDir, "extracted")
+		f.Require().NoError(os.Mkdir(extractDir, os.ModePerm))
+		entries := append(sampleTarEntries("release-1.2.3/"), tarEntry{header: tar.Header{Typeflag: tar.TypeReg, Name: "README", Mode: 0664}, content: "skipped"})
+		f.writeTarball(tarball, false, entries...)
+		fs := New(nil, WithStripComponents(1))
+
+		f.Require().NoError(fs.Extract(tarball, extractDir))
+		names, err := fs.ListFileNamesInDir(extractDir)
+		f.NoError(err)
+		f.ElementsMatch([]string{"file.test", "dir/inner_file.test", "file.hardlink"}, names, "should skip entries with no segments left")
+		content, err := os.ReadFile(path.Join(extractDir, "dir", "inner_file.test"))
+		f.NoError(err)
+		f.Equal("inner file content", string(content))
+		listed, err := fs.ListTarEntries(tarball)
+		f.NoError(err)
+		f.Equal([]string{"dir/inner_file.test", "file.hardlink", "file.test"}, listed)
+	})
+
+	f.RunWithTestDir("when different entries are stripped to the same name, should return an error", func(testDir string) {
+		tarball, extractDir := path.Join(testDir, "test.tar"), path.Join(testDir, "extracted")
+		f.Require().NoError(os.Mkdir(extractDir, os.ModePerm))
+		f.writeTarball(tarball, false,
+			tarEntry{header: tar.Header{Typeflag: tar.TypeReg, Name: "a/conf", Mode: 0664}, content: "a"},
+			tarEntry{header: tar.Header{Typeflag: tar.TypeReg, Name: "b/conf", Mode: 0664}, content: "b"})
+		fs := New(nil, WithStripComponents(1))
+
+		f.ErrorContains(fs.Extract(tarball, extractDir), "stripped to conf")
+		_, err := fs.ListTarEntries(tarball)
+		f.ErrorContains(err, "stripped to conf")
+	})
+}
+
+func (f *filesystemTestSuite) TestExtractMaxEntries() {
+	testCases := [...]struct {
+		name        string
+		maxEntries  int
+		expectedErr error
+	}{
+		{name: "when a tarball has as many files as allowed, should extract and list them", maxEntries: 3},
+		{name: "when a limit is disabled, should extract and list all files"},
+		{name: "when a tarball has more files than allowed, should abort with an ErrTooManyEntries", maxEntries: 2, expectedErr: ErrTooManyEntries},
+	}
+	for _, test := range testCases {
+		test := test
+		f.RunWithTestDir(test.name, func(testDir string) {
+			tarball, extractDir := path.Join(testDir, "test.tar"), path.Join(testDir, "extracted")
+			f.Require().NoError(os.Mkdir(extractDir, os.ModePerm))
+			f.writeTarball(tarball, false, sampleTarEntries("")...)
+			fs := New(nil, WithMaxEntries(test.maxEntries))
+
+			err := fs.Extract(tarball, extractDir)
+			f.ErrorIs(err, test.expectedErr)
+			names, listErr := fs.ListFileNamesInDir(extractDir)
+			f.Require().NoError(listErr)
+			if test.expectedErr != nil {
+				f.Len(names, test.maxEntries, "should abort before extracting a file over a limit")
+			} else {
+				f.Len(names, 3)
+			}
+			listed, err := fs.ListTarEntries(tarball)
+			f.ErrorIs(err, test.expectedErr)
+			if test.expectedErr == nil {
+				f.Len(listed, 3)
+			}
+		})
+	}
+}
+
+func (f *filesystemTestSuite) TestExtractUnsafeEntries() {
+	testCases := [...]struct {
+		name          string
+		entry         tarEntry
+		opts          []Option
+		expectedFiles []string
+		expectedErr   error
+	}{
+		{name: "when an entry is absolute, should extract it relative to a target",
+			entry:         tarEntry{header: tar.Header{Typeflag: tar.TypeReg, Name: "/conf", Mode: 0664}, content: "absolute"},
+			expectedFiles: []string{"conf"}},
+		{name: "when an entry is absolute and absolute entries are rejected, should return an ErrUnsafeEntry",
+			entry: tarEntry{header: tar.Header{Typeflag: tar.TypeReg, Name: "/conf", Mode: 0664}, content: "absolute"},
+			opts:  []Option{WithRejectAbsoluteEntries()}, expectedErr: ErrUnsafeEntry},
+		{name: "when an entry points to a parent directory, should return an ErrUnsafeEntry",
+			entry:       tarEntry{header: tar.Header{Typeflag: tar.TypeReg, Name: "dir/../../conf", Mode: 0664}, content: "escaped"},
+			expectedErr: ErrUnsafeEntry},
+		{name: "when a hardlink points to a parent directory, should return an ErrUnsafeEntry",
+			entry:       tarEntry{header: tar.Header{Typeflag: tar.TypeLink, Name: "link", Linkname: "../conf"}},
+			expectedErr: ErrUnsafeEntry},
+	}
+	for _, test := range testCases {
+		test := test
+		f.RunWithTestDir(test.name, func(testDir string) {
+			tarball, extractDir := path.Join(testDir, "test.tar"), path.Join(testDir, "extracted")
+			f.Require().NoError(os.Mkdir(extractDir, os.ModePerm))
+			f.writeTarball(tarball, false, test.entry)
+			fs := New(nil, test.opts...)
+
+			f.ErrorIs(fs.Extract(tarball, extractDir), test.expectedErr)
+			names, err := fs.ListFileNamesInDir(extractDir)
+			f.Require().NoError(err)
+			f.ElementsMatch(test.expectedFiles, names)
+			f.NoFileExists(path.Join(testDir, "conf"), "should never extract a file outside of a target")
+			f.NoFileExists("/conf")
+			if test.entry.header.Typeflag == tar.TypeReg {
+				listed, err := fs.ListTarEntries(tarball)
+				f.ErrorIs(err, test.expectedErr)
+				f.ElementsMatch(test.expectedFiles, listed)
+			}
+		})
+	}
+}
+
+func (f *filesystemTestSuite) TestExtractSymlinks() {
+	passwd := tarEntry{header: tar.Header{Typeflag: tar.TypeReg, Name: "evil/passwd", Mode: 0664}, content: "root::0:0"}
+	testCases := [...]struct {
+		name            string
+		entries         []tarEntry
+		opts            []Option
+		expectedTargets map[string]string // targets of symlinks, relative to an extraction directory if absoluteTargets is set
+		absoluteTargets bool
+		expectedFiles   map[string]string
+		existingLinks   map[string]string // symlinks in an extraction directory created before extracting, e.g. by a previous tarball
+		expectedErr     error
+	}{
+		{name: "when a symlink is absolute and absolute entries are rejected, should return an ErrUnsafeEntry",
+			entries: []tarEntry{{header: tar.Header{Typeflag: tar.TypeSymlink, Name: "evil", Linkname: "/etc"}}, passwd},
+			opts:    []Option{WithRejectAbsoluteEntries()}, expectedErr: ErrUnsafeEntry},
+		{name: "when a symlink is absolute, should point it into a target",
+			entries: []tarEntry{
+				{header: tar.Header{Typeflag: tar.TypeDir, Name: "etc/", Mode: 0775}},
+				{header: tar.Header{Typeflag: tar.TypeSymlink, Name: "evil", Linkname: "/etc"}},
+				passwd,
+			},
+			expectedTargets: map[string]string{"evil": "etc"}, absoluteTargets: true,
+			expectedFiles: map[string]string{"etc/passwd": "root::0:0"}},
+		{name: "when a symlink points to a parent directory, should return an ErrUnsafeEntry",
+			entries:     []tarEntry{{header: tar.Header{Typeflag: tar.TypeSymlink, Name: "dir/evil", Linkname: "../../etc"}}, passwd},
+			expectedErr: ErrUnsafeEntry},
+		{name: "when an absolute symlink points to a parent directory, should return an ErrUnsafeEntry",
+			entries:     []tarEntry{{header: tar.Header{Typeflag: tar.TypeSymlink, Name: "evil", Linkname: "/../etc"}}, passwd},
+			expectedErr: ErrUnsafeEntry},
+		{name: "when a symlink is short and relative, should keep its target",
+			entries: []tarEntry{
+				{header: tar.Header{Typeflag: tar.TypeReg, Name: "f", Mode: 0664}, content: "file content"},
+				{header: tar.Header{Typeflag: tar.TypeSymlink, Name: "l", Linkname: "f"}},
+				{header: tar.Header{Typeflag: tar.TypeSymlink, Name: "dir/l", Linkname: "../f"}},
+			},
+			expectedTargets: map[string]string{"l": "f", "dir/l": "../f"},
+			expectedFiles:   map[string]string{"l": "file content", "dir/l": "file content"}},
+		{name: "when symlinks are chained to point to a parent directory, should return an ErrUnsafeEntry",
+			entries: []tarEntry{
+				{header: tar.Header{Typeflag: tar.TypeSymlink, Name: "a", Linkname: "."}},
+				{header: tar.Header{Typeflag: tar.TypeSymlink, Name: "a/b", Linkname: "../outside"}},
+				{header: tar.Header{Typeflag: tar.TypeReg, Name: "a/b/pwned", Mode: 0664}, content: "pwned"},
+			},
+			expectedTargets: map[string]string{"a": "."},
+			expectedErr:     ErrUnsafeEntry},
+		{name: "when a file is extracted through an existing symlink to a parent directory, should return an ErrUnsafeEntry",
+			entries:       []tarEntry{{header: tar.Header{Typeflag: tar.TypeReg, Name: "esc/pwned", Mode: 0664}, content: "pwned"}},
+			existingLinks: map[string]string{"esc": "../outside"},
+			expectedErr:   ErrUnsafeEntry},
+		{name: "when a hardlink links a file through an existing symlink to a parent directory, should return an ErrUnsafeEntry",
+			entries:       []tarEntry{{header: tar.Header{Typeflag: tar.TypeLink, Name: "h", Linkname: "esc/secret"}}},
+			existingLinks: map[string]string{"esc": "../outside"},
+			expectedErr:   ErrUnsafeEntry},
+		{name: "when a hardlink of a symlink would point to a parent directory, should return an ErrUnsafeEntry",
+			entries: []tarEntry{
+				{header: tar.Header{Typeflag: tar.TypeReg, Name: "f", Mode: 0664}, content: "file content"},
+				{header: tar.Header{Typeflag: tar.TypeSymlink, Name: "dir/s", Linkname: "../f"}},
+				{header: tar.Header{Typeflag: tar.TypeLink, Name: "h", Linkname: "dir/s"}},
+			},
+			expectedTargets: map[string]string{"dir/s": "../f"},
+			expectedErr:     ErrUnsafeEntry},
+	}
+	for _, test := range testCases {
+		test := test
+		f.RunWithTestDir(test.name, func(testDir string) {
+			tarball, extractDir := path.Join(testDir, "test.tar"), path.Join(testDir, "extracted")
+			f.Require().NoError(os.MkdirAll(path.Join(extractDir, "dir"), os.ModePerm))
+			f.Require().NoError(os.Mkdir(path.Join(testDir, "outside"), os.ModePerm))
+			f.Require().NoError(os.WriteFile(path.Join(testDir, "outside", "secret"), []byte("secret"), 0664))
+			for name, target := range test.existingLinks {
+				f.Require().NoError(os.Symlink(target, path.Join(extractDir, name)))
+			}
+			f.writeTarball(tarball, false, test.entries...)
+
+			f.ErrorIs(New(nil, test.opts...).Extract(tarball, extractDir), test.expectedErr)
+			for name, target := range test.expectedTargets {
+				if test.absoluteTargets {
+					target = path.Join(extractDir, target)
+				}
+				linked, err := os.Readlink(path.Join(extractDir, name))
+				f.NoError(err, name)
+				f.Equal(target, linked, name)
+			}
+			for name, expected := range test.expectedFiles {
+				content, err := os.ReadFile(path.Join(extractDir, name))
+				f.NoError(err, name)
+				f.Equal(expected, string(content), name)
+			}
+			if test.expectedErr != nil {
+				f.NoFileExists(path.Join(extractDir, "evil"), "shouldn't create an unsafe symlink")
+				f.NoFileExists(path.Join(extractDir, "dir/evil"), "shouldn't create an unsafe symlink")
+				f.NoFileExists(path.Join(extractDir, "a/b"), "shouldn't create an unsafe symlink")
+				_, err := os.Lstat(path.Join(extractDir, "h"))
+				f.ErrorIs(err, os.ErrNotExist, "shouldn't create an unsafe hardlink")
+			}
+			f.NoFileExists(path.Join(testDir, "etc/passwd"), "should never extract a file outside of a target")
+			f.NoFileExists(path.Join(testDir, "outside/pwned"), "should never extract a file outside of a target")
+		})
+	}
+}
+
+func (f *filesystemTestSuite) TestListTarEntries() {
+	f.Run("when a file does not exist", func() {
+		names, err := f.ListTarEntries("not/existing/file.tar")
+
+		f.Error(err)
+		f.Nil(names)
+	})
+
+	f.RunWithTestDir("when a file is not a tarball", func(testDir string) {
+		f.Require().NoError(os.WriteFile(path.Join(testDir, "file.test"), []byte("not a tarball content"), 0664))
+		names, err := f.ListTarEntries(path.Join(testDir, "file.test"))
+
+		f.Error(err)
+		f.Nil(names)
+	})
+
+	entries := append(sampleTarEntries("./"),
+		tarEntry{header: tar.Header{Typeflag: tar.TypeDir, Name: "./dir/nested/", Mode: 0775}},
+		tarEntry{header: tar.Header{Typeflag: tar.TypeReg, Name: "./dir/nested/nested_file.test", Mode: 0664}, content: "nested"},
+		tarEntry{header: tar.Header{Typeflag: tar.TypeSymlink, Name: "./file.symlink", Linkname: "file.test"}},
+	)
+	expected := []string{"dir/inner_file.test", "dir/nested/nested_file.test", "file.hardlink", "file.symlink", "file.test"}
+	for _, gzipped := range [...]bool{false, true} {
+		gzipped := gzipped
+		f.RunWithTestDir(fmt.Sprintf("when a tarball has nested dirs, a symlink and ./ prefixes (gzipped: %t)", gzipped), func(testDir string) {
+			tarball := path.Join(testDir, "test.tar")
+			f.writeTarball(tarball, gzipped, entries...)
+			names, err := f.ListTarEntries(tarball)
+
+			f.NoError(err)
+			f.Equal(expected, names)
+			dirEntries, err := os.ReadDir(testDir)
+			f.NoError(err)
+			f.Len(dirEntries, 1, "should not extract anything")
+		})
+	}
+}
+
+func (f *filesystemTestSuite) TestExtractGzipped() {
+	f.RunWithTestDir("when a tarball is gzipped, should extract its files", func(testDir string) {
+		extractDir := path.Join(testDir, "extracted")
+		f.Require().NoError(os.Mkdir(extractDir, os.ModePerm))
+		f.writeTarball(path.Join(testDir, "test.tar.gz"), true, sampleTarEntries("")...)
+
+		f.Require().NoError(f.Extract(path.Join(testDir, "test.tar.gz"), extractDir))
+		content, err := os.ReadFile(path.Join(extractDir, "dir/inner_file.test"))
+		f.NoError(err)
+		f.Equal("inner file content", string(content))
+	})
+}
+
+func (f *filesystemTestSuite) TestExtractOverlay() {
+	f.RunWithTestDir("when a tarball is extracted over another one, should replace its files without changing their hardlinks", func(testDir string) {
+		extractDir := path.Join(testDir, "extracted")
+		f.Require().NoError(os.Mkdir(extractDir, os.ModePerm))
+		f.writeTarball(path.Join(testDir, "base.tar"), false, sampleTarEntries("")...)
+		f.writeTarball(path.Join(testDir, "overlay.tar"), false,
+			tarEntry{header: tar.Header{Typeflag: tar.TypeReg, Name: "file.test", Mode: 0664}, content: "overlay content"},
+			tarEntry{header: tar.Header{Typeflag: tar.TypeReg, Name: "added.test", Mode: 0664}, content: "added content"},
+		)
+
+		f.Require().NoError(f.Extract(path.Join(testDir, "base.tar"), extractDir))
+		f.Require().NoError(f.Extract(path.Join(testDir, "overlay.tar"), extractDir))
+		for name, expected := range map[string]string{
+			"file.test":           "overlay content",
+			"added.test":          "added content",
+			"file.hardlink":       "file content",
+			"dir/inner_file.test": "inner file content",
+		} {
+			content, err := os.ReadFile(path.Join(extractDir, name))
+			f.NoError(err, name)
+			f.Equal(expected, string(content), name)
+		}
+	})
+}
+
+// tarEntry is an entry of a tarball written by writeTarball. A size of a regular file is set from its content.
+type tarEntry struct {
+	header  tar.Header
+	content string
+}
+
+// sampleTarEntries returns entries of a file, a directory with an inner file and a hardlink. Each entry name starts
+// with a prefix.
+func sampleTarEntries(prefix string) []tarEntry {
+	entries := []tarEntry{
+		{header: tar.Header{Typeflag: tar.TypeReg, Name: prefix + "file.test", Mode: 0664}, content: "file content"},
+		{header: tar.Header{Typeflag: tar.TypeDir, Name: prefix + "dir/", Mode: 0775}},
+		{header: tar.Header{Typeflag: tar.TypeReg, Name: prefix + "dir/inner_file.test", Mode: 0664}, content: "inner file content"},
+		{header: tar.Header{Typeflag: tar.TypeLink, Name: prefix + "file.hardlink", Linkname: prefix + "file.test"}},
+	}
+	if prefix != "" {
+		entries = append([]tarEntry{{header: tar.Header{Typeflag: tar.TypeDir, Name: prefix, Mode: 0775}}}, entries...)
+	}
+	return entries
+}
+
+// writeTarball creates a tarball with entries. If gzipped is set the tarball is gzip compressed.
+func (f *filesystemTestSuite) writeTarball(tarball string, gzipped bool, entries ...tarEntry) {
+	file, err := os.Create(tarball)
+	f.Require().NoError(err)
+	defer file.Close()
+	var out io.Writer = file
+	if gzipped {
+		gzipWriter := gzip.NewWriter(file)
+		defer gzipWriter.Close()
+		out = gzipWriter
+	}
+	writer := tar.NewWriter(out)
+	defer writer.Close()
+	for _, entry := range entries {
+		header := entry.header
+		header.Size = int64(len(entry.content))
+		f.Require().NoError(writer.WriteHeader(&header))
+		_, err := writer.Write([]byte(entry.content))
+		f.Require().NoError(err)
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package filesystem
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// ListZipEntries returns a sorted list of normalized names of regular files from a zip archive without extracting it.
+// Directories are skipped. It returns an error if the archive can't be read.
+func (r real) ListZipEntries(archive string) ([]string, error) {
+	reader, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s. Reason: %w", archive, err)
+	}
+	defer reader.Close()
+	names := []string{}
+	stripped := strippedNames{}
+	for _, file := range reader.File {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+		name, err := r.entryName(file.Name)
+		if err != nil {
+			return nil, fmt.Errorf("could not list entries of a file %s. Reason: %w", archive, err)
+		} else if name == "" {
+			continue
+		}
+		if err := stripped.add(name, file.Name); err != nil {
+			return nil, fmt.Errorf("could not list entries of a file %s. Reason: %w", archive, err)
+		} else if err := r.checkEntries(stripped); err != nil {
+			return nil, fmt.Errorf("could not list entries of a file %s. Reason: %w", archive, err)
+		}
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// ExtractZip extracts all files from a zip archive to a toDir directory like Extract does with a tarball. Files
+// already present in toDir are replaced. If any errors occurs or anything from the archive is not a regular file or
+// directory then an error is returned. With durable writes all extracted files and directories are synced. Leading
+// path segments of entries are stripped if it is set.
+func (r real) ExtractZip(archive, toDir string) error {
+	reader, err := zip.OpenReader(archive)
+	if err != nil {
+		return fmt.Errorf("could not open %s. Reason: %w", archive, err)
+	}
+	defer reader.Close()
+	changedDirs := map[string]struct{}{toDir: {}}
+	stripped := strippedNames{}
+	for _, file := range reader.File {
+		name, err := r.entryName(file.Name)
+		if err != nil {
+			return fmt.Errorf("could not extract a file %s. Reason: %w", archive, err)
+		} else if name == "" || name == "." { // a root directory of an archive (or a stripped one), toDir is used instead
+			continue
+		}
+		path := filepath.Join(toDir, name)
+		mode := file.Mode()
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(path, mode.Perm()); err != nil {
+				return fmt.Errorf("could not create a directory %s from %s. Reason: %w", path, archive, err)
+			}
+		case mode.IsRegular():
+			if err := stripped.add(name, file.Name); err != nil {
+				return fmt.Errorf("could not extract a file %s. Reason: %w", archive, err)
+			} else if err := r.checkEntries(stripped); err != nil {
+				return fmt.Errorf("could not extract a file %s. Reason: %w", archive, err)
+			}
+			if err := r.extractZipFile(file, path); err != nil {
+				return fmt.Errorf("could not extract a file %s from %s. Reason: %w", path, archive, err)
+			}
+		default:
+			return fmt.Errorf("%s from %s is not a directory or regular file", file.Name, archive)
+		}
+		changedDirs[filepath.Dir(path)] = struct{}{}
+	}
+	for dir := range changedDirs {
+		if err := r.syncPath(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractZipFile replaces a file at path with a content of a regular file from a zip archive.
+func (r real) extractZipFile(file *zip.File, path string) error {
+	if err := removeExisting(path); err != nil {
+		return err
+	}
+	from, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer from.Close()
+	to, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, file.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer to.Close()
+	if _, err := io.Copy(to, from); err != nil {
+		return err
+	}
+	return r.syncFile(to)
+}
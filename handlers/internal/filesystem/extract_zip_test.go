@@ -0,0 +1,182 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package filesystem
+
+import (
+	"archive/zip"
+	"os"
+	"path"
+)
+
+func (f *filesystemTestSuite) TestExtractZip() {
+	f.Run("when a file does not exist, should return an error", func() {
+		f.Error(f.ExtractZip("not/existing/file.zip", "not/existing/dir"))
+	})
+
+	f.RunWithTestDir("when a file is not a zip archive, should return an error", func(testDir string) {
+		f.Require().NoError(os.WriteFile(path.Join(testDir, "file.test"), []byte("not a zip archive"), 0664))
+
+		f.Error(f.ExtractZip(path.Join(testDir, "file.test"), testDir))
+	})
+
+	f.RunWithTestDir("when there are files and directories, should extract them and replace existing files", func(testDir string) {
+		archive, extractDir := path.Join(testDir, "test.zip"), path.Join(testDir, "extracted")
+		f.Require().NoError(os.Mkdir(extractDir, os.ModePerm))
+		f.Require().NoError(os.WriteFile(path.Join(extractDir, "file.test"), []byte("old content"), 0664))
+		f.writeZip(archive, sampleZipEntries("")...)
+
+		f.Require().NoError(f.ExtractZip(archive, extractDir))
+		content, err := os.ReadFile(path.Join(extractDir, "file.test"))
+		f.NoError(err)
+		f.Equal("file content", string(content))
+		content, err = os.ReadFile(path.Join(extractDir, "dir", "inner_file.test"))
+		f.NoError(err)
+		f.Equal("inner file content", string(content))
+		info, err := os.Stat(path.Join(extractDir, "file.test"))
+		f.NoError(err)
+		f.Equal(os.FileMode(0640), info.Mode().Perm())
+	})
+
+	f.RunWithTestDir("when an archive contains a symlink, should return an error", func(testDir string) {
+		archive := path.Join(testDir, "test.zip")
+		f.writeZip(archive, zipEntry{name: "link", mode: os.ModeSymlink | 0777, content: "file.test"})
+
+		f.ErrorContains(f.ExtractZip(archive, testDir), "not a directory or regular file")
+	})
+
+	f.RunWithTestDir("when one component is stripped, should extract files at the top of a target", func(testDir string) {
+		archive, extractDir := path.Join(testDir, "test.zip"), path.Join(testDir, "extracted")
+		f.Require().NoError(os.Mkdir(extractDir, os.ModePerm))
+		f.writeZip(archive, append(sampleZipEntries("release-1.2.3/"), zipEntry{name: "README", mode: 0664, content: "skipped"})...)
+		fs := New(nil, WithStripComponents(1))
+
+		f.Require().NoError(fs.ExtractZip(archive, extractDir))
+		names, err := fs.ListFileNamesInDir(extractDir)
+		f.NoError(err)
+		f.ElementsMatch([]string{"file.test", "dir/inner_file.test"}, names)
+	})
+}
+
+func (f *filesystemTestSuite) TestListZipEntries() {
+	f.Run("when a file does not exist, should return an error", func() {
+		names, err := f.ListZipEntries("not/existing/file.zip")
+
+		f.Error(err)
+		f.Nil(names)
+	})
+
+	f.RunWithTestDir("when there are files and directories, should return sorted names of files", func(testDir string) {
+		archive := path.Join(testDir, "test.zip")
+		f.writeZip(archive, sampleZipEntries("./")...)
+
+		names, err := f.ListZipEntries(archive)
+		f.NoError(err)
+		f.Equal([]string{"dir/inner_file.test", "file.test"}, names)
+	})
+
+	f.RunWithTestDir("when different entries are stripped to the same name, should return an error", func(testDir string) {
+		archive := path.Join(testDir, "test.zip")
+		f.writeZip(archive, zipEntry{name: "a/conf", mode: 0664, content: "a"}, zipEntry{name: "b/conf", mode: 0664, content: "b"})
+
+		_, err := New(nil, WithStripComponents(1)).ListZipEntries(archive)
+		f.ErrorContains(err, "stripped to conf")
+	})
+}
+
+func (f *filesystemTestSuite) TestExtractZipMaxEntries() {
+	f.RunWithTestDir("when a zip archive has more files than allowed, should abort with an ErrTooManyEntries", func(testDir string) {
+		archive, extractDir := path.Join(testDir, "test.zip"), path.Join(testDir, "extracted")
+		f.Require().NoError(os.Mkdir(extractDir, os.ModePerm))
+		f.writeZip(archive, sampleZipEntries("")...)
+		fs := New(nil, WithMaxEntries(1))
+
+		f.ErrorIs(fs.ExtractZip(archive, extractDir), ErrTooManyEntries)
+		_, err := fs.ListZipEntries(archive)
+		f.ErrorIs(err, ErrTooManyEntries)
+	})
+
+	f.RunWithTestDir("when a zip archive has as many files as allowed, should extract them", func(testDir string) {
+		archive, extractDir := path.Join(testDir, "test.zip"), path.Join(testDir, "extracted")
+		f.Require().NoError(os.Mkdir(extractDir, os.ModePerm))
+		f.writeZip(archive, sampleZipEntries("")...)
+		fs := New(nil, WithMaxEntries(2))
+
+		f.NoError(fs.ExtractZip(archive, extractDir))
+		names, err := fs.ListZipEntries(archive)
+		f.NoError(err)
+		f.Len(names, 2)
+	})
+}
+
+func (f *filesystemTestSuite) TestExtractZipUnsafeEntries() {
+	f.RunWithTestDir("when an entry points to a parent directory, should return an ErrUnsafeEntry", func(testDir string) {
+		archive, extractDir := path.Join(testDir, "test.zip"), path.Join(testDir, "extracted")
+		f.Require().NoError(os.Mkdir(extractDir, os.ModePerm))
+		f.writeZip(archive, zipEntry{name: "../escaped", mode: 0664, content: "escaped"})
+
+		f.ErrorIs(f.ExtractZip(archive, extractDir), ErrUnsafeEntry)
+		f.NoFileExists(path.Join(testDir, "escaped"))
+		_, err := f.ListZipEntries(archive)
+		f.ErrorIs(err, ErrUnsafeEntry)
+	})
+
+	f.RunWithTestDir("when an entry is absolute, should extract it relative to a target unless absolute entries are rejected", func(testDir string) {
+		archive, extractDir := path.Join(testDir, "test.zip"), path.Join(testDir, "extracted")
+		f.Require().NoError(os.Mkdir(extractDir, os.ModePerm))
+		f.writeZip(archive, zipEntry{name: "/absolute", mode: 0664, content: "absolute"})
+
+		f.NoError(f.ExtractZip(archive, extractDir))
+		f.FileExists(path.Join(extractDir, "absolute"))
+		fs := New(nil, WithRejectAbsoluteEntries())
+		f.ErrorIs(fs.ExtractZip(archive, extractDir), ErrUnsafeEntry)
+		_, err := fs.ListZipEntries(archive)
+		f.ErrorIs(err, ErrUnsafeEntry)
+	})
+}
+
+// zipEntry is an entry of a zip archive created by writeZip.
+type zipEntry struct {
+	name    string
+	mode    os.FileMode
+	content string
+}
+
+// sampleZipEntries returns entries of a file and a directory with an inner file. Each entry name starts with a prefix.
+func sampleZipEntries(prefix string) []zipEntry {
+	return []zipEntry{
+		{name: prefix + "file.test", mode: 0640, content: "file content"},
+		{name: prefix + "dir/", mode: os.ModeDir | 0775},
+		{name: prefix + "dir/inner_file.test", mode: 0664, content: "inner file content"},
+	}
+}
+
+// writeZip creates a zip archive with entries.
+func (f *filesystemTestSuite) writeZip(archive string, entries ...zipEntry) {
+	file, err := os.Create(archive)
+	f.Require().NoError(err)
+	defer file.Close()
+	writer := zip.NewWriter(file)
+	defer writer.Close()
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		header.SetMode(entry.mode)
+		w, err := writer.CreateHeader(header)
+		f.Require().NoError(err)
+		_, err = w.Write([]byte(entry.content))
+		f.Require().NoError(err)
+	}
+}
@@ -19,7 +19,11 @@
 package filesystem
 
 import (
+	"compress/gzip"
+	"errors"
 	"fmt"
+	"hash"
+	"io"
 	"io/fs"
 	"log/slog"
 	"os"
@@ -36,34 +40,190 @@ import (
 type Filesystem interface {
 	// DoesExist returns true if a status from path returns no error.
 	DoesExist(path string) bool
-	// Hardlink creates a hardlink of filePath to hardlinkPath. If hardlinkPath already exists then it is deleted.
+	// Hardlink creates a hardlink of filePath to hardlinkPath. If hardlinkPath already exists then it is deleted. If
+	// filePath is a symlink, its target is hardlinked.
 	Hardlink(filePath, hardlinkPath string) error
 	// DeleteFile deletes a filePath.
 	DeleteFile(filePath string) error
 	// ClearDir deletes all files from a dirPath.
 	ClearDir(filePath string) error
+	// DeleteEmptyDirs deletes all empty directories from a dirPath tree. The dirPath itself is kept.
+	DeleteEmptyDirs(dirPath string) error
+	// CreateDir creates a dirPath with all its parents.
+	CreateDir(dirPath string) error
+	// Chmod changes a mode of a filePath.
+	Chmod(filePath string, mode fs.FileMode) error
 	// MoveFile moves a fromPath file to a toPath.
 	MoveFile(fromPath, toPath string) error
-	// Copy copies a fromPath file content to a toPath file.
+	// Copy copies a fromPath file content and mode to a toPath file.
 	Copy(fromPath, toPath string) error
+	// ReadFile returns a content of a filePath.
+	ReadFile(filePath string) ([]byte, error)
+	// Decompress decompresses a gzipFile to a toPath file atomically.
+	Decompress(gzipFile, toPath string) error
+	// WriteFileAtomic writes a content to a filePath file with a mode atomically.
+	WriteFileAtomic(filePath string, content []byte, mode fs.FileMode) error
 	// ListFileNamesInDir returns a list with file names (not paths) from dirPath.
 	ListFileNamesInDir(dirPath string) ([]string, error)
+	// ListMatchingNames returns names of entries of a dirPath matching a pattern.
+	ListMatchingNames(dirPath, pattern string) ([]string, error)
 	// NewFileWatcher creates file watcher based on fsnotify library (inotify).
 	NewFileWatcher(watchedFile string, watchedOps fsnotify.Op) (Watcher, error)
+	// NewDirWatcher creates watcher of a directory tree based on fsnotify library (inotify).
+	NewDirWatcher(watchedDir string) (Watcher, error)
+	// NewGlobWatcher creates watcher of files in a directory with names matching a pattern based on fsnotify library
+	// (inotify).
+	NewGlobWatcher(watchedDir, pattern string, watchedOps fsnotify.Op) (Watcher, error)
 	// Extract extracts all files from a tarball to a toDir directory.
 	Extract(tarball, toDir string) error
+	// ListTarEntries returns names of files from a tarball without extracting it.
+	ListTarEntries(tarball string) ([]string, error)
+	// ExtractZip extracts all files from a zip archive to a toDir directory.
+	ExtractZip(archive, toDir string) error
+	// ListZipEntries returns names of files from a zip archive without extracting it.
+	ListZipEntries(archive string) ([]string, error)
 	// AreFilesDifferent checks if two files has different contents or modes.
 	AreFilesDifferent(firstFilePath, secondFilePath string) (bool, error)
+	// DirsDiffer checks if two directory trees have different files and returns their relative paths.
+	DirsDiffer(dirA, dirB string) (bool, []string, error)
+	// HashFile returns a hash of a content of a filePath.
+	HashFile(filePath string) ([]byte, error)
+	// DirChecksum returns a hex encoded checksum of names, modes and contents of files of a directory tree.
+	DirChecksum(dir string) (string, error)
+	// Stat returns a file info of a path.
+	Stat(path string) (fs.FileInfo, error)
+	// FreeSpace returns a number of available bytes and a total size in bytes of a filesystem holding a path.
+	FreeSpace(path string) (free, total uint64, err error)
 }
 
 // New returns a Filesystem implementation that works on underlying filesystem.
-func New(logger *slog.Logger) Filesystem {
-	return real{log: global.HandleNilLogger(logger)}
+func New(logger *slog.Logger, opts ...Option) Filesystem {
+	r := real{log: global.HandleNilLogger(logger)}
+	for _, opt := range opts {
+		opt(&r)
+	}
+	return r
+}
+
+// Option changes a default behavior of a Filesystem returned by New.
+type Option func(*real)
+
+// WithEventLogSampling makes watchers log only every n-th debug log of observed events and at most perSecond of them
+// in each second. A zero value disables a limit.
+func WithEventLogSampling(every, perSecond int) Option {
+	return func(r *real) {
+		r.eventLogSampler = global.NewLogSampler(every, perSecond, global.NewClock())
+	}
+}
+
+// WithQuietFalsePositives makes watchers skip a debug log of every false positive notification. False positives are
+// still counted.
+func WithQuietFalsePositives() Option {
+	return func(r *real) {
+		r.quietFalsePositives = true
+	}
+}
+
+// WithNotifierBuffer makes watchers keep up to size pending notifications instead of one, so a consumer is notified
+// several times during a burst of events. GetEvent still returns only the latest event, so the following notifications
+// of a burst may be false positives.
+func WithNotifierBuffer(size int) Option {
+	return func(r *real) {
+		r.notifierBuffer = size
+	}
+}
+
+// WithDurableWrites makes Extract, ExtractZip, Copy, MoveFile and Decompress fsync every written file and its parent
+// directory, so an update isn't lost on a power failure right after it succeeded. It makes writes slower.
+func WithDurableWrites() Option {
+	return func(r *real) {
+		r.durableWrites = true
+	}
+}
+
+// WithStripComponents makes Extract, ExtractZip, ListTarEntries and ListZipEntries remove n leading path segments from
+// a name of every archive entry (like tar --strip-components), e.g. a versioned top-level directory. Entries with no
+// segments left are skipped. Entries of different files which end with the same name are reported as an error.
+func WithStripComponents(n int) Option {
+	return func(r *real) {
+		r.stripComponents = max(n, 0)
+	}
+}
+
+// WithRejectAbsoluteEntries makes Extract, ExtractZip, ListTarEntries and ListZipEntries return an ErrUnsafeEntry for
+// an archive entry with an absolute name instead of treating it as relative to a destination directory.
+func WithRejectAbsoluteEntries() Option {
+	return func(r *real) {
+		r.rejectAbsolute = true
+	}
+}
+
+// WithMaxEntries makes Extract, ExtractZip, ListTarEntries and ListZipEntries return an ErrTooManyEntries as soon as
+// an archive is found to contain more than n distinct files (directories are not counted), so an oversized archive
+// isn't extracted fully. A zero value disables a limit.
+func WithMaxEntries(n int) Option {
+	return func(r *real) {
+		r.maxEntries = max(n, 0)
+	}
+}
+
+// WithContentComparator makes AreFilesDifferent compare contents of files of the same mode with compare, which returns
+// true if contents of files with given paths are different. It takes precedence over WithHashComparison.
+func WithContentComparator(compare func(firstFilePath, secondFilePath string) (bool, error)) Option {
+	return func(r *real) {
+		r.compareContents = compare
+	}
+}
+
+// WithHashComparison makes AreFilesDifferent compare contents of files of the same size and mode by hashes created with
+// newHash instead of reading whole files to memory.
+func WithHashComparison(newHash func() hash.Hash) Option {
+	return func(r *real) {
+		r.newHash = newHash
+	}
 }
 
 // real implements Filesystem interface with methods using os library.
 type real struct {
-	log *slog.Logger
+	log                 *slog.Logger
+	eventLogSampler     *global.LogSampler              // limits debug logs of watcher events. Nil means no limit.
+	quietFalsePositives bool                            // disables debug logs of false positive notifications of watchers.
+	notifierBuffer      int                             // a number of pending notifications of watchers. 0 means one.
+	durableWrites       bool                            // enables fsync of written files and their directories.
+	stripComponents     int                             // a number of leading path segments removed from tarball entries.
+	maxEntries          int                             // a maximal number of files in an archive. 0 means no limit.
+	rejectAbsolute      bool                            // makes absolute archive entries an error instead of relative ones.
+	newHash             func() hash.Hash                // creates hashes used to compare files. Nil means that contents are compared.
+	compareContents     func(a, b string) (bool, error) // compares contents of files. Nil means a byte comparison.
+	fsync               func(*os.File) error
+}
+
+// syncFile fsyncs a file if durable writes are enabled.
+func (r real) syncFile(file *os.File) error {
+	if !r.durableWrites {
+		return nil
+	}
+	if r.fsync == nil {
+		return file.Sync()
+	}
+	return r.fsync(file)
+}
+
+// syncPath opens a file or a directory from path and fsyncs it if durable writes are enabled. Directories are synced to
+// persist entries created, renamed or deleted in them.
+func (r real) syncPath(path string) error {
+	if !r.durableWrites {
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := r.syncFile(file); err != nil {
+		return fmt.Errorf("could not fsync %s. Reason: %w", path, err)
+	}
+	return nil
 }
 
 // DoesExist returns true if a file from path exists and false if it does not or an error occurs.
@@ -72,20 +232,29 @@ func (real) DoesExist(path string) bool {
 	return err == nil
 }
 
-// Hardlink creates a hardlink of filePath to hardlinkPath. If hardlinkPath already exists then it is deleted.
+// Stat returns a file info of a path and an error if it can not be gotten.
+func (real) Stat(path string) (fs.FileInfo, error) {
+	return os.Stat(path)
+}
+
+// Hardlink creates a hardlink of filePath to hardlinkPath. If hardlinkPath already exists then it is deleted. If
+// filePath is a symlink, its target is hardlinked, so hardlinkPath keeps a content even if the symlink is repointed.
 func (r real) Hardlink(filePath, hardlinkPath string) error {
 	if err := r.DeleteFile(hardlinkPath); err != nil {
 		return err
 	}
+	if target, err := filepath.EvalSymlinks(filePath); err == nil {
+		filePath = target
+	}
 	return os.Link(filePath, hardlinkPath)
 }
 
-// DeleteFile deletes a filePath.
-func (r real) DeleteFile(filePath string) error {
-	if !r.DoesExist(filePath) {
-		return nil
+// DeleteFile deletes a filePath. It returns nil if the filePath doesn't exist.
+func (real) DeleteFile(filePath string) error {
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
 	}
-	return os.Remove(filePath)
+	return nil
 }
 
 // ClearDir deletes all files from a dirPath.
@@ -96,18 +265,162 @@ func (real) ClearDir(dirPath string) error {
 	return os.MkdirAll(dirPath, os.ModePerm)
 }
 
-// MoveFile moves a fromPath file to a toPath.
-func (real) MoveFile(fromPath, toPath string) error {
-	return os.Rename(fromPath, toPath)
+// DeleteEmptyDirs deletes all empty directories from a dirPath tree. Directories are visited from the deepest ones, so
+// a directory that contains only empty directories is deleted as well. The dirPath itself is kept.
+func (real) DeleteEmptyDirs(dirPath string) error {
+	dirs := []string{}
+	err := filepath.WalkDir(dirPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && p != dirPath {
+			dirs = append(dirs, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		entries, err := os.ReadDir(dirs[i])
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			continue
+		}
+		if err := os.Remove(dirs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// Copy copies a fromPath file content to a toPath file.
-func (real) Copy(fromPath, toPath string) error {
+// CreateDir creates a dirPath with all its parents. It does nothing if dirPath already exists.
+func (real) CreateDir(dirPath string) error {
+	return os.MkdirAll(dirPath, os.ModePerm)
+}
+
+// Chmod changes permission bits of a filePath to a mode. A symlink is followed.
+func (real) Chmod(filePath string, mode fs.FileMode) error {
+	return os.Chmod(filePath, mode)
+}
+
+// MoveFile moves a fromPath file to a toPath. With durable writes directories of both paths are synced.
+func (r real) MoveFile(fromPath, toPath string) error {
+	if err := os.Rename(fromPath, toPath); err != nil {
+		return err
+	}
+	if err := r.syncPath(filepath.Dir(toPath)); err != nil {
+		return err
+	}
+	if filepath.Dir(fromPath) != filepath.Dir(toPath) {
+		return r.syncPath(filepath.Dir(fromPath))
+	}
+	return nil
+}
+
+// Copy copies a fromPath file content to a toPath file. The toPath file gets a mode of the fromPath file, so copies of
+// the same file are not different. With durable writes the toPath file and its directory are synced.
+func (r real) Copy(fromPath, toPath string) error {
 	content, err := os.ReadFile(fromPath)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(toPath, content, os.ModePerm)
+	stat, err := os.Stat(fromPath)
+	if err != nil {
+		return err
+	}
+	to, err := os.OpenFile(toPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	if _, err := to.Write(content); err != nil {
+		to.Close()
+		return err
+	}
+	if err := to.Chmod(stat.Mode().Perm()); err != nil {
+		to.Close()
+		return fmt.Errorf("could not change a mode of %s. Reason: %w", toPath, err)
+	}
+	if err := r.syncFile(to); err != nil {
+		to.Close()
+		return fmt.Errorf("could not fsync %s. Reason: %w", toPath, err)
+	}
+	if err := to.Close(); err != nil {
+		return err
+	}
+	return r.syncPath(filepath.Dir(toPath))
+}
+
+// ReadFile returns a content of a filePath and an error if it can't be read.
+func (real) ReadFile(filePath string) ([]byte, error) {
+	return os.ReadFile(filePath)
+}
+
+// Decompress decompresses a gzipFile to a temporary file next to toPath and then renames it to toPath, so readers of
+// toPath see either an old or a fully decompressed content. The toPath file gets a mode of the gzipFile. If the gzipFile
+// is corrupt an error is returned and toPath is not changed. With durable writes toPath and its directory are synced.
+func (r real) Decompress(gzipFile, toPath string) error {
+	from, err := os.Open(gzipFile)
+	if err != nil {
+		return err
+	}
+	defer from.Close()
+	info, err := from.Stat()
+	if err != nil {
+		return err
+	}
+	gzipReader, err := gzip.NewReader(from)
+	if err != nil {
+		return fmt.Errorf("%s is not a valid gzip file. Reason: %w", gzipFile, err)
+	}
+	defer gzipReader.Close()
+	return r.writeAtomically(toPath, info.Mode().Perm(), func(to io.Writer) error {
+		if _, err := io.Copy(to, gzipReader); err != nil {
+			return fmt.Errorf("could not decompress %s. Reason: %w", gzipFile, err)
+		}
+		return nil
+	})
+}
+
+// WriteFileAtomic writes a content to a temporary file next to filePath and then renames it to filePath, so readers of
+// filePath see either an old or a full content. The filePath file gets a mode. With durable writes filePath and its
+// directory are synced.
+func (r real) WriteFileAtomic(filePath string, content []byte, mode fs.FileMode) error {
+	return r.writeAtomically(filePath, mode, func(to io.Writer) error {
+		_, err := to.Write(content)
+		return err
+	})
+}
+
+// writeAtomically creates a temporary file next to toPath with a mode, writes it with write and renames it to toPath.
+// If write returns an error the temporary file is removed and toPath is not changed.
+func (r real) writeAtomically(toPath string, mode fs.FileMode, write func(io.Writer) error) error {
+	to, err := os.CreateTemp(filepath.Dir(toPath), filepath.Base(toPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(to.Name()) // fails when the file was renamed
+	if err := write(to); err != nil {
+		to.Close()
+		return err
+	}
+	if err := to.Chmod(mode); err != nil {
+		to.Close()
+		return err
+	}
+	if err := r.syncFile(to); err != nil {
+		to.Close()
+		return fmt.Errorf("could not fsync %s. Reason: %w", to.Name(), err)
+	}
+	if err := to.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(to.Name(), toPath); err != nil {
+		return err
+	}
+	return r.syncPath(filepath.Dir(toPath))
 }
 
 // ListFileNamesInDir returns a list with file names (not paths) from dirPath.
@@ -115,6 +428,26 @@ func (real) ListFileNamesInDir(dirPath string) ([]string, error) {
 	return listFileNamesInDir(dirPath, "")
 }
 
+// ListMatchingNames returns a sorted list of names of entries (files, directories and others) of a dirPath which match
+// a pattern with syntax of filepath.Match. Subdirectories are not searched. Unlike filepath.Glob it returns an error if
+// the dirPath can't be read.
+func (real) ListMatchingNames(dirPath, pattern string) ([]string, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %s. Reason: %w", pattern, err)
+	}
+	dirEntries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, dirEntry := range dirEntries {
+		if matched, _ := filepath.Match(pattern, dirEntry.Name()); matched {
+			names = append(names, dirEntry.Name())
+		}
+	}
+	return names, nil
+}
+
 func listFileNamesInDir(dirPath, dirName string) ([]string, error) {
 	dirEntries, err := os.ReadDir(dirPath)
 	if err != nil {
@@ -17,9 +17,15 @@
 package filesystem
 
 import (
+	"compress/gzip"
+	"errors"
+	"fmt"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
+
+	"github.com/k-lb/entrypoint-framework/handlers/internal/global"
 )
 
 func (f *filesystemTestSuite) TestDoesExist() {
@@ -42,6 +48,51 @@ func (f *filesystemTestSuite) TestDoesExist() {
 	}
 }
 
+func (f *filesystemTestSuite) TestStat() {
+	f.RunWithTestDir("when a file does not exist", func(testDir string) {
+		info, err := f.Stat(path.Join(testDir, "not_existing_file.test"))
+
+		f.ErrorIs(err, os.ErrNotExist)
+		f.Nil(info)
+	})
+
+	f.RunWithTestDir("when a file exists", func(testDir string) {
+		testFile := path.Join(testDir, "file.test")
+		f.Require().NoError(os.WriteFile(testFile, []byte("content"), 0664))
+		info, err := f.Stat(testFile)
+
+		f.NoError(err)
+		f.Require().NotNil(info)
+		f.Equal(int64(len("content")), info.Size())
+		f.False(info.IsDir())
+	})
+
+	f.RunWithTestDir("when a directory is unreadable, should return an error other than not exist", func(testDir string) {
+		if os.Geteuid() == 0 { // permissions are not checked for root
+			return
+		}
+		dir := path.Join(testDir, "dir")
+		f.Require().NoError(os.Mkdir(dir, os.ModePerm))
+		f.Require().NoError(os.WriteFile(path.Join(dir, "file.test"), []byte{}, 0664))
+		f.Require().NoError(os.Chmod(dir, 0))
+		defer os.Chmod(dir, os.ModePerm)
+		_, err := f.Stat(path.Join(dir, "file.test"))
+
+		f.ErrorIs(err, os.ErrPermission)
+		f.NotErrorIs(err, os.ErrNotExist)
+		f.Error(f.DeleteFile(path.Join(dir, "file.test")))
+	})
+
+	f.RunWithTestDir("when a parent of a path is a file, should return an error other than not exist", func(testDir string) {
+		testFile := path.Join(testDir, "file.test")
+		f.Require().NoError(os.WriteFile(testFile, []byte{}, 0664))
+		_, err := f.Stat(path.Join(testFile, "inner_file.test"))
+
+		f.Error(err)
+		f.NotErrorIs(err, os.ErrNotExist)
+	})
+}
+
 func (f *filesystemTestSuite) TestHardlink() {
 	f.RunWithTestDir("when no files exist", func(testDir string) {
 		err := f.Hardlink("not/existing/file", "not/existing/hardlink")
@@ -78,6 +129,21 @@ func (f *filesystemTestSuite) TestHardlink() {
 		f.NoError(err)
 		f.True(areFilesTheSame(testFile, hardlinkFile))
 	})
+
+	f.RunWithTestDir("when a file is a symlink, should hardlink its target", func(testDir string) {
+		testFile := path.Join(testDir, "file.test")
+		symlink := path.Join(testDir, "file.symlink")
+		hardlinkFile := path.Join(testDir, "file.hardlink")
+		f.Require().NoError(os.WriteFile(testFile, []byte("content"), 0664))
+		f.Require().NoError(os.Symlink("file.test", symlink))
+		err := f.Hardlink(symlink, hardlinkFile)
+
+		f.NoError(err)
+		f.True(areFilesTheSame(testFile, hardlinkFile))
+		info, err := os.Lstat(hardlinkFile)
+		f.Require().NoError(err)
+		f.True(info.Mode().IsRegular(), "shouldn't hardlink the symlink itself")
+	})
 }
 
 func areFilesTheSame(filePath1, filePath2 string) bool {
@@ -125,6 +191,82 @@ func (f *filesystemTestSuite) TestClearDir() {
 	})
 }
 
+func (f *filesystemTestSuite) TestDeleteEmptyDirs() {
+	f.RunWithTestDir("when dirs are empty, should delete them with parents left empty but keep a dir", func(testDir string) {
+		f.Require().NoError(os.MkdirAll(path.Join(testDir, "empty"), os.ModePerm))
+		f.Require().NoError(os.MkdirAll(path.Join(testDir, "a", "b", "c"), os.ModePerm))
+
+		f.NoError(f.DeleteEmptyDirs(testDir))
+		f.DirExists(testDir)
+		files, err := os.ReadDir(testDir)
+		f.Require().NoError(err)
+		f.Empty(files)
+	})
+
+	f.RunWithTestDir("when dirs contain files, should keep them", func(testDir string) {
+		file := path.Join(testDir, "a", "file")
+		f.Require().NoError(os.MkdirAll(path.Join(testDir, "a", "empty"), os.ModePerm))
+		f.Require().NoError(os.WriteFile(file, []byte("content"), 0664))
+
+		f.NoError(f.DeleteEmptyDirs(testDir))
+		f.FileExists(file)
+		f.NoDirExists(path.Join(testDir, "a", "empty"))
+	})
+
+	f.RunWithTestDir("when a dir does not exist, should return an error", func(testDir string) {
+		f.Error(f.DeleteEmptyDirs(path.Join(testDir, "not/existing/dir")))
+	})
+}
+
+func (f *filesystemTestSuite) TestCreateDir() {
+	f.RunWithTestDir("when parents of a dir don't exist, should create them", func(testDir string) {
+		dir := path.Join(testDir, "parent", "dir")
+		f.NoError(f.CreateDir(dir))
+		f.DirExists(dir)
+		f.NoError(f.CreateDir(dir), "should do nothing if a dir exists")
+	})
+
+	f.RunWithTestDir("when a file exists at a path, should return an error", func(testDir string) {
+		f.Require().NoError(os.WriteFile(path.Join(testDir, "file"), []byte{}, 0664))
+		f.Error(f.CreateDir(path.Join(testDir, "file")))
+	})
+}
+
+func (f *filesystemTestSuite) TestChmod() {
+	f.RunWithTestDir("when a file exists, should change its mode", func(testDir string) {
+		file := path.Join(testDir, "file")
+		f.Require().NoError(os.WriteFile(file, []byte{}, 0664))
+
+		f.NoError(f.Chmod(file, 0600))
+		info, err := os.Stat(file)
+		f.NoError(err)
+		f.Equal(os.FileMode(0600), info.Mode().Perm())
+	})
+
+	f.RunWithTestDir("when a file does not exist, should return an error", func(testDir string) {
+		f.ErrorIs(f.Chmod(path.Join(testDir, "file"), 0600), os.ErrNotExist)
+	})
+}
+
+func (f *filesystemTestSuite) TestCopyMode() {
+	f.RunWithTestDir("when a to file exists with another mode, should change it to a mode of a from file", func(testDir string) {
+		from, to := path.Join(testDir, "from"), path.Join(testDir, "to")
+		f.Require().NoError(os.WriteFile(from, []byte("from content"), 0600))
+		f.Require().NoError(os.Chmod(from, 0640))
+		f.Require().NoError(os.WriteFile(to, []byte("to content"), 0600))
+		f.Require().NoError(os.Chmod(to, 0644))
+
+		f.Require().NoError(f.Copy(from, to))
+
+		stat, err := os.Stat(to)
+		f.Require().NoError(err)
+		f.Equal(os.FileMode(0640), stat.Mode().Perm())
+		different, err := f.AreFilesDifferent(from, to)
+		f.NoError(err)
+		f.False(different)
+	})
+}
+
 func (f *filesystemTestSuite) TestCopyAndMoveFile() {
 	presentFromFile := "fromFile.present"
 	presentToFile := "toFile.present"
@@ -182,6 +324,166 @@ func (f *filesystemTestSuite) TestCopyAndMoveFile() {
 	}
 }
 
+func (f *filesystemTestSuite) TestDurableWrites() {
+	f.False(New(nil).(real).durableWrites, "durable writes should be off by default")
+	f.True(New(nil, WithDurableWrites()).(real).durableWrites)
+
+	testCases := [...]struct {
+		name   string
+		write  func(r real, testDir string) error
+		synced []string
+	}{
+		{name: "Copy", synced: []string{"to", "."}, write: func(r real, testDir string) error {
+			return r.Copy(path.Join(testDir, "from"), path.Join(testDir, "to"))
+		}},
+		{name: "MoveFile", synced: []string{"dir", "."}, write: func(r real, testDir string) error {
+			return r.MoveFile(path.Join(testDir, "from"), path.Join(testDir, "dir", "to"))
+		}},
+		{name: "Decompress", synced: []string{"to.*.tmp", "."}, write: func(r real, testDir string) error {
+			return r.Decompress(path.Join(testDir, "from.gz"), path.Join(testDir, "to"))
+		}},
+		{name: "WriteFileAtomic", synced: []string{"to.*.tmp", "."}, write: func(r real, testDir string) error {
+			return r.WriteFileAtomic(path.Join(testDir, "to"), []byte("content"), 0664)
+		}},
+		{name: "Extract", synced: []string{"extracted/file.test", "extracted/dir/inner_file.test", "extracted", "extracted/dir"}, write: func(r real, testDir string) error {
+			return r.Extract(path.Join(testDir, "test.tar"), path.Join(testDir, "extracted"))
+		}},
+	}
+	for _, test := range testCases {
+		test := test
+		for _, durable := range []bool{false, true} {
+			durable := durable
+			f.RunWithTestDir(fmt.Sprintf("when %s is called and durable writes are %t", test.name, durable), func(testDir string) {
+				f.Require().NoError(os.WriteFile(path.Join(testDir, "from"), []byte("content"), 0664))
+				f.Require().NoError(os.Mkdir(path.Join(testDir, "dir"), os.ModePerm))
+				f.Require().NoError(os.Mkdir(path.Join(testDir, "extracted"), os.ModePerm))
+				f.writeGzipFile(path.Join(testDir, "from.gz"), "content")
+				f.writeTarball(path.Join(testDir, "test.tar"), false, sampleTarEntries("")...)
+				synced := []string{}
+				r := real{log: global.HandleNilLogger(nil), durableWrites: durable, fsync: func(file *os.File) error {
+					name, err := filepath.Rel(testDir, file.Name())
+					f.NoError(err)
+					synced = append(synced, name)
+					return nil
+				}}
+
+				f.Require().NoError(test.write(r, testDir))
+				if !durable {
+					f.Empty(synced, "should not fsync without durable writes")
+					return
+				}
+				for _, pattern := range test.synced {
+					f.True(slices.ContainsFunc(synced, func(name string) bool {
+						matched, _ := filepath.Match(pattern, name)
+						return matched
+					}), "should fsync %s, synced: %v", pattern, synced)
+				}
+			})
+		}
+	}
+
+	f.RunWithTestDir("when fsync fails, should return an error", func(testDir string) {
+		errFsync := errors.New("fsync error")
+		f.Require().NoError(os.WriteFile(path.Join(testDir, "from"), []byte("content"), 0664))
+		r := real{log: global.HandleNilLogger(nil), durableWrites: true, fsync: func(*os.File) error { return errFsync }}
+		f.ErrorIs(r.Copy(path.Join(testDir, "from"), path.Join(testDir, "to")), errFsync)
+	})
+}
+
+func (f *filesystemTestSuite) TestReadFile() {
+	f.Run("when a file does not exist, should return an error", func() {
+		_, err := f.ReadFile("not/existing/file")
+		f.ErrorIs(err, os.ErrNotExist)
+	})
+
+	f.RunWithTestDir("when a file exists, should return its content", func(testDir string) {
+		f.Require().NoError(os.WriteFile(path.Join(testDir, "file"), []byte("content"), 0664))
+		content, err := f.ReadFile(path.Join(testDir, "file"))
+		f.NoError(err)
+		f.Equal("content", string(content))
+	})
+}
+
+func (f *filesystemTestSuite) TestDecompress() {
+	f.Run("when a gzip file does not exist, should return an error", func() {
+		f.Error(f.Decompress("not/existing/file.gz", "not/existing/file"))
+	})
+
+	f.RunWithTestDir("when a gzip file is valid, should replace a file with a decompressed content", func(testDir string) {
+		gzipFile, toFile := path.Join(testDir, "file.gz"), path.Join(testDir, "file")
+		f.writeGzipFile(gzipFile, "decompressed content")
+		f.Require().NoError(os.WriteFile(toFile, []byte("old content"), 0664))
+
+		f.Require().NoError(f.Decompress(gzipFile, toFile))
+		content, err := os.ReadFile(toFile)
+		f.NoError(err)
+		f.Equal("decompressed content", string(content))
+		names, err := f.ListFileNamesInDir(testDir)
+		f.NoError(err)
+		f.ElementsMatch([]string{"file.gz", "file"}, names, "should not leave a temporary file")
+	})
+
+	corruptCases := [...]struct {
+		name    string
+		corrupt func([]byte) []byte
+	}{
+		{name: "when a gzip file has an invalid header", corrupt: func([]byte) []byte { return []byte("not a gzip") }},
+		{name: "when a gzip file is truncated", corrupt: func(content []byte) []byte { return content[:len(content)-4] }},
+	}
+	for _, test := range corruptCases {
+		test := test
+		f.RunWithTestDir(test.name+", should return an error and leave a file untouched", func(testDir string) {
+			gzipFile, toFile := path.Join(testDir, "file.gz"), path.Join(testDir, "file")
+			f.writeGzipFile(gzipFile, "decompressed content")
+			content, err := os.ReadFile(gzipFile)
+			f.Require().NoError(err)
+			f.Require().NoError(os.WriteFile(gzipFile, test.corrupt(content), 0664))
+			f.Require().NoError(os.WriteFile(toFile, []byte("old content"), 0664))
+
+			f.Error(f.Decompress(gzipFile, toFile))
+			content, err = os.ReadFile(toFile)
+			f.NoError(err)
+			f.Equal("old content", string(content))
+			names, err := f.ListFileNamesInDir(testDir)
+			f.NoError(err)
+			f.ElementsMatch([]string{"file.gz", "file"}, names, "should not leave a temporary file")
+		})
+	}
+}
+
+func (f *filesystemTestSuite) TestWriteFileAtomic() {
+	f.Run("when a directory does not exist, should return an error", func() {
+		f.Error(f.WriteFileAtomic("not/existing/file", []byte("content"), 0664))
+	})
+
+	f.RunWithTestDir("when a file exists, should replace it with a content and a mode", func(testDir string) {
+		file := path.Join(testDir, "file")
+		f.Require().NoError(os.WriteFile(file, []byte("old content"), 0600))
+
+		f.Require().NoError(f.WriteFileAtomic(file, []byte("new content"), 0640))
+		content, err := os.ReadFile(file)
+		f.NoError(err)
+		f.Equal("new content", string(content))
+		stat, err := os.Stat(file)
+		f.Require().NoError(err)
+		f.Equal(os.FileMode(0640), stat.Mode().Perm())
+		names, err := f.ListFileNamesInDir(testDir)
+		f.NoError(err)
+		f.Equal([]string{"file"}, names, "should not leave a temporary file")
+	})
+}
+
+// writeGzipFile creates a gzip file with compressed content.
+func (f *filesystemTestSuite) writeGzipFile(gzipFile, content string) {
+	file, err := os.Create(gzipFile)
+	f.Require().NoError(err)
+	defer file.Close()
+	writer := gzip.NewWriter(file)
+	_, err = writer.Write([]byte(content))
+	f.Require().NoError(err)
+	f.Require().NoError(writer.Close())
+}
+
 func (f *filesystemTestSuite) TestListFileNamesInDir() {
 	f.Run("when a directory does not exist", func() {
 		files, err := f.ListFileNamesInDir("not/existing/dir")
@@ -210,3 +512,31 @@ func (f *filesystemTestSuite) TestListFileNamesInDir() {
 		f.Empty(files)
 	})
 }
+
+func (f *filesystemTestSuite) TestListMatchingNames() {
+	f.Run("when a directory does not exist", func() {
+		names, err := f.ListMatchingNames("not/existing/dir", "*")
+
+		f.ErrorIs(err, os.ErrNotExist)
+		f.Empty(names)
+	})
+
+	f.Run("when a pattern is invalid", func() {
+		names, err := f.ListMatchingNames(os.TempDir(), "[")
+
+		f.ErrorIs(err, filepath.ErrBadPattern)
+		f.Empty(names)
+	})
+
+	f.RunWithTestDir("when a directory contains matching and not matching entries", func(testDir string) {
+		for _, file := range []string{"isactive-b", "isactive-a", "other", "dir/isactive-inner"} {
+			f.Require().NoError(os.MkdirAll(path.Join(testDir, filepath.Dir(file)), os.ModePerm))
+			f.Require().NoError(os.WriteFile(path.Join(testDir, file), []byte{}, 0664))
+		}
+
+		names, err := f.ListMatchingNames(testDir, "isactive-*")
+
+		f.NoError(err)
+		f.Equal([]string{"isactive-a", "isactive-b"}, names, "should return sorted names without searching subdirectories")
+	})
+}
@@ -21,8 +21,13 @@ package filesystem
 import (
 	"context"
 	"fmt"
+	"io/fs"
 	"log/slog"
+	"os"
 	"path"
+	"path/filepath"
+	"sync/atomic"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/k-lb/entrypoint-framework/handlers/internal/global"
@@ -35,7 +40,7 @@ type Watcher interface {
 	GetEvent() *WatcherEvent
 	// GetNotificationChannel returns a channel that sends notifications when a new event is available.
 	GetNotificationChannel() <-chan struct{}
-	// Stop causes Watcher to cease its operation.
+	// Stop causes Watcher to cease its operation. A notification channel should be closed afterwards.
 	Stop()
 }
 
@@ -46,6 +51,27 @@ type WatcherEvent struct {
 	Operation fsnotify.Op
 	// Error denotes that error has occurred while watching.
 	Error error
+	// Initial denotes that the event wasn't observed by a watcher but was created by a consumer for a state of
+	// the watched file found at startup.
+	Initial bool
+}
+
+// WatcherHealth is a diagnostic state of a watcher. It tells if the watcher is still delivering events.
+type WatcherHealth struct {
+	// Open is true until a goroutine reading events of an underlying fsnotify watcher has returned.
+	Open bool
+	// Stopped is true when Stop was called.
+	Stopped bool
+	// Events is a number of watcher events (including errors) pushed so far.
+	Events uint64
+	// LastEvent is a time when the last watcher event was pushed. It is zero if no event was pushed.
+	LastEvent time.Time
+}
+
+// HealthReporter is implemented by watchers which report their WatcherHealth.
+type HealthReporter interface {
+	// Health returns a current WatcherHealth.
+	Health() WatcherHealth
 }
 
 // FileWatcher observes file and notifies when observed type of change occurs (e.g. write). It always provides latest
@@ -53,37 +79,167 @@ type WatcherEvent struct {
 type FileWatcher struct {
 	notifier        *global.EventNotifier[WatcherEvent]
 	fsnotifyWatcher *fsnotify.Watcher
+
+	log                 *slog.Logger
+	quietFalsePositives bool
+	falsePositives      atomic.Uint64 // a number of GetEvent calls which returned nil.
+
+	open      atomic.Bool
+	stopped   atomic.Bool
+	events    atomic.Uint64
+	lastEvent atomic.Int64 // unix nanoseconds of the last pushed event, 0 if none was pushed.
 }
 
 // NewFileWatcher returns a watcher events channel and an error if any occurred. It initializes fsnotify watcher to a
 // watchedFile and listens for its events in a new goroutine. A watcher event is pushed with an operation or an error
 // depending on operation of fsnotify watcher. Watched operations can be created with "|" operator for example
-// fsnotify.Create|fsnotify.Remove.
+// fsnotify.Create|fsnotify.Remove. If a watchedFile is a symlink, it is watched as described in newSymlinkWatcher.
 func (r real) NewFileWatcher(watchedFile string, watchedOps fsnotify.Op) (Watcher, error) {
+	if info, err := os.Lstat(watchedFile); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		return r.newSymlinkWatcher(watchedFile, watchedOps)
+	}
+	return r.newWatcher([]string{path.Dir(watchedFile)}, func(_ *fsnotify.Watcher, ev fsnotify.Event) fsnotify.Op {
+		if ev.Name == watchedFile {
+			return ev.Op & watchedOps
+		}
+		return 0
+	})
+}
+
+// newSymlinkWatcher returns a watcher of a link and an error if any occurred. Directories of the link and of every link
+// it points to are watched, so repointing any of them is observed (e.g. an atomic swap of a "..data" symlink in
+// a Kubernetes ConfigMap volume). The link is resolved again on every event: when its target has changed, a Create
+// event is pushed and directories of a new chain of links are watched. When the target can't be resolved, a Remove event
+// is pushed. Other operations are pushed if they were made to the link itself or to its current target.
+func (r real) newSymlinkWatcher(link string, watchedOps fsnotify.Op) (*FileWatcher, error) {
+	target, _ := filepath.EvalSymlinks(link)
+	return r.newWatcher(symlinkDirs(link), func(w *fsnotify.Watcher, ev fsnotify.Event) fsnotify.Op {
+		newTarget, err := filepath.EvalSymlinks(link)
+		if err != nil {
+			newTarget = ""
+		}
+		changed := newTarget != target
+		target = newTarget
+		switch {
+		case changed && newTarget == "":
+			return fsnotify.Remove & watchedOps
+		case changed:
+			for _, dir := range symlinkDirs(link) {
+				if err := w.Add(dir); err != nil {
+					r.log.Warn("could not watch a directory of a symlink", slog.String("dir", dir), slog.Any("error", err))
+				}
+			}
+			r.log.Debug("a symlink was repointed", slog.String("target", newTarget))
+			return fsnotify.Create & watchedOps
+		case ev.Name == link:
+			return ev.Op & watchedOps
+		case target != "":
+			if resolved, err := filepath.EvalSymlinks(ev.Name); err == nil && resolved == target {
+				return ev.Op & watchedOps
+			}
+		}
+		return 0
+	})
+}
+
+// maxSymlinks is a maximal number of links followed by symlinkDirs.
+const maxSymlinks = 255
+
+// symlinkDirs returns directories of a link and of every link on a chain it points to.
+func symlinkDirs(link string) []string {
+	dirs := []string{}
+	for i := 0; i < maxSymlinks; i++ {
+		dirs = append(dirs, filepath.Dir(link))
+		dest, err := os.Readlink(link)
+		if err != nil {
+			break
+		}
+		if !filepath.IsAbs(dest) {
+			dest = filepath.Join(filepath.Dir(link), dest)
+		}
+		link = dest
+	}
+	return dirs
+}
+
+// NewDirWatcher returns a watcher and an error if any occurred. It initializes fsnotify watcher to a watchedDir and all
+// its subdirectories and listens for their events in a new goroutine. Subdirectories created later are also watched.
+// A watcher event is pushed on every operation made to any file in a watchedDir tree.
+func (r real) NewDirWatcher(watchedDir string) (Watcher, error) {
+	dirs := []string{}
+	err := filepath.WalkDir(watchedDir, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.IsDir() {
+			dirs = append(dirs, path)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not list directories of %s. Reason: %w", watchedDir, err)
+	}
+	return r.newWatcher(dirs, func(w *fsnotify.Watcher, ev fsnotify.Event) fsnotify.Op {
+		if ev.Has(fsnotify.Create) {
+			if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+				if err := w.Add(ev.Name); err != nil {
+					r.log.Warn("could not watch a new directory", slog.String("dir", ev.Name), slog.Any("error", err))
+				}
+			}
+		}
+		return ev.Op
+	})
+}
+
+// NewGlobWatcher returns a watcher and an error if any occurred. It initializes fsnotify watcher to a watchedDir and
+// listens for its events in a new goroutine. A watcher event is pushed with an operation of watchedOps made to any file
+// directly in the watchedDir with a name matching a pattern with syntax of filepath.Match.
+func (r real) NewGlobWatcher(watchedDir, pattern string, watchedOps fsnotify.Op) (Watcher, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %s. Reason: %w", pattern, err)
+	}
+	watchedDir = filepath.Clean(watchedDir)
+	return r.newWatcher([]string{watchedDir}, func(_ *fsnotify.Watcher, ev fsnotify.Event) fsnotify.Op {
+		if matched, _ := filepath.Match(pattern, filepath.Base(ev.Name)); matched && filepath.Dir(ev.Name) == watchedDir {
+			return ev.Op & watchedOps
+		}
+		return 0
+	})
+}
+
+// newWatcher returns a FileWatcher observing dirs and an error if any occurred. In a new goroutine it pushes watcher
+// events with operations returned by watchedOp for fsnotify events. An fsnotify event is ignored if watchedOp returns 0.
+func (r real) newWatcher(dirs []string, watchedOp func(*fsnotify.Watcher, fsnotify.Event) fsnotify.Op) (*FileWatcher, error) {
 	fsnotifyWatcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, fmt.Errorf("could not create a new fsnotify watcher. Reason: %w", err)
 	}
-	err = fsnotifyWatcher.Add(path.Dir(watchedFile))
-	if err != nil {
-		return nil, fmt.Errorf("could not add to fsnotify watcher a file: %s. Reason: %w", watchedFile, err)
+	for _, dir := range dirs {
+		if err := fsnotifyWatcher.Add(dir); err != nil {
+			fsnotifyWatcher.Close()
+			return nil, fmt.Errorf("could not add to fsnotify watcher a directory: %s. Reason: %w", dir, err)
+		}
 	}
 	fw := &FileWatcher{
-		notifier:        global.NewEventNotifier[WatcherEvent](),
+		notifier:        global.NewBufferedEventNotifier[WatcherEvent](r.notifierBuffer),
 		fsnotifyWatcher: fsnotifyWatcher,
+
+		log:                 r.log,
+		quietFalsePositives: r.quietFalsePositives,
 	}
+	fw.open.Store(true)
 	r.log.Debug("watching has started")
 
 	go func() {
 		defer fw.notifier.Stop()
+		defer fw.open.Store(false)
 		for {
 			select {
 			case ev, open := <-fw.fsnotifyWatcher.Events:
 				if open {
-					if ev.Op&watchedOps != 0 && ev.Name == watchedFile {
-						fw.notifier.Notify(WatcherEvent{Operation: ev.Op})
-						r.log.Debug("a watcher event was sent", slog.String("operation", ev.Op.String()))
-					} else {
+					if op := watchedOp(fw.fsnotifyWatcher, ev); op != 0 {
+						fw.notify(WatcherEvent{Operation: op})
+						if r.eventLogSampler.Allow() {
+							r.log.Debug("a watcher event was sent", slog.String("operation", op.String()))
+						}
+					} else if r.eventLogSampler.Allow() {
 						r.log.Log(context.Background(), slog.LevelDebug-1, "an fsnotify event was observed", slog.String("event", ev.String()))
 					}
 				} else {
@@ -92,7 +248,7 @@ func (r real) NewFileWatcher(watchedFile string, watchedOps fsnotify.Op) (Watche
 				}
 			case err, open := <-fw.fsnotifyWatcher.Errors:
 				if open {
-					fw.notifier.Notify(WatcherEvent{Error: fmt.Errorf("watcher error. Reason: %w", err)})
+					fw.notify(WatcherEvent{Error: fmt.Errorf("watcher error. Reason: %w", err)})
 					r.log.Debug("a watcher event was sent", slog.Any("error", err))
 				} else {
 					r.log.Debug("a watcher errors channel was closed")
@@ -104,10 +260,39 @@ func (r real) NewFileWatcher(watchedFile string, watchedOps fsnotify.Op) (Watche
 	return fw, nil
 }
 
+// notify pushes an event and records it in a health of the FileWatcher.
+func (f *FileWatcher) notify(ev WatcherEvent) {
+	f.lastEvent.Store(time.Now().UnixNano())
+	f.events.Add(1)
+	f.notifier.Notify(ev)
+}
+
+// Health returns a current WatcherHealth of the FileWatcher. It is safe to call at any time, also after Stop.
+func (f *FileWatcher) Health() WatcherHealth {
+	health := WatcherHealth{Open: f.open.Load(), Stopped: f.stopped.Load(), Events: f.events.Load()}
+	if last := f.lastEvent.Load(); last != 0 {
+		health.LastEvent = time.Unix(0, last)
+	}
+	return health
+}
+
 // GetEvent returns the latest WatcherEvent that was observed. Nil will be returned if there were no new events
-// between GetEvent calls.
+// between GetEvent calls. Such a false positive is counted and logged unless quiet false positives were requested.
 func (f *FileWatcher) GetEvent() *WatcherEvent {
-	return f.notifier.GetValue()
+	ev := f.notifier.GetValue()
+	if ev == nil {
+		count := f.falsePositives.Add(1)
+		if !f.quietFalsePositives {
+			f.log.Debug("a false positive notification was observed", slog.Uint64("count", count))
+		}
+	}
+	return ev
+}
+
+// FalsePositiveCount returns a number of notifications after which GetEvent returned nil. It helps to find sources of
+// needless wake-ups of a consumer.
+func (f *FileWatcher) FalsePositiveCount() uint64 {
+	return f.falsePositives.Load()
 }
 
 // GetNotificationChannel returns channel on which a notification that an event was observed is sent.
@@ -117,7 +302,10 @@ func (f *FileWatcher) GetNotificationChannel() <-chan struct{} {
 	return f.notifier.GetNotifyChannel()
 }
 
-// Stop ceases FileWatcher operations.
+// Stop ceases FileWatcher operations. It doesn't block, a notification channel is closed by a watching goroutine when
+// it has returned and a pending notification is dropped then. No notification is sent afterwards. Stop may be called
+// many times and GetEvent is safe to call after it.
 func (f *FileWatcher) Stop() {
+	f.stopped.Store(true)
 	f.fsnotifyWatcher.Close()
 }
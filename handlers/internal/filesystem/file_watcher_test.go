@@ -17,8 +17,15 @@
 package filesystem
 
 import (
+	"bytes"
+	"fmt"
+	"log/slog"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
@@ -80,6 +87,357 @@ func (f *filesystemTestSuite) TestFileWatcher() {
 	}
 }
 
+func (f *filesystemTestSuite) TestFileWatcherStopWithPendingEvents() {
+	f.RunWithTestDir("when a watcher is stopped while events are pending, should close a notification channel", func(testDir string) {
+		testFile := path.Join(testDir, "file.test")
+		for i := 0; i < 20; i++ {
+			fw, err := f.NewFileWatcher(testFile, fsnotify.Write)
+			f.Require().NoError(err)
+			stopWriting := make(chan struct{})
+			written := make(chan struct{})
+			go func() {
+				defer close(written)
+				for {
+					select {
+					case <-stopWriting:
+						return
+					default:
+						os.WriteFile(testFile, []byte("content"), 0664)
+					}
+				}
+			}()
+			notifier := fw.GetNotificationChannel()
+			<-notifier
+			go fw.Stop()
+			closed := make(chan struct{})
+			go func() {
+				defer close(closed)
+				for range notifier {
+					fw.GetEvent()
+				}
+				fw.GetEvent() // should be safe after Stop
+			}()
+			select {
+			case <-closed:
+			case <-time.After(5 * time.Second):
+				f.Fail("a notification channel wasn't closed after Stop")
+			}
+			close(stopWriting)
+			<-written
+		}
+	})
+}
+
+// syncBuffer is a bytes.Buffer which can be written by a watcher goroutine and read by a test.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.String()
+}
+
+func (f *filesystemTestSuite) TestFileWatcherLogSampling() {
+	const changes = 100 // every change creates a file, so it makes at least one and at most three fsnotify events
+	testCases := [...]struct {
+		name     string
+		opts     []Option
+		minLines int
+		maxLines func(seconds int) int
+	}{
+		{name: "when sampling is disabled, should log every observed event", minLines: changes,
+			maxLines: func(int) int { return 3 * changes }},
+		{name: "when every 10th log is sampled, should log every 10th observed event", opts: []Option{WithEventLogSampling(10, 0)}, minLines: changes / 10,
+			maxLines: func(int) int { return 3 * changes / 10 }},
+		{name: "when at most 5 logs per second are sampled, should log at most 5 observed events per second", opts: []Option{WithEventLogSampling(0, 5)}, minLines: 1,
+			maxLines: func(seconds int) int { return 5 * seconds }},
+	}
+	for _, test := range testCases {
+		test := test
+		f.RunWithTestDir(test.name, func(testDir string) {
+			logs := &syncBuffer{}
+			fs := New(slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug - 1})), test.opts...)
+			fw, err := fs.NewFileWatcher(path.Join(testDir, "file.test"), fsnotify.Write)
+			f.Require().NoError(err)
+
+			start := time.Now()
+			for i := 0; i < changes; i++ {
+				f.writeToFile(path.Join(testDir, fmt.Sprintf("other%d.test", i)))
+			}
+			f.writeToFile(path.Join(testDir, "file.test")) // events are ordered, so all previous ones were logged after it
+			<-fw.GetNotificationChannel()
+			fw.Stop()
+			for range fw.GetNotificationChannel() {
+			}
+			seconds := int(time.Since(start)/time.Second) + 1
+
+			lines := strings.Count(logs.String(), "an fsnotify event was observed")
+			f.GreaterOrEqual(lines, test.minLines)
+			f.LessOrEqual(lines, test.maxLines(seconds))
+		})
+	}
+}
+
+func (f *filesystemTestSuite) TestFileWatcherFalsePositives() {
+	testCases := [...]struct {
+		name          string
+		opts          []Option
+		expectedLines int
+	}{
+		{name: "when false positives are not quiet, should count and log them", expectedLines: 3},
+		{name: "when false positives are quiet, should only count them", opts: []Option{WithQuietFalsePositives()}},
+	}
+	for _, test := range testCases {
+		test := test
+		f.RunWithTestDir(test.name, func(testDir string) {
+			logs := &syncBuffer{}
+			fs := New(slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug})), test.opts...)
+			w, err := fs.NewFileWatcher(path.Join(testDir, "file.test"), fsnotify.Write)
+			f.Require().NoError(err)
+			fw := w.(*FileWatcher)
+
+			for i := 0; i < 3; i++ {
+				fw.notifier.Notify(WatcherEvent{Operation: fsnotify.Write})
+				fw.notifier.GetValue() // a value is taken before a notification is read, so it has no pending value
+				<-fw.GetNotificationChannel()
+				f.Nil(fw.GetEvent())
+			}
+			fw.notifier.Notify(WatcherEvent{Operation: fsnotify.Write})
+			<-fw.GetNotificationChannel()
+			f.NotNil(fw.GetEvent())
+			fw.Stop()
+
+			f.Equal(uint64(3), fw.FalsePositiveCount(), "should count only notifications without a pending value")
+			f.Equal(test.expectedLines, strings.Count(logs.String(), "a false positive notification was observed"))
+		})
+	}
+}
+
+func (f *filesystemTestSuite) TestFileWatcherNotifierBuffer() {
+	testCases := [...]struct {
+		name                  string
+		opts                  []Option
+		expectedNotifications int
+	}{
+		{name: "when a buffer isn't configured, should coalesce a burst to a single notification", expectedNotifications: 1},
+		{name: "when a buffer is configured, should keep notifications of a burst up to a buffer size", opts: []Option{WithNotifierBuffer(3)}, expectedNotifications: 3},
+	}
+	for _, test := range testCases {
+		test := test
+		f.RunWithTestDir(test.name, func(testDir string) {
+			testFile := path.Join(testDir, "file.test")
+			fw, err := New(nil, test.opts...).NewFileWatcher(testFile, fsnotify.Write)
+			f.Require().NoError(err)
+			defer fw.Stop()
+
+			notifier := fw.GetNotificationChannel()
+			for i := 0; i < 10; i++ {
+				f.writeToFile(testFile)
+				// the kernel merges identical events which weren't read yet, so every write waits for its notification
+				pending := min(i+1, test.expectedNotifications)
+				f.Require().Eventually(func() bool { return len(notifier) == pending }, time.Second, time.Millisecond)
+			}
+			<-notifier
+			ev := fw.GetEvent()
+			f.Require().NotNil(ev)
+			f.Equal(fsnotify.Write, ev.Operation, "should keep the latest event")
+			for i := 1; i < test.expectedNotifications; i++ {
+				<-notifier
+				f.Nil(fw.GetEvent(), "should report following notifications of a burst as false positives")
+			}
+		})
+	}
+}
+
+func (f *filesystemTestSuite) TestFileWatcherHealth() {
+	f.RunWithTestDir("when events are pushed and a watcher is stopped, should reflect them in a health", func(testDir string) {
+		testFile := path.Join(testDir, "file.test")
+		w, err := f.NewFileWatcher(testFile, fsnotify.Write)
+		f.Require().NoError(err)
+		fw := w.(*FileWatcher)
+		f.Equal(WatcherHealth{Open: true}, fw.Health(), "should be open without events after start")
+
+		start := time.Now()
+		for i := 1; i <= 3; i++ {
+			f.writeToFile(testFile)
+			<-fw.GetNotificationChannel()
+			fw.GetEvent()
+			f.Eventually(func() bool { return fw.Health().Events >= uint64(i) }, time.Second, time.Millisecond)
+		}
+		health := fw.Health()
+		f.True(health.Open)
+		f.False(health.Stopped)
+		f.GreaterOrEqual(health.Events, uint64(3))
+		f.False(health.LastEvent.Before(start), "should record a time of the last event")
+
+		fw.Stop()
+		f.True(fw.Health().Stopped)
+		for range fw.GetNotificationChannel() {
+		}
+		health = fw.Health()
+		f.False(health.Open, "should be closed after a watching goroutine has returned")
+		f.True(health.Stopped)
+	})
+}
+
+func (f *filesystemTestSuite) TestDirWatcher() {
+	f.Run("when a directory does not exist", func() {
+		dirWatcher, err := f.NewDirWatcher("not/existing/dir")
+		f.Nil(dirWatcher)
+		f.Error(err)
+	})
+
+	f.RunWithTestDir("when files are changed in a directory tree", func(testDir string) {
+		f.Require().NoError(os.Mkdir(path.Join(testDir, "inner"), os.ModePerm))
+		dw, err := f.NewDirWatcher(testDir)
+		f.Require().NoError(err)
+		f.Require().NotNil(dw)
+		notifier := dw.GetNotificationChannel()
+		// drain discards all pending events so every step observes only its own changes.
+		drain := func() {
+			time.Sleep(time.Second / 100)
+			select {
+			case <-notifier:
+			default:
+			}
+			dw.GetEvent()
+		}
+
+		f.writeToFile(path.Join(testDir, "file.test"))
+		_, open := <-notifier
+		f.True(open)
+		f.NotNil(dw.GetEvent(), "an event should be returned after a file in a watched directory was changed")
+		drain()
+
+		f.writeToFile(path.Join(testDir, "inner", "file.test"))
+		_, open = <-notifier
+		f.True(open)
+		f.NotNil(dw.GetEvent(), "an event should be returned after a file in a watched subdirectory was changed")
+		drain()
+
+		f.Require().NoError(os.Mkdir(path.Join(testDir, "new"), os.ModePerm))
+		<-notifier
+		f.Equal(&WatcherEvent{Operation: fsnotify.Create}, dw.GetEvent())
+		drain()
+		f.writeToFile(path.Join(testDir, "new", "file.test"))
+		_, open = <-notifier
+		f.True(open)
+		f.NotNil(dw.GetEvent(), "an event should be returned after a file in a new subdirectory was changed")
+
+		dw.Stop()
+		for range notifier {
+		}
+		_, open = <-notifier
+		f.False(open, "should close a notifier channel")
+	})
+}
+
+func (f *filesystemTestSuite) TestGlobWatcher() {
+	f.Run("when a pattern is invalid", func() {
+		globWatcher, err := f.NewGlobWatcher(os.TempDir(), "[", fsnotify.Create)
+		f.Nil(globWatcher)
+		f.ErrorIs(err, filepath.ErrBadPattern)
+	})
+
+	f.RunWithTestDir("when files are created in a directory, should notify only about files matching a pattern", func(testDir string) {
+		f.Require().NoError(os.Mkdir(path.Join(testDir, "isactive-dir"), os.ModePerm))
+		gw, err := f.NewGlobWatcher(testDir, "isactive-*", fsnotify.Create)
+		f.Require().NoError(err)
+		f.Require().NotNil(gw)
+		notifier := gw.GetNotificationChannel()
+
+		f.writeToFile(path.Join(testDir, "other"))
+		f.writeToFile(path.Join(testDir, "isactive-dir", "isactive-inner"))
+		select {
+		case <-notifier:
+			f.Fail("should not notify about files which don't match a pattern or are in subdirectories")
+		case <-time.After(time.Second / 10):
+		}
+		f.writeToFile(path.Join(testDir, "isactive-1"))
+		_, open := <-notifier
+		f.True(open)
+		f.Equal(&WatcherEvent{Operation: fsnotify.Create}, gw.GetEvent())
+
+		gw.Stop()
+		for range notifier {
+		}
+	})
+}
+
+func (f *filesystemTestSuite) TestSymlinkWatcher() {
+	f.RunWithTestDir("when a ..data symlink of a ConfigMap volume is swapped, should push a Create event and hardlink a new target", func(testDir string) {
+		f.swapConfigMapData(testDir, "..v1", "v1")
+		link, hardlink := path.Join(testDir, "app.conf"), path.Join(testDir, "app.conf.hardlink")
+		f.Require().NoError(os.Symlink(path.Join("..data", "app.conf"), link))
+		sw, err := f.NewFileWatcher(link, fsnotify.Create|fsnotify.Remove)
+		f.Require().NoError(err)
+		f.Require().NotNil(sw)
+		notifier := sw.GetNotificationChannel()
+
+		for _, version := range []string{"v2", "v3"} {
+			f.swapConfigMapData(testDir, ".."+version, version)
+			_, open := <-notifier
+			f.True(open)
+			f.Equal(&WatcherEvent{Operation: fsnotify.Create}, sw.GetEvent(), version)
+			f.Require().NoError(f.Hardlink(link, hardlink))
+			content, err := os.ReadFile(hardlink)
+			f.NoError(err)
+			f.Equal(version, string(content), "should hardlink a target of the symlink")
+		}
+
+		f.Require().NoError(os.Remove(link))
+		_, open := <-notifier
+		f.True(open)
+		f.Equal(&WatcherEvent{Operation: fsnotify.Remove}, sw.GetEvent())
+
+		sw.Stop()
+		for range notifier {
+		}
+	})
+
+	f.RunWithTestDir("when a target of a symlink is written in place, should push its operation", func(testDir string) {
+		target, link := path.Join(testDir, "target"), path.Join(testDir, "link")
+		f.writeToFile(target)
+		f.Require().NoError(os.Symlink(target, link))
+		sw, err := f.NewFileWatcher(link, fsnotify.Write)
+		f.Require().NoError(err)
+		f.Require().NotNil(sw)
+		notifier := sw.GetNotificationChannel()
+
+		f.writeToFile(path.Join(testDir, "other"))
+		f.writeToFile(target)
+		_, open := <-notifier
+		f.True(open)
+		f.Equal(&WatcherEvent{Operation: fsnotify.Write}, sw.GetEvent())
+
+		sw.Stop()
+		for range notifier {
+		}
+	})
+}
+
+// swapConfigMapData updates a dir as kubelet updates a ConfigMap volume: an app.conf file with a content is written to
+// a new dataDir and a "..data" symlink is atomically replaced to point to it. A previous dataDir is removed.
+func (f *filesystemTestSuite) swapConfigMapData(dir, dataDir, content string) {
+	f.Require().NoError(os.Mkdir(path.Join(dir, dataDir), os.ModePerm))
+	f.Require().NoError(os.WriteFile(path.Join(dir, dataDir, "app.conf"), []byte(content), 0664))
+	previous, _ := os.Readlink(path.Join(dir, "..data"))
+	f.Require().NoError(os.Symlink(dataDir, path.Join(dir, "..data_tmp")))
+	f.Require().NoError(os.Rename(path.Join(dir, "..data_tmp"), path.Join(dir, "..data")))
+	if previous != "" {
+		f.Require().NoError(os.RemoveAll(path.Join(dir, previous)))
+	}
+}
+
 // writeToFile can not be replaced with os.WriteFile as os.O_TRUNC flag will make extra write events
 func (f *filesystemTestSuite) writeToFile(filePath string) {
 	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE, 0664)
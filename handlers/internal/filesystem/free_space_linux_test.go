@@ -0,0 +1,36 @@
+//go:build linux
+
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package filesystem
+
+import "path"
+
+func (f *filesystemTestSuite) TestFreeSpace() {
+	f.RunWithTestDir("when a path exists, should return free space of its filesystem", func(testDir string) {
+		free, total, err := f.FreeSpace(testDir)
+
+		f.NoError(err)
+		f.Positive(total)
+		f.LessOrEqual(free, total)
+	})
+
+	f.RunWithTestDir("when a path does not exist, should return an error", func(testDir string) {
+		_, _, err := f.FreeSpace(path.Join(testDir, "not/existing/dir"))
+		f.Error(err)
+	})
+}
@@ -0,0 +1,29 @@
+//go:build !linux
+
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package filesystem
+
+import "errors"
+
+// ErrFreeSpaceUnsupported is returned when free space of a filesystem can't be checked on this platform.
+var ErrFreeSpaceUnsupported = errors.New("checking free space is not supported on this platform")
+
+// FreeSpace returns an ErrFreeSpaceUnsupported, as free space can't be checked on this platform.
+func (real) FreeSpace(string) (free, total uint64, err error) {
+	return 0, 0, ErrFreeSpaceUnsupported
+}
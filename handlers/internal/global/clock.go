@@ -0,0 +1,55 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package global
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Clock provides time utilities. It is used to separate time operations from rest of the code, so they can be
+// replaced in tests.
+type Clock interface {
+	// Now returns current time.
+	Now() time.Time
+	// After returns a channel on which current time is sent after d has elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// NewClock returns a Clock implementation that uses time package.
+func NewClock() Clock {
+	return realClock{}
+}
+
+// realClock implements Clock interface with functions from time package.
+type realClock struct{}
+
+// Now returns current local time.
+func (realClock) Now() time.Time { return time.Now() }
+
+// After waits for d to elapse and then sends current time on returned channel.
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Jitter returns d changed by a random value from range [-fraction*d, fraction*d]. It is used to desynchronize
+// periodic actions of many instances started at the same time. Fraction is limited to range [0, 1].
+func Jitter(d time.Duration, fraction float64) time.Duration {
+	fraction = min(max(fraction, 0), 1)
+	if fraction == 0 {
+		return d
+	}
+	return d + time.Duration((rand.Float64()*2-1)*fraction*float64(d))
+}
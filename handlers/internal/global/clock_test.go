@@ -0,0 +1,57 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package global
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJitter(t *testing.T) {
+	testCases := [...]struct {
+		name           string
+		fraction       float64
+		expectedMin    time.Duration
+		expectedMax    time.Duration
+		expectPerturbs bool
+	}{
+		{name: "when fraction is 0, should return an unchanged duration", fraction: 0, expectedMin: time.Second, expectedMax: time.Second},
+		{name: "when fraction is negative, should return an unchanged duration", fraction: -1, expectedMin: time.Second, expectedMax: time.Second},
+		{name: "when fraction is 0.1, should perturb a duration within 10%", fraction: 0.1, expectedMin: 900 * time.Millisecond, expectedMax: 1100 * time.Millisecond, expectPerturbs: true},
+		{name: "when fraction is greater than 1, should perturb a duration within 100%", fraction: 5, expectedMin: 0, expectedMax: 2 * time.Second, expectPerturbs: true},
+	}
+	for _, test := range testCases {
+		perturbed := false
+		for i := 0; i < 100; i++ {
+			d := Jitter(time.Second, test.fraction)
+			assert.GreaterOrEqual(t, d, test.expectedMin, test.name)
+			assert.LessOrEqual(t, d, test.expectedMax, test.name)
+			perturbed = perturbed || d != time.Second
+		}
+		assert.Equal(t, test.expectPerturbs, perturbed, test.name)
+	}
+}
+
+func TestClock(t *testing.T) {
+	clock := NewClock()
+	before := time.Now()
+	fired := <-clock.After(time.Millisecond)
+	assert.False(t, fired.Before(before.Add(time.Millisecond)))
+	assert.False(t, clock.Now().Before(fired))
+}
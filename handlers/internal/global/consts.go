@@ -16,9 +16,11 @@
 
 // Package global is created to contain common variables and functions used by many packages.
 //
-// Currently there are two types of resources:
+// Currently there are following types of resources:
 // - constants,
-// - functions to set or get a logger.
+// - functions to set or get a logger and a log sampler,
+// - an event notifier,
+// - a clock and time helpers.
 package global
 
 const (
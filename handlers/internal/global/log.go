@@ -19,6 +19,8 @@ package global
 import (
 	"io"
 	"log/slog"
+	"sync"
+	"time"
 )
 
 // HandleNilLogger returns a discard logger if passed logger is nil.
@@ -28,3 +30,45 @@ func HandleNilLogger(logger *slog.Logger) *slog.Logger {
 	}
 	return slog.New(slog.NewTextHandler(io.Discard, nil))
 }
+
+// LogSampler limits a number of high-frequency logs. It allows only every n-th log and at most perSecond logs in each
+// second. A zero value of a limit disables it. A nil LogSampler allows all logs. It is safe for concurrent use.
+type LogSampler struct {
+	every     int
+	perSecond int
+	clock     Clock
+
+	mu          sync.Mutex
+	count       int
+	windowStart time.Time
+	inWindow    int
+}
+
+// NewLogSampler returns a pointer to a LogSampler allowing every n-th log and at most perSecond logs per second.
+func NewLogSampler(every, perSecond int, clock Clock) *LogSampler {
+	return &LogSampler{every: every, perSecond: perSecond, clock: clock}
+}
+
+// Allow returns true if a log should be emitted.
+func (s *LogSampler) Allow() bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count++
+	if s.every > 1 && (s.count-1)%s.every != 0 {
+		return false
+	}
+	if s.perSecond > 0 {
+		if now := s.clock.Now(); now.Sub(s.windowStart) >= time.Second {
+			s.windowStart = now
+			s.inWindow = 0
+		}
+		if s.inWindow >= s.perSecond {
+			return false
+		}
+		s.inWindow++
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package global
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// manualClock implements Clock. Its time changes only when it is set by a test.
+type manualClock struct {
+	now time.Time
+}
+
+func (m *manualClock) Now() time.Time                       { return m.now }
+func (m *manualClock) After(time.Duration) <-chan time.Time { return nil }
+
+func TestLogSampler(t *testing.T) {
+	countAllowed := func(s *LogSampler, n int) int {
+		allowed := 0
+		for i := 0; i < n; i++ {
+			if s.Allow() {
+				allowed++
+			}
+		}
+		return allowed
+	}
+	clock := &manualClock{now: time.Now()}
+
+	assert.Equal(t, 100, countAllowed(nil, 100), "a nil sampler should allow all logs")
+	assert.Equal(t, 100, countAllowed(NewLogSampler(0, 0, clock), 100), "a sampler without limits should allow all logs")
+	assert.Equal(t, 10, countAllowed(NewLogSampler(10, 0, clock), 100), "should allow every 10th log")
+
+	perSecond := NewLogSampler(0, 5, clock)
+	assert.Equal(t, 5, countAllowed(perSecond, 100), "should allow at most 5 logs in a second")
+	clock.now = clock.now.Add(time.Second / 2)
+	assert.Zero(t, countAllowed(perSecond, 100), "should not allow logs until a second has passed")
+	clock.now = clock.now.Add(time.Second / 2)
+	assert.Equal(t, 5, countAllowed(perSecond, 100), "should allow logs in a next second")
+
+	both := NewLogSampler(10, 3, clock)
+	assert.Equal(t, 3, countAllowed(both, 100), "should apply both limits")
+}
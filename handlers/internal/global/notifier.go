@@ -17,29 +17,53 @@
 package global
 
 import (
+	"sync"
 	"sync/atomic"
 )
 
 // EventNotifier allows producer that generates many events to notify consumer that event is pending.
 // On the other side - consumer always gets the latest event and all previous ones are ignored.
 // An event can be of any type.
+//
+// Stop and Notify may be called concurrently and Stop may be called many times. A Notify which happens after Stop only
+// stores a value, it never sends on the closed notify channel. GetValue is safe to call at any time, also after Stop.
 type EventNotifier[T any] struct {
-	ch  chan struct{}
-	val atomic.Pointer[T]
+	ch      chan struct{}
+	val     atomic.Pointer[T]
+	mu      sync.Mutex // guards sending on and closing of ch.
+	stopped bool
+
+	droppedSinceRead atomic.Int64 // a number of events overwritten by Notify since the last GetValue.
 }
 
 // NewEventNotifier returns EventNotifier that is ready to be used. If it's not needed anymore it
 // must be stopped with Stop() method.
 func NewEventNotifier[T any]() *EventNotifier[T] {
+	return NewBufferedEventNotifier[T](1)
+}
+
+// NewBufferedEventNotifier returns EventNotifier which keeps up to size pending notifications instead of one, so
+// a consumer can tell that a burst of events occurred. A value is still the latest event, so after the first
+// notification of a burst is handled, the following ones may be false positives. A size lower than 1 is treated as 1.
+func NewBufferedEventNotifier[T any](size int) *EventNotifier[T] {
 	return &EventNotifier[T]{
-		ch: make(chan struct{}, 1),
+		ch: make(chan struct{}, max(size, 1)),
 	}
 }
 
-// Stop closes notify channel and makes EventNotifier unusable. It should be used by producer.
+// Stop closes notify channel and makes EventNotifier unusable. It should be used by producer. Pending notifications are
+// dropped, so a consumer reading the channel after Stop sees it closed without more notifications. Stop never blocks
+// and calling it again does nothing.
 func (e *EventNotifier[_]) Stop() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stopped {
+		return
+	}
+	e.stopped = true
 	close(e.ch)
-	<-e.ch
+	for range e.ch { // a closed channel is drained, so it never blocks
+	}
 }
 
 // GetNotifyChannel returns channels on which consumer gets notifications about new events.
@@ -50,16 +74,30 @@ func (e *EventNotifier[_]) GetNotifyChannel() <-chan struct{} {
 // GetValue returns latest event that was registered. Consumer should use it after getting
 // notification from notify channel.
 func (e *EventNotifier[T]) GetValue() *T {
-	return e.val.Swap(nil)
+	val := e.val.Swap(nil)
+	e.droppedSinceRead.Store(0)
+	return val
 }
 
-// Notify should be used by producer to inform consumer about new event.
+// CoalescedCount returns a number of events which were overwritten by newer ones before consumer got them since
+// the last GetValue. It shows how far behind a slow consumer is.
+func (e *EventNotifier[_]) CoalescedCount() int {
+	return int(e.droppedSinceRead.Load())
+}
+
+// Notify should be used by producer to inform consumer about new event. After Stop a consumer isn't notified anymore.
 func (e *EventNotifier[T]) Notify(val T) {
-	e.val.Store(&val)
+	if e.val.Swap(&val) != nil {
+		e.droppedSinceRead.Add(1)
+	}
 
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stopped {
+		return
+	}
 	select {
 	case e.ch <- struct{}{}:
 	default:
-		return
 	}
 }
@@ -16,6 +16,10 @@
 
 package global
 
+import (
+	"sync"
+)
+
 func (s *eventNotifierTestSuite) TestGetNotifyChannel() {
 	ch := s.en.GetNotifyChannel()
 	s.Assert().Equal(1, cap(ch))
@@ -60,3 +64,108 @@ func (s *eventNotifierTestSuite) TestNotify() {
 		})
 	}
 }
+
+func (s *eventNotifierTestSuite) TestCoalescedCount() {
+	tests := [...]struct {
+		name     string
+		notifies int
+		expected int
+	}{
+		{name: "when there were no events, should return 0", notifies: 0, expected: 0},
+		{name: "when there was one event, should return 0", notifies: 1, expected: 0},
+		{name: "when there were few events without reading, should return a number of overwritten events", notifies: 5, expected: 4},
+	}
+	for _, test := range tests {
+		test := test
+		s.Run(test.name, func() {
+			en := NewEventNotifier[int]()
+			defer en.Stop()
+			for i := 0; i < test.notifies; i++ {
+				en.Notify(i)
+			}
+			s.Equal(test.expected, en.CoalescedCount())
+			en.GetValue()
+			s.Zero(en.CoalescedCount(), "should reset a count after a value is read")
+			en.Notify(0)
+			s.Zero(en.CoalescedCount(), "should not count an event notified after a read")
+		})
+	}
+}
+
+func (s *eventNotifierTestSuite) TestBufferedNotify() {
+	testCases := [...]struct {
+		name          string
+		size          int
+		notifies      int
+		expectedCap   int
+		expectedCount int
+	}{
+		{name: "when a burst is bigger than a buffer, should keep a buffer size of notifications", size: 3, notifies: 10, expectedCap: 3, expectedCount: 3},
+		{name: "when a burst is smaller than a buffer, should keep a notification for every event", size: 3, notifies: 2, expectedCap: 3, expectedCount: 2},
+		{name: "when a size is lower than 1, should keep a single notification", size: 0, notifies: 10, expectedCap: 1, expectedCount: 1},
+	}
+	for _, test := range testCases {
+		test := test
+		s.Run(test.name, func() {
+			en := NewBufferedEventNotifier[int](test.size)
+			defer en.Stop()
+			for i := 0; i < test.notifies; i++ {
+				en.Notify(i)
+			}
+			s.Equal(test.expectedCap, cap(en.GetNotifyChannel()))
+			s.Len(en.GetNotifyChannel(), test.expectedCount)
+			s.Equal(test.notifies-1, *en.GetValue(), "should keep the latest value")
+			s.Nil(en.GetValue())
+		})
+	}
+
+	s.Run("when a buffered notifier is stopped with pending notifications, should close a channel without them", func() {
+		en := NewBufferedEventNotifier[int](3)
+		en.Notify(1)
+		en.Notify(2)
+		en.Stop()
+		_, open := <-en.GetNotifyChannel()
+		s.False(open)
+	})
+}
+
+func (s *eventNotifierTestSuite) TestStop() {
+	s.Run("when a notifier is stopped with a pending notification, should close a channel without it", func() {
+		en := NewEventNotifier[int]()
+		en.Notify(1)
+		en.Stop()
+		_, open := <-en.GetNotifyChannel()
+		s.False(open)
+		s.Equal(1, *en.GetValue(), "should keep a value readable after Stop")
+	})
+
+	s.Run("when a notifier is stopped many times or notified after Stop, shouldn't panic", func() {
+		en := NewEventNotifier[int]()
+		en.Stop()
+		s.NotPanics(en.Stop)
+		s.NotPanics(func() { en.Notify(1) })
+		_, open := <-en.GetNotifyChannel()
+		s.False(open)
+	})
+
+	s.Run("when Stop and Notify are called concurrently, shouldn't panic or block", func() {
+		for i := 0; i < 100; i++ {
+			en := NewEventNotifier[int]()
+			wg := sync.WaitGroup{}
+			for p := 0; p < 4; p++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for v := 0; v < 100; v++ {
+						en.Notify(v)
+					}
+				}()
+			}
+			go en.Stop()
+			for range en.GetNotifyChannel() {
+				en.GetValue()
+			}
+			wg.Wait()
+		}
+	})
+}
@@ -10,6 +10,7 @@
 package mocks
 
 import (
+	fs "io/fs"
 	reflect "reflect"
 
 	fsnotify "github.com/fsnotify/fsnotify"
@@ -56,6 +57,20 @@ func (mr *MockFilesystemMockRecorder) AreFilesDifferent(firstFilePath, secondFil
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AreFilesDifferent", reflect.TypeOf((*MockFilesystem)(nil).AreFilesDifferent), firstFilePath, secondFilePath)
 }
 
+// Chmod mocks base method.
+func (m *MockFilesystem) Chmod(filePath string, mode fs.FileMode) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Chmod", filePath, mode)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Chmod indicates an expected call of Chmod.
+func (mr *MockFilesystemMockRecorder) Chmod(filePath, mode any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Chmod", reflect.TypeOf((*MockFilesystem)(nil).Chmod), filePath, mode)
+}
+
 // ClearDir mocks base method.
 func (m *MockFilesystem) ClearDir(filePath string) error {
 	m.ctrl.T.Helper()
@@ -84,6 +99,48 @@ func (mr *MockFilesystemMockRecorder) Copy(fromPath, toPath any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Copy", reflect.TypeOf((*MockFilesystem)(nil).Copy), fromPath, toPath)
 }
 
+// CreateDir mocks base method.
+func (m *MockFilesystem) CreateDir(dirPath string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateDir", dirPath)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateDir indicates an expected call of CreateDir.
+func (mr *MockFilesystemMockRecorder) CreateDir(dirPath any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateDir", reflect.TypeOf((*MockFilesystem)(nil).CreateDir), dirPath)
+}
+
+// Decompress mocks base method.
+func (m *MockFilesystem) Decompress(gzipFile, toPath string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Decompress", gzipFile, toPath)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Decompress indicates an expected call of Decompress.
+func (mr *MockFilesystemMockRecorder) Decompress(gzipFile, toPath any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Decompress", reflect.TypeOf((*MockFilesystem)(nil).Decompress), gzipFile, toPath)
+}
+
+// DeleteEmptyDirs mocks base method.
+func (m *MockFilesystem) DeleteEmptyDirs(dirPath string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteEmptyDirs", dirPath)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteEmptyDirs indicates an expected call of DeleteEmptyDirs.
+func (mr *MockFilesystemMockRecorder) DeleteEmptyDirs(dirPath any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteEmptyDirs", reflect.TypeOf((*MockFilesystem)(nil).DeleteEmptyDirs), dirPath)
+}
+
 // DeleteFile mocks base method.
 func (m *MockFilesystem) DeleteFile(filePath string) error {
 	m.ctrl.T.Helper()
@@ -98,6 +155,37 @@ func (mr *MockFilesystemMockRecorder) DeleteFile(filePath any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteFile", reflect.TypeOf((*MockFilesystem)(nil).DeleteFile), filePath)
 }
 
+// DirChecksum mocks base method.
+func (m *MockFilesystem) DirChecksum(dir string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DirChecksum", dir)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DirChecksum indicates an expected call of DirChecksum.
+func (mr *MockFilesystemMockRecorder) DirChecksum(dir any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DirChecksum", reflect.TypeOf((*MockFilesystem)(nil).DirChecksum), dir)
+}
+
+// DirsDiffer mocks base method.
+func (m *MockFilesystem) DirsDiffer(dirA, dirB string) (bool, []string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DirsDiffer", dirA, dirB)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].([]string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// DirsDiffer indicates an expected call of DirsDiffer.
+func (mr *MockFilesystemMockRecorder) DirsDiffer(dirA, dirB any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DirsDiffer", reflect.TypeOf((*MockFilesystem)(nil).DirsDiffer), dirA, dirB)
+}
+
 // DoesExist mocks base method.
 func (m *MockFilesystem) DoesExist(path string) bool {
 	m.ctrl.T.Helper()
@@ -126,6 +214,36 @@ func (mr *MockFilesystemMockRecorder) Extract(tarball, toDir any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Extract", reflect.TypeOf((*MockFilesystem)(nil).Extract), tarball, toDir)
 }
 
+// ExtractZip mocks base method.
+func (m *MockFilesystem) ExtractZip(archive, toDir string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExtractZip", archive, toDir)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExtractZip indicates an expected call of ExtractZip.
+func (mr *MockFilesystemMockRecorder) ExtractZip(archive, toDir any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExtractZip", reflect.TypeOf((*MockFilesystem)(nil).ExtractZip), archive, toDir)
+}
+
+// FreeSpace mocks base method.
+func (m *MockFilesystem) FreeSpace(path string) (uint64, uint64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FreeSpace", path)
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].(uint64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// FreeSpace indicates an expected call of FreeSpace.
+func (mr *MockFilesystemMockRecorder) FreeSpace(path any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FreeSpace", reflect.TypeOf((*MockFilesystem)(nil).FreeSpace), path)
+}
+
 // Hardlink mocks base method.
 func (m *MockFilesystem) Hardlink(filePath, hardlinkPath string) error {
 	m.ctrl.T.Helper()
@@ -140,6 +258,21 @@ func (mr *MockFilesystemMockRecorder) Hardlink(filePath, hardlinkPath any) *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Hardlink", reflect.TypeOf((*MockFilesystem)(nil).Hardlink), filePath, hardlinkPath)
 }
 
+// HashFile mocks base method.
+func (m *MockFilesystem) HashFile(filePath string) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HashFile", filePath)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HashFile indicates an expected call of HashFile.
+func (mr *MockFilesystemMockRecorder) HashFile(filePath any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HashFile", reflect.TypeOf((*MockFilesystem)(nil).HashFile), filePath)
+}
+
 // ListFileNamesInDir mocks base method.
 func (m *MockFilesystem) ListFileNamesInDir(dirPath string) ([]string, error) {
 	m.ctrl.T.Helper()
@@ -155,6 +288,51 @@ func (mr *MockFilesystemMockRecorder) ListFileNamesInDir(dirPath any) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListFileNamesInDir", reflect.TypeOf((*MockFilesystem)(nil).ListFileNamesInDir), dirPath)
 }
 
+// ListMatchingNames mocks base method.
+func (m *MockFilesystem) ListMatchingNames(dirPath, pattern string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListMatchingNames", dirPath, pattern)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListMatchingNames indicates an expected call of ListMatchingNames.
+func (mr *MockFilesystemMockRecorder) ListMatchingNames(dirPath, pattern any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMatchingNames", reflect.TypeOf((*MockFilesystem)(nil).ListMatchingNames), dirPath, pattern)
+}
+
+// ListTarEntries mocks base method.
+func (m *MockFilesystem) ListTarEntries(tarball string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListTarEntries", tarball)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListTarEntries indicates an expected call of ListTarEntries.
+func (mr *MockFilesystemMockRecorder) ListTarEntries(tarball any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTarEntries", reflect.TypeOf((*MockFilesystem)(nil).ListTarEntries), tarball)
+}
+
+// ListZipEntries mocks base method.
+func (m *MockFilesystem) ListZipEntries(archive string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListZipEntries", archive)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListZipEntries indicates an expected call of ListZipEntries.
+func (mr *MockFilesystemMockRecorder) ListZipEntries(archive any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListZipEntries", reflect.TypeOf((*MockFilesystem)(nil).ListZipEntries), archive)
+}
+
 // MoveFile mocks base method.
 func (m *MockFilesystem) MoveFile(fromPath, toPath string) error {
 	m.ctrl.T.Helper()
@@ -169,6 +347,21 @@ func (mr *MockFilesystemMockRecorder) MoveFile(fromPath, toPath any) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MoveFile", reflect.TypeOf((*MockFilesystem)(nil).MoveFile), fromPath, toPath)
 }
 
+// NewDirWatcher mocks base method.
+func (m *MockFilesystem) NewDirWatcher(watchedDir string) (filesystem.Watcher, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewDirWatcher", watchedDir)
+	ret0, _ := ret[0].(filesystem.Watcher)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NewDirWatcher indicates an expected call of NewDirWatcher.
+func (mr *MockFilesystemMockRecorder) NewDirWatcher(watchedDir any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewDirWatcher", reflect.TypeOf((*MockFilesystem)(nil).NewDirWatcher), watchedDir)
+}
+
 // NewFileWatcher mocks base method.
 func (m *MockFilesystem) NewFileWatcher(watchedFile string, watchedOps fsnotify.Op) (filesystem.Watcher, error) {
 	m.ctrl.T.Helper()
@@ -183,3 +376,62 @@ func (mr *MockFilesystemMockRecorder) NewFileWatcher(watchedFile, watchedOps any
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewFileWatcher", reflect.TypeOf((*MockFilesystem)(nil).NewFileWatcher), watchedFile, watchedOps)
 }
+
+// NewGlobWatcher mocks base method.
+func (m *MockFilesystem) NewGlobWatcher(watchedDir, pattern string, watchedOps fsnotify.Op) (filesystem.Watcher, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewGlobWatcher", watchedDir, pattern, watchedOps)
+	ret0, _ := ret[0].(filesystem.Watcher)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NewGlobWatcher indicates an expected call of NewGlobWatcher.
+func (mr *MockFilesystemMockRecorder) NewGlobWatcher(watchedDir, pattern, watchedOps any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewGlobWatcher", reflect.TypeOf((*MockFilesystem)(nil).NewGlobWatcher), watchedDir, pattern, watchedOps)
+}
+
+// ReadFile mocks base method.
+func (m *MockFilesystem) ReadFile(filePath string) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadFile", filePath)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadFile indicates an expected call of ReadFile.
+func (mr *MockFilesystemMockRecorder) ReadFile(filePath any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadFile", reflect.TypeOf((*MockFilesystem)(nil).ReadFile), filePath)
+}
+
+// Stat mocks base method.
+func (m *MockFilesystem) Stat(path string) (fs.FileInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stat", path)
+	ret0, _ := ret[0].(fs.FileInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Stat indicates an expected call of Stat.
+func (mr *MockFilesystemMockRecorder) Stat(path any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stat", reflect.TypeOf((*MockFilesystem)(nil).Stat), path)
+}
+
+// WriteFileAtomic mocks base method.
+func (m *MockFilesystem) WriteFileAtomic(filePath string, content []byte, mode fs.FileMode) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteFileAtomic", filePath, content, mode)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WriteFileAtomic indicates an expected call of WriteFileAtomic.
+func (mr *MockFilesystemMockRecorder) WriteFileAtomic(filePath, content, mode any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteFileAtomic", reflect.TypeOf((*MockFilesystem)(nil).WriteFileAtomic), filePath, content, mode)
+}
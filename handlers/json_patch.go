@@ -0,0 +1,323 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var ErrJSONPatchTestFailed = errors.New("json patch test operation failed")
+
+// jsonPatchOperation is a single operation of a JSON Patch document (RFC 6902). Value is nil when it is missing and
+// holds null when it is null.
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// applyJSONPatch applies a JSON Patch document to a JSON document and returns a patched document with paths of
+// operations which changed it. It stops at the first failing operation, so a document is patched either fully or not
+// at all. Numbers are kept as they were written.
+func applyJSONPatch(document, patch []byte) (any, []string, error) {
+	operations := []jsonPatchOperation{}
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, nil, fmt.Errorf("could not parse a json patch. Reason: %w", err)
+	}
+	doc, err := decodeJSON(document)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not parse a json document. Reason: %w", err)
+	}
+	paths := []string{}
+	for i, op := range operations {
+		if doc, err = op.apply(doc); err != nil {
+			return nil, nil, fmt.Errorf("could not apply an operation %d (%s %s). Reason: %w", i, op.Op, op.Path, err)
+		}
+		if op.Op != "test" {
+			paths = append(paths, op.Path)
+		}
+	}
+	return doc, paths, nil
+}
+
+// decodeJSON decodes a JSON value keeping numbers as json.Number.
+func decodeJSON(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// apply applies an operation to a doc and returns a changed doc. A doc may be changed in place.
+func (o jsonPatchOperation) apply(doc any) (any, error) {
+	path, err := parseJSONPointer(o.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch o.Op {
+	case "add", "replace", "test":
+		if o.Value == nil {
+			return nil, fmt.Errorf("a value of %s operation is missing", o.Op)
+		}
+		value, err := decodeJSON(o.Value)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse a value. Reason: %w", err)
+		}
+		switch o.Op {
+		case "add":
+			return addJSONValue(doc, path, value)
+		case "replace":
+			return replaceJSONValue(doc, path, value)
+		}
+		current, err := getJSONValue(doc, path)
+		if err != nil {
+			return nil, err
+		} else if !jsonEqual(current, value) {
+			return nil, fmt.Errorf("a value at %s is different. Reason: %w", o.Path, ErrJSONPatchTestFailed)
+		}
+		return doc, nil
+	case "remove":
+		return removeJSONValue(doc, path)
+	case "move", "copy":
+		from, err := parseJSONPointer(o.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := getJSONValue(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if o.Op == "copy" {
+			return addJSONValue(doc, path, copyJSONValue(value))
+		} else if strings.HasPrefix(o.Path, o.From+"/") {
+			return nil, fmt.Errorf("can not move %s to its child %s", o.From, o.Path)
+		} else if doc, err = removeJSONValue(doc, from); err != nil {
+			return nil, err
+		}
+		return addJSONValue(doc, path, value)
+	}
+	return nil, fmt.Errorf("unknown operation %q", o.Op)
+}
+
+// parseJSONPointer returns unescaped reference tokens of a JSON Pointer (RFC 6901). The root is an empty list.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	} else if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("a json pointer %q doesn't start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// getJSONValue returns a value at a path of a doc.
+func getJSONValue(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch container := doc.(type) {
+		case map[string]any:
+			value, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("a member %q doesn't exist", token)
+			}
+			doc = value
+		case []any:
+			index, err := jsonArrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = container[index]
+		default:
+			return nil, fmt.Errorf("can not reference %q in a value which is not an object or an array", token)
+		}
+	}
+	return doc, nil
+}
+
+// addJSONValue adds a value at a path of a doc. An existing member of an object is replaced and an element of an array
+// is inserted before an index, "-" appends it. An empty path replaces the whole doc.
+func addJSONValue(doc any, path []string, value any) (any, error) {
+	return changeJSONParent(doc, path, value, func(container any, token string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			c[token] = value
+			return c, nil
+		case []any:
+			if token == "-" {
+				return append(c, value), nil
+			}
+			index, err := jsonArrayIndex(token, len(c))
+			if err != nil {
+				return nil, err
+			}
+			return append(c[:index], append([]any{value}, c[index:]...)...), nil
+		}
+		return nil, fmt.Errorf("can not add %q to a value which is not an object or an array", token)
+	})
+}
+
+// replaceJSONValue replaces an existing value at a path of a doc. An empty path replaces the whole doc.
+func replaceJSONValue(doc any, path []string, value any) (any, error) {
+	return changeJSONParent(doc, path, value, func(container any, token string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			if _, ok := c[token]; !ok {
+				return nil, fmt.Errorf("a member %q doesn't exist", token)
+			}
+			c[token] = value
+			return c, nil
+		case []any:
+			index, err := jsonArrayIndex(token, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			c[index] = value
+			return c, nil
+		}
+		return nil, fmt.Errorf("can not replace %q in a value which is not an object or an array", token)
+	})
+}
+
+// removeJSONValue removes an existing value at a path of a doc. The whole doc can't be removed.
+func removeJSONValue(doc any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, errors.New("can not remove a whole document")
+	}
+	return changeJSONParent(doc, path, nil, func(container any, token string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			if _, ok := c[token]; !ok {
+				return nil, fmt.Errorf("a member %q doesn't exist", token)
+			}
+			delete(c, token)
+			return c, nil
+		case []any:
+			index, err := jsonArrayIndex(token, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(c[:index], c[index+1:]...), nil
+		}
+		return nil, fmt.Errorf("can not remove %q from a value which is not an object or an array", token)
+	})
+}
+
+// changeJSONParent calls change with a container referenced by all but the last token of a path and the last token.
+// A changed container replaces the referenced one in a doc, which is returned. An empty path returns root.
+func changeJSONParent(doc any, path []string, root any, change func(container any, token string) (any, error)) (any, error) {
+	if len(path) == 0 {
+		return root, nil
+	} else if len(path) == 1 {
+		return change(doc, path[0])
+	}
+	child, err := getJSONValue(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	if child, err = changeJSONParent(child, path[1:], root, change); err != nil {
+		return nil, err
+	}
+	switch container := doc.(type) {
+	case map[string]any:
+		container[path[0]] = child
+	case []any:
+		index, _ := jsonArrayIndex(path[0], len(container)-1) // already checked by getJSONValue
+		container[index] = child
+	}
+	return doc, nil
+}
+
+// jsonArrayIndex returns an array index from a token. It returns an error if the token is not a number without leading
+// zeros or the index is greater than last.
+func jsonArrayIndex(token string, last int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (len(token) > 1 && token[0] == '0') || token[0] == '+' {
+		return 0, fmt.Errorf("%q is not a valid array index", token)
+	} else if index > last {
+		return 0, fmt.Errorf("an array index %d is out of range", index)
+	}
+	return index, nil
+}
+
+// copyJSONValue returns a deep copy of a decoded JSON value.
+func copyJSONValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(v))
+		for key, member := range v {
+			copied[key] = copyJSONValue(member)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(v))
+		for i, element := range v {
+			copied[i] = copyJSONValue(element)
+		}
+		return copied
+	}
+	return value
+}
+
+// jsonEqual returns true if decoded JSON values are equal. Numbers are equal if they have the same value, even if they
+// are written differently.
+func jsonEqual(first, second any) bool {
+	switch f := first.(type) {
+	case map[string]any:
+		s, ok := second.(map[string]any)
+		if !ok || len(f) != len(s) {
+			return false
+		}
+		for key, member := range f {
+			if other, ok := s[key]; !ok || !jsonEqual(member, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		s, ok := second.([]any)
+		if !ok || len(f) != len(s) {
+			return false
+		}
+		for i := range f {
+			if !jsonEqual(f[i], s[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		s, ok := second.(json.Number)
+		if !ok {
+			return false
+		}
+		firstRat, okFirst := new(big.Rat).SetString(f.String())
+		secondRat, okSecond := new(big.Rat).SetString(s.String())
+		return okFirst && okSecond && firstRat.Cmp(secondRat) == 0
+	}
+	return first == second
+}
@@ -0,0 +1,99 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"encoding/json"
+)
+
+func (h *HandlersTestSuite) TestApplyJSONPatch() {
+	testCases := [...]struct {
+		name          string
+		document      string
+		patch         string
+		expected      string
+		expectedPaths []string
+		expectedErr   error
+		expectErr     bool
+	}{
+		{name: "when a member is added, should add it", document: `{"a":1}`, patch: `[{"op":"add","path":"/b","value":{"c":[1]}}]`,
+			expected: `{"a":1,"b":{"c":[1]}}`, expectedPaths: []string{"/b"}},
+		{name: "when an element is added, should insert it before an index", document: `{"a":[1,3]}`, patch: `[{"op":"add","path":"/a/1","value":2}]`,
+			expected: `{"a":[1,2,3]}`, expectedPaths: []string{"/a/1"}},
+		{name: "when an element is added at -, should append it", document: `{"a":[1]}`, patch: `[{"op":"add","path":"/a/-","value":2}]`,
+			expected: `{"a":[1,2]}`, expectedPaths: []string{"/a/-"}},
+		{name: "when a member is removed, should remove it", document: `{"a":1,"b":2}`, patch: `[{"op":"remove","path":"/a"}]`,
+			expected: `{"b":2}`, expectedPaths: []string{"/a"}},
+		{name: "when an element is removed, should shift next elements", document: `[1,2,3]`, patch: `[{"op":"remove","path":"/0"}]`,
+			expected: `[2,3]`, expectedPaths: []string{"/0"}},
+		{name: "when a nested member is replaced, should replace it", document: `{"a":{"b":[{"c":1}]}}`, patch: `[{"op":"replace","path":"/a/b/0/c","value":null}]`,
+			expected: `{"a":{"b":[{"c":null}]}}`, expectedPaths: []string{"/a/b/0/c"}},
+		{name: "when a root is replaced, should replace a whole document", document: `{"a":1}`, patch: `[{"op":"replace","path":"","value":[1]}]`,
+			expected: `[1]`, expectedPaths: []string{""}},
+		{name: "when a member is moved, should remove it from an old path", document: `{"a":{"b":1},"c":{}}`, patch: `[{"op":"move","from":"/a/b","path":"/c/d"}]`,
+			expected: `{"a":{},"c":{"d":1}}`, expectedPaths: []string{"/c/d"}},
+		{name: "when a member is copied, should copy it deeply", document: `{"a":{"b":1}}`, patch: `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`,
+			expected: `{"a":{"b":1},"c":{"b":2}}`, expectedPaths: []string{"/c", "/c/b"}},
+		{name: "when a pointer has escaped characters, should unescape them", document: `{"a/b":1,"m~n":2}`, patch: `[{"op":"remove","path":"/a~1b"},{"op":"replace","path":"/m~0n","value":3}]`,
+			expected: `{"m~n":3}`, expectedPaths: []string{"/a~1b", "/m~0n"}},
+		{name: "when test operations match, should apply next operations and not list tests", document: `{"a":[1,{"b":"c"}],"n":1}`,
+			patch:    `[{"op":"test","path":"/a","value":[1,{"b":"c"}]},{"op":"test","path":"/n","value":1.0},{"op":"add","path":"/d","value":true}]`,
+			expected: `{"a":[1,{"b":"c"}],"d":true,"n":1}`, expectedPaths: []string{"/d"}},
+		{name: "when a test operation doesn't match, should return an error", document: `{"a":1}`, patch: `[{"op":"add","path":"/b","value":2},{"op":"test","path":"/a","value":2}]`,
+			expectedErr: ErrJSONPatchTestFailed},
+		{name: "when a member to replace doesn't exist, should return an error", document: `{"a":1}`, patch: `[{"op":"replace","path":"/b","value":2}]`, expectErr: true},
+		{name: "when a member to remove doesn't exist, should return an error", document: `{"a":1}`, patch: `[{"op":"remove","path":"/b"}]`, expectErr: true},
+		{name: "when an index is out of range, should return an error", document: `[1]`, patch: `[{"op":"add","path":"/2","value":2}]`, expectErr: true},
+		{name: "when an index has a leading zero, should return an error", document: `[1,2]`, patch: `[{"op":"remove","path":"/01"}]`, expectErr: true},
+		{name: "when a parent doesn't exist, should return an error", document: `{}`, patch: `[{"op":"add","path":"/a/b","value":1}]`, expectErr: true},
+		{name: "when a value is moved to its child, should return an error", document: `{"a":{}}`, patch: `[{"op":"move","from":"/a","path":"/a/b"}]`, expectErr: true},
+		{name: "when a value is missing, should return an error", document: `{}`, patch: `[{"op":"add","path":"/a"}]`, expectErr: true},
+		{name: "when an operation is unknown, should return an error", document: `{}`, patch: `[{"op":"merge","path":"/a","value":1}]`, expectErr: true},
+		{name: "when a pointer doesn't start with a slash, should return an error", document: `{"a":1}`, patch: `[{"op":"remove","path":"a"}]`, expectErr: true},
+		{name: "when a patch is not an array, should return an error", document: `{}`, patch: `{"op":"remove","path":"/a"}`, expectErr: true},
+		{name: "when a document is not json, should return an error", document: `not json`, patch: `[]`, expectErr: true},
+	}
+	for _, test := range testCases {
+		test := test
+		h.Run(test.name, func() {
+			patched, paths, err := applyJSONPatch([]byte(test.document), []byte(test.patch))
+
+			if test.expectedErr != nil || test.expectErr {
+				h.Error(err)
+				if test.expectedErr != nil {
+					h.ErrorIs(err, test.expectedErr)
+				}
+				h.Nil(patched)
+				h.Nil(paths)
+				return
+			}
+			h.Require().NoError(err)
+			content, err := json.Marshal(patched)
+			h.Require().NoError(err)
+			h.JSONEq(test.expected, string(content))
+			h.Equal(test.expectedPaths, paths)
+		})
+	}
+}
+
+func (h *HandlersTestSuite) TestJSONEqual() {
+	h.True(jsonEqual(json.Number("1"), json.Number("1.0")), "should compare numbers by values")
+	h.False(jsonEqual(json.Number("1"), "1"))
+	h.False(jsonEqual(map[string]any{"a": nil}, map[string]any{"b": nil}))
+	h.False(jsonEqual([]any{json.Number("1")}, []any{json.Number("1"), json.Number("2")}))
+	h.True(jsonEqual(nil, nil))
+}
@@ -0,0 +1,653 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"hash"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/k-lb/entrypoint-framework/handlers/internal/filesystem"
+	"github.com/k-lb/entrypoint-framework/handlers/internal/global"
+)
+
+// ConfigurationOption changes a default behavior of a ConfigurationHandler. It should be passed to one of
+// ConfigurationHandler constructors.
+type ConfigurationOption func(*configurationOptions)
+
+// configurationOptions contains all settings that can be changed with a ConfigurationOption.
+type configurationOptions struct {
+	stabilityInterval time.Duration
+	updateRateLimit   time.Duration
+	heartbeatInterval time.Duration
+	maxInFlight       int // 0 means that a number of requested updates is not limited
+	tamperDir         string
+	jitter            float64
+	clock             global.Clock
+
+	diskPressurePath      string // a path of a filesystem checked for space pressure, empty if it isn't checked
+	diskPressureThreshold float64
+	diskPressureInterval  time.Duration
+
+	suppressInitialEvent bool
+	keepHardlinkOnClose  bool
+	dropStaleResults     bool
+	detectRenames        bool
+	emptyMeansDeleted    bool
+	cancelStaleUpdates   bool
+	pruneEmptyDirs       bool
+
+	envInterpolation       bool
+	strictEnvInterpolation bool
+	envAllowlist           []string // names of environment variables substituted by envInterpolation
+
+	preserveFailedDir string // a directory to which failed extractions are copied, empty if they aren't preserved
+
+	schemaGate *schemaGate // nil means that schema versions aren't checked
+
+	archiver        Archiver         // nil means that a TarArchiver is used
+	permissionRules []PermissionRule // the first matching rule sets a mode of an extracted file
+	contentPattern  *regexp.Regexp   // set by NewRegexTriggeredConfigurationHandler
+	newConfigDir    string           // a directory to which a new configuration is extracted, set by directory handlers
+	appliedDir      string           // a directory with an applied configuration, set by directory handlers
+	initialContext  context.Context  // bounds handling of an initial configuration, set by context-aware constructors
+
+	fsOpts []filesystem.Option // used to create a filesystem by public constructors
+}
+
+// newConfigurationOptions returns configurationOptions with all opts applied.
+func newConfigurationOptions(opts []ConfigurationOption) configurationOptions {
+	o := configurationOptions{clock: global.NewClock(), pruneEmptyDirs: true}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithStabilityCheck makes a ConfigurationHandler wait until a size and a modification time of a new configuration
+// haven't changed for an interval before the hardlink is created. It should be used when a writer doesn't move
+// a configuration file atomically but writes it in place, so only fully written files are captured. If the file is
+// still changing after 100 checks, an event with an ErrConfigNotStable is sent instead.
+func WithStabilityCheck(interval time.Duration) ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.stabilityInterval = interval
+	}
+}
+
+// WithUpdateRateLimit makes a ConfigurationHandler start at most one update per minInterval. An update requested sooner
+// is deferred until minInterval has elapsed since the previous one, and all requests made in the meantime are coalesced
+// with it, so a single result is sent for them. As the deferred update applies the latest new configuration, frequent
+// changes are still applied eventually. A deferred update is dropped when the handler is closed. It protects an
+// application from being restarted continuously by a producer rewriting a configuration in a tight loop.
+func WithUpdateRateLimit(minInterval time.Duration) ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.updateRateLimit = minInterval
+	}
+}
+
+// WithMaxInFlight makes a ConfigurationHandler reject an update requested when n updates haven't pushed their results
+// yet. Update and ForceUpdate return an ErrTooManyInFlight and TryUpdate returns a RejectTooManyInFlight then. It
+// prevents a queue of updates from growing without bounds when a producer requests them faster than they complete.
+// A number of outstanding updates is returned by InFlightUpdates. A non-positive n means no limit.
+func WithMaxInFlight(n int) ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.maxInFlight = n
+	}
+}
+
+// WithHeartbeat makes a ConfigurationHandler send a heartbeat every interval to a channel returned by
+// GetHeartbeatChannel. Heartbeats are sent by a goroutine handling events, so their absence means that it has stalled
+// or ended, even if there were no changes of a configuration. The interval is perturbed by a jitter set by WithJitter.
+func WithHeartbeat(interval time.Duration) ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.heartbeatInterval = interval
+	}
+}
+
+// WithDiskPressureWarning makes a ConfigurationHandler check every interval a usage of a filesystem holding a path
+// (usually an old config dir or a directory with backups) and send a DiskPressureEvent to a channel returned by
+// GetDiskPressureChannel when the usage crosses a threshold (a fraction in range (0, 1]). Another event is sent only
+// after the usage has dropped below the threshold and crossed it again. It lets operators act before updates fail with
+// ENOSPC. Checks are done by a goroutine handling events. The interval is perturbed by a jitter set by WithJitter.
+func WithDiskPressureWarning(path string, threshold float64, interval time.Duration) ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.diskPressurePath = path
+		o.diskPressureThreshold = threshold
+		o.diskPressureInterval = interval
+	}
+}
+
+// WithTamperDetection makes a ConfigurationHandler watch a dir (usually a directory with an applied configuration) and
+// push an ErrConfigTampered to a tamper channel when files in it are changed without an update. It helps to detect
+// misconfiguration where two writers change the same directory.
+func WithTamperDetection(dir string) ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.tamperDir = dir
+	}
+}
+
+// WithJitter makes a ConfigurationHandler change every interval of its periodic checks by a random value up to
+// a fraction of the interval. It prevents many entrypoints started at the same time from checking files
+// simultaneously. Fraction is limited to range [0, 1]. It is also used by a PollingWatcher passed to
+// NewConfigurationHandlerWithWatcher unless the watcher has its own jitter set by WithPollingJitter.
+func WithJitter(fraction float64) ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.jitter = fraction
+	}
+}
+
+// WithSuppressInitialEvent makes a ConfigurationHandler skip a wasChanged event for a new configuration present at
+// startup. The configuration is still hardlinked, so it can be updated, but only subsequent changes are sent. It should
+// be used when a consumer sets its own starting state.
+func WithSuppressInitialEvent() ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.suppressInitialEvent = true
+	}
+}
+
+// WithKeepHardlinkOnClose makes a ConfigurationHandler leave a hardlink of the last new configuration on disk when it
+// is closed, so it can be inspected after a crash. A hardlink left by a previous handler is replaced when a new
+// configuration is hardlinked.
+func WithKeepHardlinkOnClose() ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.keepHardlinkOnClose = true
+	}
+}
+
+// WithDropStaleResults makes a ConfigurationHandler discard results of previous updates which weren't read from
+// an update result channel when Update or ForceUpdate is called. By default such results are kept and read in order.
+// It should be used by callers which don't read every result, as discarded results (including their errors) are lost.
+func WithDropStaleResults() ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.dropStaleResults = true
+	}
+}
+
+// WithCancelStaleUpdates makes a ConfigurationHandler cancel an update in progress when a newer configuration is
+// notified. A tarred configuration is checked for cancellation between operations on single files, so a file which is
+// being changed is always completed and an applied directory is never left with a partially written file. A cancelled
+// update sends a result with an ErrUpdateCancelled and files changed so far, and the newer configuration is reported
+// on a wasChanged channel as usual, so a caller can update again. It has no effect on handlers which can't be
+// cancelled.
+func WithCancelStaleUpdates() ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.cancelStaleUpdates = true
+	}
+}
+
+// WithEmptyMeansDeleted makes a ConfigurationHandler treat an existing but empty new configuration as deleted. Instead
+// of hardlinking it, a wasChanged event with an ErrConfigDeleted is pushed. Writes to the configuration are watched too,
+// so truncating it in place is noticed, and a write making it non-empty again is reported as a change. It should be
+// used when a writer clears a configuration by truncating it instead of removing it.
+func WithEmptyMeansDeleted() ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.emptyMeansDeleted = true
+	}
+}
+
+// WithEventLogSampling makes a ConfigurationHandler log only every n-th debug log of events observed by its watchers
+// and at most perSecond of them in each second. It keeps debug logs useful when files change frequently. A zero value
+// disables a limit.
+func WithEventLogSampling(every, perSecond int) ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.fsOpts = append(o.fsOpts, filesystem.WithEventLogSampling(every, perSecond))
+	}
+}
+
+// WithQuietFalsePositives makes a ConfigurationHandler skip debug logs of false positive notifications of its watchers
+// (notifications after which no event is pending). It should be used when files change in a tight loop.
+func WithQuietFalsePositives() ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.fsOpts = append(o.fsOpts, filesystem.WithQuietFalsePositives())
+	}
+}
+
+// WithNotifierBuffer makes watchers of a ConfigurationHandler keep up to size pending notifications instead of one, so
+// a burst of changes is noticed as several wasChanged events. Every event is handled with the latest change, so events
+// following the first one of a burst may be dropped as false positives.
+func WithNotifierBuffer(size int) ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.fsOpts = append(o.fsOpts, filesystem.WithNotifierBuffer(size))
+	}
+}
+
+// WithDurableWrites makes a ConfigurationHandler fsync every file written by an update and its parent directory, so
+// an applied configuration isn't lost on a power failure right after the update succeeded. It makes updates slower.
+func WithDurableWrites() ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.fsOpts = append(o.fsOpts, filesystem.WithDurableWrites())
+	}
+}
+
+// WithStripComponents makes a tarred ConfigurationHandler remove n leading path segments from names of entries of
+// a new configuration (like tar --strip-components), e.g. a versioned top-level directory, so files land directly in
+// a new config dir. Entries with no segments left are skipped and entries of different files stripped to the same name
+// fail an update.
+func WithStripComponents(n int) ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.fsOpts = append(o.fsOpts, filesystem.WithStripComponents(n))
+	}
+}
+
+// WithRejectAbsoluteEntries makes a tarred ConfigurationHandler fail an update with an ErrUnsafeEntry when a new
+// configuration contains an entry with an absolute name. By default such an entry is extracted relative to a new
+// config dir. It applies to built-in archivers only.
+func WithRejectAbsoluteEntries() ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.fsOpts = append(o.fsOpts, filesystem.WithRejectAbsoluteEntries())
+	}
+}
+
+// WithMaxFiles makes a tarred ConfigurationHandler abort an update with an ErrTooManyFiles when a new configuration
+// contains more than n files, before the limit is exceeded on disk. It applies to built-in archivers only. Zero or
+// less disables the limit, which is the default.
+func WithMaxFiles(n int) ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.fsOpts = append(o.fsOpts, filesystem.WithMaxEntries(n))
+	}
+}
+
+// WithFileComparator makes a ConfigurationHandler compare contents of a new and an applied file with compare, which
+// returns true if they are different, e.g. to treat JSON files with reordered keys as equal. Modes are still compared
+// and files of different modes are not passed to compare. A file which compare finds equal isn't updated. Contents are
+// compared byte by byte by default.
+func WithFileComparator(compare func(newFile, oldFile string) (bool, error)) ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.fsOpts = append(o.fsOpts, filesystem.WithContentComparator(compare))
+	}
+}
+
+// WithHashComparison makes a tarred ConfigurationHandler compare files of a new and an applied configuration by hashes
+// created with newHash (e.g. sha256.New) instead of their full contents. Modes are still compared and files of
+// different sizes are not hashed. It should be used for large binary files. Contents are compared by default.
+func WithHashComparison(newHash func() hash.Hash) ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.fsOpts = append(o.fsOpts, filesystem.WithHashComparison(newHash))
+	}
+}
+
+// WithRenameDetection makes a tarred ConfigurationHandler report a deleted file and a created file with an identical
+// content as Renamed in UpdateResult.Renames instead of a deletion and a creation. It hashes all applied files before
+// every update, so it makes updates slower.
+func WithRenameDetection() ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.detectRenames = true
+	}
+}
+
+// WithEnvInterpolation makes a tarred ConfigurationHandler substitute ${VAR} placeholders in extracted files with values
+// of environment variables named in an allowlist, before files are compared with an applied configuration.
+// Placeholders of variables which aren't allowlisted or aren't set are left intact, unless WithStrictEnvInterpolation
+// is passed too.
+func WithEnvInterpolation(allowlist []string) ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.envInterpolation = true
+		o.envAllowlist = append([]string{}, allowlist...)
+	}
+}
+
+// WithStrictEnvInterpolation makes a tarred ConfigurationHandler with WithEnvInterpolation fail an update with
+// an ErrUnknownPlaceholder when an extracted file contains a placeholder which can't be substituted. An applied
+// configuration is left untouched then.
+func WithStrictEnvInterpolation() ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.strictEnvInterpolation = true
+	}
+}
+
+// WithPreserveFailedExtraction makes a tarred ConfigurationHandler copy an extracted new config dir to a subdirectory of
+// a dir named after a time of the failure (in UTC) when an update fails, so the failing input can be inspected after
+// the next update clears the new config dir. Preserved copies are never deleted by the handler.
+func WithPreserveFailedExtraction(dir string) ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.preserveFailedDir = dir
+	}
+}
+
+// WithSchemaGate makes a tarred ConfigurationHandler check a schema version of an extracted new configuration before it
+// is applied. extract is called with a new config dir and returns the version (e.g. read from a schema_version field).
+// An update fails with an ErrSchemaVersionMismatch if the version is outside of [minVersion, maxVersion] or with an
+// extraction error if it can't be read. An applied configuration is left untouched then.
+func WithSchemaGate(extract func(dir string) (int, error), minVersion, maxVersion int) ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.schemaGate = &schemaGate{extract: extract, min: minVersion, max: maxVersion}
+	}
+}
+
+// WithPruneEmptyDirs sets if a tarred ConfigurationHandler deletes directories of an old config dir which are left empty
+// after files were deleted by an update. Pruning is enabled by default.
+func WithPruneEmptyDirs(prune bool) ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.pruneEmptyDirs = prune
+	}
+}
+
+// PermissionRule sets a Mode of extracted files with names matching a Glob (in a path.Match syntax). A Glob without
+// a slash is matched against a base name of a file, otherwise against its name relative to a config dir.
+type PermissionRule struct {
+	Glob string
+	Mode fs.FileMode
+}
+
+// WithPermissionRules makes a tarred ConfigurationHandler change modes of extracted files matching rules before they
+// are compared with an applied configuration, regardless of modes recorded in a new configuration. The first matching
+// rule wins and files matching no rule keep their modes. Applied files keep modes of rules, so they aren't reported
+// as modified by following updates.
+func WithPermissionRules(rules []PermissionRule) ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.permissionRules = append([]PermissionRule{}, rules...)
+	}
+}
+
+// WithArchiver makes a tarred ConfigurationHandler extract a new configuration with an archiver instead of
+// a TarArchiver, e.g. a ZipArchiver or an Archiver of another format.
+func WithArchiver(a Archiver) ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.archiver = a
+	}
+}
+
+// withContentPattern makes a ConfigurationHandler permit an update only when a content of a new configuration matches
+// a pattern. It is used by NewRegexTriggeredConfigurationHandler.
+func withContentPattern(pattern *regexp.Regexp) ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.contentPattern = pattern
+	}
+}
+
+// withConfigDirs sets a directory to which a new configuration is extracted and a directory listed by
+// ConfigurationHandlerBase.AppliedFiles. It is used by constructors of handlers which apply a configuration to
+// a directory.
+func withConfigDirs(newDir, appliedDir string) ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.newConfigDir = newDir
+		o.appliedDir = appliedDir
+	}
+}
+
+// withInitialContext makes a ConfigurationHandler constructor return an error if ctx is done before an initial
+// configuration is handled. It is used by context-aware constructors.
+func withInitialContext(ctx context.Context) ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.initialContext = ctx
+	}
+}
+
+// withClock makes a ConfigurationHandler use a clock instead of a real one. It is intended for tests.
+func withClock(clock global.Clock) ConfigurationOption {
+	return func(o *configurationOptions) {
+		o.clock = clock
+	}
+}
+
+// ActivationOption changes a default behavior of an ActivationHandler. It should be passed to NewActivationHandler.
+type ActivationOption func(*activationOptions)
+
+// activationOptions contains all settings that can be changed with an ActivationOption.
+type activationOptions struct {
+	suppressInitialEvent bool
+
+	fsOpts []filesystem.Option // used to create a filesystem by public constructors
+}
+
+// newActivationOptions returns activationOptions with all opts applied.
+func newActivationOptions(opts []ActivationOption) activationOptions {
+	o := activationOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithSuppressInitialActivationEvent makes an ActivationHandler skip an ActivationEvent with a state at startup, so
+// only subsequent changes are sent. It should be used when a consumer sets its own starting state.
+func WithSuppressInitialActivationEvent() ActivationOption {
+	return func(o *activationOptions) {
+		o.suppressInitialEvent = true
+	}
+}
+
+// WithActivationEventLogSampling makes an ActivationHandler log only every n-th debug log of events observed by its
+// watcher and at most perSecond of them in each second. A zero value disables a limit.
+func WithActivationEventLogSampling(every, perSecond int) ActivationOption {
+	return func(o *activationOptions) {
+		o.fsOpts = append(o.fsOpts, filesystem.WithEventLogSampling(every, perSecond))
+	}
+}
+
+// WithQuietActivationFalsePositives makes an ActivationHandler skip debug logs of false positive notifications of its
+// watcher (notifications after which no event is pending).
+func WithQuietActivationFalsePositives() ActivationOption {
+	return func(o *activationOptions) {
+		o.fsOpts = append(o.fsOpts, filesystem.WithQuietFalsePositives())
+	}
+}
+
+// WithActivationNotifierBuffer makes a watcher of an ActivationHandler keep up to size pending notifications instead of
+// one. An activation is always checked with the latest change, so notifications following the first one of a burst
+// may be dropped as false positives.
+func WithActivationNotifierBuffer(size int) ActivationOption {
+	return func(o *activationOptions) {
+		o.fsOpts = append(o.fsOpts, filesystem.WithNotifierBuffer(size))
+	}
+}
+
+// ProcessOption changes a default behavior of a ProcessHandler. It should be passed to NewProcessHandler.
+type ProcessOption func(*processOptions)
+
+// processOptions contains all settings that can be changed with a ProcessOption.
+type processOptions struct {
+	allowedSignals []syscall.Signal // nil means that all signals are allowed
+	rlimits        []rlimit
+	credential     *credential   // nil means that a process runs as the entrypoint user
+	outputLevels   *outputLevels // nil means that an output of a process isn't forwarded to a logger
+	stdin          io.Reader     // nil means that stdin of a process is set by a command
+	extraFiles     []*os.File
+	subreaper      bool
+}
+
+// outputLevels are levels of logs with lines of stdout and stderr of a process.
+type outputLevels struct {
+	stdout, stderr slog.Level
+}
+
+// credential is a user and a group a process runs as.
+type credential struct {
+	uid, gid uint32
+}
+
+// rlimit is a resource limit set on a process before it runs.
+type rlimit struct {
+	resource   int
+	soft, hard uint64
+}
+
+// newProcessOptions returns processOptions with all opts applied.
+func newProcessOptions(opts []ProcessOption) processOptions {
+	o := processOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// isAllowed returns true if a signal can be sent to a process.
+func (o processOptions) isAllowed(signal syscall.Signal) bool {
+	return o.allowedSignals == nil || slices.Contains(o.allowedSignals, signal)
+}
+
+// WithAllowedSignals makes a ProcessHandler send only sigs to a process. Sending any other signal (including by Stop
+// and Kill) returns an ErrSignalNotAllowed. It should be used for applications which must always shut down gracefully.
+func WithAllowedSignals(sigs ...syscall.Signal) ProcessOption {
+	return func(o *processOptions) {
+		o.allowedSignals = append([]syscall.Signal{}, sigs...)
+	}
+}
+
+// WithRLimit makes a ProcessHandler set a soft and a hard limit of a resource (e.g. syscall.RLIMIT_NOFILE) on
+// a process before it runs any instruction of an application. Limits of the entrypoint itself are not changed. It is
+// supported only on Linux, where the process is traced until limits are set, so it can't be started under a debugger.
+// On other platforms the process fails to start with an ErrRLimitUnsupported.
+func WithRLimit(resource int, soft, hard uint64) ProcessOption {
+	return func(o *processOptions) {
+		o.rlimits = append(o.rlimits, rlimit{resource: resource, soft: soft, hard: hard})
+	}
+}
+
+// WithCredential makes a ProcessHandler run a process as a user with uid and a group with gid, without supplementary
+// groups. The entrypoint must be privileged to do it, otherwise the process fails to start with
+// an ErrInsufficientPrivilege. It is not supported on Windows.
+func WithCredential(uid, gid uint32) ProcessOption {
+	return func(o *processOptions) {
+		o.credential = &credential{uid: uid, gid: gid}
+	}
+}
+
+// WithLogForwarding makes a ProcessHandler log every line written by a process to stdout with stdoutLevel and to
+// stderr with stderrLevel using its logger. Each log has a source attribute with a name of the stream. A last line
+// without a trailing newline is logged too. An ended event is sent after both streams are closed, so a process which
+// leaves a child holding them open is reported when the child ends. Stdout and Stderr of a command must not be set.
+func WithLogForwarding(stdoutLevel, stderrLevel slog.Level) ProcessOption {
+	return func(o *processOptions) {
+		o.outputLevels = &outputLevels{stdout: stdoutLevel, stderr: stderrLevel}
+	}
+}
+
+// WithStdin makes a ProcessHandler provide a content read from r on stdin of a process. If r is an io.Closer, it is
+// closed when the process has ended or failed to start. A process is waited for until r is read to the end or
+// the process closes its stdin. Stdin of a command must not be set.
+func WithStdin(r io.Reader) ProcessOption {
+	return func(o *processOptions) {
+		o.stdin = r
+	}
+}
+
+// WithStdinBytes makes a ProcessHandler provide content on stdin of a process. Stdin of a command must not be set.
+func WithStdinBytes(content []byte) ProcessOption {
+	return WithStdin(bytes.NewReader(content))
+}
+
+// WithExtraFiles makes a ProcessHandler pass files (e.g. listening sockets) to a process as open file descriptors,
+// appended to ExtraFiles of a command before it is started. Descriptors are numbered from 3 (after stdin, stdout and
+// stderr) in order of ExtraFiles of the command followed by files, so without ExtraFiles of the command files[i] is
+// a descriptor 3+i in the process. Files are referenced by a handler, so they stay open until the process is started;
+// the process has its own copies, so a caller can close files afterwards. It is not supported on Windows, where
+// the process fails to start.
+func WithExtraFiles(files ...*os.File) ProcessOption {
+	return func(o *processOptions) {
+		o.extraFiles = append(o.extraFiles, files...)
+	}
+}
+
+// WithSubreaper makes a ProcessHandler reap orphaned descendants of a process which are reparented to the entrypoint,
+// so they don't become zombies when the entrypoint runs as PID 1 in a container. The entrypoint becomes a subreaper of
+// its descendants and, while the process runs, reaps every ended child on SIGCHLD except processes of handlers started
+// with this option, which are still reported on ended channels. Children started by other means (e.g. another
+// ProcessHandler without this option) may be reaped before they are waited for, so all process handlers of
+// the entrypoint should use it. It is supported only on Linux. On other platforms the process fails to start with
+// an ErrSubreaperUnsupported.
+func WithSubreaper() ProcessOption {
+	return func(o *processOptions) {
+		o.subreaper = true
+	}
+}
+
+// PollingOption changes a default behavior of a PollingWatcher. It should be passed to NewPollingWatcher.
+type PollingOption func(*pollingOptions)
+
+// pollingOptions contains all settings that can be changed with a PollingOption.
+type pollingOptions struct {
+	recoverStaleHandles bool
+	jitter              float64
+	clock               global.Clock
+}
+
+// newPollingOptions returns pollingOptions with all opts applied.
+func newPollingOptions(opts []PollingOption) pollingOptions {
+	o := pollingOptions{clock: global.NewClock()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithStaleHandleRecovery makes a PollingWatcher aware of NFS stale file handles. When a status check fails with
+// ESTALE, the path is resolved again at once and polling continues: an error wrapping ErrStaleFileHandle is pushed
+// unless a change was detected after the path was resolved again. Without it ESTALE is pushed as any other error.
+func WithStaleHandleRecovery() PollingOption {
+	return func(o *pollingOptions) {
+		o.recoverStaleHandles = true
+	}
+}
+
+// WithPollingJitter makes a PollingWatcher change every interval between checks by a random value up to a fraction of
+// the interval, so many watchers started at the same time don't check files simultaneously. Fraction is limited to
+// range [0, 1]. Without it a PollingWatcher uses a jitter of a ConfigurationHandler created with it (see WithJitter).
+func WithPollingJitter(fraction float64) PollingOption {
+	return func(o *pollingOptions) {
+		o.jitter = fraction
+	}
+}
+
+// withPollingClock makes a PollingWatcher use a clock instead of a real one. It is intended for tests.
+func withPollingClock(clock global.Clock) PollingOption {
+	return func(o *pollingOptions) {
+		o.clock = clock
+	}
+}
+
+// ServiceOption changes a default behavior of a ReloadableService. It should be passed to NewReloadableService.
+type ServiceOption func(*serviceOptions)
+
+// serviceOptions contains all settings that can be changed with a ServiceOption.
+type serviceOptions struct {
+	reloadSignal syscall.Signal
+	stopTimeout  time.Duration
+}
+
+// newServiceOptions returns serviceOptions with all opts applied.
+func newServiceOptions(opts []ServiceOption) serviceOptions {
+	o := serviceOptions{reloadSignal: syscall.SIGHUP, stopTimeout: defaultServiceStopTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithReloadSignal makes a ReloadableService with a ReloadBySignal strategy send a signal instead of SIGHUP to reload
+// a configuration of a process.
+func WithReloadSignal(signal syscall.Signal) ServiceOption {
+	return func(o *serviceOptions) {
+		o.reloadSignal = signal
+	}
+}
+
+// WithServiceStopTimeout makes a ReloadableService kill a process which hasn't ended after a timeout since it was
+// stopped for a restart or by Stop. 10 seconds are used by default.
+func WithServiceStopTimeout(timeout time.Duration) ServiceOption {
+	return func(o *serviceOptions) {
+		o.stopTimeout = timeout
+	}
+}
@@ -0,0 +1,206 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"log/slog"
+	"math"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/k-lb/entrypoint-framework/handlers/internal/filesystem"
+	"github.com/k-lb/entrypoint-framework/handlers/internal/global"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ErrStaleFileHandle is pushed by a PollingWatcher with stale handle recovery when a status of a watched file couldn't
+// be checked because of a stale file handle (e.g. after a file was replaced by another NFS client). It is recoverable:
+// the watcher resolves the path again and continues polling.
+var ErrStaleFileHandle = errors.New("stale file handle")
+
+// PollingWatcher implements Watcher by checking a status of a file periodically instead of relying on file system
+// notifications. It should be used when changes aren't notified (e.g. on NFS, where inotify doesn't observe changes made
+// by other clients). A Create event is pushed when the file appears or its size, modification time or mode changes
+// (as it is usually replaced by moving a new file over it) and a Remove event when it disappears. An error of
+// a status check is pushed only when it occurs after a successful check, so a failing file doesn't flood a consumer.
+type PollingWatcher struct {
+	notifier *global.EventNotifier[WatcherEvent]
+	done     chan struct{}
+	stopOnce sync.Once
+
+	file     string
+	interval time.Duration
+	previous iofs.FileInfo // a status of the file from the last successful check, nil if it didn't exist.
+	failing  bool          // set when the last check has failed.
+
+	open      atomic.Bool
+	stopped   atomic.Bool
+	events    atomic.Uint64
+	lastEvent atomic.Int64  // unix nanoseconds of the last pushed event, 0 if none was pushed.
+	jitter    atomic.Uint64 // math.Float64bits of a fraction by which intervals are perturbed, 0 if they aren't.
+
+	log  *slog.Logger
+	fs   filesystem.Filesystem
+	opts pollingOptions
+}
+
+// newPollingWatcher returns a pointer to a PollingWatcher and an error if any occurred. It checks an initial status of
+// a file and polls it every interval in a new goroutine.
+func newPollingWatcher(file string, interval time.Duration, log *slog.Logger, fs filesystem.Filesystem, opts ...PollingOption) (*PollingWatcher, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("can not create polling watcher with a non-positive interval: %s", interval)
+	}
+	p := &PollingWatcher{
+		notifier: global.NewEventNotifier[WatcherEvent](),
+		done:     make(chan struct{}),
+		file:     file,
+		interval: interval,
+		log:      log,
+		fs:       fs,
+		opts:     newPollingOptions(opts),
+	}
+	p.previous, _ = p.stat() // a failure is pushed by the first poll
+	p.jitter.Store(math.Float64bits(p.opts.jitter))
+	p.open.Store(true)
+	go p.poll()
+	return p, nil
+}
+
+// GetEvent returns the latest WatcherEvent that was observed. Nil will be returned if there were no new events
+// between GetEvent calls.
+func (p *PollingWatcher) GetEvent() *WatcherEvent {
+	return p.notifier.GetValue()
+}
+
+// GetNotificationChannel returns channel on which a notification that an event was observed is sent. To find out
+// the latest event GetEvent must be called.
+func (p *PollingWatcher) GetNotificationChannel() <-chan struct{} {
+	return p.notifier.GetNotifyChannel()
+}
+
+// Health returns a current WatcherHealth of the PollingWatcher. It is safe to call at any time, also after Stop.
+func (p *PollingWatcher) Health() WatcherHealth {
+	health := WatcherHealth{Open: p.open.Load(), Stopped: p.stopped.Load(), Events: p.events.Load()}
+	if last := p.lastEvent.Load(); last != 0 {
+		health.LastEvent = time.Unix(0, last)
+	}
+	return health
+}
+
+// Stop ceases polling. It doesn't block, a notification channel is closed by a polling goroutine when it has returned.
+// Stop may be called many times.
+func (p *PollingWatcher) Stop() {
+	p.stopped.Store(true)
+	p.stopOnce.Do(func() { close(p.done) })
+}
+
+// poll checks a status of a file every interval until the PollingWatcher is stopped.
+func (p *PollingWatcher) poll() {
+	defer p.notifier.Stop()
+	defer p.open.Store(false)
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-p.opts.clock.After(global.Jitter(p.interval, p.jitterFraction())):
+			p.check()
+		}
+	}
+}
+
+// jitterFraction returns a fraction by which intervals between checks are perturbed.
+func (p *PollingWatcher) jitterFraction() float64 {
+	return math.Float64frombits(p.jitter.Load())
+}
+
+// inheritJitter makes the PollingWatcher perturb intervals by a fraction (e.g. of a ConfigurationHandler using it)
+// unless a jitter was set by WithPollingJitter.
+func (p *PollingWatcher) inheritJitter(fraction float64) {
+	p.jitter.CompareAndSwap(0, math.Float64bits(fraction))
+}
+
+// check compares a current status of a file with the previous one and pushes an event if it has changed or couldn't
+// be checked. With stale handle recovery a path with a stale file handle is resolved again by checking it once more.
+func (p *PollingWatcher) check() {
+	current, err := p.stat()
+	stale := p.opts.recoverStaleHandles && errors.Is(err, syscall.ESTALE)
+	if stale {
+		p.log.Debug("a file handle is stale, the path is resolved again", slog.Any(errorKey, err))
+		current, err = p.stat()
+	}
+	switch {
+	case err != nil && stale && errors.Is(err, syscall.ESTALE):
+		p.fail(fmt.Errorf("%w of %s. Reason: %w", ErrStaleFileHandle, p.file, err))
+	case err != nil:
+		p.fail(fmt.Errorf("could not check a status of a file %s. Reason: %w", p.file, err))
+	default:
+		op := changedOp(p.previous, current)
+		p.previous, p.failing = current, false
+		if op != 0 {
+			p.notify(WatcherEvent{Operation: op})
+		} else if stale {
+			p.notify(WatcherEvent{Error: fmt.Errorf("%w of %s was recovered. Reason: %w", ErrStaleFileHandle, p.file, syscall.ESTALE)})
+		}
+	}
+}
+
+// fail pushes an error of a status check unless the previous check has failed too.
+func (p *PollingWatcher) fail(err error) {
+	if !p.failing {
+		p.notify(WatcherEvent{Error: err})
+	}
+	p.failing = true
+}
+
+// stat returns a status of a file. It returns nil without an error if the file doesn't exist.
+func (p *PollingWatcher) stat() (iofs.FileInfo, error) {
+	info, err := p.fs.Stat(p.file)
+	if errors.Is(err, iofs.ErrNotExist) {
+		return nil, nil
+	}
+	return info, err
+}
+
+// notify pushes an event and records it in a health of the PollingWatcher.
+func (p *PollingWatcher) notify(ev WatcherEvent) {
+	p.lastEvent.Store(p.opts.clock.Now().UnixNano())
+	p.events.Add(1)
+	p.notifier.Notify(ev)
+	p.log.Debug("a watcher event was sent", slog.String("operation", ev.Operation.String()), slog.Any(errorKey, ev.Error))
+}
+
+// changedOp returns an operation which changed a status of a file from previous to current or 0 if it hasn't changed.
+// A nil status means that the file doesn't exist.
+func changedOp(previous, current iofs.FileInfo) fsnotify.Op {
+	switch {
+	case previous == nil && current == nil:
+		return 0
+	case previous == nil:
+		return fsnotify.Create
+	case current == nil:
+		return fsnotify.Remove
+	case previous.Size() != current.Size() || !previous.ModTime().Equal(current.ModTime()) || previous.Mode() != current.Mode():
+		return fsnotify.Create
+	}
+	return 0
+}
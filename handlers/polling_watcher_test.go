@@ -0,0 +1,249 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	m "go.uber.org/mock/gomock"
+)
+
+// statReturn is a pair of values returned by Filesystem.Stat.
+type statReturn struct {
+	info fs.FileInfo
+	err  error
+}
+
+// staleStat is returned by Filesystem.Stat for a file with a stale NFS file handle.
+var staleStat = statReturn{err: &fs.PathError{Op: "stat", Path: "watched", Err: syscall.ESTALE}}
+
+// pollOnce advances a clock to a next poll of a watcher, which should call Stat of a watched file once for every
+// value of stats, and waits until the poll is done.
+func (h *HandlersTestSuite) pollOnce(mocks *mocksControl, clock *manualClock, stats ...statReturn) {
+	polled := make(chan struct{})
+	calls := make([]any, 0, len(stats))
+	for _, stat := range stats {
+		calls = append(calls, mocks.fs.EXPECT().Stat("watched").Times(1).Return(stat.info, stat.err))
+	}
+	calls[len(calls)-1].(*m.Call).Do(func(string) { close(polled) })
+	m.InOrder(calls...)
+	h.Require().Eventually(func() bool { return clock.pendingTimers() == 1 }, time.Second, time.Millisecond)
+	clock.advance(time.Second)
+	<-polled
+}
+
+// nextEvent returns the next event pushed by a watcher.
+func nextEvent(w Watcher) *WatcherEvent {
+	<-w.GetNotificationChannel()
+	return w.GetEvent()
+}
+
+func (h *HandlersTestSuite) TestNewPollingWatcher() {
+	h.RunWithMockEnv("when an interval isn't positive, should return an error", func(mocks *mocksControl) {
+		watcher, err := newPollingWatcher("watched", 0, logDiscard, mocks.fs)
+
+		h.Error(err)
+		h.Nil(watcher)
+	})
+}
+
+func (h *HandlersTestSuite) TestPollingWatcher() {
+	start := time.Now()
+	initial := fakeFileInfo{size: 1, modTime: start}
+	changed := fakeFileInfo{size: 2, modTime: start.Add(time.Second)}
+
+	h.RunWithMockEnv("when a file appears, changes and disappears, should push Create, Create and Remove events", func(mocks *mocksControl) {
+		clock := &manualClock{now: start}
+		mocks.fs.EXPECT().Stat("watched").Times(1).Return(nil, fs.ErrNotExist)
+		watcher, err := newPollingWatcher("watched", time.Second, logDiscard, mocks.fs, withPollingClock(clock))
+		h.Require().NoError(err)
+
+		h.pollOnce(mocks, clock, statReturn{info: initial})
+		h.Equal(&WatcherEvent{Operation: fsnotify.Create}, nextEvent(watcher))
+		h.pollOnce(mocks, clock, statReturn{info: initial})
+		h.Empty(watcher.GetNotificationChannel(), "shouldn't push an event for an unchanged file")
+		h.pollOnce(mocks, clock, statReturn{info: changed})
+		h.Equal(&WatcherEvent{Operation: fsnotify.Create}, nextEvent(watcher))
+		h.pollOnce(mocks, clock, statReturn{err: fs.ErrNotExist})
+		h.Equal(&WatcherEvent{Operation: fsnotify.Remove}, nextEvent(watcher))
+		h.Equal(uint64(3), watcher.Health().Events)
+		h.True(clock.Now().Equal(watcher.Health().LastEvent), "should take a time of the last event from a clock")
+
+		watcher.Stop()
+		_, open := <-watcher.GetNotificationChannel()
+		h.False(open)
+		h.Equal(WatcherHealth{Stopped: true, Events: 3, LastEvent: watcher.Health().LastEvent}, watcher.Health())
+	})
+
+	h.RunWithMockEnv("when stale handle recovery is disabled, should push ESTALE as any other error once", func(mocks *mocksControl) {
+		clock := &manualClock{now: start}
+		mocks.fs.EXPECT().Stat("watched").Times(1).Return(initial, nil)
+		watcher, err := newPollingWatcher("watched", time.Second, logDiscard, mocks.fs, withPollingClock(clock))
+		h.Require().NoError(err)
+
+		h.pollOnce(mocks, clock, staleStat)
+		ev := nextEvent(watcher)
+		h.ErrorIs(ev.Error, syscall.ESTALE)
+		h.NotErrorIs(ev.Error, ErrStaleFileHandle)
+		h.pollOnce(mocks, clock, staleStat)
+		h.Empty(watcher.GetNotificationChannel(), "shouldn't push an error again while checks are failing")
+		h.pollOnce(mocks, clock, statReturn{info: changed})
+		h.Equal(&WatcherEvent{Operation: fsnotify.Create}, nextEvent(watcher))
+
+		watcher.Stop()
+	})
+
+	h.RunWithMockEnv("when a handle stays stale, should push a recoverable error and resume change detection after recovery", func(mocks *mocksControl) {
+		clock := &manualClock{now: start}
+		mocks.fs.EXPECT().Stat("watched").Times(1).Return(initial, nil)
+		watcher, err := newPollingWatcher("watched", time.Second, logDiscard, mocks.fs, withPollingClock(clock), WithStaleHandleRecovery())
+		h.Require().NoError(err)
+
+		h.pollOnce(mocks, clock, staleStat, staleStat)
+		ev := nextEvent(watcher)
+		h.ErrorIs(ev.Error, ErrStaleFileHandle)
+		h.ErrorIs(ev.Error, syscall.ESTALE)
+		h.pollOnce(mocks, clock, staleStat, staleStat)
+		h.Empty(watcher.GetNotificationChannel(), "shouldn't push an error again while a handle is stale")
+		h.pollOnce(mocks, clock, statReturn{info: initial})
+		h.Empty(watcher.GetNotificationChannel(), "shouldn't push an event for an unchanged file after recovery")
+		h.pollOnce(mocks, clock, statReturn{info: changed})
+		h.Equal(&WatcherEvent{Operation: fsnotify.Create}, nextEvent(watcher), "should detect a change after recovery")
+
+		watcher.Stop()
+	})
+
+	testCases := [...]struct {
+		name     string
+		resolved statReturn
+		expected func(*WatcherEvent)
+	}{
+		{name: "when a path resolved again after ESTALE has changed, should push a change",
+			resolved: statReturn{info: changed},
+			expected: func(ev *WatcherEvent) { h.Equal(&WatcherEvent{Operation: fsnotify.Create}, ev) }},
+		{name: "when a path resolved again after ESTALE hasn't changed, should push a recoverable error",
+			resolved: statReturn{info: initial},
+			expected: func(ev *WatcherEvent) { h.ErrorIs(ev.Error, ErrStaleFileHandle) }},
+		{name: "when a path resolved again after ESTALE fails with another error, should push the error",
+			resolved: statReturn{err: errors.New("stat error")},
+			expected: func(ev *WatcherEvent) {
+				h.NotErrorIs(ev.Error, ErrStaleFileHandle)
+				h.ErrorContains(ev.Error, "stat error")
+			}},
+	}
+	for _, test := range testCases {
+		test := test
+		h.RunWithMockEnv(test.name, func(mocks *mocksControl) {
+			clock := &manualClock{now: start}
+			mocks.fs.EXPECT().Stat("watched").Times(1).Return(initial, nil)
+			watcher, err := newPollingWatcher("watched", time.Second, logDiscard, mocks.fs, withPollingClock(clock), WithStaleHandleRecovery())
+			h.Require().NoError(err)
+
+			h.pollOnce(mocks, clock, staleStat, test.resolved)
+			test.expected(nextEvent(watcher))
+
+			watcher.Stop()
+		})
+	}
+}
+
+func (h *HandlersTestSuite) TestPollingWatcherJitter() {
+	h.RunWithMockEnv("when a jitter is set, should perturb intervals between checks within a bound", func(mocks *mocksControl) {
+		const checks = 20
+		clock := &manualClock{now: time.Now()}
+		polled := make(chan struct{}, checks)
+		mocks.fs.EXPECT().Stat("watched").Times(1).Return(nil, fs.ErrNotExist)
+		mocks.fs.EXPECT().Stat("watched").Times(checks).DoAndReturn(func(string) (fs.FileInfo, error) {
+			polled <- struct{}{}
+			return nil, fs.ErrNotExist
+		})
+		watcher, err := newPollingWatcher("watched", time.Second, logDiscard, mocks.fs, withPollingClock(clock), WithPollingJitter(0.25))
+		h.Require().NoError(err)
+
+		for range checks {
+			h.Require().Eventually(func() bool { return clock.pendingTimers() == 1 }, time.Second, time.Millisecond)
+			clock.advance(2 * time.Second)
+			<-polled
+		}
+		watcher.Stop()
+		for range watcher.GetNotificationChannel() {
+		}
+
+		waits := clock.getWaits()
+		h.GreaterOrEqual(len(waits), checks)
+		perturbed := false
+		for _, wait := range waits {
+			h.GreaterOrEqual(wait, 750*time.Millisecond)
+			h.LessOrEqual(wait, 1250*time.Millisecond)
+			perturbed = perturbed || wait != waits[0]
+		}
+		h.True(perturbed, "intervals should differ")
+	})
+
+	testCases := [...]struct {
+		name           string
+		pollingOpts    []PollingOption
+		expectedJitter float64
+	}{
+		{name: "when a watcher has no jitter, should use a jitter of a configuration handler", expectedJitter: 0.25},
+		{name: "when a watcher has its own jitter, should keep it",
+			pollingOpts: []PollingOption{WithPollingJitter(0.1)}, expectedJitter: 0.1},
+	}
+	for _, test := range testCases {
+		test := test
+		h.Run(test.name, func() {
+			newConfig := path.Join(h.T().TempDir(), "new.conf")
+			watcher, err := NewPollingWatcher(newConfig, time.Hour, nil, test.pollingOpts...)
+			h.Require().NoError(err)
+			handler, err := NewConfigurationHandlerWithWatcher(watcher, newConfig, newConfig+hardlinkPostfix, func() int { return 1 }, nil, WithJitter(0.25))
+			h.Require().NoError(err)
+
+			h.Equal(test.expectedJitter, watcher.jitterFraction())
+			wasChanged := handler.GetWasChangedChannel()
+			handler.Close()
+			for range wasChanged {
+			}
+		})
+	}
+}
+
+func (h *HandlersTestSuite) TestPollingWatcherWithConfigurationHandler() {
+	h.Run("when a configuration is moved to a polled path, should push a was changed event", func() {
+		testDir := h.T().TempDir()
+		newConfig := path.Join(testDir, "new.conf")
+		watcher, err := NewPollingWatcher(newConfig, time.Millisecond, nil, WithStaleHandleRecovery())
+		h.Require().NoError(err)
+		handler, err := NewConfigurationHandlerWithWatcher(watcher, newConfig, newConfig+hardlinkPostfix, func() int { return 1 }, nil)
+		h.Require().NoError(err)
+
+		h.Require().NoError(os.WriteFile(newConfig+".new", []byte("content"), 0664))
+		h.Require().NoError(os.Rename(newConfig+".new", newConfig))
+		h.NoError(<-handler.GetWasChangedChannel())
+		h.FileExists(newConfig + hardlinkPostfix)
+
+		wasChanged := handler.GetWasChangedChannel()
+		handler.Close()
+		for range wasChanged {
+		}
+	})
+}
@@ -17,11 +17,18 @@
 package handlers
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"os"
 	"os/exec"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 )
 
 // CmdProcessHandler executes an application and notifies when it starts and ends. The application can be started only
@@ -31,9 +38,48 @@ type CmdProcessHandler struct {
 	cmd     *exec.Cmd
 	started chan error
 	ended   chan error
+	exited  chan struct{} // closed when a process has ended
 	log     *slog.Logger
+	opts    processOptions
+
+	mutex    sync.Mutex // guards cmd.Process, state, pipes and lifecycle flags
+	state    ProcessState
+	pipes    []outputPipe // pipes of an output forwarded to a logger
+	starting bool         // set when Start was called and its goroutine hasn't finished yet
+	closed   bool         // set when Close was called
+	lastErr  lastError    // the most recent error pushed to started or ended channel.
+}
+
+// ProcessState tells if a process of a CmdProcessHandler was started and if it has ended.
+type ProcessState int
+
+const (
+	ProcessNotStarted ProcessState = iota // Start wasn't called or a process is being started
+	ProcessRunning                        // a process was started and hasn't ended yet
+	ProcessExited                         // a process has ended or failed to start
+)
+
+// ToString returns string representation of a ProcessState.
+func (s ProcessState) ToString() string {
+	switch s {
+	case ProcessNotStarted:
+		return "not started"
+	case ProcessRunning:
+		return "running"
+	case ProcessExited:
+		return "exited"
+	}
+	return "invalid"
 }
 
+var ErrSignalNotAllowed = errors.New("signal is not allowed")
+
+var ErrRLimitUnsupported = errors.New("resource limits are not supported on this platform")
+
+var ErrInsufficientPrivilege = errors.New("insufficient privilege to run a process as another user")
+
+var ErrSubreaperUnsupported = errors.New("reaping of orphaned processes is not supported on this platform")
+
 // GetStartedChannel returns a read only channel with an error when the process has started.
 func (p *CmdProcessHandler) GetStartedChannel() <-chan error {
 	return p.started
@@ -44,44 +90,298 @@ func (p *CmdProcessHandler) GetEndedChannel() <-chan error {
 	return p.ended
 }
 
+// LastError returns the most recent error of starting or waiting for a process (e.g. a non-zero exit status) or nil
+// if none occurred. It doesn't depend on draining started and ended channels.
+func (p *CmdProcessHandler) LastError() error {
+	return p.lastErr.get()
+}
+
 // newCmdProcessHandler returns a pointer to a CmdProcessHandler and an error if any occurred.
-func newCmdProcessHandler(cmd *exec.Cmd, log *slog.Logger) (*CmdProcessHandler, error) {
+func newCmdProcessHandler(cmd *exec.Cmd, log *slog.Logger, opts ...ProcessOption) (*CmdProcessHandler, error) {
 	if cmd == nil {
 		return nil, errors.New("can not create process handler without a command")
 	}
 	if cmd.Err != nil {
 		return nil, fmt.Errorf("process handler can not be initialized. Reason: %w", cmd.Err)
 	}
-	return &CmdProcessHandler{cmd: cmd, started: make(chan error, 1), ended: make(chan error, 1), log: log}, nil
+	return &CmdProcessHandler{
+		cmd:     cmd,
+		started: make(chan error, 1),
+		ended:   make(chan error, 1),
+		exited:  make(chan struct{}),
+		log:     log,
+		opts:    newProcessOptions(opts),
+	}, nil
 }
 
-// Start starts and waits for a command in a new goroutine. It returns start and wait errors to channels.
+// Start starts and waits for a command in a new goroutine. It returns start and wait errors to channels. It does
+// nothing when the handler is closed.
 func (p *CmdProcessHandler) Start() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		p.log.Warn("a closed process handler can't be started")
+		return
+	}
+	p.starting = true
 	go func() {
+		defer p.finish()
 		p.log.Info("starting a command")
-		startErr := p.cmd.Start()
+		p.mutex.Lock()
+		var pipes []outputPipe
+		startErr := fmt.Errorf("can not start a command. Reason: %w", ErrHandlerClosed)
+		if !p.closed {
+			if pipes, startErr = p.openOutputPipes(); startErr == nil {
+				if startErr = p.provideStdin(); startErr == nil {
+					p.cmd.ExtraFiles = append(p.cmd.ExtraFiles, p.opts.extraFiles...)
+					startErr = p.startCmd()
+				}
+			}
+		}
+		p.state = ProcessRunning
+		if startErr != nil {
+			p.state = ProcessExited
+		}
+		p.pipes = pipes
+		p.mutex.Unlock()
+		p.lastErr.record(startErr)
 		p.started <- startErr
 		p.log.Info("command start", slog.Any(errorKey, startErr))
 		if startErr != nil {
+			p.closeStdin()
 			return
 		}
+		p.forwardOutput(pipes) // pipes must be read to the end before waiting, as Wait closes them
 		endErr := p.cmd.Wait()
+		if p.opts.subreaper {
+			releaseSubreaper(p.cmd)
+		}
+		p.closeStdin()
+		p.mutex.Lock()
+		p.state = ProcessExited
+		p.mutex.Unlock()
+		close(p.exited)
+		p.lastErr.record(endErr)
 		p.ended <- endErr
 		p.log.Info("command end", slog.Any(errorKey, endErr))
 	}()
 }
 
+// finish marks that a goroutine started by Start has sent all its events. If the handler was closed meanwhile,
+// channels are closed.
+func (p *CmdProcessHandler) finish() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.starting = false
+	if p.closed {
+		p.closeChannels()
+	}
+}
+
+// Close kills a process if it's running and releases pipes of its forwarded output. Started and ended channels are
+// closed when the process has ended and its events were sent, or immediately if it wasn't started. It doesn't wait
+// for the process to end, so it returns even if a SIGKILL is not allowed. A closed handler can't be started.
+func (p *CmdProcessHandler) Close() {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return
+	}
+	p.closed = true
+	running, pipes := p.state == ProcessRunning, p.pipes
+	if !p.starting {
+		p.closeChannels()
+	}
+	p.mutex.Unlock()
+	if !running {
+		return
+	}
+	if err := p.Kill(); err != nil {
+		p.log.Warn("could not kill a process of a closed handler", slog.Any(errorKey, err))
+	}
+	for _, pipe := range pipes {
+		pipe.reader.Close()
+	}
+}
+
+// closeChannels closes started and ended channels. It must be called once, when no events can be sent to them.
+func (p *CmdProcessHandler) closeChannels() {
+	close(p.started)
+	close(p.ended)
+	p.log.Debug("started and ended channels were closed")
+}
+
+// startCmd starts a command. If WithSubreaper was set, orphaned processes are reaped while the command runs.
+func (p *CmdProcessHandler) startCmd() error {
+	if p.opts.subreaper {
+		return startWithSubreaper(p.cmd, p.launchCmd)
+	}
+	return p.launchCmd()
+}
+
+// launchCmd starts a command. If a credential was set with WithCredential or resource limits were set with WithRLimit,
+// they are applied before the command runs.
+func (p *CmdProcessHandler) launchCmd() error {
+	if c := p.opts.credential; c != nil {
+		if err := setCredential(p.cmd, c.uid, c.gid); err != nil {
+			return err
+		}
+	}
+	var err error
+	if len(p.opts.rlimits) == 0 {
+		err = p.cmd.Start()
+	} else {
+		err = startWithRLimits(p.cmd, p.opts.rlimits)
+	}
+	if c := p.opts.credential; c != nil && errors.Is(err, syscall.EPERM) {
+		return fmt.Errorf("could not start a command as uid %d and gid %d. Reason: %w", c.uid, c.gid, errors.Join(ErrInsufficientPrivilege, err))
+	}
+	return err
+}
+
+// provideStdin sets stdin of a command to a reader set with WithStdin. It must be called before the command is started.
+func (p *CmdProcessHandler) provideStdin() error {
+	if p.opts.stdin == nil {
+		return nil
+	} else if p.cmd.Stdin != nil {
+		return errors.New("could not provide stdin of a command. Reason: stdin is already set")
+	}
+	p.cmd.Stdin = p.opts.stdin
+	return nil
+}
+
+// closeStdin closes a reader set with WithStdin if it is an io.Closer.
+func (p *CmdProcessHandler) closeStdin() {
+	closer, ok := p.opts.stdin.(io.Closer)
+	if !ok {
+		return
+	}
+	if err := closer.Close(); err != nil {
+		p.log.Warn("could not close stdin of a command", slog.Any(errorKey, err))
+	}
+}
+
+// outputPipe is a stream of an output of a process which is forwarded to a logger with a level.
+type outputPipe struct {
+	reader io.ReadCloser
+	source string
+	level  slog.Level
+}
+
+// openOutputPipes returns pipes of stdout and stderr of a command if it was set with WithLogForwarding. It must be
+// called before the command is started.
+func (p *CmdProcessHandler) openOutputPipes() ([]outputPipe, error) {
+	levels := p.opts.outputLevels
+	if levels == nil {
+		return nil, nil
+	}
+	stdout, err := p.cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("could not forward stdout of a command. Reason: %w", err)
+	}
+	stderr, err := p.cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("could not forward stderr of a command. Reason: %w", err)
+	}
+	return []outputPipe{
+		{reader: stdout, source: "stdout", level: levels.stdout},
+		{reader: stderr, source: "stderr", level: levels.stderr},
+	}, nil
+}
+
+// forwardOutput logs lines read from all pipes concurrently and returns when all of them are closed.
+func (p *CmdProcessHandler) forwardOutput(pipes []outputPipe) {
+	wg := sync.WaitGroup{}
+	for _, pipe := range pipes {
+		wg.Add(1)
+		go func(pipe outputPipe) {
+			defer wg.Done()
+			p.forwardLines(pipe)
+		}(pipe)
+	}
+	wg.Wait()
+}
+
+// forwardLines logs every line read from a pipe with its level until the pipe is closed. A last line without
+// a trailing newline is logged too.
+func (p *CmdProcessHandler) forwardLines(pipe outputPipe) {
+	reader := bufio.NewReader(pipe.reader)
+	for {
+		line, err := reader.ReadString('\n')
+		if err == nil || line != "" {
+			p.log.Log(context.Background(), pipe.level, strings.TrimRight(line, "\r\n"), slog.String(sourceKey, pipe.source))
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, os.ErrClosed) {
+				p.log.Error("could not read an output of a command", slog.String(sourceKey, pipe.source), slog.Any(errorKey, err))
+			}
+			return
+		}
+	}
+}
+
 // Stop sends sigterm signal to a process.
 func (p *CmdProcessHandler) Stop() error { return p.Signal(syscall.SIGTERM) }
 
+// StopWithTimeout sends sigterm signal to a process. If the process hasn't ended after a timeout, sigkill signal is
+// sent. It returns an error if sigterm signal couldn't be sent.
+func (p *CmdProcessHandler) StopWithTimeout(timeout time.Duration) error {
+	if err := p.Stop(); err != nil {
+		return err
+	}
+	go func() {
+		select {
+		case <-p.exited:
+		case <-time.After(timeout):
+			p.log.Info("a process hasn't stopped in time", slog.Duration("timeout", timeout))
+			if err := p.Kill(); err != nil {
+				p.log.Error("could not kill a process after a stop timeout", slog.Any(errorKey, err))
+			}
+		}
+	}()
+	return nil
+}
+
 // Kill sends sigkill signal to a process.
 func (p *CmdProcessHandler) Kill() error { return p.Signal(syscall.SIGKILL) }
 
-// Signal sends a signal to a process if it's running and returns nil on success or an error.
+// Signal sends a signal to a process if it's running and returns nil on success or an error. It returns
+// an ErrSignalNotAllowed if the signal isn't allowed by WithAllowedSignals.
 func (p *CmdProcessHandler) Signal(signal syscall.Signal) error {
+	if !p.opts.isAllowed(signal) {
+		return fmt.Errorf("can not send a signal %s. Reason: %w", signal.String(), ErrSignalNotAllowed)
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
 	if p.cmd.Process == nil {
 		return fmt.Errorf("a process is nil. Can not send a signal %s", signal.String())
 	}
 	p.log.Info("a signal is being sent", slog.Any("signal", signal.String()))
 	return p.cmd.Process.Signal(signal)
 }
+
+// PID returns an identifier of a started process. It returns 0 if the process wasn't started.
+func (p *CmdProcessHandler) PID() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.cmd.Process == nil {
+		return 0
+	}
+	return p.cmd.Process.Pid
+}
+
+// IsRunning returns true if a process was started and hasn't ended yet.
+func (p *CmdProcessHandler) IsRunning() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.state == ProcessRunning
+}
+
+// State returns a current ProcessState. It changes from ProcessNotStarted to ProcessRunning before a started event is
+// sent and to ProcessExited before an ended event is sent (or a started event with an error), so it can be read
+// before any event is received, e.g. by a consumer which has subscribed after the handler was created.
+func (p *CmdProcessHandler) State() ProcessState {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.state
+}
@@ -17,8 +17,15 @@
 package handlers
 
 import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
 	"os/exec"
+	"runtime"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -82,13 +89,35 @@ func (h *HandlersTestSuite) TestCmdProcessHandler() {
 				expectNoEvents(handler.GetEndedChannel())
 				h.Require().NoError(handler.Stop())
 				h.Error(<-handler.GetEndedChannel())
+				h.Error(handler.LastError(), "should record an error of a stopped process")
 				return
 			}
 
 			h.Nil(<-handler.GetEndedChannel())
+			h.NoError(handler.LastError())
 		})
 	}
 
+	h.Run("when a process can't start or exits with a non-zero code, LastError returns the most recent error", func() {
+		h.T().Parallel()
+		failing := cmd("sh -c true")
+		failing.Dir = "not/existing/dir"
+		handler, err := newCmdProcessHandler(failing, logDiscard)
+		h.Require().NoError(err)
+		handler.Start()
+		h.Error(<-handler.GetStartedChannel())
+		h.ErrorIs(handler.LastError(), os.ErrNotExist)
+
+		handler, err = newCmdProcessHandler(exec.Command("sh", "-c", "exit 3"), logDiscard)
+		h.Require().NoError(err)
+		handler.Start()
+		h.NoError(<-handler.GetStartedChannel())
+		h.Error(<-handler.GetEndedChannel())
+		var exitErr *exec.ExitError
+		h.Require().ErrorAs(handler.LastError(), &exitErr)
+		h.Equal(3, exitErr.ExitCode())
+	})
+
 	h.Run("when Kill is called but process is nil, it returns an error", func() {
 		h.T().Parallel()
 		handler, err := newCmdProcessHandler(cmd("echo"), logDiscard)
@@ -97,4 +126,330 @@ func (h *HandlersTestSuite) TestCmdProcessHandler() {
 		h.Require().NotNil(handler)
 		h.EqualError(handler.Kill(), "a process is nil. Can not send a signal killed")
 	})
+
+	h.Run("when a signal is not allowed, it returns an error and doesn't send it", func() {
+		h.T().Parallel()
+		handler, err := newCmdProcessHandler(cmd("sleep 1"), logDiscard, WithAllowedSignals(syscall.SIGTERM))
+		h.Require().NoError(err)
+		h.Require().NotNil(handler)
+
+		handler.Start()
+		h.Require().NoError(<-handler.GetStartedChannel())
+		h.ErrorIs(handler.Kill(), ErrSignalNotAllowed)
+		h.ErrorIs(handler.Signal(syscall.SIGINT), ErrSignalNotAllowed)
+		expectNoEvents(handler.GetEndedChannel())
+		h.NoError(handler.Stop())
+		h.EqualError(<-handler.GetEndedChannel(), "signal: terminated")
+	})
+
+	h.Run("when a process is signaled and inspected concurrently while it runs, it is race-free", func() {
+		h.T().Parallel()
+		handler, err := newCmdProcessHandler(cmd("sleep 1"), logDiscard)
+		h.Require().NoError(err)
+		h.Require().NotNil(handler)
+		h.False(handler.IsRunning())
+		h.Zero(handler.PID())
+
+		var wg sync.WaitGroup
+		handler.Start()
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				handler.Signal(syscall.Signal(0)) // checks only if the process can be signaled
+				handler.IsRunning()
+				handler.PID()
+			}()
+		}
+		h.Require().NoError(<-handler.GetStartedChannel())
+		wg.Wait()
+		h.True(handler.IsRunning())
+		h.NotZero(handler.PID())
+
+		h.NoError(handler.Kill())
+		h.Error(<-handler.GetEndedChannel())
+		h.False(handler.IsRunning())
+		h.NotZero(handler.PID(), "should return an identifier of an ended process")
+	})
+
+	h.Run("when a process ends after StopWithTimeout, it isn't killed", func() {
+		h.T().Parallel()
+		handler, err := newCmdProcessHandler(cmd("sleep 5"), logDiscard)
+		h.Require().NoError(err)
+		h.Require().NotNil(handler)
+
+		handler.Start()
+		h.Require().NoError(<-handler.GetStartedChannel())
+		h.NoError(handler.StopWithTimeout(time.Second))
+		h.EqualError(<-handler.GetEndedChannel(), "signal: terminated")
+	})
+
+	h.Run("when a process ignores sigterm after StopWithTimeout, it is killed after the timeout", func() {
+		h.T().Parallel()
+		handler, err := newCmdProcessHandler(exec.Command("sh", "-c", "trap '' TERM; while true; do sleep 0.01; done"), logDiscard)
+		h.Require().NoError(err)
+		h.Require().NotNil(handler)
+
+		handler.Start()
+		h.Require().NoError(<-handler.GetStartedChannel())
+		time.Sleep(time.Second / 10) // wait until a trap is set
+		h.NoError(handler.StopWithTimeout(time.Second / 2))
+		expectNoEvents(handler.GetEndedChannel())
+		h.EqualError(<-handler.GetEndedChannel(), "signal: killed")
+	})
+
+	h.Run("when StopWithTimeout is called but process is nil, it returns an error", func() {
+		h.T().Parallel()
+		handler, err := newCmdProcessHandler(cmd("echo"), logDiscard)
+
+		h.Require().NoError(err)
+		h.Error(handler.StopWithTimeout(time.Second))
+	})
+}
+
+func (h *HandlersTestSuite) TestCmdProcessHandlerLogForwarding() {
+	h.Run("when output is forwarded, should log lines of both streams with their levels before an ended event", func() {
+		h.T().Parallel()
+		logs := &syncBuffer{}
+		log := slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		handler, err := newCmdProcessHandler(exec.Command("sh", "-c", "echo first out; echo first err >&2; echo; printf 'partial out'"),
+			log, WithLogForwarding(slog.LevelDebug, slog.LevelWarn))
+		h.Require().NoError(err)
+
+		handler.Start()
+		h.Require().NoError(<-handler.GetStartedChannel())
+		h.NoError(<-handler.GetEndedChannel())
+		output := logs.String()
+		h.Contains(output, `level=DEBUG msg="first out" source=stdout`)
+		h.Contains(output, `level=WARN msg="first err" source=stderr`)
+		h.Contains(output, `level=DEBUG msg="" source=stdout`, "should log an empty line")
+		h.Contains(output, `level=DEBUG msg="partial out" source=stdout`, "should log a line without a trailing newline")
+	})
+
+	h.Run("when output is forwarded but stdout of a command is already set, should fail to start", func() {
+		h.T().Parallel()
+		command := exec.Command("echo")
+		command.Stdout = &bytes.Buffer{}
+		handler, err := newCmdProcessHandler(command, logDiscard, WithLogForwarding(slog.LevelInfo, slog.LevelInfo))
+		h.Require().NoError(err)
+
+		handler.Start()
+		h.ErrorContains(<-handler.GetStartedChannel(), "could not forward stdout")
+		h.False(handler.IsRunning())
+	})
+}
+
+func (h *HandlersTestSuite) TestCmdProcessHandlerStdin() {
+	h.Run("when stdin is provided with bytes, should pass them to a process", func() {
+		h.T().Parallel()
+		stdout := &syncBuffer{}
+		command := exec.Command("cat")
+		command.Stdout = stdout
+		handler, err := newCmdProcessHandler(command, logDiscard, WithStdinBytes([]byte("secret\nvalue")))
+		h.Require().NoError(err)
+
+		handler.Start()
+		h.Require().NoError(<-handler.GetStartedChannel())
+		h.NoError(<-handler.GetEndedChannel())
+		h.Equal("secret\nvalue", stdout.String())
+	})
+
+	h.Run("when stdin is provided with a reader, should pass its content to a process and close it after the process ends", func() {
+		h.T().Parallel()
+		stdout := &syncBuffer{}
+		command := exec.Command("cat")
+		command.Stdout = stdout
+		stdin := &closeRecorder{Reader: strings.NewReader("from reader")}
+		handler, err := newCmdProcessHandler(command, logDiscard, WithStdin(stdin))
+		h.Require().NoError(err)
+
+		handler.Start()
+		h.Require().NoError(<-handler.GetStartedChannel())
+		h.NoError(<-handler.GetEndedChannel())
+		h.Equal("from reader", stdout.String())
+		h.True(stdin.isClosed(), "should close a reader when a process has ended")
+	})
+
+	h.Run("when stdin is provided but stdin of a command is already set, should fail to start and close a reader", func() {
+		h.T().Parallel()
+		command := exec.Command("cat")
+		command.Stdin = strings.NewReader("already set")
+		stdin := &closeRecorder{Reader: strings.NewReader("from reader")}
+		handler, err := newCmdProcessHandler(command, logDiscard, WithStdin(stdin))
+		h.Require().NoError(err)
+
+		handler.Start()
+		h.ErrorContains(<-handler.GetStartedChannel(), "could not provide stdin")
+		h.False(handler.IsRunning())
+		handler.Close()
+		for range handler.GetEndedChannel() {
+		}
+		h.True(stdin.isClosed(), "should close a reader when a process has failed to start")
+	})
+}
+
+func (h *HandlersTestSuite) TestCmdProcessHandlerState() {
+	h.Run("when a process is started and ends, should change a state from not started through running to exited", func() {
+		h.T().Parallel()
+		reader, writer, err := os.Pipe()
+		h.Require().NoError(err)
+		handler, err := newCmdProcessHandler(exec.Command("cat"), logDiscard, WithStdin(reader))
+		h.Require().NoError(err)
+		h.Equal(ProcessNotStarted, handler.State())
+
+		handler.Start()
+		h.Require().NoError(<-handler.GetStartedChannel())
+		h.Equal(ProcessRunning, handler.State())
+		h.Require().NoError(writer.Close())
+		h.NoError(<-handler.GetEndedChannel())
+		h.Equal(ProcessExited, handler.State())
+	})
+
+	h.Run("when a process fails to start, should change a state to exited", func() {
+		h.T().Parallel()
+		handler, err := newCmdProcessHandler(exec.Command("/nonexistent/command"), logDiscard)
+		h.Require().NoError(err)
+
+		handler.Start()
+		h.Error(<-handler.GetStartedChannel())
+		h.Equal(ProcessExited, handler.State())
+	})
+
+	h.Run("when a handler is closed before a start, should stay not started", func() {
+		h.T().Parallel()
+		handler, err := newCmdProcessHandler(exec.Command("cat"), logDiscard)
+		h.Require().NoError(err)
+
+		handler.Close()
+		handler.Start()
+		h.Equal(ProcessNotStarted, handler.State())
+	})
+}
+
+func (h *HandlersTestSuite) TestProcessStateToString() {
+	h.Equal("not started", ProcessNotStarted.ToString())
+	h.Equal("running", ProcessRunning.ToString())
+	h.Equal("exited", ProcessExited.ToString())
+	h.Equal("invalid", ProcessState(-1).ToString())
+}
+
+func (h *HandlersTestSuite) TestCmdProcessHandlerExtraFiles() {
+	h.Run("when extra files are passed, should let a process read from an inherited descriptor", func() {
+		h.T().Parallel()
+		reader, writer, err := os.Pipe()
+		h.Require().NoError(err)
+		defer reader.Close()
+		_, err = writer.WriteString("from descriptor")
+		h.Require().NoError(err)
+		h.Require().NoError(writer.Close())
+		stdout := &syncBuffer{}
+		command := exec.Command("sh", "-c", "cat <&3")
+		command.Stdout = stdout
+		handler, err := newCmdProcessHandler(command, logDiscard, WithExtraFiles(reader))
+		h.Require().NoError(err)
+
+		handler.Start()
+		h.Require().NoError(<-handler.GetStartedChannel())
+		h.NoError(<-handler.GetEndedChannel())
+		h.Equal("from descriptor", stdout.String())
+	})
+
+	h.Run("when a command has extra files, should number passed files after them", func() {
+		h.T().Parallel()
+		pipe := func(content string) *os.File {
+			reader, writer, err := os.Pipe()
+			h.Require().NoError(err)
+			_, err = writer.WriteString(content)
+			h.Require().NoError(err)
+			h.Require().NoError(writer.Close())
+			return reader
+		}
+		first, second := pipe("first"), pipe("second")
+		defer first.Close()
+		defer second.Close()
+		stdout := &syncBuffer{}
+		command := exec.Command("sh", "-c", "cat <&4; cat <&3")
+		command.Stdout = stdout
+		command.ExtraFiles = []*os.File{first}
+		handler, err := newCmdProcessHandler(command, logDiscard, WithExtraFiles(second))
+		h.Require().NoError(err)
+
+		handler.Start()
+		h.Require().NoError(<-handler.GetStartedChannel())
+		h.NoError(<-handler.GetEndedChannel())
+		h.Equal("secondfirst", stdout.String())
+	})
+}
+
+// closeRecorder is an io.ReadCloser which records if it was closed.
+type closeRecorder struct {
+	io.Reader
+	mutex  sync.Mutex
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *closeRecorder) isClosed() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.closed
+}
+
+func (h *HandlersTestSuite) TestCmdProcessHandlerClose() {
+	h.Run("when a running process handler is closed, should kill the process, close channels and leave no goroutines", func() {
+		goroutines := runtime.NumGoroutine()
+		handler, err := newCmdProcessHandler(exec.Command("sleep", "5"), logDiscard, WithLogForwarding(slog.LevelInfo, slog.LevelInfo))
+		h.Require().NoError(err)
+		handler.Start()
+		h.Require().NoError(<-handler.GetStartedChannel())
+
+		handler.Close()
+		h.EqualError(<-handler.GetEndedChannel(), "signal: killed")
+		_, open := <-handler.GetEndedChannel()
+		h.False(open)
+		_, open = <-handler.GetStartedChannel()
+		h.False(open)
+		h.False(handler.IsRunning())
+		for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > goroutines && time.Now().Before(deadline); {
+			time.Sleep(time.Second / 100) // Eventually can't be used, as it starts goroutines itself
+		}
+		h.LessOrEqual(runtime.NumGoroutine(), goroutines)
+		handler.Close()
+	})
+
+	h.Run("when a process handler wasn't started, should close channels and not start a process", func() {
+		h.T().Parallel()
+		handler, err := newCmdProcessHandler(exec.Command("echo"), logDiscard)
+		h.Require().NoError(err)
+
+		handler.Close()
+		_, open := <-handler.GetStartedChannel()
+		h.False(open)
+		_, open = <-handler.GetEndedChannel()
+		h.False(open)
+		handler.Start()
+		h.Zero(handler.PID())
+	})
+
+	h.Run("when a process leaves a child holding forwarded pipes, should release them and send an ended event", func() {
+		h.T().Parallel()
+		handler, err := newCmdProcessHandler(exec.Command("sh", "-c", "sleep 2 & wait"), logDiscard, WithLogForwarding(slog.LevelInfo, slog.LevelInfo))
+		h.Require().NoError(err)
+		handler.Start()
+		h.Require().NoError(<-handler.GetStartedChannel())
+
+		handler.Close()
+		select {
+		case err := <-handler.GetEndedChannel():
+			h.EqualError(err, "signal: killed")
+		case <-time.After(time.Second):
+			h.Fail("an ended event should be sent before a child releases pipes")
+		}
+	})
 }
@@ -0,0 +1,150 @@
+//go:build linux
+
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// subreaper reaps zombie children of the entrypoint which are not managed by process handlers. It is shared by all
+// process handlers started with WithSubreaper and runs while any of their processes is running.
+var subreaper = &reaper{managed: map[int]bool{}}
+
+// reaper reaps orphaned processes reparented to the entrypoint when they end. Pids of managed processes are never
+// reaped, so they are waited for by their handlers.
+type reaper struct {
+	mutex   sync.Mutex // guards all fields and makes registering a started process atomic with reaping
+	managed map[int]bool
+	stop    chan struct{} // closed to stop listening to SIGCHLD, nil when the reaper isn't running
+}
+
+// startWithSubreaper makes the entrypoint a subreaper of its descendants and starts a command with start. A started
+// process is registered as managed before any child can be reaped, so it must be released with releaseSubreaper after
+// it was waited for.
+func startWithSubreaper(cmd *exec.Cmd, start func() error) error {
+	return subreaper.start(cmd, start)
+}
+
+// releaseSubreaper unregisters a process of a command which was waited for. The reaper stops when no managed process is
+// left, after reaping children which have already ended.
+func releaseSubreaper(cmd *exec.Cmd) {
+	subreaper.release(cmd.Process.Pid)
+}
+
+// start starts a command with start and registers its process as managed. The reaper starts listening to SIGCHLD if it
+// isn't running.
+func (r *reaper) start(cmd *exec.Cmd, start func() error) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("could not become a subreaper. Reason: %w", err)
+	}
+	if err := start(); err != nil {
+		return err
+	}
+	r.managed[cmd.Process.Pid] = true
+	if r.stop == nil {
+		r.stop = make(chan struct{})
+		go r.listen(r.stop)
+	}
+	return nil
+}
+
+// release unregisters a managed process with a pid and reaps ended children. The reaper stops listening to SIGCHLD when
+// no managed process is left.
+func (r *reaper) release(pid int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.managed, pid)
+	r.reapLocked()
+	if len(r.managed) == 0 && r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+}
+
+// listen reaps children on every SIGCHLD until stop is closed.
+func (r *reaper) listen(stop <-chan struct{}) {
+	sigchld := make(chan os.Signal, 1)
+	signal.Notify(sigchld, syscall.SIGCHLD)
+	defer signal.Stop(sigchld)
+	r.reap() // a child could have ended before SIGCHLD was subscribed
+	for {
+		select {
+		case <-stop:
+			return
+		case <-sigchld:
+			r.reap()
+		}
+	}
+}
+
+// reap waits for all zombie children which aren't managed.
+func (r *reaper) reap() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.reapLocked()
+}
+
+// reapLocked waits for all zombie children which aren't managed. It must be called with a mutex locked.
+func (r *reaper) reapLocked() {
+	for _, pid := range zombieChildren() {
+		if r.managed[pid] {
+			continue
+		}
+		var status syscall.WaitStatus
+		syscall.Wait4(pid, &status, syscall.WNOHANG, nil)
+	}
+}
+
+// zombieChildren returns pids of children of the entrypoint which have ended and weren't waited for. Children are
+// found in /proc, as waiting for any child would reap managed processes.
+func zombieChildren() []int {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	self := strconv.Itoa(os.Getpid())
+	pids := []int{}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := os.ReadFile("/proc/" + entry.Name() + "/stat")
+		if err != nil {
+			continue // the process was reaped meanwhile
+		}
+		// a name of a command is in parentheses and may contain spaces, so fields are read after the last one.
+		fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+		if len(fields) > 1 && fields[0] == "Z" && fields[1] == self {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
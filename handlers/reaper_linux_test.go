@@ -0,0 +1,65 @@
+//go:build linux
+
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (h *HandlersTestSuite) TestCmdProcessHandlerSubreaper() {
+	h.Run("when a descendant of a process is orphaned, should reap it when it ends", func() {
+		stdout := &syncBuffer{}
+		cmd := exec.Command("sh", "-c", `sh -c 'sleep 0.1 & echo $!'; exec sleep 10`)
+		cmd.Stdout = stdout
+		handler, err := NewProcessHandler(cmd, nil, WithSubreaper())
+		h.Require().NoError(err)
+		handler.Start()
+		h.Require().NoError(<-handler.GetStartedChannel())
+
+		var orphan int
+		h.Require().Eventually(func() bool {
+			orphan, err = strconv.Atoi(strings.TrimSpace(stdout.String()))
+			return err == nil
+		}, 5*time.Second, 10*time.Millisecond, "should print a pid of an orphaned process")
+		h.Eventually(func() bool {
+			_, err := os.Stat("/proc/" + strconv.Itoa(orphan))
+			return errors.Is(err, os.ErrNotExist)
+		}, 5*time.Second, 10*time.Millisecond, "shouldn't leave a zombie of an orphaned process")
+		h.True(handler.IsRunning())
+
+		h.NoError(handler.Kill())
+		h.Error(<-handler.GetEndedChannel(), "should report an end of a managed process")
+	})
+
+	h.Run("when a managed process exits, should report its exit code on an ended channel", func() {
+		handler, err := NewProcessHandler(exec.Command("sh", "-c", "exit 3"), nil, WithSubreaper())
+		h.Require().NoError(err)
+		handler.Start()
+		h.Require().NoError(<-handler.GetStartedChannel())
+
+		var exitErr *exec.ExitError
+		h.Require().ErrorAs(<-handler.GetEndedChannel(), &exitErr)
+		h.Equal(3, exitErr.ExitCode())
+	})
+}
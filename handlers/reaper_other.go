@@ -0,0 +1,33 @@
+//go:build !linux
+
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// startWithSubreaper returns an ErrSubreaperUnsupported without starting a command, as the entrypoint can't become
+// a subreaper on this platform.
+func startWithSubreaper(*exec.Cmd, func() error) error {
+	return fmt.Errorf("can not start a command. Reason: %w", ErrSubreaperUnsupported)
+}
+
+// releaseSubreaper does nothing, as a command is never started with a subreaper on this platform.
+func releaseSubreaper(*exec.Cmd) {}
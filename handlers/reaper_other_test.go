@@ -0,0 +1,35 @@
+//go:build !linux
+
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"os/exec"
+)
+
+func (h *HandlersTestSuite) TestCmdProcessHandlerSubreaper() {
+	h.Run("when a subreaper is set on an unsupported platform, a process is not started and an error is returned", func() {
+		handler, err := NewProcessHandler(exec.Command("sleep", "10"), nil, WithSubreaper())
+		h.Require().NoError(err)
+		handler.Start()
+
+		h.ErrorIs(<-handler.GetStartedChannel(), ErrSubreaperUnsupported)
+		h.False(handler.IsRunning())
+		h.Zero(handler.PID())
+	})
+}
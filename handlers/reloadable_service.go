@@ -0,0 +1,281 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/k-lb/entrypoint-framework/handlers/internal/global"
+)
+
+// defaultServiceStopTimeout is a time after which a stopped process of a ReloadableService is killed.
+const defaultServiceStopTimeout = 10 * time.Second
+
+// ErrServiceStarted is returned when a ReloadableService which is already running is started.
+var ErrServiceStarted = errors.New("service was already started")
+
+// ReloadStrategy tells how a ReloadableService applies an updated configuration to its process.
+type ReloadStrategy int
+
+const (
+	ReloadBySignal  ReloadStrategy = iota // a reload signal is sent to a running process
+	ReloadByRestart                       // a running process is stopped and a new one is started
+)
+
+// ToString returns string representation of a ReloadStrategy.
+func (r ReloadStrategy) ToString() string {
+	switch r {
+	case ReloadBySignal:
+		return "signal"
+	case ReloadByRestart:
+		return "restart"
+	}
+	return "invalid"
+}
+
+// ServiceState tells if a process of a ReloadableService is running.
+type ServiceState int
+
+const (
+	ServiceStopped ServiceState = iota // the service isn't started or a process is being started
+	ServiceRunning                     // a process was started and hasn't ended yet
+	ServiceEnded                       // a process has ended by itself or failed to start
+)
+
+// ToString returns string representation of a ServiceState.
+func (s ServiceState) ToString() string {
+	switch s {
+	case ServiceStopped:
+		return "stopped"
+	case ServiceRunning:
+		return "running"
+	case ServiceEnded:
+		return "ended"
+	}
+	return "invalid"
+}
+
+// ServiceStatus is a snapshot of a ReloadableService returned by Status.
+type ServiceStatus struct {
+	State     ServiceState
+	Reloads   int   // a number of updated configurations applied to processes with a reload strategy.
+	LastError error // the most recent error of a configuration, an update or a process, nil if none occurred.
+}
+
+// ReloadableService couples a ConfigurationHandler with processes created by a factory. When a configuration was
+// changed, an update is triggered, and after every successful update the configuration is applied to a process with
+// a ReloadStrategy: a reload signal is sent or the process is restarted. Update results of the handler are read only by
+// the service, so the handler must not be updated directly.
+type ReloadableService[T any] struct {
+	config     ConfigurationHandler[T]
+	newProcess func() (ProcessHandler, error)
+	check      func(T) error
+	strategy   ReloadStrategy
+	log        *slog.Logger
+	opts       serviceOptions
+
+	mutex   sync.Mutex    // guards status and channels of a running loop
+	status  ServiceStatus // read by Status, which may run concurrently with the loop.
+	done    chan struct{} // closed by Stop, nil when the service isn't started.
+	stopped chan struct{} // closed when the loop has stopped a process.
+}
+
+// NewReloadableService returns a pointer to a ReloadableService and an error if any occurred. newProcess is called
+// to create a process on Start and on every restart, as a process can be started only once. check returns an error
+// for update results which must not be applied (e.g. with a failed update), nil check accepts every result. The service
+// doesn't run until Start is called.
+func NewReloadableService[T any](config ConfigurationHandler[T], newProcess func() (ProcessHandler, error), check func(T) error, strategy ReloadStrategy, logger *slog.Logger, opts ...ServiceOption) (*ReloadableService[T], error) {
+	if config == nil || newProcess == nil {
+		return nil, errors.New("can not create reloadable service without a configuration handler and a process factory")
+	}
+	if check == nil {
+		check = func(T) error { return nil }
+	}
+	return &ReloadableService[T]{
+		config:     config,
+		newProcess: newProcess,
+		check:      check,
+		strategy:   strategy,
+		log:        global.HandleNilLogger(logger).With(slog.String(handlerLogKey, "reloadable service"), slog.String("strategy", strategy.ToString())),
+		opts:       newServiceOptions(opts),
+	}, nil
+}
+
+// Start creates and starts a process and couples it with a configuration in a new goroutine. It returns
+// an ErrServiceStarted if the service is already running or an error of the process factory.
+func (s *ReloadableService[_]) Start() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.done != nil {
+		return fmt.Errorf("can not start a service. Reason: %w", ErrServiceStarted)
+	}
+	process, err := s.newProcess()
+	if err != nil {
+		return fmt.Errorf("can not create a process. Reason: %w", err)
+	}
+	s.done, s.stopped = make(chan struct{}), make(chan struct{})
+	s.status.State = ServiceStopped
+	process.Start()
+	go s.run(process, s.done, s.stopped)
+	return nil
+}
+
+// Stop stops a process (it is killed after a stop timeout) and waits until it has ended. The configuration handler
+// isn't closed, so the service can be started again. It does nothing if the service isn't running.
+func (s *ReloadableService[_]) Stop() {
+	s.mutex.Lock()
+	done, stopped := s.done, s.stopped
+	s.done, s.stopped = nil, nil
+	s.mutex.Unlock()
+	if done == nil {
+		return
+	}
+	close(done)
+	<-stopped
+}
+
+// Status returns a current ServiceStatus.
+func (s *ReloadableService[_]) Status() ServiceStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.status
+}
+
+// setState changes a state of the service.
+func (s *ReloadableService[_]) setState(state ServiceState) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.status.State = state
+}
+
+// record stores err as the most recent error of the service and logs it. A nil err is ignored.
+func (s *ReloadableService[_]) record(err error) {
+	if err == nil {
+		return
+	}
+	s.log.Warn("a reloadable service has observed an error", slog.Any(errorKey, err))
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.status.LastError = err
+}
+
+// run handles events of a configuration handler and a process until done is closed. Then the process is stopped and
+// stopped is closed.
+func (s *ReloadableService[T]) run(process ProcessHandler, done, stopped chan struct{}) {
+	defer close(stopped)
+	wasChanged, updateResult := s.config.GetWasChangedChannel(), s.config.GetUpdateResultChannel()
+	started, ended := process.GetStartedChannel(), process.GetEndedChannel()
+	running := false
+	for {
+		select {
+		case err, open := <-wasChanged:
+			if !open {
+				s.record(fmt.Errorf("a configuration can't be changed anymore. Reason: %w", ErrHandlerClosed))
+				wasChanged, updateResult = nil, nil
+			} else if err != nil {
+				s.record(fmt.Errorf("a configuration was changed with an error. Reason: %w", err))
+			} else if err := s.config.Update(); err != nil {
+				s.record(fmt.Errorf("could not update a configuration. Reason: %w", err))
+			}
+		case result, open := <-updateResult:
+			if !open {
+				wasChanged, updateResult = nil, nil
+			} else if err := s.check(result); err != nil {
+				s.record(fmt.Errorf("an updated configuration wasn't applied. Reason: %w", err))
+			} else {
+				process, running = s.reload(process, running)
+				started, ended = process.GetStartedChannel(), process.GetEndedChannel()
+			}
+		case err, open := <-started:
+			if !open {
+				started = nil
+			} else if err != nil {
+				s.record(fmt.Errorf("a process couldn't be started. Reason: %w", err))
+				s.setState(ServiceEnded)
+			} else {
+				running = true
+				s.setState(ServiceRunning)
+			}
+		case err, open := <-ended:
+			if !open {
+				ended = nil
+				continue
+			}
+			running = false
+			s.record(err)
+			s.setState(ServiceEnded)
+			s.log.Info("a process has ended by itself", slog.Any(errorKey, err))
+		case <-done:
+			s.stopProcess(process, running)
+			s.setState(ServiceStopped)
+			return
+		}
+	}
+}
+
+// reload applies an updated configuration to a process with a strategy of the service. It returns a process which
+// runs afterwards (a new one after a restart) and whether it has already started.
+func (s *ReloadableService[_]) reload(process ProcessHandler, running bool) (ProcessHandler, bool) {
+	switch s.strategy {
+	case ReloadBySignal:
+		if !running {
+			s.log.Info("a configuration was updated, but a process isn't running, so it isn't signalled")
+			return process, running
+		}
+		if err := process.Signal(s.opts.reloadSignal); err != nil {
+			s.record(fmt.Errorf("could not signal a process to reload a configuration. Reason: %w", err))
+			return process, running
+		}
+	case ReloadByRestart:
+		newProcess, err := s.newProcess()
+		if err != nil {
+			s.record(fmt.Errorf("could not create a process to restart. Reason: %w", err))
+			return process, running
+		}
+		s.stopProcess(process, running)
+		s.setState(ServiceStopped)
+		newProcess.Start()
+		process, running = newProcess, false
+	}
+	s.mutex.Lock()
+	s.status.Reloads++
+	s.mutex.Unlock()
+	s.log.Info("a configuration was applied to a process")
+	return process, running
+}
+
+// stopProcess stops a process if it's running, waits until it has ended and closes it. The process is killed if it
+// can't be stopped, and it isn't awaited if it can't be killed either.
+func (s *ReloadableService[_]) stopProcess(process ProcessHandler, running bool) {
+	if running {
+		if err := process.StopWithTimeout(s.opts.stopTimeout); err != nil {
+			s.record(fmt.Errorf("could not stop a process. Reason: %w", err))
+			if err := process.Kill(); err != nil {
+				s.record(fmt.Errorf("could not kill a process. Reason: %w", err))
+				running = false
+			}
+		}
+		if running {
+			<-process.GetEndedChannel()
+		}
+	}
+	process.Close()
+}
@@ -0,0 +1,180 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"errors"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// fakeProcessHandler is a ProcessHandler which pushes a started event on Start and an ended event when it is stopped.
+type fakeProcessHandler struct {
+	started chan error
+	ended   chan error
+	signals chan syscall.Signal
+	closed  atomic.Bool
+}
+
+func newFakeProcessHandler() *fakeProcessHandler {
+	return &fakeProcessHandler{started: make(chan error, 1), ended: make(chan error, 1), signals: make(chan syscall.Signal, 10)}
+}
+
+func (f *fakeProcessHandler) GetStartedChannel() <-chan error { return f.started }
+func (f *fakeProcessHandler) GetEndedChannel() <-chan error   { return f.ended }
+func (f *fakeProcessHandler) Start()                          { f.started <- nil }
+func (f *fakeProcessHandler) Stop() error                     { return f.Signal(syscall.SIGTERM) }
+func (f *fakeProcessHandler) Kill() error                     { return f.Signal(syscall.SIGKILL) }
+func (f *fakeProcessHandler) Close()                          { f.closed.Store(true) }
+
+func (f *fakeProcessHandler) StopWithTimeout(time.Duration) error {
+	f.ended <- nil
+	return f.Stop()
+}
+
+func (f *fakeProcessHandler) Signal(signal syscall.Signal) error {
+	f.signals <- signal
+	return nil
+}
+
+// processFactory returns a factory of processes which returns them in order.
+func processFactory(processes ...*fakeProcessHandler) func() (ProcessHandler, error) {
+	created := atomic.Int32{}
+	return func() (ProcessHandler, error) {
+		return processes[created.Add(1)-1], nil
+	}
+}
+
+func (h *HandlersTestSuite) TestNewReloadableService() {
+	service, err := NewReloadableService[int](nil, processFactory(), nil, ReloadBySignal, logDiscard)
+
+	h.Error(err, "should return an error without a configuration handler")
+	h.Nil(service)
+}
+
+func (h *HandlersTestSuite) TestReloadableService() {
+	// waitForState waits until a service is in a state.
+	waitForState := func(service *ReloadableService[int], state ServiceState) {
+		h.Require().Eventually(func() bool { return service.Status().State == state }, time.Second, time.Millisecond, state.ToString())
+	}
+	// updateConfig pushes a change of a configuration and a result of its update.
+	updateConfig := func(config *fakeConfigurationHandler, result int) {
+		config.wasChanged <- nil
+		<-config.updated
+		config.results <- result
+	}
+
+	h.Run("when a configuration is updated with a signal strategy, should signal a process", func() {
+		config, process := newFakeConfigurationHandler(), newFakeProcessHandler()
+		service, err := NewReloadableService[int](config, processFactory(process), nil, ReloadBySignal, logDiscard, WithReloadSignal(syscall.SIGUSR1))
+		h.Require().NoError(err)
+		h.Require().NoError(service.Start())
+		h.ErrorIs(service.Start(), ErrServiceStarted)
+		waitForState(service, ServiceRunning)
+
+		updateConfig(config, 1)
+		h.Equal(syscall.SIGUSR1, <-process.signals)
+		h.Eventually(func() bool { return service.Status().Reloads == 1 }, time.Second, time.Millisecond)
+
+		service.Stop()
+		h.Equal(syscall.SIGTERM, <-process.signals)
+		h.True(process.closed.Load())
+		h.Equal(ServiceStatus{State: ServiceStopped, Reloads: 1}, service.Status())
+		h.False(config.closed, "shouldn't close a configuration handler")
+	})
+
+	h.Run("when a configuration is updated with a restart strategy, should replace a process with a new one", func() {
+		config, first, second := newFakeConfigurationHandler(), newFakeProcessHandler(), newFakeProcessHandler()
+		service, err := NewReloadableService[int](config, processFactory(first, second), nil, ReloadByRestart, logDiscard)
+		h.Require().NoError(err)
+		h.Require().NoError(service.Start())
+		waitForState(service, ServiceRunning)
+
+		updateConfig(config, 1)
+		h.Equal(syscall.SIGTERM, <-first.signals)
+		h.Eventually(func() bool { return first.closed.Load() && len(second.started) == 0 }, time.Second, time.Millisecond,
+			"should close the first process and start the second one")
+		waitForState(service, ServiceRunning)
+		h.Equal(1, service.Status().Reloads)
+
+		service.Stop()
+		h.Equal(syscall.SIGTERM, <-second.signals)
+		h.True(second.closed.Load())
+	})
+
+	h.Run("when an update result is rejected by a check, shouldn't reload a process", func() {
+		errFailed := errors.New("failed update")
+		config, process := newFakeConfigurationHandler(), newFakeProcessHandler()
+		check := func(result int) error {
+			if result < 0 {
+				return errFailed
+			}
+			return nil
+		}
+		service, err := NewReloadableService(config, processFactory(process), check, ReloadBySignal, logDiscard)
+		h.Require().NoError(err)
+		h.Require().NoError(service.Start())
+		waitForState(service, ServiceRunning)
+
+		updateConfig(config, -1)
+		h.Eventually(func() bool { return errors.Is(service.Status().LastError, errFailed) }, time.Second, time.Millisecond)
+		h.Empty(process.signals)
+		h.Zero(service.Status().Reloads)
+
+		service.Stop()
+	})
+
+	h.Run("when a process ends by itself, should report it and not signal it", func() {
+		errExit := errors.New("exit status 1")
+		config, process := newFakeConfigurationHandler(), newFakeProcessHandler()
+		service, err := NewReloadableService[int](config, processFactory(process), nil, ReloadBySignal, logDiscard)
+		h.Require().NoError(err)
+		h.Require().NoError(service.Start())
+		waitForState(service, ServiceRunning)
+
+		process.ended <- errExit
+		waitForState(service, ServiceEnded)
+		h.ErrorIs(service.Status().LastError, errExit)
+		updateConfig(config, 1)
+		h.Never(func() bool { return len(process.signals) > 0 }, 50*time.Millisecond, time.Millisecond)
+
+		service.Stop()
+		h.True(process.closed.Load())
+		h.Empty(process.signals, "shouldn't stop a process which has ended")
+	})
+
+	h.Run("when a configuration handler can't be updated, should report an error", func() {
+		config, process := newFakeConfigurationHandler(), newFakeProcessHandler()
+		config.updateErr = ErrHandlerClosed
+		service, err := NewReloadableService[int](config, processFactory(process), nil, ReloadBySignal, logDiscard)
+		h.Require().NoError(err)
+		h.Require().NoError(service.Start())
+
+		config.wasChanged <- nil
+		h.Eventually(func() bool { return errors.Is(service.Status().LastError, ErrHandlerClosed) }, time.Second, time.Millisecond)
+		service.Stop()
+	})
+}
+
+func (h *HandlersTestSuite) TestReloadStrategyToString() {
+	h.Equal("signal", ReloadBySignal.ToString())
+	h.Equal("restart", ReloadByRestart.ToString())
+	h.Equal("invalid", ReloadStrategy(-1).ToString())
+	h.Equal("ended", ServiceEnded.ToString())
+	h.Equal("invalid", ServiceState(-1).ToString())
+}
@@ -0,0 +1,67 @@
+//go:build linux
+
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// startWithRLimits starts a command traced, so it stops right after exec. Then rlimits are set on it with prlimit and
+// the command is detached to continue. If rlimits can't be set, the command is killed and an error is returned.
+func startWithRLimits(cmd *exec.Cmd, rlimits []rlimit) error {
+	// ptrace requests must be sent from the thread which started a tracee.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Ptrace = true
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	pid := cmd.Process.Pid
+	var status syscall.WaitStatus
+	if _, err := syscall.Wait4(pid, &status, 0, nil); err != nil {
+		return abortStart(cmd, fmt.Errorf("could not wait for a process %d to stop. Reason: %w", pid, err))
+	} else if !status.Stopped() {
+		return fmt.Errorf("a process %d has ended before resource limits were set", pid)
+	}
+	for _, limit := range rlimits {
+		if err := unix.Prlimit(pid, limit.resource, &unix.Rlimit{Cur: limit.soft, Max: limit.hard}, nil); err != nil {
+			return abortStart(cmd, fmt.Errorf("could not set a resource %d limit of a process %d. Reason: %w", limit.resource, pid, err))
+		}
+	}
+	if err := syscall.PtraceDetach(pid); err != nil {
+		return abortStart(cmd, fmt.Errorf("could not detach from a process %d. Reason: %w", pid, err))
+	}
+	return nil
+}
+
+// abortStart kills and reaps a stopped command which can't be run and returns err.
+func abortStart(cmd *exec.Cmd, err error) error {
+	cmd.Process.Kill()
+	syscall.PtraceDetach(cmd.Process.Pid)
+	cmd.Wait()
+	return err
+}
@@ -0,0 +1,51 @@
+//go:build linux
+
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+func (h *HandlersTestSuite) TestCmdProcessHandlerRLimit() {
+	h.Run("when RLIMIT_NOFILE is set, a process observes the limit", func() {
+		var out bytes.Buffer
+		cmd := exec.Command("sh", "-c", "ulimit -Sn; ulimit -Hn")
+		cmd.Stdout = &out
+		handler, err := NewProcessHandler(cmd, nil, WithRLimit(syscall.RLIMIT_NOFILE, 32, 64))
+		h.Require().NoError(err)
+		handler.Start()
+
+		h.Require().NoError(<-handler.GetStartedChannel())
+		h.Require().NoError(<-handler.GetEndedChannel())
+		h.Equal([]string{"32", "64"}, strings.Fields(out.String()))
+	})
+
+	h.Run("when a limit is invalid, a process is not started and an error is returned", func() {
+		handler, err := NewProcessHandler(exec.Command("sleep", "10"), nil, WithRLimit(syscall.RLIMIT_NOFILE, 64, 32))
+		h.Require().NoError(err)
+		handler.Start()
+
+		h.Error(<-handler.GetStartedChannel())
+		h.False(handler.IsRunning())
+		h.Error(syscall.Kill(handler.PID(), 0), "should kill and reap a process")
+	})
+}
@@ -0,0 +1,84 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+// permanentErrors are errors of a configuration itself (a malformed archive or document, an unsafe entry or a failed
+// validation). An update fails again with them until the configuration is changed.
+var permanentErrors = [...]error{
+	ErrUnsafeEntry,
+	ErrTooManyFiles,
+	ErrUnknownPlaceholder,
+	ErrJSONPatchTestFailed,
+	ErrConfigIsDirectory,
+	ErrConfigNoMatch,
+	ErrHandlerClosed,
+	tar.ErrHeader,
+	zip.ErrFormat,
+	gzip.ErrHeader,
+	gzip.ErrChecksum,
+}
+
+// transientErrors are errors of an environment (a full disk, a stale NFS handle, an archive which is still being
+// written or a temporary I/O failure). An update may succeed when it is retried later.
+var transientErrors = [...]error{
+	syscall.ENOSPC,
+	syscall.ESTALE,
+	ErrStaleFileHandle,
+	io.ErrUnexpectedEOF,
+	syscall.EIO,
+	syscall.EAGAIN,
+	syscall.EINTR,
+	syscall.EBUSY,
+	os.ErrDeadlineExceeded,
+}
+
+// IsTransient returns true if err (e.g. an Err of an UpdateResult) is caused by an environment and an operation may
+// succeed when it is retried, or false if err is permanent or unknown. An error which wraps a permanent error (e.g.
+// ErrUnsafeEntry or a malformed archive) is permanent even if it wraps a transient one too. An error with a Temporary
+// method returning true is transient.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, permanent := range permanentErrors {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return false
+	}
+	for _, transient := range transientErrors {
+		if errors.Is(err, transient) {
+			return true
+		}
+	}
+	var temporary interface{ Temporary() bool }
+	return errors.As(err, &temporary) && temporary.Temporary()
+}
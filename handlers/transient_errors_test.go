@@ -0,0 +1,66 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"syscall"
+)
+
+// temporaryError is an error with a Temporary method, like errors of the net package.
+type temporaryError struct {
+	temporary bool
+}
+
+func (t temporaryError) Error() string   { return "temporary error" }
+func (t temporaryError) Temporary() bool { return t.temporary }
+
+func (h *HandlersTestSuite) TestIsTransient() {
+	wrap := func(err error) error { return fmt.Errorf("could not update a configuration. Reason: %w", err) }
+	testCases := [...]struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "when there is no error, should return false"},
+		{name: "when a disk is full, should return true", err: wrap(&fs.PathError{Op: "write", Path: "file", Err: syscall.ENOSPC}), expected: true},
+		{name: "when a file handle is stale, should return true", err: wrap(&fs.PathError{Op: "stat", Path: "file", Err: syscall.ESTALE}), expected: true},
+		{name: "when a polling watcher reports a stale handle, should return true", err: wrap(ErrStaleFileHandle), expected: true},
+		{name: "when an archive is incomplete, should return true", err: wrap(io.ErrUnexpectedEOF), expected: true},
+		{name: "when an I/O error occurs, should return true", err: wrap(syscall.EIO), expected: true},
+		{name: "when an error is temporary, should return true", err: wrap(temporaryError{temporary: true}), expected: true},
+		{name: "when an error isn't temporary, should return false", err: wrap(temporaryError{})},
+		{name: "when an archive entry is unsafe, should return false", err: wrap(ErrUnsafeEntry)},
+		{name: "when an archive has too many files, should return false", err: wrap(ErrTooManyFiles)},
+		{name: "when a tar header is malformed, should return false", err: wrap(tar.ErrHeader)},
+		{name: "when a gzip header is malformed, should return false", err: wrap(gzip.ErrHeader)},
+		{name: "when a JSON document is malformed, should return false", err: wrap(&json.SyntaxError{Offset: 1})},
+		{name: "when a JSON patch test fails, should return false", err: wrap(ErrJSONPatchTestFailed)},
+		{name: "when a placeholder is unknown, should return false", err: wrap(ErrUnknownPlaceholder)},
+		{name: "when an error is unknown, should return false", err: wrap(errors.New("unknown"))},
+		{name: "when an error wraps transient and permanent errors, should return false", err: errors.Join(syscall.ENOSPC, wrap(ErrUnsafeEntry))},
+	}
+	for _, test := range testCases {
+		h.Equal(test.expected, IsTransient(test.err), test.name)
+	}
+}
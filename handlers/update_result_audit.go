@@ -0,0 +1,76 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// AuditRecord is a serialized UpdateResult written by WriteAudit. Modifications of changed files are stored by their
+// names (as returned by Modification.ToString) and an error by its message.
+type AuditRecord struct {
+	Time         time.Time         `json:"time"`
+	ChangedFiles map[string]string `json:"changedFiles"`
+	Renames      []Renamed         `json:"renames,omitempty"`
+	Error        string            `json:"error,omitempty"`
+}
+
+// WriteAudit writes an UpdateResult with a current time as a single line of JSON (an AuditRecord) to w, so records of
+// consecutive updates can be appended to the same audit file. The line is written with a single Write call.
+func (u UpdateResult) WriteAudit(w io.Writer) error {
+	return u.writeAudit(w, time.Now())
+}
+
+// writeAudit writes an UpdateResult as an AuditRecord with a time t to w.
+func (u UpdateResult) writeAudit(w io.Writer, t time.Time) error {
+	record := AuditRecord{Time: t.UTC(), ChangedFiles: make(map[string]string, len(u.ChangedFiles)), Renames: u.Renames}
+	for file, modification := range u.ChangedFiles {
+		record.ChangedFiles[file] = modification.ToString()
+	}
+	if u.Err != nil {
+		record.Error = u.Err.Error()
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("could not serialize an audit record. Reason: %w", err)
+	}
+	if _, err := w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("could not write an audit record. Reason: %w", err)
+	}
+	return nil
+}
+
+// UpdateResult returns an UpdateResult of an AuditRecord. An error is restored only with its message and files with
+// unknown modifications are skipped.
+func (r AuditRecord) UpdateResult() UpdateResult {
+	result := UpdateResult{ChangedFiles: make(map[string]Modification, len(r.ChangedFiles)), Renames: r.Renames}
+	for file, name := range r.ChangedFiles {
+		for _, modification := range [...]Modification{Deleted, Modified, Created} {
+			if modification.ToString() == name {
+				result.ChangedFiles[file] = modification
+			}
+		}
+	}
+	if r.Error != "" {
+		result.Err = errors.New(r.Error)
+	}
+	return result
+}
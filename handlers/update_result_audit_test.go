@@ -0,0 +1,85 @@
+/*
+ *  Copyright (c) 2023 Samsung Electronics Co., Ltd All Rights Reserved
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License
+ */
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// failingWriter is an io.Writer which always returns an error.
+type failingWriter struct {
+	err error
+}
+
+func (f failingWriter) Write([]byte) (int, error) { return 0, f.err }
+
+func (h *HandlersTestSuite) TestUpdateResultWriteAudit() {
+	h.Run("when a result is written, should round-trip all changed files, renames and an error", func() {
+		result := UpdateResult{
+			ChangedFiles: map[string]Modification{"created": Created, "dir/modified": Modified, "deleted": Deleted},
+			Renames:      []Renamed{{From: "old", To: "new"}},
+			Err:          errors.New("update error"),
+		}
+		at := time.Date(2023, 5, 1, 12, 30, 0, 0, time.UTC)
+		buf := &bytes.Buffer{}
+		h.Require().NoError(result.writeAudit(buf, at))
+
+		h.True(strings.HasSuffix(buf.String(), "\n"), "should end a record with a newline")
+		h.Equal(1, strings.Count(buf.String(), "\n"), "should write a record as a single line")
+		record := AuditRecord{}
+		h.Require().NoError(json.Unmarshal(buf.Bytes(), &record))
+		h.Equal(AuditRecord{
+			Time:         at,
+			ChangedFiles: map[string]string{"created": "created", "dir/modified": "modified", "deleted": "deleted"},
+			Renames:      []Renamed{{From: "old", To: "new"}},
+			Error:        "update error",
+		}, record)
+		restored := record.UpdateResult()
+		h.Equal(result.ChangedFiles, restored.ChangedFiles)
+		h.Equal(result.Renames, restored.Renames)
+		h.EqualError(restored.Err, "update error")
+	})
+
+	h.Run("when results are appended, should write a decodable record per line with a current time", func() {
+		before := time.Now()
+		buf := &bytes.Buffer{}
+		h.Require().NoError(UpdateResult{ChangedFiles: map[string]Modification{"a": Created}}.WriteAudit(buf))
+		h.Require().NoError(UpdateResult{}.WriteAudit(buf))
+		after := time.Now()
+
+		decoder := json.NewDecoder(buf)
+		first, second := AuditRecord{}, AuditRecord{}
+		h.Require().NoError(decoder.Decode(&first))
+		h.Require().NoError(decoder.Decode(&second))
+		h.False(decoder.More())
+		h.Equal(map[string]string{"a": "created"}, first.ChangedFiles)
+		h.Equal(map[string]string{}, second.ChangedFiles)
+		h.Empty(second.Error)
+		h.Nil(second.UpdateResult().Err)
+		h.WithinRange(first.Time, before, after)
+	})
+
+	h.Run("when a writer fails, should return its error", func() {
+		errWrite := errors.New("write error")
+
+		h.ErrorIs(UpdateResult{}.WriteAudit(failingWriter{err: errWrite}), errWrite)
+	})
+}
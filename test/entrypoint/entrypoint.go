@@ -17,12 +17,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log/slog"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path"
+	"syscall"
+	"time"
 
 	"github.com/k-lb/entrypoint-framework/handlers"
 )
@@ -34,47 +40,440 @@ const (
 	oldConfigurationDir      = "/tmp/configuration/old"
 
 	errKey = "error"
+
+	defaultReadyDebounce   = 100 * time.Millisecond
+	defaultPostStopTimeout = 10 * time.Second
+	defaultDrainTimeout    = 10 * time.Second
+)
+
+var (
+	ErrActivationClosed    = errors.New("activation handler was closed")
+	ErrConfigurationClosed = errors.New("configuration handler was closed")
+	ErrMaxRestartsExceeded = errors.New("maximum number of process restarts was exceeded")
+	ErrConfigUpdateFailed  = errors.New("configuration update has failed")
+	ErrNoInitialConfig     = errors.New("initial configuration wasn't applied in time")
+	ErrPreStartFailed      = errors.New("pre-start command has failed")
+	ErrDrainTimeout        = errors.New("in-flight configuration updates haven't finished in time")
 )
 
+// Config contains paths watched by an Entrypoint and its timeouts. It is passed to NewEntrypoint and can be reloaded
+// while the entrypoint runs (see WithReload).
+type Config struct {
+	ActivationPath      string // a file whose presence makes an activation active.
+	ConfigurationPath   string // a tarball with a new configuration.
+	NewConfigurationDir string // a directory to which a new configuration is extracted.
+	OldConfigurationDir string // a directory with an applied configuration.
+
+	ReadyDebounce        time.Duration // see WithReadyDebounce.
+	InitialConfigTimeout time.Duration // see WithRequiredInitialConfig. It is used only when Run starts.
+	IdleTimeout          time.Duration // see WithIdleTimeout.
+}
+
+// DefaultConfig returns a Config with default paths and timeouts.
+func DefaultConfig() Config {
+	return Config{
+		ActivationPath:      watchedActivationPath,
+		ConfigurationPath:   watchedConfigurationPath,
+		NewConfigurationDir: newConfigurationDir,
+		OldConfigurationDir: oldConfigurationDir,
+		ReadyDebounce:       defaultReadyDebounce,
+	}
+}
+
+// configFromEnv returns a DefaultConfig with values overridden by environment variables read by getenv. An empty
+// variable is ignored. It returns an error if a timeout can't be parsed.
+func configFromEnv(getenv func(string) string) (Config, error) {
+	cfg := DefaultConfig()
+	for name, value := range map[string]*string{
+		"ENTRYPOINT_ACTIVATION_PATH":       &cfg.ActivationPath,
+		"ENTRYPOINT_CONFIGURATION_PATH":    &cfg.ConfigurationPath,
+		"ENTRYPOINT_NEW_CONFIGURATION_DIR": &cfg.NewConfigurationDir,
+		"ENTRYPOINT_OLD_CONFIGURATION_DIR": &cfg.OldConfigurationDir,
+	} {
+		if env := getenv(name); env != "" {
+			*value = env
+		}
+	}
+	for name, value := range map[string]*time.Duration{
+		"ENTRYPOINT_READY_DEBOUNCE":         &cfg.ReadyDebounce,
+		"ENTRYPOINT_INITIAL_CONFIG_TIMEOUT": &cfg.InitialConfigTimeout,
+		"ENTRYPOINT_IDLE_TIMEOUT":           &cfg.IdleTimeout,
+	} {
+		if env := getenv(name); env != "" {
+			d, err := time.ParseDuration(env)
+			if err != nil {
+				return Config{}, fmt.Errorf("could not parse %s. Reason: %w", name, err)
+			}
+			*value = d
+		}
+	}
+	return cfg, nil
+}
+
+// createConfigDirs creates parent directories of watched files and a directory with an applied configuration.
+func createConfigDirs(cfg Config) error {
+	for _, dir := range [...]string{path.Dir(cfg.ActivationPath), path.Dir(cfg.ConfigurationPath), cfg.OldConfigurationDir} {
+		if err := os.MkdirAll(dir, fs.ModePerm); err != nil {
+			return fmt.Errorf("couldn't create directory \"%s\". Reason: %w", dir, err)
+		}
+	}
+	return nil
+}
+
 // Entrypoint contains all necessary variables for entrypoint to work.
 type Entrypoint struct {
+	cfg                  Config
 	activation           handlers.ActivationHandler
 	configuration        handlers.ConfigurationHandler[handlers.UpdateResult]
 	process              handlers.ProcessHandler
 	state                State
 	wasConfigChanged     bool
 	configUpdatesRunning int
+	processStarts        int
+	maxRestarts          int           // a maximum number of process restarts. 0 means no limit.
+	deactivationGrace    time.Duration // a time for a process to stop after deactivation. 0 means it is killed at once.
+	restartPolicy        RestartPolicy
+	restartBlocked       bool // set when a process has ended and restartPolicy forbids starting it again
+	fatalConfigErrors    bool // set when a failed configuration update should stop the entrypoint
+	coalesceRestarts     bool // set when restarts for an updated configuration wait for pending updates
+
+	initialConfigTimeout  time.Duration    // a time for the first configuration to be applied. 0 means no limit.
+	initialConfigDeadline <-chan time.Time // fires when initialConfigTimeout has elapsed, nil after the first update
+
+	ready         chan bool     // changes of readiness, a pending change is replaced by a newer one
+	readyDebounce time.Duration // a time for which readiness must be stable to be reported
+
+	idleTimeout  time.Duration    // a time of inactivity after which a process handler is closed. 0 means no limit.
+	idleDeadline <-chan time.Time // fires when idleTimeout has elapsed since a deactivation, nil when active
+	idle         bool             // set when a process handler was closed after idleTimeout, until a new one is created
+
+	restartGrace    time.Duration    // a time between an end of a process killed for a restart and its start
+	restartDeadline <-chan time.Time // fires when restartGrace has elapsed since a killed process has ended
+	restarting      bool             // set when a process was killed to be restarted, until it has ended
+
+	preStart     *exec.Cmd // a one-shot command run to completion before a process is started. nil means none.
+	preStartDone bool      // set when preStart has succeeded, so it isn't run again
+
+	postStop        *exec.Cmd     // a template of a command run after a process has ended. nil means none.
+	postStopTimeout time.Duration // a time after which a hanging postStop is killed
+
+	clock Clock // nil means a real clock
+
+	audit io.Writer // receives an audit record of every configuration update result. nil means no audit.
+
+	reloads    <-chan os.Signal       // signals on which a Config is reloaded. nil means no reloads.
+	loadConfig func() (Config, error) // returns a reloaded Config.
+
+	validationArchiver handlers.Archiver                 // extracts a configuration in Validate. nil means a TarArchiver.
+	lookPath           func(file string) (string, error) // resolves a command in Validate. nil means exec.LookPath.
 
 	log *slog.Logger
 	hc  HandlersConstructorIface
 }
 
+// Clock provides time utilities, so they can be replaced in tests.
+type Clock interface {
+	// After returns a channel on which current time is sent after d has elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock implements Clock with functions from time package.
+type realClock struct{}
+
+// After waits for d to elapse and then sends current time on returned channel.
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Option changes a default behavior of an Entrypoint.
+type Option func(*Entrypoint)
+
+// WithMaxRestarts makes Run return ErrMaxRestartsExceeded when a process would be restarted more than n times.
+func WithMaxRestarts(n int) Option {
+	return func(e *Entrypoint) {
+		e.maxRestarts = n
+	}
+}
+
+// WithFatalConfigErrors makes Run return an error wrapping ErrConfigUpdateFailed when a configuration update fails,
+// instead of only logging it. Transient failures (see handlers.IsTransient), e.g. a full disk, are only logged, as
+// an update may succeed when it is retried. It should be used when an orchestrator is expected to restart a container with a fresh
+// state after such a failure.
+func WithFatalConfigErrors() Option {
+	return func(e *Entrypoint) {
+		e.fatalConfigErrors = true
+	}
+}
+
+// WithCoalescedRestarts makes an Entrypoint defer starting a process for an updated configuration while configuration
+// updates are running or a configuration change is waiting to be handled. Overlapping updates then cause a single
+// restart after all of them have settled, instead of a restart after each of them.
+func WithCoalescedRestarts() Option {
+	return func(e *Entrypoint) {
+		e.coalesceRestarts = true
+	}
+}
+
+// WithRequiredInitialConfig makes Run return ErrNoInitialConfig if no configuration update has succeeded within
+// a timeout since Run was called. A process is never started before the first configuration is applied, so
+// the entrypoint fails fast instead of waiting forever for a configuration which never arrives.
+func WithRequiredInitialConfig(timeout time.Duration) Option {
+	return func(e *Entrypoint) {
+		e.initialConfigTimeout = timeout
+	}
+}
+
+// WithIdleTimeout makes an Entrypoint fully stop a process after an activation has been inactive for timeout: a process
+// which is still ending is killed and its handler is closed. The process isn't started again, even by a configuration
+// update, until the activation changes to active.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(e *Entrypoint) {
+		e.idleTimeout = timeout
+	}
+}
+
+// WithRestartGrace makes an Entrypoint wait for grace after a process killed for a restart (on a configuration
+// update) has ended, before the process is started again. It gives an operating system time to release resources
+// (e.g. ports or locks) held by the old process. By default the process is started at once after it has ended.
+func WithRestartGrace(grace time.Duration) Option {
+	return func(e *Entrypoint) {
+		e.restartGrace = grace
+	}
+}
+
+// WithReload makes an Entrypoint reload its Config with load on every signal received from signals (e.g. SIGHUP).
+// Handlers whose paths have changed are created again with new paths and the previous ones are closed, so
+// the container doesn't have to be restarted. In-flight configuration updates are finished first. If load or creating
+// a handler fails, the previous handler and its paths are kept.
+func WithReload(signals <-chan os.Signal, load func() (Config, error)) Option {
+	return func(e *Entrypoint) {
+		e.reloads, e.loadConfig = signals, load
+	}
+}
+
+// WithAuditSink makes an Entrypoint write every received configuration update result, including failed ones, to
+// a sink as a line of JSON (see handlers.UpdateResult.WriteAudit). A failed write is logged and doesn't stop
+// the entrypoint.
+func WithAuditSink(sink io.Writer) Option {
+	return func(e *Entrypoint) {
+		e.audit = sink
+	}
+}
+
+// WithPreStart makes an Entrypoint run cmd to completion (e.g. migrations or a directory setup) before a process is
+// started for the first time. The entrypoint loop is blocked until cmd has ended. If cmd can't be started or exits
+// with an error, a process isn't started and Run returns an error wrapping ErrPreStartFailed.
+func WithPreStart(cmd *exec.Cmd) Option {
+	return func(e *Entrypoint) {
+		e.preStart = cmd
+	}
+}
+
+// WithPostStop makes an Entrypoint run cmd (e.g. to flush buffers or deregister from a service discovery) every time
+// a process has ended, also when it has crashed, before it is started again or the entrypoint is torn down. A copy of
+// cmd is run each time, as a command can't be run twice. The entrypoint loop is blocked until the copy has ended, but
+// no longer than a timeout set with WithPostStopTimeout (defaultPostStopTimeout by default), after which it is killed.
+// A failure of cmd is logged.
+func WithPostStop(cmd *exec.Cmd) Option {
+	return func(e *Entrypoint) {
+		e.postStop = cmd
+	}
+}
+
+// WithPostStopTimeout makes an Entrypoint kill a command passed to WithPostStop if it hasn't ended after timeout.
+func WithPostStopTimeout(timeout time.Duration) Option {
+	return func(e *Entrypoint) {
+		e.postStopTimeout = timeout
+	}
+}
+
+// WithReadyDebounce makes an Entrypoint report a change of readiness on a ready channel only after it has been stable
+// for debounce. defaultReadyDebounce is used by default.
+func WithReadyDebounce(debounce time.Duration) Option {
+	return func(e *Entrypoint) {
+		e.readyDebounce = debounce
+	}
+}
+
+// RestartPolicy decides if a process which has ended by itself (not by the entrypoint) is started again.
+type RestartPolicy int
+
+const (
+	RestartAlways    RestartPolicy = iota // a process is always started again
+	RestartOnFailure                      // a process is started again only if it has exited with a non-zero code
+	RestartNever                          // a process is not started again
+)
+
+// shouldRestart returns true if a process which has exited with an exitCode should be started again.
+func (p RestartPolicy) shouldRestart(exitCode int) bool {
+	switch p {
+	case RestartOnFailure:
+		return exitCode != 0
+	case RestartNever:
+		return false
+	}
+	return true
+}
+
+// exitCode returns an exit code of a process based on an error from a process ended event. It returns -1 if
+// the process was terminated by a signal or the code is unknown.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// WithRestartPolicy makes an Entrypoint decide with a policy if a process which has ended by itself is started
+// again. When the process isn't started again, it is started after the activation changes to inactive and back
+// to active. RestartAlways is used by default.
+func WithRestartPolicy(policy RestartPolicy) Option {
+	return func(e *Entrypoint) {
+		e.restartPolicy = policy
+	}
+}
+
+// WithGracefulDeactivation makes an Entrypoint stop a process with sigterm when an activation changes to inactive.
+// If the process hasn't ended after grace, it is killed. A process is not started again before it ends, even if
+// the activation changes back to active in the meantime.
+func WithGracefulDeactivation(grace time.Duration) Option {
+	return func(e *Entrypoint) {
+		e.deactivationGrace = grace
+	}
+}
+
+// NewEntrypoint returns a pointer to an Entrypoint with paths and timeouts from cfg and all opts applied. Options take
+// precedence over timeouts from cfg. It must be initialized before running.
+func NewEntrypoint(cfg Config, hc HandlersConstructorIface, log *slog.Logger, opts ...Option) *Entrypoint {
+	e := &Entrypoint{log: log, hc: hc, ready: make(chan bool, 1), postStopTimeout: defaultPostStopTimeout}
+	e.applyConfig(cfg)
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// newEntrypoint returns a pointer to an Entrypoint with a DefaultConfig and all opts applied.
+func newEntrypoint(log *slog.Logger, hc HandlersConstructorIface, opts ...Option) *Entrypoint {
+	return NewEntrypoint(DefaultConfig(), hc, log, opts...)
+}
+
+// applyConfig sets paths and timeouts of an Entrypoint to ones from cfg.
+func (e *Entrypoint) applyConfig(cfg Config) {
+	e.cfg = cfg
+	e.readyDebounce = cfg.ReadyDebounce
+	e.initialConfigTimeout = cfg.InitialConfigTimeout
+	e.idleTimeout = cfg.IdleTimeout
+}
+
 // cmd returns an entrypoint command.
 func cmd() *exec.Cmd {
 	return exec.Command("sleep", "1")
 }
 
 func main() { // place here only the code that can't be tested
-	for _, dir := range [...]string{path.Dir(watchedActivationPath), path.Dir(watchedConfigurationPath), oldConfigurationDir} {
-		if err := os.MkdirAll(dir, fs.ModePerm); err != nil {
-			panic(fmt.Sprintf("couldn't create directory \"%s\". Reason: %v", dir, err))
-		}
+	load := func() (Config, error) { return configFromEnv(os.Getenv) }
+	cfg, err := load()
+	if err != nil {
+		panic(fmt.Sprintf("couldn't load configuration. Reason: %v", err))
 	}
-	e := Entrypoint{
-		log: slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.Level(-10)})),
-		hc:  HandlersConstructor{},
+	if err := createConfigDirs(cfg); err != nil {
+		panic(err.Error())
 	}
+	reloads := make(chan os.Signal, 1)
+	signal.Notify(reloads, syscall.SIGHUP)
+	e := NewEntrypoint(cfg, HandlersConstructor{},
+		slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.Level(-10)})),
+		WithReload(reloads, load))
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
 
-	err := e.initialize()
-	defer e.tearDown()
+	err = e.initialize()
+	defer func() {
+		if err := e.tearDown(); err != nil {
+			e.log.Error("could not tear down entrypoint", slog.Any(errKey, err))
+		}
+	}()
 	if err != nil {
 		panic(fmt.Sprintf("couldn't initialize entrypoint. Reason: %v", err))
 	}
+	if err := e.Run(ctx); err != nil {
+		panic(fmt.Sprintf("entrypoint has stopped. Reason: %v", err))
+	}
+}
+
+// Run reacts on handlers events until ctx is canceled or a fatal condition occurs. It returns nil when ctx was canceled
+// and ErrActivationClosed, ErrConfigurationClosed, ErrMaxRestartsExceeded, ErrConfigUpdateFailed, ErrNoInitialConfig
+// or ErrPreStartFailed otherwise. Entrypoint must be initialized before running.
+func (e *Entrypoint) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var readiness chan bool
+	if e.ready != nil {
+		readiness = make(chan bool)
+		go debounceReadiness(ctx, readiness, e.ready, e.readyDebounce, e.after)
+	}
+	if e.initialConfigTimeout > 0 && is(e.state).config(notReady, changed).value() {
+		e.initialConfigDeadline = e.after(e.initialConfigTimeout)
+	}
+	if e.state.activation == inactive {
+		e.armIdleDeadline()
+	}
 	for {
-		e.changeStateByEvent()
-		e.log.Info("state was changed by an event", "state", e.state.string())
-		e.handleStatusChange()
+		source, err := e.changeStateByEvent(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				e.log.Info("entrypoint was stopped", slog.Any(errKey, err))
+				return nil
+			}
+			return err
+		}
+		e.log.Info("state was changed by an event", "state", e.state.string(), "source", source.string())
+		if err := e.handleStatusChange(); err != nil {
+			return err
+		}
 		e.log.Info("status change was handled    ", "state", e.state.string())
+		if readiness != nil {
+			readiness <- e.state.isReady()
+		}
+	}
+}
+
+// GetReadyChannel returns a read only channel with true when the system becomes ready to serve (it is active,
+// a configuration is applied and a process is alive) and false when it stops being ready. Changes are reported after
+// they have been stable for a debounce time, so short intermediate transitions (e.g. an update which didn't change any
+// file) are not reported. Only the latest unread change is kept.
+func (e *Entrypoint) GetReadyChannel() <-chan bool {
+	return e.ready
+}
+
+// debounceReadiness reads readiness from in and sends it to out when it differs from the last sent one for debounce.
+// A value waiting in out is replaced by a newer one. A debounce time is measured with after. It returns when ctx is done.
+func debounceReadiness(ctx context.Context, in <-chan bool, out chan bool, debounce time.Duration,
+	after func(time.Duration) <-chan time.Time) {
+	var reported bool
+	var settled <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ready := <-in:
+			if ready == reported {
+				settled = nil
+			} else if settled == nil {
+				settled = after(debounce)
+			}
+		case <-settled:
+			settled = nil
+			reported = !reported
+			select {
+			case <-out:
+			default:
+			}
+			out <- reported
+		}
 	}
 }
 
@@ -83,12 +482,14 @@ func (e *Entrypoint) initialize() error {
 	var err error
 	e.wasConfigChanged = false
 	e.configUpdatesRunning = 0
-	e.activation, err = e.hc.NewActivationHandler(watchedActivationPath, e.log)
+	e.processStarts = 0
+	e.restartBlocked = false
+	e.activation, err = e.hc.NewActivationHandler(e.cfg.ActivationPath, e.log)
 	if err != nil {
 		return fmt.Errorf("could not create a new activation handler. Reason: %w", err)
 	}
 	e.configuration, err = e.hc.NewConfigurationHandler(
-		watchedConfigurationPath, newConfigurationDir, oldConfigurationDir, e.log)
+		e.cfg.ConfigurationPath, e.cfg.NewConfigurationDir, e.cfg.OldConfigurationDir, e.log)
 	if err != nil {
 		return fmt.Errorf("could not create a new configuration handler. Reason: %w", err)
 	}
@@ -100,29 +501,262 @@ func (e *Entrypoint) initialize() error {
 	return nil
 }
 
-// tearDown shutdowns all handlers making Entrypoint instance unusable.
-func (e *Entrypoint) tearDown() {
+// tearDown shutdowns all handlers making Entrypoint instance unusable. It is done in order: activation events stop
+// being accepted, in-flight configuration updates are finished, a process is killed and the configuration handler
+// (with its watchers) is closed. In-flight updates are awaited for at most defaultDrainTimeout. It returns errors of all
+// steps joined.
+func (e *Entrypoint) tearDown() error {
 	e.log.Info("tearing down entrypoint")
+	var errs []error
 	e.activation.Close()
+	var deadline <-chan time.Time
+	if e.configUpdatesRunning > 0 {
+		deadline = e.after(defaultDrainTimeout)
+	}
+drain:
+	for ; e.configUpdatesRunning > 0; e.configUpdatesRunning-- {
+		select {
+		case result, open := <-e.configuration.GetUpdateResultChannel():
+			if !open {
+				errs = append(errs, ErrConfigurationClosed)
+				break drain
+			} else if result.Err != nil {
+				errs = append(errs, fmt.Errorf("an in-flight configuration update has failed. Reason: %w", result.Err))
+			}
+		case <-deadline:
+			errs = append(errs, fmt.Errorf("%w: %d left after %s", ErrDrainTimeout, e.configUpdatesRunning, defaultDrainTimeout))
+			e.configUpdatesRunning = 0
+			break drain
+		}
+	}
+	if !e.idle { // a process of an idle entrypoint was already killed and its handler was closed
+		if err := e.terminate(); err != nil {
+			errs = append(errs, fmt.Errorf("could not kill a process. Reason: %w", err))
+		} else if e.postStop != nil && e.state.process != dead {
+			e.awaitEndAndRunPostStop()
+		}
+	}
 	e.configuration.Close()
-	if err := e.process.Kill(); err != nil {
-		e.log.Error("could not kill a process", slog.Any(errKey, err))
+	return errors.Join(errs...)
+}
+
+// Validate checks wiring of an Entrypoint without entering the run loop, e.g. in CI smoke tests. Handlers are created,
+// an initial configuration is extracted to a temporary directory, so an applied configuration isn't changed, and
+// a command is resolved. A process is never started. Handlers are closed afterwards, so the Entrypoint must be
+// initialized again to run. It returns errors of all checks joined or nil if the Entrypoint is valid.
+func (e *Entrypoint) Validate() error {
+	defer e.closeHandlers()
+	if err := e.initialize(); err != nil {
+		return err
+	}
+	var errs []error
+	if err := e.dryRunConfigUpdate(); err != nil {
+		errs = append(errs, err)
+	}
+	lookPath := e.lookPath
+	if lookPath == nil {
+		lookPath = exec.LookPath
+	}
+	if command := cmd(); len(command.Args) == 0 {
+		errs = append(errs, errors.New("a command is empty"))
+	} else if _, err := lookPath(command.Args[0]); err != nil {
+		errs = append(errs, fmt.Errorf("could not resolve a command %s. Reason: %w", command.Args[0], err))
+	}
+	return errors.Join(errs...)
+}
+
+// dryRunConfigUpdate extracts a new configuration to a temporary directory which is removed afterwards. It returns
+// an error if the configuration can't be extracted.
+func (e *Entrypoint) dryRunConfigUpdate() error {
+	archiver := e.validationArchiver
+	if archiver == nil {
+		archiver = handlers.TarArchiver{}
+	}
+	dir, err := os.MkdirTemp("", "entrypoint-validation-")
+	if err != nil {
+		return fmt.Errorf("could not create a directory for a dry run of a configuration update. Reason: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := archiver.Extract(e.cfg.ConfigurationPath, dir); err != nil {
+		return fmt.Errorf("could not extract a configuration %s. Reason: %w", e.cfg.ConfigurationPath, err)
+	}
+	return nil
+}
+
+// closeHandlers closes all created handlers without waiting for them. It should be used when a process wasn't started.
+func (e *Entrypoint) closeHandlers() {
+	if e.activation != nil {
+		e.activation.Close()
+	}
+	if e.configuration != nil {
+		e.configuration.Close()
+	}
+	if e.process != nil {
+		e.process.Close()
 	}
 }
 
-// changeStateByEvent reacts on handlers events by changing state of the entrypoint.
-func (e *Entrypoint) changeStateByEvent() {
+// EventSource identifies a source of an event which drove an iteration of the entrypoint loop.
+type EventSource int
+
+const (
+	contextSource EventSource = iota
+	initialConfigDeadlineSource
+	idleDeadlineSource
+	restartGraceSource
+	reloadSource
+	activationSource
+	configChangeSource
+	configResultSource
+	processStartSource
+	processEndSource
+)
+
+// string returns string representation of an EventSource.
+func (s EventSource) string() string {
+	switch s {
+	case initialConfigDeadlineSource:
+		return "initialConfigDeadline"
+	case idleDeadlineSource:
+		return "idleDeadline"
+	case restartGraceSource:
+		return "restartGrace"
+	case reloadSource:
+		return "reload"
+	case activationSource:
+		return "activation"
+	case configChangeSource:
+		return "configChange"
+	case configResultSource:
+		return "configResult"
+	case processStartSource:
+		return "processStart"
+	case processEndSource:
+		return "processEnd"
+	}
+	return "context"
+}
+
+// changeStateByEvent reacts on handlers events by changing state of the entrypoint. It returns a source of the handled
+// event and an error when ctx is done, one of handlers channels was closed, a configuration update has failed with
+// a non-transient error and such failures are fatal or the first configuration wasn't applied in time.
+func (e *Entrypoint) changeStateByEvent(ctx context.Context) (EventSource, error) {
+	var started, ended <-chan error
+	if !e.idle { // channels of a closed process handler are closed, so they mustn't be read
+		started, ended = e.process.GetStartedChannel(), e.process.GetEndedChannel()
+	}
 	select {
-	case ev := <-e.activation.GetWasChangedChannel():
+	case <-ctx.Done():
+		return contextSource, ctx.Err()
+	case <-e.initialConfigDeadline:
+		return initialConfigDeadlineSource, fmt.Errorf("%w: %s", ErrNoInitialConfig, e.initialConfigTimeout)
+	case <-e.idleDeadline:
+		e.becomeIdle()
+		return idleDeadlineSource, nil
+	case <-e.restartDeadline:
+		e.restartDeadline = nil
+		return restartGraceSource, nil
+	case <-e.reloads:
+		e.reload()
+		return reloadSource, nil
+	case ev, open := <-e.activation.GetWasChangedChannel():
+		if !open {
+			return activationSource, ErrActivationClosed
+		}
 		runFunctionIfNoError(e, ev, "activation was changed", e.activationWasChanged, ev.Error)
-	case ev := <-e.configuration.GetWasChangedChannel():
+		return activationSource, nil
+	case ev, open := <-e.configuration.GetWasChangedChannel():
+		if !open {
+			return configChangeSource, ErrConfigurationClosed
+		}
 		runFunctionIfNoError(e, ev, "configuration was changed", e.configurationWasChanged, ev)
-	case ev := <-e.configuration.GetUpdateResultChannel():
+		return configChangeSource, nil
+	case ev, open := <-e.configuration.GetUpdateResultChannel():
+		if !open {
+			return configResultSource, ErrConfigurationClosed
+		}
+		e.writeAudit(ev)
+		if ev.Err != nil {
+			e.configUpdatesRunning-- // the result was received, so tearDown mustn't wait for it
+			if e.fatalConfigErrors && !handlers.IsTransient(ev.Err) {
+				return configResultSource, fmt.Errorf("%w. Reason: %w", ErrConfigUpdateFailed, ev.Err)
+			}
+		}
 		runFunctionIfNoError(e, ev, "configuration was updated", e.configurationWasUpdated, ev.Err)
-	case ev := <-e.process.GetStartedChannel():
+		return configResultSource, nil
+	case ev := <-started:
 		runFunctionIfNoError(e, ev, "process was started", e.processWasStarted, ev)
-	case ev := <-e.process.GetEndedChannel():
+		return processStartSource, nil
+	case ev := <-ended:
 		e.processWasEnded(ev)
+		return processEndSource, nil
+	}
+}
+
+// reload loads a Config again and creates handlers whose paths have changed. A handler which can't be created is
+// logged and the previous one is kept with its paths. Results of in-flight updates of a previous configuration handler
+// are handled before it is closed.
+func (e *Entrypoint) reload() {
+	cfg, err := e.loadConfig()
+	if err == nil {
+		err = createConfigDirs(cfg)
+	}
+	if err != nil {
+		e.log.Error("could not reload a configuration of an entrypoint", slog.Any(errKey, err))
+		return
+	}
+	if cfg.ActivationPath != e.cfg.ActivationPath {
+		if activation, err := e.hc.NewActivationHandler(cfg.ActivationPath, e.log); err != nil {
+			e.log.Error("could not create a new activation handler on reload", slog.Any(errKey, err))
+			cfg.ActivationPath = e.cfg.ActivationPath
+		} else {
+			e.activation.Close()
+			e.activation = activation
+		}
+	}
+	if cfg.ConfigurationPath != e.cfg.ConfigurationPath || cfg.NewConfigurationDir != e.cfg.NewConfigurationDir ||
+		cfg.OldConfigurationDir != e.cfg.OldConfigurationDir {
+		if configuration, err := e.hc.NewConfigurationHandler(
+			cfg.ConfigurationPath, cfg.NewConfigurationDir, cfg.OldConfigurationDir, e.log); err != nil {
+			e.log.Error("could not create a new configuration handler on reload", slog.Any(errKey, err))
+			cfg.ConfigurationPath = e.cfg.ConfigurationPath
+			cfg.NewConfigurationDir, cfg.OldConfigurationDir = e.cfg.NewConfigurationDir, e.cfg.OldConfigurationDir
+		} else {
+			e.finishConfigUpdates()
+			e.configuration.Close()
+			e.configuration = configuration
+		}
+	}
+	e.applyConfig(cfg)
+	e.log.Info("a configuration of an entrypoint was reloaded",
+		slog.String("activation", cfg.ActivationPath), slog.String("configuration", cfg.ConfigurationPath))
+}
+
+// finishConfigUpdates waits for results of all in-flight configuration updates and handles them.
+func (e *Entrypoint) finishConfigUpdates() {
+	for e.configUpdatesRunning > 0 {
+		result, open := <-e.configuration.GetUpdateResultChannel()
+		if !open {
+			e.configUpdatesRunning = 0
+			return
+		}
+		e.writeAudit(result)
+		if result.Err != nil {
+			e.log.Error("an in-flight configuration update has failed", slog.Any(errKey, result.Err))
+			e.configUpdatesRunning--
+			continue
+		}
+		e.configurationWasUpdated(result)
+	}
+}
+
+// writeAudit writes an audit record of a configuration update result to an audit sink if it is set.
+func (e *Entrypoint) writeAudit(result handlers.UpdateResult) {
+	if e.audit == nil {
+		return
+	}
+	if err := result.WriteAudit(e.audit); err != nil {
+		e.log.Error("could not write an audit record", slog.Any(errKey, err))
 	}
 }
 
@@ -137,6 +771,43 @@ func runFunctionIfNoError[T any](e *Entrypoint, ev T, eventDescription string, f
 // activationWasChanged reacts to ActivationHandlers wasChanged event to change the entrypoint state.
 func (e *Entrypoint) activationWasChanged(ev handlers.ActivationEvent) {
 	e.state.activation = ActivationState(ev.State)
+	if e.state.activation == inactive {
+		e.restartBlocked = false
+		e.armIdleDeadline()
+	} else {
+		e.idleDeadline = nil // a closed handler of an idle entrypoint is replaced when a process is started
+	}
+}
+
+// armIdleDeadline starts waiting for an idle timeout if it is set and the entrypoint isn't already waiting or idle.
+func (e *Entrypoint) armIdleDeadline() {
+	if e.idleTimeout <= 0 || e.idleDeadline != nil || e.idle {
+		return
+	}
+	e.idleDeadline = e.after(e.idleTimeout)
+}
+
+// after returns a channel on which current time is sent after d has elapsed on a clock of the entrypoint.
+func (e *Entrypoint) after(d time.Duration) <-chan time.Time {
+	if e.clock == nil {
+		return realClock{}.After(d)
+	}
+	return e.clock.After(d)
+}
+
+// becomeIdle kills a process if it hasn't ended yet and closes its handler. A process is not started again until
+// an activation changes to active, as it is started only when active.
+func (e *Entrypoint) becomeIdle() {
+	e.log.Info("entrypoint is idle, a process handler is closed", slog.Duration("idleTimeout", e.idleTimeout))
+	e.idleDeadline = nil
+	if e.state.process != dead {
+		if err := e.terminate(); err != nil {
+			e.log.Error("could not kill an idle entrypoint", slog.Any(errKey, err))
+		}
+	}
+	e.process.Close()
+	e.idle = true
+	e.state.process = dead
 }
 
 // configurationWasChanged reacts to ConfigurationHandlers wasChanged event to change the entrypoint state.
@@ -145,6 +816,7 @@ func (e *Entrypoint) configurationWasChanged(_ error) { e.state.configuration =
 // configurationWasUpdated reacts to event with configuration update results to change the entrypoint state.
 func (e *Entrypoint) configurationWasUpdated(ev handlers.UpdateResult) {
 	e.configUpdatesRunning--
+	e.initialConfigDeadline = nil
 	for file, modification := range ev.ChangedFiles {
 		e.log.Info(fmt.Sprintf("File %s was %s", file, modification.ToString()))
 	}
@@ -169,45 +841,198 @@ func (e *Entrypoint) processWasStarted(_ error) {
 	}
 }
 
-// processWasEnded reacts to event of stopping the process to change the entrypoint state.
+// processWasEnded reacts to event of stopping the process to change the entrypoint state. If the process has ended by
+// itself and a restart policy forbids it, the process won't be started again.
 func (e *Entrypoint) processWasEnded(ev error) {
 	e.log.Info("received process was ended event", slog.Any(errKey, ev))
+	if code := exitCode(ev); e.state.process == alive && !e.restartPolicy.shouldRestart(code) {
+		e.log.Info("a process won't be restarted", slog.Int("exitCode", code))
+		e.restartBlocked = true
+	}
+	if e.restarting && e.restartGrace > 0 {
+		e.restartDeadline = e.after(e.restartGrace)
+	}
+	e.restarting = false
 	e.state.process = dead
+	e.runPostStop()
 }
 
-// handleStatusChange handles a status change.
-func (e *Entrypoint) handleStatusChange() {
-	if is(e.state).act(active).config(applied, updated).proc(dead).value() {
-		e.start()
-	} else if is(e.state).act(active).config(updated).proc(alive).value() {
-		e.kill()
-		if e.state.process == changing { //kill was successful
-			e.start()
+// runPostStop runs a copy of a post-stop command if it is set. A failure is logged.
+func (e *Entrypoint) runPostStop() {
+	if e.postStop == nil {
+		return
+	}
+	postStop := copyCmd(e.postStop)
+	e.log.Info("running a post-stop command", slog.String("command", postStop.String()))
+	if err := e.runToCompletion(postStop, e.after(e.postStopTimeout)); err != nil {
+		e.log.Error("a post-stop command has failed", slog.Any(errKey, err))
+		return
+	}
+	e.log.Info("a post-stop command has succeeded")
+}
+
+// awaitEndAndRunPostStop waits for a killed process to end, but no longer than a post-stop timeout, and runs
+// a post-stop command then. It is used by tearDown, as events of a process aren't handled anymore.
+func (e *Entrypoint) awaitEndAndRunPostStop() {
+	select {
+	case err := <-e.process.GetEndedChannel():
+		e.log.Info("received process was ended event", slog.Any(errKey, err))
+	case <-e.after(e.postStopTimeout):
+		e.log.Error("a process hasn't ended before a post-stop command", slog.Duration("timeout", e.postStopTimeout))
+	}
+	e.runPostStop()
+}
+
+// copyCmd returns a new command with a path, arguments, an environment, a directory and standard streams of cmd, so
+// it can be run again.
+func copyCmd(cmd *exec.Cmd) *exec.Cmd {
+	return &exec.Cmd{Path: cmd.Path, Args: cmd.Args, Env: cmd.Env, Dir: cmd.Dir, Stdin: cmd.Stdin, Stdout: cmd.Stdout, Stderr: cmd.Stderr}
+}
+
+// handleStatusChange handles a status change. It returns an error if the entrypoint can't continue. Only one transition
+// of a process (a start or a kill) is in flight at a time: while the process state is changing no other transition is
+// issued, so intents observed meanwhile (e.g. rapid activation flips) collapse to the one of the state in which
+// the transition has settled. A process is restarted by killing it and starting it again after it has ended and
+// a restart grace has elapsed. An action taken in every state is listed by TransitionTable.
+func (e *Entrypoint) handleStatusChange() error {
+	switch e.state.action() {
+	case startAction:
+		if e.restartBlocked || e.restartDeadline != nil || e.isRestartDeferred() {
+			return nil
+		}
+		return e.start()
+	case killAction:
+		if e.isRestartDeferred() {
+			return nil
+		}
+		e.kill() // a process is started again by a start action when it has ended and a restart grace has elapsed
+		e.restarting = e.state.process == changing
+	case deactivateAction:
+		e.deactivate()
+	case updateAction:
+		if err := e.configuration.Update(); err != nil {
+			e.log.Error("could not update a configuration", slog.Any(errKey, err))
+			return nil
 		}
-	} else if is(e.state).act(inactive).proc(alive).value() {
-		e.kill()
-	} else if is(e.state).config(changed).proc(dead, alive).value() {
-		e.configuration.Update()
 		e.configUpdatesRunning++
 		e.state.configuration = notReady
 	}
+	return nil
 }
 
-// start creates a new process handler. If no errors occurred it starts the process and changes Entrypoints process
-// state to changing.
-func (e *Entrypoint) start() {
+// isRestartDeferred returns true if restarts are coalesced and a process shouldn't be started for an updated
+// configuration yet, because another configuration update is running or a configuration change is pending.
+func (e *Entrypoint) isRestartDeferred() bool {
+	if !e.coalesceRestarts || e.state.configuration != updated {
+		return false
+	}
+	if e.configUpdatesRunning > 0 || len(e.configuration.GetWasChangedChannel()) > 0 {
+		e.log.Info("a restart was deferred until pending configuration updates settle")
+		return true
+	}
+	return false
+}
+
+// start closes a previous process handler and creates a new one. If no errors occurred it starts the process and
+// changes Entrypoints process state to changing. It returns ErrMaxRestartsExceeded if the process was already restarted
+// maxRestarts times and an error wrapping ErrPreStartFailed if a pre-start command has failed.
+func (e *Entrypoint) start() error {
+	if e.maxRestarts > 0 && e.processStarts > e.maxRestarts {
+		return fmt.Errorf("%w: %d", ErrMaxRestartsExceeded, e.maxRestarts)
+	}
+	if err := e.runPreStart(); err != nil {
+		return fmt.Errorf("%w. Reason: %w", ErrPreStartFailed, err)
+	}
+	if e.process != nil && !e.idle { // a handler of an idle entrypoint was already closed
+		e.process.Close() // a discarded handler releases its resources when its process has ended
+	}
 	var err error
 	if e.process, err = e.hc.NewProcessHandler(cmd(), e.log); err != nil {
 		e.log.Error("could not start an entrypoint", slog.Any(errKey, err))
-		return
+		return nil
 	}
+	e.idle = false
 	e.process.Start()
+	e.processStarts++
+	e.state.process = changing
+	return nil
+}
+
+// runPreStart runs a pre-start command with a new process handler and waits until it has ended. It does nothing if
+// the command isn't set or has already succeeded. It returns an error of starting or ending the command.
+func (e *Entrypoint) runPreStart() error {
+	if e.preStart == nil || e.preStartDone {
+		return nil
+	}
+	e.log.Info("running a pre-start command", slog.String("command", e.preStart.String()))
+	if err := e.runToCompletion(e.preStart, nil); err != nil {
+		return err
+	}
+	e.preStartDone = true
+	e.log.Info("a pre-start command has succeeded")
+	return nil
+}
+
+// ErrCommandTimeout is returned when a command run to completion hasn't ended before a timeout.
+var ErrCommandTimeout = errors.New("command hasn't ended before a timeout")
+
+// runToCompletion runs a command with a new process handler and waits until it has ended or timeout fires. A nil
+// timeout means no limit. A handler is closed afterwards, so a command which hasn't ended is killed. It returns
+// an error of starting or ending the command or an ErrCommandTimeout.
+func (e *Entrypoint) runToCompletion(cmd *exec.Cmd, timeout <-chan time.Time) error {
+	process, err := e.hc.NewProcessHandler(cmd, e.log)
+	if err != nil {
+		return fmt.Errorf("could not create a process handler of a command. Reason: %w", err)
+	}
+	defer process.Close()
+	process.Start()
+	for _, events := range [...]func() <-chan error{process.GetStartedChannel, process.GetEndedChannel} {
+		select {
+		case err, open := <-events():
+			if !open {
+				return fmt.Errorf("could not run a command. Reason: %w", handlers.ErrHandlerClosed)
+			} else if err != nil {
+				return err
+			}
+		case <-timeout:
+			return ErrCommandTimeout
+		}
+	}
+	return nil
+}
+
+// deactivate stops an entrypoint's process with a grace period if it is set or kills it otherwise. If no errors
+// occurred it changes process state to changing.
+func (e *Entrypoint) deactivate() {
+	if e.deactivationGrace <= 0 {
+		e.kill()
+		return
+	}
+	if err := e.process.StopWithTimeout(e.deactivationGrace); err != nil {
+		e.log.Error("could not stop an entrypoint", slog.Any(errKey, err))
+		return
+	}
 	e.state.process = changing
 }
 
+// fallbackKillSignals are sent (from the strongest) to end a process when a SIGKILL is not allowed by a process handler.
+var fallbackKillSignals = [...]syscall.Signal{syscall.SIGTERM, syscall.SIGINT}
+
+// terminate kills an entrypoint's process with the strongest allowed signal. It returns nil on success or an error.
+func (e *Entrypoint) terminate() error {
+	err := e.process.Kill()
+	for _, signal := range fallbackKillSignals {
+		if !errors.Is(err, handlers.ErrSignalNotAllowed) {
+			break
+		}
+		err = e.process.Signal(signal)
+	}
+	return err
+}
+
 // kill kills an entrypoint's process. If no errors occurred it changes process state to changing.
 func (e *Entrypoint) kill() {
-	if err := e.process.Kill(); err != nil {
+	if err := e.terminate(); err != nil {
 		e.log.Error("could not kill an entrypoint", slog.Any(errKey, err))
 		return
 	}
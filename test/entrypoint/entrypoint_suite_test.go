@@ -40,6 +40,16 @@ type mocksControl struct {
 	process       *mocks.MockProcessHandler
 }
 
+// newHandlers returns new mocks of an activation and a configuration handler, e.g. ones created on reload.
+func (c *mocksControl) newHandlers() (*mocks.MockActivationHandler, *mocks.MockConfigurationHandler[handlers.UpdateResult]) {
+	return mocks.NewMockActivationHandler(c.Controller), mocks.NewMockConfigurationHandler[handlers.UpdateResult](c.Controller)
+}
+
+// newProcess returns a new mock of a process handler, e.g. one of a pre-start command.
+func (c *mocksControl) newProcess() *mocks.MockProcessHandler {
+	return mocks.NewMockProcessHandler(c.Controller)
+}
+
 func (e *EntrypointTestSuite) runWithMockEntrypoint(
 	name string, test func(*Entrypoint, *mocksControl, *bytes.Buffer)) {
 	e.Run(name, func() {
@@ -56,6 +66,7 @@ func (e *EntrypointTestSuite) runWithMockEntrypoint(
 		logBuf := new(bytes.Buffer)
 		test(
 			&Entrypoint{
+				cfg:           DefaultConfig(),
 				log:           slog.New(slog.NewTextHandler(logBuf, nil)),
 				hc:            mocks.hc,
 				activation:    mocks.activation,
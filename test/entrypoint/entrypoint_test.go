@@ -18,8 +18,16 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
 	"os/exec"
+	"path"
+	"syscall"
+	"time"
 
 	m "go.uber.org/mock/gomock"
 
@@ -83,12 +91,1194 @@ func (e *EntrypointTestSuite) TestEntrypointInitialization() {
 	}
 }
 
+func (e *EntrypointTestSuite) TestEntrypointFromConfig() {
+	e.runWithMockEntrypoint("when created from a config, should create handlers with its paths and use its timeouts", func(_ *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+		cfg := Config{
+			ActivationPath:      "/custom/activation",
+			ConfigurationPath:   "/custom/config.tar",
+			NewConfigurationDir: "/custom/new",
+			OldConfigurationDir: "/custom/old",
+			ReadyDebounce:       time.Second,
+			IdleTimeout:         time.Minute,
+		}
+		entrypoint := NewEntrypoint(cfg, mocks.hc, slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)), WithIdleTimeout(time.Hour))
+		mocks.hc.EXPECT().NewActivationHandler("/custom/activation", entrypoint.log).Times(1).Return(mocks.activation, nil)
+		mocks.hc.EXPECT().NewConfigurationHandler("/custom/config.tar", "/custom/new", "/custom/old", entrypoint.log).
+			Times(1).Return(mocks.configuration, nil)
+		mocks.hc.EXPECT().NewProcessHandler(m.Any(), entrypoint.log).Times(1).Return(mocks.process, nil)
+
+		e.NoError(entrypoint.initialize())
+		e.Equal(time.Second, entrypoint.readyDebounce)
+		e.Equal(time.Hour, entrypoint.idleTimeout, "options should take precedence over a config")
+	})
+}
+
+func (e *EntrypointTestSuite) TestConfigFromEnv() {
+	testCases := [...]struct {
+		name        string
+		env         map[string]string
+		expected    Config
+		expectedErr bool
+	}{
+		{name: "when no variables are set, should return a default config", expected: DefaultConfig()},
+		{name: "when variables are set, should override a default config",
+			env: map[string]string{
+				"ENTRYPOINT_ACTIVATION_PATH":        "/a",
+				"ENTRYPOINT_CONFIGURATION_PATH":     "/c.tar",
+				"ENTRYPOINT_NEW_CONFIGURATION_DIR":  "/new",
+				"ENTRYPOINT_OLD_CONFIGURATION_DIR":  "/old",
+				"ENTRYPOINT_READY_DEBOUNCE":         "1s",
+				"ENTRYPOINT_INITIAL_CONFIG_TIMEOUT": "2s",
+				"ENTRYPOINT_IDLE_TIMEOUT":           "3s",
+			},
+			expected: Config{"/a", "/c.tar", "/new", "/old", time.Second, 2 * time.Second, 3 * time.Second}},
+		{name: "when a timeout is invalid, should return an error",
+			env: map[string]string{"ENTRYPOINT_IDLE_TIMEOUT": "never"}, expectedErr: true},
+	}
+	for _, test := range testCases {
+		test := test
+		e.Run(test.name, func() {
+			cfg, err := configFromEnv(func(name string) string { return test.env[name] })
+
+			if test.expectedErr {
+				e.ErrorContains(err, "ENTRYPOINT_IDLE_TIMEOUT")
+				return
+			}
+			e.NoError(err)
+			e.Equal(test.expected, cfg)
+		})
+	}
+}
+
+func (e *EntrypointTestSuite) TestEntrypointReload() {
+	errCreate := errors.New("create handler error")
+	errUpdate := errors.New("update error")
+	testCases := [...]struct {
+		name                 string
+		loadErr              error
+		activationErr        error
+		configurationErr     error
+		configUpdatesRunning int
+	}{
+		{name: "when paths have changed, should recreate handlers and close previous ones"},
+		{name: "when a config can't be loaded, should keep handlers", loadErr: errors.New("load error")},
+		{name: "when an activation handler can't be created, should keep a previous one", activationErr: errCreate},
+		{name: "when a configuration handler can't be created, should keep a previous one", configurationErr: errCreate},
+		{name: "when configuration updates are in flight, should handle their results first", configUpdatesRunning: 2},
+	}
+	for _, test := range testCases {
+		test := test
+		e.runWithMockEntrypoint(test.name, func(entrypoint *Entrypoint, mocks *mocksControl, logBuf *bytes.Buffer) {
+			dir := e.T().TempDir()
+			cfg := Config{
+				ActivationPath:      path.Join(dir, "activation", "active"),
+				ConfigurationPath:   path.Join(dir, "config", "config.tar"),
+				NewConfigurationDir: path.Join(dir, "new"),
+				OldConfigurationDir: path.Join(dir, "old"),
+				ReadyDebounce:       time.Second,
+			}
+			previous := entrypoint.cfg
+			reloads := make(chan os.Signal, 1)
+			WithReload(reloads, func() (Config, error) { return cfg, test.loadErr })(entrypoint)
+			entrypoint.configUpdatesRunning = test.configUpdatesRunning
+			activation, configuration := mocks.newHandlers()
+			var expectedActivation, expectedConfiguration any = mocks.activation, mocks.configuration
+			mocks.activation.EXPECT().GetWasChangedChannel().Return(nil).Times(1)
+			mocks.configuration.EXPECT().GetWasChangedChannel().Return(nil).Times(1)
+			mocks.configuration.EXPECT().GetUpdateResultChannel().Return(nil).Times(1)
+			mocks.process.EXPECT().GetStartedChannel().Return(nil).Times(1)
+			mocks.process.EXPECT().GetEndedChannel().Return(nil).Times(1)
+			if test.loadErr == nil {
+				mocks.hc.EXPECT().NewActivationHandler(cfg.ActivationPath, entrypoint.log).Times(1).
+					Return(activation, test.activationErr)
+				mocks.hc.EXPECT().NewConfigurationHandler(
+					cfg.ConfigurationPath, cfg.NewConfigurationDir, cfg.OldConfigurationDir, entrypoint.log).
+					Times(1).Return(configuration, test.configurationErr)
+				if test.activationErr == nil {
+					mocks.activation.EXPECT().Close().Times(1)
+					expectedActivation = activation
+				}
+				if test.configurationErr == nil {
+					results := sliceToChan([]handlers.UpdateResult{{Err: errUpdate}, {Err: errUpdate}})
+					mocks.configuration.EXPECT().GetUpdateResultChannel().Return(results).Times(test.configUpdatesRunning)
+					mocks.configuration.EXPECT().Close().Times(1)
+					expectedConfiguration = configuration
+				}
+			}
+			reloads <- syscall.SIGHUP
+
+			source, err := entrypoint.changeStateByEvent(context.Background())
+			e.Equal(reloadSource, source, source.string())
+			e.NoError(err)
+			e.Same(expectedActivation, entrypoint.activation)
+			e.Same(expectedConfiguration, entrypoint.configuration)
+			e.Zero(entrypoint.configUpdatesRunning)
+			switch {
+			case test.loadErr != nil:
+				e.Equal(previous, entrypoint.cfg)
+				e.Contains(logBuf.String(), test.loadErr.Error())
+			case test.activationErr != nil:
+				e.Equal(previous.ActivationPath, entrypoint.cfg.ActivationPath)
+				e.Equal(cfg.ConfigurationPath, entrypoint.cfg.ConfigurationPath)
+				e.Contains(logBuf.String(), errCreate.Error())
+			case test.configurationErr != nil:
+				e.Equal(cfg.ActivationPath, entrypoint.cfg.ActivationPath)
+				e.Equal(previous.ConfigurationPath, entrypoint.cfg.ConfigurationPath)
+				e.Equal(previous.OldConfigurationDir, entrypoint.cfg.OldConfigurationDir)
+				e.Contains(logBuf.String(), errCreate.Error())
+			default:
+				e.Equal(cfg, entrypoint.cfg)
+				e.Equal(time.Second, entrypoint.readyDebounce)
+				e.DirExists(path.Join(dir, "activation"))
+				e.DirExists(cfg.OldConfigurationDir)
+			}
+		})
+	}
+}
+
+func (e *EntrypointTestSuite) TestEntrypointValidate() {
+	errExtract := errors.New("extract error")
+	errConstruct := errors.New("create configuration handler error")
+	testCases := [...]struct {
+		name          string
+		constructErr  error
+		extractErr    error
+		lookPathErr   error
+		expectedError error
+	}{
+		{name: "when a setup is healthy, should return no error"},
+		{name: "when a handler can't be created, should return an error", constructErr: errConstruct, expectedError: errConstruct},
+		{name: "when an initial configuration can't be extracted, should return an error", extractErr: errExtract, expectedError: errExtract},
+		{name: "when a command can't be resolved, should return an error", lookPathErr: exec.ErrNotFound, expectedError: exec.ErrNotFound},
+	}
+	for _, test := range testCases {
+		test := test
+		e.runWithMockEntrypoint(test.name, func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+			entrypoint.process = nil
+			mocks.hc.EXPECT().NewActivationHandler(watchedActivationPath, entrypoint.log).Times(1).Return(mocks.activation, nil)
+			mocks.activation.EXPECT().Close().Times(1)
+			if test.constructErr != nil {
+				mocks.hc.EXPECT().NewConfigurationHandler(watchedConfigurationPath, newConfigurationDir, oldConfigurationDir, entrypoint.log).
+					Times(1).Return(nil, test.constructErr)
+			} else {
+				mocks.hc.EXPECT().NewConfigurationHandler(watchedConfigurationPath, newConfigurationDir, oldConfigurationDir, entrypoint.log).
+					Times(1).Return(mocks.configuration, nil)
+				mocks.hc.EXPECT().NewProcessHandler(m.Any(), entrypoint.log).Times(1).Return(mocks.process, nil)
+				mocks.configuration.EXPECT().Close().Times(1)
+				mocks.process.EXPECT().Close().Times(1)
+			}
+			archiver := &stubArchiver{err: test.extractErr}
+			entrypoint.validationArchiver = archiver
+			entrypoint.lookPath = func(file string) (string, error) {
+				e.Equal("sleep", file)
+				return file, test.lookPathErr
+			}
+
+			e.ErrorIs(entrypoint.Validate(), test.expectedError)
+			if test.constructErr == nil {
+				e.Equal(watchedConfigurationPath, archiver.archive)
+				e.NotEqual(oldConfigurationDir, archiver.toDir, "shouldn't change an applied configuration")
+				e.NoDirExists(archiver.toDir, "should remove a directory of a dry run")
+			}
+		})
+	}
+}
+
+// stubArchiver is a handlers.Archiver which records arguments of Extract and returns err.
+type stubArchiver struct {
+	archive, toDir string
+	err            error
+}
+
+func (s *stubArchiver) Extract(archive, toDir string) error {
+	s.archive, s.toDir = archive, toDir
+	return s.err
+}
+
+func (s *stubArchiver) List(string) ([]string, error) {
+	return nil, s.err
+}
+
 func (e *EntrypointTestSuite) TestEntrypointTearDown() {
 	e.runWithMockEntrypoint("should close all handlers", func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
 		mocks.activation.EXPECT().Close().Times(1)
 		mocks.configuration.EXPECT().Close().Times(1)
 		mocks.process.EXPECT().Kill().Return(nil).Times(1)
-		entrypoint.tearDown()
+		e.NoError(entrypoint.tearDown())
+	})
+
+	e.runWithMockEntrypoint("when in-flight updates are running, should wait for them before killing a process", func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+		entrypoint.configUpdatesRunning = 2
+		m.InOrder(
+			mocks.activation.EXPECT().Close().Times(1),
+			mocks.configuration.EXPECT().GetUpdateResultChannel().Return(sliceToChan([]handlers.UpdateResult{{}, {}})).Times(2),
+			mocks.process.EXPECT().Kill().Return(nil).Times(1),
+			mocks.configuration.EXPECT().Close().Times(1),
+		)
+		e.NoError(entrypoint.tearDown())
+		e.Zero(entrypoint.configUpdatesRunning)
+	})
+
+	e.runWithMockEntrypoint("when multiple steps fail, should return all errors joined", func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+		errUpdate := errors.New("update error")
+		errKill := errors.New("kill error")
+		entrypoint.configUpdatesRunning = 3
+		results := make(chan handlers.UpdateResult, 1)
+		results <- handlers.UpdateResult{Err: errUpdate}
+		close(results)
+		mocks.activation.EXPECT().Close().Times(1)
+		mocks.configuration.EXPECT().GetUpdateResultChannel().Return(results).Times(2)
+		mocks.process.EXPECT().Kill().Return(errKill).Times(1)
+		mocks.configuration.EXPECT().Close().Times(1)
+
+		err := entrypoint.tearDown()
+		e.ErrorIs(err, errUpdate)
+		e.ErrorIs(err, ErrConfigurationClosed)
+		e.ErrorIs(err, errKill)
+	})
+
+	e.runWithMockEntrypoint("when in-flight updates don't finish in time, should stop waiting for them and kill a process", func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+		entrypoint.configUpdatesRunning = 2
+		clock := fakeClock{timers: make(chan chan time.Time)}
+		entrypoint.clock = clock
+		mocks.activation.EXPECT().Close().Times(1)
+		mocks.configuration.EXPECT().GetUpdateResultChannel().Return(make(chan handlers.UpdateResult)).AnyTimes()
+		mocks.process.EXPECT().Kill().Return(nil).Times(1)
+		mocks.configuration.EXPECT().Close().Times(1)
+		ended := make(chan error)
+		go func() { ended <- entrypoint.tearDown() }()
+
+		timer := <-clock.timers
+		timer <- time.Now()
+		e.ErrorIs(<-ended, ErrDrainTimeout)
+		e.Zero(entrypoint.configUpdatesRunning)
+	})
+
+	e.runWithMockEntrypoint("when an update has failed before a shutdown, shouldn't wait for its result", func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+		ctx, cancel := context.WithCancel(context.Background())
+		results := make(chan handlers.UpdateResult)
+		mocks.activation.EXPECT().GetWasChangedChannel().Return(nil).AnyTimes()
+		mocks.configuration.EXPECT().GetWasChangedChannel().Return(nil).AnyTimes()
+		mocks.configuration.EXPECT().GetUpdateResultChannel().Return(results).AnyTimes()
+		mocks.process.EXPECT().GetStartedChannel().Return(nil).AnyTimes()
+		mocks.process.EXPECT().GetEndedChannel().Return(nil).AnyTimes()
+		mocks.activation.EXPECT().Close().Times(1)
+		mocks.process.EXPECT().Kill().Return(nil).Times(1)
+		mocks.configuration.EXPECT().Close().Times(1)
+		clock := fakeClock{timers: make(chan chan time.Time, 1)}
+		entrypoint.clock = clock
+		entrypoint.state = State{inactive, notReady, dead}
+		entrypoint.configUpdatesRunning = 1
+		go func() {
+			results <- handlers.UpdateResult{Err: errors.New("update error")}
+			cancel()
+		}()
+
+		e.NoError(entrypoint.Run(ctx))
+		e.Require().Zero(entrypoint.configUpdatesRunning, "a failed update should be counted as finished")
+		e.NoError(entrypoint.tearDown())
+		e.Empty(clock.timers, "shouldn't wait for in-flight updates")
+	})
+}
+
+func (e *EntrypointTestSuite) TestEntrypointRun() {
+	closed := func() <-chan error { c := make(chan error); close(c); return c }
+	testCases := [...]struct {
+		name                    string
+		activationWasChanged    chan handlers.ActivationEvent
+		configurationWasChanged <-chan error
+		configurationResult     chan handlers.UpdateResult
+		processEnded            <-chan error
+		processStarts           int
+		maxRestarts             int
+		expectedError           error
+	}{
+		{name: "when the activation channel is closed, should return ErrActivationClosed",
+			activationWasChanged: make(chan handlers.ActivationEvent), expectedError: ErrActivationClosed},
+		{name: "when the configuration was changed channel is closed, should return ErrConfigurationClosed",
+			configurationWasChanged: closed(), expectedError: ErrConfigurationClosed},
+		{name: "when the configuration update result channel is closed, should return ErrConfigurationClosed",
+			configurationResult: make(chan handlers.UpdateResult), expectedError: ErrConfigurationClosed},
+		{name: "when a process ended and it was restarted more than maxRestarts times, should return ErrMaxRestartsExceeded",
+			processEnded: sliceToChan([]error{nil}), processStarts: 3, maxRestarts: 2, expectedError: ErrMaxRestartsExceeded},
+	}
+	for _, test := range testCases {
+		test := test
+		e.runWithMockEntrypoint(test.name, func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+			if test.activationWasChanged != nil {
+				close(test.activationWasChanged)
+			}
+			if test.configurationResult != nil {
+				close(test.configurationResult)
+			}
+			mocks.activation.EXPECT().GetWasChangedChannel().Return(test.activationWasChanged).AnyTimes()
+			mocks.configuration.EXPECT().GetWasChangedChannel().Return(test.configurationWasChanged).AnyTimes()
+			mocks.configuration.EXPECT().GetUpdateResultChannel().Return(test.configurationResult).AnyTimes()
+			mocks.process.EXPECT().GetStartedChannel().Return(nil).AnyTimes()
+			mocks.process.EXPECT().GetEndedChannel().Return(test.processEnded).AnyTimes()
+			entrypoint.state = State{active, applied, alive}
+			entrypoint.processStarts = test.processStarts
+			entrypoint.maxRestarts = test.maxRestarts
+
+			e.ErrorIs(entrypoint.Run(context.Background()), test.expectedError)
+		})
+	}
+
+	e.runWithMockEntrypoint("when the context is canceled, should return nil", func(entrypoint *Entrypoint, mocks *mocksControl, logBuf *bytes.Buffer) {
+		mocks.activation.EXPECT().GetWasChangedChannel().Return(nil).AnyTimes()
+		mocks.configuration.EXPECT().GetWasChangedChannel().Return(nil).AnyTimes()
+		mocks.configuration.EXPECT().GetUpdateResultChannel().Return(nil).AnyTimes()
+		mocks.process.EXPECT().GetStartedChannel().Return(nil).AnyTimes()
+		mocks.process.EXPECT().GetEndedChannel().Return(nil).AnyTimes()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		e.NoError(entrypoint.Run(ctx))
+		e.Contains(logBuf.String(), "entrypoint was stopped")
+	})
+
+	e.runWithMockEntrypoint("when a process ended and it wasn't restarted maxRestarts times, should restart it", func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+		ctx, cancel := context.WithCancel(context.Background())
+		mocks.activation.EXPECT().GetWasChangedChannel().Return(nil).AnyTimes()
+		mocks.configuration.EXPECT().GetWasChangedChannel().Return(nil).AnyTimes()
+		mocks.configuration.EXPECT().GetUpdateResultChannel().Return(nil).AnyTimes()
+		mocks.process.EXPECT().GetStartedChannel().Return(nil).AnyTimes()
+		mocks.process.EXPECT().GetEndedChannel().Return(sliceToChan([]error{nil})).Times(1)
+		mocks.process.EXPECT().Close().Times(1)
+		mocks.hc.EXPECT().NewProcessHandler(m.Any(), entrypoint.log).Return(mocks.process, nil).Times(1)
+		mocks.process.EXPECT().Start().Do(cancel).Times(1)
+		mocks.process.EXPECT().GetEndedChannel().Return(nil).AnyTimes()
+		entrypoint.state = State{active, applied, alive}
+		entrypoint.processStarts = 2
+		entrypoint.maxRestarts = 2
+
+		e.NoError(entrypoint.Run(ctx))
+		e.Equal(3, entrypoint.processStarts)
+	})
+}
+
+func (e *EntrypointTestSuite) TestEntrypointFatalConfigErrors() {
+	errUpdate := errors.New("update error")
+	testCases := [...]struct {
+		name          string
+		opts          []Option
+		updateErr     error
+		expectedError error
+	}{
+		{name: "when a configuration update fails and config errors aren't fatal, should continue the loop",
+			updateErr: errUpdate, expectedError: ErrConfigurationClosed},
+		{name: "when a configuration update fails and config errors are fatal, should return ErrConfigUpdateFailed",
+			opts: []Option{WithFatalConfigErrors()}, updateErr: errUpdate, expectedError: ErrConfigUpdateFailed},
+		{name: "when a configuration update fails with a transient error and config errors are fatal, should continue the loop",
+			opts:      []Option{WithFatalConfigErrors()},
+			updateErr: &fs.PathError{Op: "write", Path: "file", Err: syscall.ENOSPC}, expectedError: ErrConfigurationClosed},
+	}
+	for _, test := range testCases {
+		test := test
+		e.runWithMockEntrypoint(test.name, func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+			results := make(chan handlers.UpdateResult, 1)
+			results <- handlers.UpdateResult{Err: test.updateErr}
+			close(results) // a next read ends the loop if it continued after the failure
+			mocks.activation.EXPECT().GetWasChangedChannel().Return(nil).AnyTimes()
+			mocks.configuration.EXPECT().GetWasChangedChannel().Return(nil).AnyTimes()
+			mocks.configuration.EXPECT().GetUpdateResultChannel().Return(results).AnyTimes()
+			mocks.process.EXPECT().GetStartedChannel().Return(nil).AnyTimes()
+			mocks.process.EXPECT().GetEndedChannel().Return(nil).AnyTimes()
+			for _, opt := range test.opts {
+				opt(entrypoint)
+			}
+			entrypoint.state = State{active, notReady, alive}
+			entrypoint.configUpdatesRunning = 1
+
+			err := entrypoint.Run(context.Background())
+			e.ErrorIs(err, test.expectedError)
+			if test.expectedError == ErrConfigUpdateFailed {
+				e.ErrorIs(err, errUpdate)
+			}
+			e.Zero(entrypoint.configUpdatesRunning)
+		})
+	}
+}
+
+func (e *EntrypointTestSuite) TestEntrypointAuditSink() {
+	errUpdate := errors.New("update error")
+	testCases := [...]struct {
+		name      string
+		sinkErr   error
+		auditLogs int
+	}{
+		{name: "when an audit sink is set, should write a record of every update result", auditLogs: 2},
+		{name: "when an audit sink fails, should log an error and continue the loop", sinkErr: errors.New("sink error")},
+	}
+	for _, test := range testCases {
+		test := test
+		e.runWithMockEntrypoint(test.name, func(entrypoint *Entrypoint, mocks *mocksControl, logBuf *bytes.Buffer) {
+			results := sliceToChan([]handlers.UpdateResult{
+				{ChangedFiles: map[string]handlers.Modification{"file": handlers.Created}},
+				{Err: errUpdate},
+			})
+			mocks.activation.EXPECT().GetWasChangedChannel().Return(nil).AnyTimes()
+			mocks.configuration.EXPECT().GetWasChangedChannel().Return(nil).AnyTimes()
+			mocks.configuration.EXPECT().GetUpdateResultChannel().DoAndReturn(func() <-chan handlers.UpdateResult {
+				if len(results) == 0 {
+					return closedResults() // ends the loop after all results are handled
+				}
+				return results
+			}).AnyTimes()
+			mocks.process.EXPECT().GetStartedChannel().Return(nil).AnyTimes()
+			mocks.process.EXPECT().GetEndedChannel().Return(nil).AnyTimes()
+			sink := &bytes.Buffer{}
+			if test.sinkErr != nil {
+				WithAuditSink(failingWriter{err: test.sinkErr})(entrypoint)
+			} else {
+				WithAuditSink(sink)(entrypoint)
+			}
+			entrypoint.state = State{inactive, notReady, dead}
+			entrypoint.configUpdatesRunning = 2
+
+			e.ErrorIs(entrypoint.Run(context.Background()), ErrConfigurationClosed)
+			if test.sinkErr != nil {
+				e.Contains(logBuf.String(), "could not write an audit record")
+				e.Contains(logBuf.String(), test.sinkErr.Error())
+				return
+			}
+			decoder := json.NewDecoder(sink)
+			records := []handlers.AuditRecord{}
+			for decoder.More() {
+				record := handlers.AuditRecord{}
+				e.Require().NoError(decoder.Decode(&record))
+				records = append(records, record)
+			}
+			e.Require().Len(records, test.auditLogs)
+			e.Equal(map[string]string{"file": "created"}, records[0].ChangedFiles)
+			e.Empty(records[0].Error)
+			e.Equal(errUpdate.Error(), records[1].Error, "should write a record of a failed update")
+		})
+	}
+}
+
+// closedResults returns a closed channel of update results.
+func closedResults() <-chan handlers.UpdateResult {
+	results := make(chan handlers.UpdateResult)
+	close(results)
+	return results
+}
+
+// failingWriter is an io.Writer which always returns an error.
+type failingWriter struct {
+	err error
+}
+
+func (f failingWriter) Write([]byte) (int, error) { return 0, f.err }
+
+func (e *EntrypointTestSuite) TestEntrypointRequiredInitialConfig() {
+	e.runWithMockEntrypoint("when the first configuration is applied in time, should start a process", func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+		ctx, cancel := context.WithCancel(context.Background())
+		results := make(chan handlers.UpdateResult, 1)
+		results <- handlers.UpdateResult{ChangedFiles: map[string]handlers.Modification{"file": handlers.Created}}
+		mocks.activation.EXPECT().GetWasChangedChannel().Return(nil).AnyTimes()
+		mocks.configuration.EXPECT().GetWasChangedChannel().Return(nil).AnyTimes()
+		mocks.configuration.EXPECT().GetUpdateResultChannel().Return(results).AnyTimes()
+		mocks.process.EXPECT().GetStartedChannel().Return(nil).AnyTimes()
+		mocks.process.EXPECT().GetEndedChannel().Return(nil).AnyTimes()
+		mocks.process.EXPECT().Close().Times(1)
+		mocks.hc.EXPECT().NewProcessHandler(m.Any(), entrypoint.log).Return(mocks.process, nil).Times(1)
+		mocks.process.EXPECT().Start().Do(cancel).Times(1)
+		entrypoint.clock = fakeClock{timers: make(chan chan time.Time, 1)}
+		WithRequiredInitialConfig(time.Minute)(entrypoint)
+		entrypoint.state = State{active, notReady, dead}
+		entrypoint.configUpdatesRunning = 1
+
+		e.NoError(entrypoint.Run(ctx))
+		e.Equal(State{active, updated, changing}, entrypoint.state)
+		e.Nil(entrypoint.initialConfigDeadline, "should stop waiting for the first configuration")
+	})
+
+	e.runWithMockEntrypoint("when the first configuration isn't applied in time, should return ErrNoInitialConfig", func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+		results := make(chan handlers.UpdateResult)
+		mocks.activation.EXPECT().GetWasChangedChannel().Return(nil).AnyTimes()
+		mocks.configuration.EXPECT().GetWasChangedChannel().Return(nil).AnyTimes()
+		mocks.configuration.EXPECT().GetUpdateResultChannel().Return(results).AnyTimes()
+		mocks.process.EXPECT().GetStartedChannel().Return(nil).AnyTimes()
+		mocks.process.EXPECT().GetEndedChannel().Return(nil).AnyTimes()
+		clock := fakeClock{timers: make(chan chan time.Time)}
+		entrypoint.clock = clock
+		WithRequiredInitialConfig(time.Minute)(entrypoint)
+		entrypoint.state = State{active, notReady, dead}
+		entrypoint.configUpdatesRunning = 1
+		ended := make(chan error)
+		go func() { ended <- entrypoint.Run(context.Background()) }()
+
+		timer := <-clock.timers
+		results <- handlers.UpdateResult{Err: errors.New("update error")}
+		timer <- time.Now()
+		e.ErrorIs(<-ended, ErrNoInitialConfig, "a failed update shouldn't count as an applied configuration")
+		e.Equal(State{active, notReady, dead}, entrypoint.state)
+	})
+}
+
+func (e *EntrypointTestSuite) TestEntrypointReadyChannel() {
+	e.runWithMockEntrypoint("when a state changes, should report only stable changes of readiness", func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+		ctx, cancel := context.WithCancel(context.Background())
+		activations := make(chan handlers.ActivationEvent, 1)
+		changes := make(chan error, 1)
+		results := make(chan handlers.UpdateResult, 1)
+		started := make(chan error, 1)
+		mocks.activation.EXPECT().GetWasChangedChannel().Return(activations).AnyTimes()
+		mocks.configuration.EXPECT().GetWasChangedChannel().Return(changes).AnyTimes()
+		mocks.configuration.EXPECT().GetUpdateResultChannel().Return(results).AnyTimes()
+		mocks.process.EXPECT().GetStartedChannel().Return(started).AnyTimes()
+		mocks.process.EXPECT().GetEndedChannel().Return(nil).AnyTimes()
+		mocks.process.EXPECT().Close().Times(1)
+		mocks.hc.EXPECT().NewProcessHandler(m.Any(), entrypoint.log).Return(mocks.process, nil).Times(1)
+		mocks.process.EXPECT().Start().Do(func() { started <- nil }).Times(1)
+		clock := fakeClock{timers: make(chan chan time.Time)}
+		entrypoint.clock = clock
+		entrypoint.ready = make(chan bool, 1)
+		WithReadyDebounce(time.Second)(entrypoint)
+		entrypoint.state = State{inactive, applied, dead}
+		ended := make(chan error)
+		go func() { ended <- entrypoint.Run(ctx) }()
+		readReady := func() bool {
+			select {
+			case ready := <-entrypoint.GetReadyChannel():
+				return ready
+			case <-time.After(time.Second):
+				e.FailNow("readiness wasn't reported")
+			}
+			return false
+		}
+
+		activations <- handlers.ActivationEvent{State: true}
+		activated := <-clock.timers
+		e.Empty(entrypoint.GetReadyChannel(), "shouldn't report readiness before a debounce time has elapsed")
+		activated <- time.Now()
+		e.True(readReady(), "should report readiness when a process has started")
+
+		mocks.configuration.EXPECT().Update().DoAndReturn(func() error {
+			results <- handlers.UpdateResult{}
+			return nil
+		}).Times(1)
+		changes <- nil
+		updating := <-clock.timers
+
+		mocks.process.EXPECT().Kill().Return(nil).Times(1)
+		activations <- handlers.ActivationEvent{State: false}
+		deactivated := <-clock.timers // readiness after the update was received before it, so the update has settled
+		updating <- time.Now()
+		e.Empty(entrypoint.GetReadyChannel(), "shouldn't report an update which didn't change any file")
+		deactivated <- time.Now()
+		e.False(readReady(), "should report that it's not ready after deactivation")
+
+		cancel()
+		e.NoError(<-ended)
+		e.Empty(entrypoint.GetReadyChannel())
+	})
+}
+
+func (e *EntrypointTestSuite) TestEntrypointCoalescedRestarts() {
+	testCases := [...]struct {
+		name                 string
+		coalesceRestarts     bool
+		configUpdatesRunning int
+		pendingChanges       int
+		expectedRestart      bool
+	}{
+		{name: "when restarts aren't coalesced and a change is pending, should restart a process",
+			pendingChanges: 1, expectedRestart: true},
+		{name: "when restarts are coalesced and nothing is pending, should restart a process",
+			coalesceRestarts: true, expectedRestart: true},
+		{name: "when restarts are coalesced and a change is pending, should defer a restart",
+			coalesceRestarts: true, pendingChanges: 1},
+		{name: "when restarts are coalesced and an update is running, should defer a restart",
+			coalesceRestarts: true, configUpdatesRunning: 1},
+	}
+	for _, test := range testCases {
+		test := test
+		e.runWithMockEntrypoint(test.name, func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+			mocks.configuration.EXPECT().GetWasChangedChannel().Return(sliceToChan(make([]error, test.pendingChanges))).AnyTimes()
+			if test.expectedRestart {
+				mocks.process.EXPECT().Kill().Return(nil).Times(1)
+			}
+			entrypoint.coalesceRestarts = test.coalesceRestarts
+			entrypoint.configUpdatesRunning = test.configUpdatesRunning
+			entrypoint.state = State{active, updated, alive}
+
+			e.NoError(entrypoint.handleStatusChange())
+			if test.expectedRestart {
+				e.Equal(State{active, updated, changing}, entrypoint.state)
+			} else {
+				e.Equal(State{active, updated, alive}, entrypoint.state)
+			}
+		})
+	}
+
+	e.runWithMockEntrypoint("when updates overlap and restarts are coalesced, should restart a process once after all of them", func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+		ctx, cancel := context.WithCancel(context.Background())
+		changes := make(chan error, 2)
+		results := make(chan handlers.UpdateResult, 2)
+		changed := handlers.UpdateResult{ChangedFiles: map[string]handlers.Modification{"file": handlers.Modified}}
+		mocks.activation.EXPECT().GetWasChangedChannel().Return(nil).AnyTimes()
+		mocks.configuration.EXPECT().GetWasChangedChannel().Return(changes).AnyTimes()
+		mocks.configuration.EXPECT().GetUpdateResultChannel().Return(results).AnyTimes()
+		ended := make(chan error, 1)
+		mocks.process.EXPECT().GetStartedChannel().Return(nil).AnyTimes()
+		mocks.process.EXPECT().GetEndedChannel().Return(ended).AnyTimes()
+		updates := 0
+		mocks.configuration.EXPECT().Update().DoAndReturn(func() error {
+			if updates++; updates == 1 { // the next change arrives before the first update result
+				changes <- nil
+			}
+			results <- changed
+			return nil
+		}).Times(2)
+		mocks.process.EXPECT().Kill().DoAndReturn(func() error {
+			ended <- nil
+			return nil
+		}).Times(1)
+		mocks.process.EXPECT().Close().Times(1)
+		mocks.hc.EXPECT().NewProcessHandler(m.Any(), entrypoint.log).Return(mocks.process, nil).Times(1)
+		mocks.process.EXPECT().Start().Do(cancel).Times(1)
+		WithCoalescedRestarts()(entrypoint)
+		entrypoint.state = State{active, applied, alive}
+		changes <- nil
+
+		e.NoError(entrypoint.Run(ctx))
+		e.Zero(entrypoint.configUpdatesRunning)
+		e.Equal(State{active, updated, changing}, entrypoint.state)
+	})
+}
+
+func (e *EntrypointTestSuite) TestEntrypointIdleTimeout() {
+	e.runWithMockEntrypoint("when inactive past an idle timeout, should close a process handler and not restart a process until activated", func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+		ctx, cancel := context.WithCancel(context.Background())
+		activations := make(chan handlers.ActivationEvent, 1)
+		changes := make(chan error, 1)
+		results := make(chan handlers.UpdateResult, 1)
+		started, ended := make(chan error), make(chan error)
+		killed, idled, updateCalled := make(chan struct{}), make(chan struct{}), make(chan struct{})
+		restarted := mocks.newProcess()
+		mocks.activation.EXPECT().GetWasChangedChannel().Return(activations).AnyTimes()
+		mocks.configuration.EXPECT().GetWasChangedChannel().Return(changes).AnyTimes()
+		mocks.configuration.EXPECT().GetUpdateResultChannel().Return(results).AnyTimes()
+		mocks.process.EXPECT().GetStartedChannel().Return(started).AnyTimes()
+		mocks.process.EXPECT().GetEndedChannel().Return(ended).AnyTimes()
+		restarted.EXPECT().GetStartedChannel().Return(nil).AnyTimes()
+		restarted.EXPECT().GetEndedChannel().Return(nil).AnyTimes()
+		m.InOrder(
+			mocks.process.EXPECT().Kill().Do(func() { close(killed) }).Return(nil).Times(1),
+			mocks.process.EXPECT().Close().Do(func() { close(started); close(ended); close(idled) }).Times(1),
+			mocks.configuration.EXPECT().Update().DoAndReturn(func() error {
+				results <- handlers.UpdateResult{ChangedFiles: map[string]handlers.Modification{"file": handlers.Modified}}
+				close(updateCalled)
+				return nil
+			}).Times(1),
+			mocks.hc.EXPECT().NewProcessHandler(m.Any(), entrypoint.log).Return(restarted, nil).Times(1),
+			restarted.EXPECT().Start().Do(cancel).Times(1),
+		)
+		clock := fakeClock{timers: make(chan chan time.Time)}
+		entrypoint.clock = clock
+		WithIdleTimeout(time.Minute)(entrypoint)
+		entrypoint.state = State{active, applied, alive}
+		runEnded := make(chan error)
+		go func() { runEnded <- entrypoint.Run(ctx) }()
+
+		activations <- handlers.ActivationEvent{State: false}
+		timer := <-clock.timers
+		<-killed
+		ended <- nil // a process has ended before an idle timeout
+		timer <- time.Now()
+		<-idled
+		changes <- nil
+		<-updateCalled // a configuration update while idle shouldn't restart a process
+		activations <- handlers.ActivationEvent{State: true}
+
+		e.NoError(<-runEnded)
+		e.Equal(State{active, updated, changing}, entrypoint.state)
+		e.False(entrypoint.idle)
+	})
+
+	e.runWithMockEntrypoint("when activated before an idle timeout, shouldn't close a process handler until a restart", func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+		ctx, cancel := context.WithCancel(context.Background())
+		activations := make(chan handlers.ActivationEvent, 1)
+		started, ended := make(chan error), make(chan error, 1)
+		restarted := mocks.newProcess()
+		mocks.activation.EXPECT().GetWasChangedChannel().Return(activations).AnyTimes()
+		mocks.configuration.EXPECT().GetWasChangedChannel().Return(nil).AnyTimes()
+		mocks.configuration.EXPECT().GetUpdateResultChannel().Return(nil).AnyTimes()
+		mocks.process.EXPECT().GetStartedChannel().Return(started).AnyTimes()
+		mocks.process.EXPECT().GetEndedChannel().Return(ended).AnyTimes()
+		restarted.EXPECT().GetStartedChannel().Return(nil).AnyTimes()
+		restarted.EXPECT().GetEndedChannel().Return(nil).AnyTimes()
+		m.InOrder(
+			mocks.process.EXPECT().Kill().DoAndReturn(func() error {
+				ended <- nil
+				return nil
+			}).Times(1),
+			mocks.process.EXPECT().Close().Do(func() { close(started); close(ended) }).Times(1),
+			mocks.hc.EXPECT().NewProcessHandler(m.Any(), entrypoint.log).Return(restarted, nil).Times(1),
+			restarted.EXPECT().Start().Do(cancel).Times(1),
+		)
+		clock := fakeClock{timers: make(chan chan time.Time)}
+		entrypoint.clock = clock
+		WithIdleTimeout(time.Minute)(entrypoint)
+		entrypoint.state = State{active, applied, alive}
+		runEnded := make(chan error)
+		go func() { runEnded <- entrypoint.Run(ctx) }()
+
+		activations <- handlers.ActivationEvent{State: false}
+		timer := <-clock.timers
+		activations <- handlers.ActivationEvent{State: true}
+		e.NoError(<-runEnded)
+		timer <- time.Now()
+
+		e.Equal(State{active, applied, changing}, entrypoint.state)
+		e.Nil(entrypoint.idleDeadline, "should stop waiting for an idle timeout")
+		e.False(entrypoint.idle)
+	})
+
+	e.runWithMockEntrypoint("when activated while an update is in flight after an idle timeout, shouldn't read channels of a closed process handler", func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+		ctx, cancel := context.WithCancel(context.Background())
+		activations, changes, results := make(chan handlers.ActivationEvent), make(chan error), make(chan handlers.UpdateResult)
+		started, ended := make(chan error), make(chan error)
+		killed, idled, updateCalled := make(chan struct{}), make(chan struct{}), make(chan struct{})
+		restarted := mocks.newProcess()
+		mocks.activation.EXPECT().GetWasChangedChannel().Return(activations).AnyTimes()
+		mocks.configuration.EXPECT().GetWasChangedChannel().Return(changes).AnyTimes()
+		mocks.configuration.EXPECT().GetUpdateResultChannel().Return(results).AnyTimes()
+		mocks.process.EXPECT().GetStartedChannel().Return(started).AnyTimes()
+		mocks.process.EXPECT().GetEndedChannel().Return(ended).AnyTimes()
+		restarted.EXPECT().GetStartedChannel().Return(nil).AnyTimes()
+		restarted.EXPECT().GetEndedChannel().Return(nil).AnyTimes()
+		m.InOrder(
+			mocks.process.EXPECT().Kill().Do(func() { close(killed) }).Return(nil).Times(1),
+			mocks.process.EXPECT().Close().Do(func() { close(started); close(ended); close(idled) }).Times(1),
+			mocks.configuration.EXPECT().Update().Do(func() { close(updateCalled) }).Return(nil).Times(1),
+			mocks.hc.EXPECT().NewProcessHandler(m.Any(), entrypoint.log).Return(restarted, nil).Times(1),
+			restarted.EXPECT().Start().Do(cancel).Times(1),
+		)
+		clock := fakeClock{timers: make(chan chan time.Time)}
+		entrypoint.clock = clock
+		WithIdleTimeout(time.Minute)(entrypoint)
+		entrypoint.state = State{active, applied, alive}
+		runEnded := make(chan error)
+		go func() { runEnded <- entrypoint.Run(ctx) }()
+
+		activations <- handlers.ActivationEvent{State: false}
+		timer := <-clock.timers
+		<-killed
+		ended <- nil // a process has ended before an idle timeout
+		timer <- time.Now()
+		<-idled
+		changes <- nil
+		<-updateCalled
+		activations <- handlers.ActivationEvent{State: true} // a process isn't started, as an update is in flight
+		results <- handlers.UpdateResult{ChangedFiles: map[string]handlers.Modification{"file": handlers.Modified}}
+
+		e.NoError(<-runEnded)
+		e.Equal(State{active, updated, changing}, entrypoint.state)
+		e.False(entrypoint.idle)
+		e.Equal(1, entrypoint.processStarts)
+	})
+}
+
+func (e *EntrypointTestSuite) TestEntrypointRestartGrace() {
+	e.runWithMockEntrypoint("when a process is killed for a restart, should start it after it has ended and a grace has elapsed", func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+		ctx, cancel := context.WithCancel(context.Background())
+		results := sliceToChan([]handlers.UpdateResult{{ChangedFiles: map[string]handlers.Modification{"file": handlers.Modified}}})
+		ended := make(chan error, 1)
+		killed := make(chan struct{})
+		elapsed := false
+		mocks.activation.EXPECT().GetWasChangedChannel().Return(nil).AnyTimes()
+		mocks.configuration.EXPECT().GetWasChangedChannel().Return(nil).AnyTimes()
+		mocks.configuration.EXPECT().GetUpdateResultChannel().Return(results).AnyTimes()
+		mocks.process.EXPECT().GetStartedChannel().Return(nil).AnyTimes()
+		mocks.process.EXPECT().GetEndedChannel().Return(ended).AnyTimes()
+		m.InOrder(
+			mocks.process.EXPECT().Kill().Do(func() { close(killed) }).Return(nil).Times(1),
+			mocks.process.EXPECT().Close().Times(1),
+			mocks.hc.EXPECT().NewProcessHandler(m.Any(), entrypoint.log).DoAndReturn(func(*exec.Cmd, *slog.Logger) (handlers.ProcessHandler, error) {
+				e.True(elapsed, "shouldn't start a process before a restart grace has elapsed")
+				return mocks.process, nil
+			}).Times(1),
+			mocks.process.EXPECT().Start().Do(cancel).Times(1),
+		)
+		clock := fakeClock{timers: make(chan chan time.Time)}
+		entrypoint.clock = clock
+		WithRestartGrace(time.Second)(entrypoint)
+		entrypoint.state = State{active, notReady, alive}
+		entrypoint.configUpdatesRunning = 1
+		runEnded := make(chan error)
+		go func() { runEnded <- entrypoint.Run(ctx) }()
+
+		<-killed
+		select {
+		case <-clock.timers:
+			e.Fail("shouldn't wait for a restart grace before a process has ended")
+		case <-time.After(50 * time.Millisecond):
+		}
+		ended <- errors.New("signal: killed")
+		timer := <-clock.timers
+		elapsed = true
+		timer <- time.Now()
+
+		e.NoError(<-runEnded)
+		e.Equal(State{active, updated, changing}, entrypoint.state)
+		e.Nil(entrypoint.restartDeadline)
+	})
+
+	e.runWithMockEntrypoint("when a process has ended by itself, should start it again without a grace", func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+		ctx, cancel := context.WithCancel(context.Background())
+		mocks.activation.EXPECT().GetWasChangedChannel().Return(nil).AnyTimes()
+		mocks.configuration.EXPECT().GetWasChangedChannel().Return(nil).AnyTimes()
+		mocks.configuration.EXPECT().GetUpdateResultChannel().Return(nil).AnyTimes()
+		mocks.process.EXPECT().GetStartedChannel().Return(nil).AnyTimes()
+		mocks.process.EXPECT().GetEndedChannel().Return(sliceToChan([]error{nil})).AnyTimes()
+		m.InOrder(
+			mocks.process.EXPECT().Close().Times(1),
+			mocks.hc.EXPECT().NewProcessHandler(m.Any(), entrypoint.log).Return(mocks.process, nil).Times(1),
+			mocks.process.EXPECT().Start().Do(cancel).Times(1),
+		)
+		clock := fakeClock{timers: make(chan chan time.Time, 1)}
+		entrypoint.clock = clock
+		WithRestartGrace(time.Second)(entrypoint)
+		entrypoint.state = State{active, applied, alive}
+
+		e.NoError(entrypoint.Run(ctx))
+		e.Empty(clock.timers, "shouldn't wait for a restart grace")
+	})
+}
+
+// fakeClock is a Clock which passes channels returned by After to timers, so a test decides when they fire.
+type fakeClock struct {
+	timers chan chan time.Time
+}
+
+func (c fakeClock) After(time.Duration) <-chan time.Time {
+	timer := make(chan time.Time, 1)
+	c.timers <- timer
+	return timer
+}
+
+func (e *EntrypointTestSuite) TestEntrypointSerializedRestarts() {
+	e.runWithMockEntrypoint("when activation flips rapidly during a restart, should run one transition at a time and settle with one alive process", func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+		ctx, cancel := context.WithCancel(context.Background())
+		activations := sliceToChan([]handlers.ActivationEvent{{State: true}, {State: false}, {State: true}, {State: false}, {State: true}})
+		changes := make(chan error, 1)
+		results := make(chan handlers.UpdateResult, 1)
+		mocks.activation.EXPECT().GetWasChangedChannel().Return(activations).AnyTimes()
+		mocks.configuration.EXPECT().GetWasChangedChannel().Return(changes).AnyTimes()
+		mocks.configuration.EXPECT().GetUpdateResultChannel().Return(results).AnyTimes()
+		mocks.configuration.EXPECT().Update().DoAndReturn(func() error {
+			results <- handlers.UpdateResult{ChangedFiles: map[string]handlers.Modification{"file": handlers.Modified}}
+			return nil
+		}).Times(1)
+		processes := &fakeProcesses{onStart: func(starts int) {
+			if starts == 1 { // a configuration changes while a process is alive, so it is restarted
+				changes <- nil
+			}
+		}}
+		mocks.hc.EXPECT().NewProcessHandler(m.Any(), entrypoint.log).DoAndReturn(func(*exec.Cmd, *slog.Logger) (handlers.ProcessHandler, error) {
+			return processes.new(), nil
+		}).AnyTimes()
+		entrypoint.process = processes.new()
+		entrypoint.ready = make(chan bool, 1)
+		WithReadyDebounce(50 * time.Millisecond)(entrypoint)
+		entrypoint.state = State{inactive, applied, dead}
+		ended := make(chan error)
+		go func() { ended <- entrypoint.Run(ctx) }()
+
+		for settled := false; !settled; {
+			select {
+			case ready := <-entrypoint.GetReadyChannel():
+				settled = ready && len(activations) == 0 && len(changes) == 0 && len(results) == 0
+			case <-time.After(5 * time.Second):
+				e.FailNow("an entrypoint hasn't settled")
+			}
+		}
+		cancel()
+		e.NoError(<-ended)
+
+		e.Equal(State{active, applied, alive}, entrypoint.state)
+		e.False(processes.overlapped, "shouldn't start a process before another one has ended")
+		e.Equal(1, processes.running)
+		for i, process := range processes.all {
+			if process == entrypoint.process {
+				e.True(process.isRunning, "a current process should be running")
+				e.False(process.closed, "a current process shouldn't be closed")
+			} else {
+				e.False(process.isRunning, "a previous process %d should have ended", i)
+				e.True(process.closed, "a previous process handler %d should be closed", i)
+			}
+		}
+	})
+}
+
+// fakeProcesses creates fakeProcess handlers and tracks how many of their processes are running.
+type fakeProcesses struct {
+	all        []*fakeProcess
+	running    int
+	overlapped bool // set when a process was started while another one was running or its ended event was unread
+	starts     int
+	onStart    func(starts int) // called after a process was started
+}
+
+func (f *fakeProcesses) new() *fakeProcess {
+	process := &fakeProcess{started: make(chan error, 1), ended: make(chan error, 1), processes: f}
+	f.all = append(f.all, process)
+	return process
+}
+
+// fakeProcess is a handlers.ProcessHandler which starts and ends a process at once. It must be used by one goroutine.
+type fakeProcess struct {
+	started, ended    chan error
+	isRunning, closed bool
+	processes         *fakeProcesses
+}
+
+func (f *fakeProcess) GetStartedChannel() <-chan error       { return f.started }
+func (f *fakeProcess) GetEndedChannel() <-chan error         { return f.ended }
+func (f *fakeProcess) Stop() error                           { return f.Kill() }
+func (f *fakeProcess) StopWithTimeout(_ time.Duration) error { return f.Kill() }
+func (f *fakeProcess) Signal(_ syscall.Signal) error         { return f.Kill() }
+
+func (f *fakeProcess) Start() {
+	for _, other := range f.processes.all {
+		if other.isRunning || len(other.ended) > 0 { // a process which has ended isn't settled until its event is read
+			f.processes.overlapped = true
+		}
+	}
+	f.isRunning = true
+	f.processes.running++
+	f.started <- nil
+	f.processes.starts++
+	f.processes.onStart(f.processes.starts)
+}
+
+func (f *fakeProcess) Kill() error {
+	if f.isRunning {
+		f.isRunning = false
+		f.processes.running--
+		f.ended <- errors.New("signal: killed")
+	}
+	return nil
+}
+
+func (f *fakeProcess) Close() {
+	f.closed = true
+	f.Kill()
+}
+
+func (e *EntrypointTestSuite) TestEntrypointUnchangedConfigurationUpdate() {
+	e.runWithMockEntrypoint("when an update changed no files and a process is alive, shouldn't restart the process", func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+		entrypoint.state = State{active, notReady, alive}
+		entrypoint.configUpdatesRunning = 1
+
+		entrypoint.configurationWasUpdated(handlers.UpdateResult{ChangedFiles: map[string]handlers.Modification{}})
+		e.NoError(entrypoint.handleStatusChange())
+		e.Equal(State{active, applied, alive}, entrypoint.state)
+		e.False(entrypoint.wasConfigChanged)
+	})
+}
+
+func (e *EntrypointTestSuite) TestEntrypointClosesDiscardedProcessHandler() {
+	e.runWithMockEntrypoint("when a process is started again, should close a previous handler before creating a new one", func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+		m.InOrder(
+			mocks.process.EXPECT().Close().Times(1),
+			mocks.hc.EXPECT().NewProcessHandler(m.Any(), entrypoint.log).Return(mocks.process, nil).Times(1),
+			mocks.process.EXPECT().Start().Times(1),
+		)
+		entrypoint.state = State{active, applied, dead}
+
+		e.NoError(entrypoint.handleStatusChange())
+		e.Equal(State{active, applied, changing}, entrypoint.state)
+	})
+}
+
+func (e *EntrypointTestSuite) TestEntrypointPreStart() {
+	errExit := exec.Command("sh", "-c", "exit 3").Run()
+	e.Require().Error(errExit)
+	errStart := errors.New("start error")
+	failingTestCases := [...]struct {
+		name     string
+		started  error
+		ended    error
+		expected error
+	}{
+		{name: "when a pre-start command can't be started, should return an error and not start a process", started: errStart, expected: errStart},
+		{name: "when a pre-start command exits with an error, should return an error and not start a process", ended: errExit, expected: errExit},
+	}
+	for _, test := range failingTestCases {
+		test := test
+		e.runWithMockEntrypoint(test.name, func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+			preStartCmd := exec.Command("migrate")
+			WithPreStart(preStartCmd)(entrypoint)
+			preStart := mocks.newProcess()
+			mocks.hc.EXPECT().NewProcessHandler(preStartCmd, entrypoint.log).Return(preStart, nil).Times(1)
+			preStart.EXPECT().Start().Times(1)
+			preStart.EXPECT().GetStartedChannel().Return(sliceToChan([]error{test.started})).Times(1)
+			if test.started == nil {
+				preStart.EXPECT().GetEndedChannel().Return(sliceToChan([]error{test.ended})).Times(1)
+			}
+			preStart.EXPECT().Close().Times(1)
+			entrypoint.state = State{active, applied, dead}
+
+			err := entrypoint.handleStatusChange()
+			e.ErrorIs(err, ErrPreStartFailed)
+			e.ErrorIs(err, test.expected)
+			e.Equal(State{active, applied, dead}, entrypoint.state)
+		})
+	}
+
+	e.runWithMockEntrypoint("when a pre-start command succeeds, should start a process and not run the command again", func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+		preStartCmd := exec.Command("migrate")
+		WithPreStart(preStartCmd)(entrypoint)
+		preStart := mocks.newProcess()
+		m.InOrder(
+			mocks.hc.EXPECT().NewProcessHandler(preStartCmd, entrypoint.log).Return(preStart, nil).Times(1),
+			preStart.EXPECT().Start().Times(1),
+			preStart.EXPECT().GetStartedChannel().Return(sliceToChan([]error{nil})).Times(1),
+			preStart.EXPECT().GetEndedChannel().Return(sliceToChan([]error{nil})).Times(1),
+			preStart.EXPECT().Close().Times(1),
+			mocks.process.EXPECT().Close().Times(1),
+			mocks.hc.EXPECT().NewProcessHandler(m.Not(preStartCmd), entrypoint.log).Return(mocks.process, nil).Times(1),
+			mocks.process.EXPECT().Start().Times(1),
+		)
+		entrypoint.state = State{active, applied, dead}
+		e.NoError(entrypoint.handleStatusChange())
+		e.Equal(State{active, applied, changing}, entrypoint.state)
+
+		mocks.process.EXPECT().Close().Times(1)
+		mocks.hc.EXPECT().NewProcessHandler(m.Not(preStartCmd), entrypoint.log).Return(mocks.process, nil).Times(1)
+		mocks.process.EXPECT().Start().Times(1)
+		entrypoint.state = State{active, applied, dead}
+		e.NoError(entrypoint.handleStatusChange())
+	})
+}
+
+func (e *EntrypointTestSuite) TestEntrypointPostStop() {
+	e.runWithMockEntrypoint("when a process has ended, should run a copy of a post-stop command", func(entrypoint *Entrypoint, mocks *mocksControl, logBuf *bytes.Buffer) {
+		postStopCmd := exec.Command("deregister", "--now")
+		WithPostStop(postStopCmd)(entrypoint)
+		WithPostStopTimeout(time.Minute)(entrypoint)
+		postStop := mocks.newProcess()
+		m.InOrder(
+			mocks.hc.EXPECT().NewProcessHandler(m.Any(), entrypoint.log).DoAndReturn(func(cmd *exec.Cmd, _ *slog.Logger) (handlers.ProcessHandler, error) {
+				e.NotSame(postStopCmd, cmd, "should run a copy, as a command can't be run twice")
+				e.Equal(postStopCmd.Args, cmd.Args)
+				return postStop, nil
+			}).Times(1),
+			postStop.EXPECT().Start().Times(1),
+			postStop.EXPECT().GetStartedChannel().Return(sliceToChan([]error{nil})).Times(1),
+			postStop.EXPECT().GetEndedChannel().Return(sliceToChan([]error{nil})).Times(1),
+			postStop.EXPECT().Close().Times(1),
+		)
+		entrypoint.state = State{active, applied, alive}
+
+		entrypoint.processWasEnded(errors.New("crash"))
+		e.Equal(State{active, applied, dead}, entrypoint.state)
+		e.Contains(logBuf.String(), "a post-stop command has succeeded")
+	})
+
+	e.runWithMockEntrypoint("when an entrypoint is torn down, should run a post-stop command after a process has ended", func(entrypoint *Entrypoint, mocks *mocksControl, logBuf *bytes.Buffer) {
+		WithPostStop(exec.Command("flush"))(entrypoint)
+		WithPostStopTimeout(time.Minute)(entrypoint)
+		postStop := mocks.newProcess()
+		m.InOrder(
+			mocks.activation.EXPECT().Close().Times(1),
+			mocks.process.EXPECT().Kill().Return(nil).Times(1),
+			mocks.process.EXPECT().GetEndedChannel().Return(sliceToChan([]error{nil})).Times(1),
+			mocks.hc.EXPECT().NewProcessHandler(m.Any(), entrypoint.log).Return(postStop, nil).Times(1),
+			postStop.EXPECT().Start().Times(1),
+			postStop.EXPECT().GetStartedChannel().Return(sliceToChan([]error{nil})).Times(1),
+			postStop.EXPECT().GetEndedChannel().Return(sliceToChan([]error{nil})).Times(1),
+			postStop.EXPECT().Close().Times(1),
+			mocks.configuration.EXPECT().Close().Times(1),
+		)
+		entrypoint.state = State{active, applied, alive}
+
+		e.NoError(entrypoint.tearDown())
+		e.Contains(logBuf.String(), "a post-stop command has succeeded")
+	})
+
+	e.Run("when a post-stop command hangs, should kill it after a timeout", func() {
+		e.T().Parallel()
+		logBuf := new(bytes.Buffer)
+		entrypoint := NewEntrypoint(DefaultConfig(), HandlersConstructor{}, slog.New(slog.NewTextHandler(logBuf, nil)),
+			WithPostStop(exec.Command("sleep", "60")), WithPostStopTimeout(100*time.Millisecond))
+		entrypoint.state = State{active, applied, alive}
+
+		begin := time.Now()
+		entrypoint.processWasEnded(nil)
+		e.Less(time.Since(begin), 10*time.Second)
+		e.Contains(logBuf.String(), ErrCommandTimeout.Error())
+		e.Equal(State{active, applied, dead}, entrypoint.state)
+	})
+}
+
+func (e *EntrypointTestSuite) TestEntrypointRestartPolicy() {
+	errExit := exec.Command("sh", "-c", "exit 3").Run()
+	e.Require().Error(errExit)
+	testCases := [...]struct {
+		name          string
+		policy        RestartPolicy
+		processEnded  error
+		expectRestart bool
+	}{
+		{name: "when policy is Always and a process exited with 0, should restart it", policy: RestartAlways, expectRestart: true},
+		{name: "when policy is Always and a process exited with non-zero, should restart it", policy: RestartAlways, processEnded: errExit, expectRestart: true},
+		{name: "when policy is OnFailure and a process exited with 0, shouldn't restart it", policy: RestartOnFailure},
+		{name: "when policy is OnFailure and a process exited with non-zero, should restart it", policy: RestartOnFailure, processEnded: errExit, expectRestart: true},
+		{name: "when policy is OnFailure and a process was terminated by a signal, should restart it", policy: RestartOnFailure, processEnded: errors.New("signal: killed"), expectRestart: true},
+		{name: "when policy is Never and a process exited with 0, shouldn't restart it", policy: RestartNever},
+		{name: "when policy is Never and a process exited with non-zero, shouldn't restart it", policy: RestartNever, processEnded: errExit},
+	}
+	for _, test := range testCases {
+		test := test
+		e.runWithMockEntrypoint(test.name, func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+			WithRestartPolicy(test.policy)(entrypoint)
+			entrypoint.state = State{active, applied, alive}
+			if test.expectRestart {
+				mocks.process.EXPECT().Close().Times(1)
+				mocks.hc.EXPECT().NewProcessHandler(m.Any(), entrypoint.log).Return(mocks.process, nil).Times(1)
+				mocks.process.EXPECT().Start().Times(1)
+			}
+			entrypoint.processWasEnded(test.processEnded)
+			e.NoError(entrypoint.handleStatusChange())
+
+			if test.expectRestart {
+				e.Equal(State{active, applied, changing}, entrypoint.state)
+			} else {
+				e.Equal(State{active, applied, dead}, entrypoint.state)
+			}
+		})
+	}
+
+	e.runWithMockEntrypoint("when a process wasn't restarted and activation changes to inactive and back, should start it", func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+		WithRestartPolicy(RestartNever)(entrypoint)
+		entrypoint.state = State{active, applied, alive}
+		entrypoint.processWasEnded(nil)
+		e.NoError(entrypoint.handleStatusChange())
+		e.Equal(State{active, applied, dead}, entrypoint.state)
+
+		entrypoint.activationWasChanged(handlers.ActivationEvent{State: false})
+		e.NoError(entrypoint.handleStatusChange())
+		entrypoint.activationWasChanged(handlers.ActivationEvent{State: true})
+		mocks.process.EXPECT().Close().Times(1)
+		mocks.hc.EXPECT().NewProcessHandler(m.Any(), entrypoint.log).Return(mocks.process, nil).Times(1)
+		mocks.process.EXPECT().Start().Times(1)
+		e.NoError(entrypoint.handleStatusChange())
+		e.Equal(State{active, applied, changing}, entrypoint.state)
+	})
+
+	e.runWithMockEntrypoint("when a process was killed by the entrypoint, should start it regardless of a policy", func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+		WithRestartPolicy(RestartNever)(entrypoint)
+		entrypoint.state = State{active, applied, changing}
+		entrypoint.processWasEnded(errors.New("signal: killed"))
+		mocks.process.EXPECT().Close().Times(1)
+		mocks.hc.EXPECT().NewProcessHandler(m.Any(), entrypoint.log).Return(mocks.process, nil).Times(1)
+		mocks.process.EXPECT().Start().Times(1)
+		e.NoError(entrypoint.handleStatusChange())
 	})
 }
 
@@ -187,7 +1377,7 @@ func (e *EntrypointTestSuite) TestEntrypointChangingStateByEvents() {
 			entrypoint.state = test.initialState
 			entrypoint.wasConfigChanged = test.wasConfigChanged
 			entrypoint.configUpdatesRunning = test.configUpdatesRunning
-			entrypoint.changeStateByEvent()
+			entrypoint.changeStateByEvent(context.Background())
 
 			e.Equal(test.expectedState, entrypoint.state)
 			e.Equal(test.expectedWasConfigChanged, entrypoint.wasConfigChanged)
@@ -197,6 +1387,97 @@ func (e *EntrypointTestSuite) TestEntrypointChangingStateByEvents() {
 	}
 }
 
+func (e *EntrypointTestSuite) TestEntrypointEventSource() {
+	closedActivation := make(chan handlers.ActivationEvent)
+	close(closedActivation)
+	elapsed := func() <-chan time.Time { return sliceToChan([]time.Time{time.Now()}) }
+	testCases := [...]struct {
+		name string
+
+		activationWasChanged      <-chan handlers.ActivationEvent
+		configurationWasChanged   []error
+		configurationUpdateResult []handlers.UpdateResult
+		processStarted            []error
+		processEnded              []error
+		initialConfigDeadline     <-chan time.Time
+		idleDeadline              <-chan time.Time
+		restartDeadline           <-chan time.Time
+		cancelled                 bool
+
+		expectedSource EventSource
+		expectedErr    error
+	}{
+		{name: "When ctx is done, should return a context source",
+			cancelled: true, expectedSource: contextSource, expectedErr: context.Canceled},
+		{name: "When a first configuration wasn't applied in time, should return an initial config deadline source",
+			initialConfigDeadline: elapsed(), expectedSource: initialConfigDeadlineSource, expectedErr: ErrNoInitialConfig},
+		{name: "When an idle timeout has elapsed, should return an idle deadline source",
+			idleDeadline: elapsed(), expectedSource: idleDeadlineSource},
+		{name: "When a restart grace has elapsed, should return a restart grace source",
+			restartDeadline: elapsed(), expectedSource: restartGraceSource},
+		{name: "When activation was changed, should return an activation source",
+			activationWasChanged: sliceToChan([]handlers.ActivationEvent{{Error: errors.New("activation error")}}), expectedSource: activationSource},
+		{name: "When an activation channel was closed, should return an activation source and an error",
+			activationWasChanged: closedActivation, expectedSource: activationSource, expectedErr: ErrActivationClosed},
+		{name: "When configuration was changed, should return a config change source",
+			configurationWasChanged: []error{errors.New("change error")}, expectedSource: configChangeSource},
+		{name: "When configuration was updated, should return a config result source",
+			configurationUpdateResult: []handlers.UpdateResult{{Err: errors.New("update error")}}, expectedSource: configResultSource},
+		{name: "When process was started, should return a process start source",
+			processStarted: []error{errors.New("start error")}, expectedSource: processStartSource},
+		{name: "When process was ended, should return a process end source",
+			processEnded: []error{nil}, expectedSource: processEndSource},
+	}
+	for _, test := range testCases {
+		test := test
+		e.runWithMockEntrypoint(test.name, func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if test.cancelled {
+				cancel()
+			}
+			mocks.activation.EXPECT().GetWasChangedChannel().Return(test.activationWasChanged).Times(1)
+			mocks.configuration.EXPECT().GetWasChangedChannel().Return(sliceToChan(test.configurationWasChanged)).Times(1)
+			mocks.configuration.EXPECT().GetUpdateResultChannel().Return(sliceToChan(test.configurationUpdateResult)).Times(1)
+			mocks.process.EXPECT().GetStartedChannel().Return(sliceToChan(test.processStarted)).Times(1)
+			mocks.process.EXPECT().GetEndedChannel().Return(sliceToChan(test.processEnded)).Times(1)
+			if test.idleDeadline != nil {
+				mocks.process.EXPECT().Close().Times(1)
+			}
+			entrypoint.initialConfigDeadline = test.initialConfigDeadline
+			entrypoint.idleDeadline = test.idleDeadline
+			entrypoint.restartDeadline = test.restartDeadline
+			entrypoint.configUpdatesRunning = len(test.configurationUpdateResult)
+			source, err := entrypoint.changeStateByEvent(ctx)
+
+			e.Equal(test.expectedSource, source, source.string())
+			e.ErrorIs(err, test.expectedErr)
+		})
+	}
+}
+
+func (e *EntrypointTestSuite) TestEntrypointTransitionTable() {
+	for _, transition := range TransitionTable() {
+		transition := transition
+		e.runWithMockEntrypoint("When state is "+transition.From.string()+", should "+transition.Action.string(), func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+			entrypoint.state = transition.From
+			switch transition.Action {
+			case startAction:
+				mocks.process.EXPECT().Close().Times(1)
+				mocks.hc.EXPECT().NewProcessHandler(m.Any(), entrypoint.log).Times(1).Return(mocks.process, nil)
+				mocks.process.EXPECT().Start().Times(1)
+			case killAction, deactivateAction:
+				mocks.process.EXPECT().Kill().Times(1).Return(nil)
+			case updateAction:
+				mocks.configuration.EXPECT().Update().Times(1).Return(nil)
+			}
+
+			e.NoError(entrypoint.handleStatusChange())
+			e.Equal(transition.To, entrypoint.state)
+		})
+	}
+}
+
 func (e *EntrypointTestSuite) TestEntrypointHandlingStatusChanged() {
 	startTestCases := [...]struct {
 		name                 string
@@ -237,46 +1518,29 @@ func (e *EntrypointTestSuite) TestEntrypointHandlingStatusChanged() {
 	}
 
 	restartTestCases := [...]struct {
-		name                          string
-		state                         State
-		errNewProcessHandler, errKill error
-		logContains                   string
+		name    string
+		state   State
+		errKill error
 	}{
 		{name: "When state is active, updated, alive and killing returns an error, should try killing the process and log error",
-			state:       State{active, updated, alive},
-			errKill:     errors.New("signal error"),
-			logContains: "signal error"},
-		{name: "When state is active, updated, alive and NewProcessHandler returns an error, should kill the process, change process state to changing, try creating a new process handler and log error",
-			state:                State{active, updated, alive},
-			errNewProcessHandler: errors.New("new process handler error"),
-			logContains:          "new process handler error"},
-		{name: "When state is active, updated, alive, should kill the process, change process state to changing, create a new process handler and starts it",
+			state:   State{active, updated, alive},
+			errKill: errors.New("signal error")},
+		{name: "When state is active, updated, alive, should kill the process, change process state to changing and not start it before it has ended",
 			state: State{active, updated, alive}},
 	}
 	for _, test := range restartTestCases {
 		test := test
 		e.runWithMockEntrypoint(test.name, func(entrypoint *Entrypoint, mocks *mocksControl, logBuf *bytes.Buffer) {
 			entrypoint.state = test.state
-			expectedError := func() error {
-				if mocks.process.EXPECT().Kill().Return(test.errKill).Times(1); test.errKill != nil {
-					return test.errKill
-				}
-				test.state.process = changing
-				mocks.hc.EXPECT().NewProcessHandler(m.Any(), entrypoint.log).
-					Return(entrypoint.process, test.errNewProcessHandler).Times(1)
-				if test.errNewProcessHandler != nil {
-					return test.errNewProcessHandler
-				}
-				mocks.process.EXPECT().Start().Times(1)
-				return nil
-			}()
+			mocks.process.EXPECT().Kill().Return(test.errKill).Times(1)
 			entrypoint.handleStatusChange()
 
-			e.Equal(test.state, entrypoint.state)
-
-			if expectedError != nil {
-				e.Contains(logBuf.String(), expectedError.Error())
+			if test.errKill == nil {
+				test.state.process = changing
+			} else {
+				e.Contains(logBuf.String(), test.errKill.Error())
 			}
+			e.Equal(test.state, entrypoint.state)
 		})
 	}
 
@@ -313,6 +1577,85 @@ func (e *EntrypointTestSuite) TestEntrypointHandlingStatusChanged() {
 		})
 	}
 
+	gracefulDeactivationTestCases := [...]struct {
+		name    string
+		state   State
+		errStop error
+	}{
+		{name: "When state is inactive, applied, alive and graceful deactivation is set, should stop a process with a grace period and change process state to changing",
+			state: State{inactive, applied, alive}},
+		{name: "When state is inactive, applied, alive, graceful deactivation is set and stop returns an error, shouldn't change process state and log an error",
+			state: State{inactive, applied, alive}, errStop: errors.New("stop error")},
+	}
+	for _, test := range gracefulDeactivationTestCases {
+		test := test
+		e.runWithMockEntrypoint(test.name, func(entrypoint *Entrypoint, mocks *mocksControl, logBuf *bytes.Buffer) {
+			WithGracefulDeactivation(time.Second)(entrypoint)
+			entrypoint.state = test.state
+			mocks.process.EXPECT().StopWithTimeout(time.Second).Return(test.errStop).Times(1)
+			entrypoint.handleStatusChange()
+
+			if test.errStop == nil {
+				test.state.process = changing
+			} else {
+				e.Contains(logBuf.String(), "could not stop an entrypoint")
+			}
+			e.Equal(test.state, entrypoint.state)
+		})
+	}
+
+	e.runWithMockEntrypoint("When activation changes to active during a grace period, should start a process only after the old one ended", func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
+		WithGracefulDeactivation(time.Second)(entrypoint)
+		entrypoint.state = State{inactive, applied, alive}
+		mocks.process.EXPECT().StopWithTimeout(time.Second).Return(nil).Times(1)
+		e.NoError(entrypoint.handleStatusChange())
+
+		entrypoint.state.activation = active
+		e.NoError(entrypoint.handleStatusChange())
+		e.Equal(State{active, applied, changing}, entrypoint.state, "should wait for the process to end")
+
+		entrypoint.state.process = dead
+		mocks.process.EXPECT().Close().Times(1)
+		mocks.hc.EXPECT().NewProcessHandler(m.Any(), entrypoint.log).Return(mocks.process, nil).Times(1)
+		mocks.process.EXPECT().Start().Times(1)
+		e.NoError(entrypoint.handleStatusChange())
+		e.Equal(State{active, applied, changing}, entrypoint.state)
+	})
+
+	fallbackKillTestCases := [...]struct {
+		name          string
+		allowedSignal syscall.Signal
+		errSignal     error
+	}{
+		{name: "When state is inactive, notReady, alive and SIGKILL is not allowed, should stop a process with SIGTERM and change process state to changing",
+			allowedSignal: syscall.SIGTERM},
+		{name: "When state is inactive, notReady, alive and only SIGINT is allowed, should interrupt a process and change process state to changing",
+			allowedSignal: syscall.SIGINT},
+		{name: "When state is inactive, notReady, alive and no kill signal is allowed, shouldn't change process state and log an error",
+			errSignal: handlers.ErrSignalNotAllowed},
+	}
+	for _, test := range fallbackKillTestCases {
+		test := test
+		e.runWithMockEntrypoint(test.name, func(entrypoint *Entrypoint, mocks *mocksControl, logBuf *bytes.Buffer) {
+			entrypoint.state = State{inactive, notReady, alive}
+			mocks.process.EXPECT().Kill().Return(handlers.ErrSignalNotAllowed).Times(1)
+			mocks.process.EXPECT().Signal(m.Any()).DoAndReturn(func(signal syscall.Signal) error {
+				if signal == test.allowedSignal {
+					return nil
+				}
+				return handlers.ErrSignalNotAllowed
+			}).MinTimes(1)
+			entrypoint.handleStatusChange()
+
+			if test.errSignal == nil {
+				e.Equal(State{inactive, notReady, changing}, entrypoint.state)
+			} else {
+				e.Contains(logBuf.String(), "could not kill an entrypoint")
+				e.Equal(State{inactive, notReady, alive}, entrypoint.state)
+			}
+		})
+	}
+
 	configUpdateTestCases := [...]struct {
 		name  string
 		state State
@@ -329,7 +1672,7 @@ func (e *EntrypointTestSuite) TestEntrypointHandlingStatusChanged() {
 		e.runWithMockEntrypoint(test.name, func(entrypoint *Entrypoint, mocks *mocksControl, _ *bytes.Buffer) {
 			entrypoint.configUpdatesRunning = 0
 			entrypoint.state = test.state
-			mocks.configuration.EXPECT().Update().Times(1)
+			mocks.configuration.EXPECT().Update().Times(1).Return(nil)
 			entrypoint.handleStatusChange()
 
 			e.Equal(1, entrypoint.configUpdatesRunning)
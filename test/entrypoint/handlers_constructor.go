@@ -19,6 +19,7 @@ package main
 import (
 	"log/slog"
 	"os/exec"
+	"syscall"
 
 	"github.com/k-lb/entrypoint-framework/handlers"
 )
@@ -35,6 +36,7 @@ type HandlersConstructorIface interface {
 
 // HandlersConstructor implements HandlersConstructorIface with calls to handlers package
 type HandlersConstructor struct {
+	AllowedSignals []syscall.Signal // signals which can be sent to a process. Empty means all signals.
 }
 
 // NewActivationHandler returns a new ActivationHandler.
@@ -48,6 +50,9 @@ func (HandlersConstructor) NewConfigurationHandler(newConfigFile, newConfigDir,
 }
 
 // NewProcessHandler returns a new ProcessHandler.
-func (HandlersConstructor) NewProcessHandler(cmd *exec.Cmd, logger *slog.Logger) (handlers.ProcessHandler, error) {
+func (h HandlersConstructor) NewProcessHandler(cmd *exec.Cmd, logger *slog.Logger) (handlers.ProcessHandler, error) {
+	if len(h.AllowedSignals) > 0 {
+		return handlers.NewProcessHandler(cmd, logger, handlers.WithAllowedSignals(h.AllowedSignals...))
+	}
 	return handlers.NewProcessHandler(cmd, logger)
 }
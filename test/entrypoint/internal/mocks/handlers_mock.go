@@ -12,6 +12,7 @@ package mocks
 import (
 	reflect "reflect"
 	syscall "syscall"
+	time "time"
 
 	handlers "github.com/k-lb/entrypoint-framework/handlers"
 	gomock "go.uber.org/mock/gomock"
@@ -132,9 +133,11 @@ func (mr *MockConfigurationHandlerMockRecorder[T]) GetWasChangedChannel() *gomoc
 }
 
 // Update mocks base method.
-func (m *MockConfigurationHandler[T]) Update() {
+func (m *MockConfigurationHandler[T]) Update() error {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "Update")
+	ret := m.ctrl.Call(m, "Update")
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
 // Update indicates an expected call of Update.
@@ -167,6 +170,18 @@ func (m *MockProcessHandler) EXPECT() *MockProcessHandlerMockRecorder {
 	return m.recorder
 }
 
+// Close mocks base method.
+func (m *MockProcessHandler) Close() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Close")
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockProcessHandlerMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockProcessHandler)(nil).Close))
+}
+
 // GetEndedChannel mocks base method.
 func (m *MockProcessHandler) GetEndedChannel() <-chan error {
 	m.ctrl.T.Helper()
@@ -248,3 +263,17 @@ func (mr *MockProcessHandlerMockRecorder) Stop() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockProcessHandler)(nil).Stop))
 }
+
+// StopWithTimeout mocks base method.
+func (m *MockProcessHandler) StopWithTimeout(timeout time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StopWithTimeout", timeout)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StopWithTimeout indicates an expected call of StopWithTimeout.
+func (mr *MockProcessHandlerMockRecorder) StopWithTimeout(timeout any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StopWithTimeout", reflect.TypeOf((*MockProcessHandler)(nil).StopWithTimeout), timeout)
+}
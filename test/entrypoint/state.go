@@ -123,3 +123,98 @@ func (i *InState) proc(processes ...ProcessState) *InState {
 func (i *InState) value() bool {
 	return i.isState
 }
+
+// isReady returns true if the system is ready to serve: it is active, a configuration is applied and a process is alive.
+func (s State) isReady() bool {
+	return is(s).act(active).config(applied).proc(alive).value()
+}
+
+// Action represents what an Entrypoint does in a State after it has handled an event.
+type Action int
+
+const (
+	noAction Action = iota
+	startAction
+	killAction
+	deactivateAction
+	updateAction
+)
+
+// string returns string representation of an Action.
+func (a Action) string() string {
+	switch a {
+	case startAction:
+		return "start"
+	case killAction:
+		return "kill"
+	case deactivateAction:
+		return "deactivate"
+	case updateAction:
+		return "update"
+	}
+	return "none"
+}
+
+// action returns an Action taken in a State. Guards which depend on more than a State (e.g. a restart grace or
+// coalesced restarts) can only defer an action.
+func (s State) action() Action {
+	switch {
+	case is(s).act(active).config(applied, updated).proc(dead).value():
+		return startAction
+	case is(s).act(active).config(updated).proc(alive).value():
+		return killAction
+	case is(s).act(inactive).proc(alive).value():
+		return deactivateAction
+	case is(s).config(changed).proc(dead, alive).value():
+		return updateAction
+	}
+	return noAction
+}
+
+// after returns a State to which s is changed when an Action succeeds.
+func (a Action) after(s State) State {
+	switch a {
+	case startAction, killAction, deactivateAction:
+		s.process = changing
+	case updateAction:
+		s.configuration = notReady
+	}
+	return s
+}
+
+// Transition describes an Action taken in a State and a State after it succeeds.
+type Transition struct {
+	From   State
+	Action Action
+	To     State
+}
+
+// string returns string representation of a Transition, e.g. for documentation.
+func (t Transition) string() string {
+	return fmt.Sprintf("%s %-10s %s", t.From.string(), t.Action.string(), t.To.string())
+}
+
+// allStates returns every combination of activation, configuration and process states.
+func allStates() []State {
+	states := []State{}
+	for _, a := range [...]ActivationState{inactive, active} {
+		for _, c := range [...]ConfigurationState{notReady, changed, updated, applied} {
+			for _, p := range [...]ProcessState{dead, changing, alive} {
+				states = append(states, State{a, c, p})
+			}
+		}
+	}
+	return states
+}
+
+// TransitionTable returns a Transition for every State. Events only change a single part of a State, so they can lead
+// to any of them, and the Action of a Transition is what an Entrypoint does after every event.
+func TransitionTable() []Transition {
+	states := allStates()
+	table := make([]Transition, 0, len(states))
+	for _, s := range states {
+		a := s.action()
+		table = append(table, Transition{From: s, Action: a, To: a.after(s)})
+	}
+	return table
+}
@@ -38,6 +38,22 @@ func TestStateString(t *testing.T) {
 	}
 }
 
+func TestStateIsReady(t *testing.T) {
+	testCases := [...]struct {
+		state    State
+		expected bool
+	}{
+		{state: State{active, applied, alive}, expected: true},
+		{state: State{inactive, applied, alive}},
+		{state: State{active, updated, alive}},
+		{state: State{active, notReady, alive}},
+		{state: State{active, applied, changing}},
+	}
+	for _, test := range testCases {
+		assert.Equal(t, test.expected, test.state.isReady(), test.state.string())
+	}
+}
+
 func TestIsState(t *testing.T) {
 	testCases := [...]struct {
 		name     string
@@ -77,3 +93,40 @@ func TestIsState(t *testing.T) {
 		assert.Equal(t, test.expected, inState.value(), test.name)
 	}
 }
+
+func TestTransitionTable(t *testing.T) {
+	expected := map[State]Action{
+		{active, applied, dead}:     startAction,
+		{active, updated, dead}:     startAction,
+		{active, updated, alive}:    killAction,
+		{inactive, notReady, alive}: deactivateAction,
+		{inactive, changed, alive}:  deactivateAction,
+		{inactive, updated, alive}:  deactivateAction,
+		{inactive, applied, alive}:  deactivateAction,
+		{inactive, changed, dead}:   updateAction,
+		{active, changed, dead}:     updateAction,
+		{active, changed, alive}:    updateAction,
+	}
+	table := TransitionTable()
+	assert.Len(t, table, 2*4*3, "should contain every combination of states")
+	seen := map[State]bool{}
+	for _, transition := range table {
+		assert.False(t, seen[transition.From], "should map a state to exactly one action: %s", transition.string())
+		seen[transition.From] = true
+		assert.Equal(t, expected[transition.From], transition.Action, transition.string())
+		assert.Equal(t, transition.Action.after(transition.From), transition.To, transition.string())
+		if transition.Action == noAction {
+			assert.Equal(t, transition.From, transition.To, "shouldn't change a state without an action: %s", transition.string())
+		} else {
+			assert.NotEqual(t, transition.From, transition.To, "should change a state by an action: %s", transition.string())
+		}
+	}
+	for _, state := range allStates() {
+		assert.True(t, seen[state], state.string())
+	}
+}
+
+func TestTransitionString(t *testing.T) {
+	transition := Transition{From: State{active, changed, alive}, Action: updateAction, To: State{active, notReady, alive}}
+	assert.Equal(t, "| active   | changed  | alive    | update     | active   | notReady | alive    |", transition.string())
+}